@@ -0,0 +1,239 @@
+// Registro de auditoría: quién cambió cada libro, cuándo y qué campos
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Acciones que no son eventos del catálogo
+const (
+	accionRestaurado = "restaurado"
+	accionPurgado    = "purgado"
+)
+
+// Actor usado cuando la petición no se identifica y para tareas internas
+const (
+	actorAnonimo = "anónimo"
+	actorSistema = "sistema"
+)
+
+// Datos de la petición que se guardan en cada entrada
+type datosSolicitud struct {
+	RequestID string
+	Actor     string
+	Idioma    string // Negociado con Accept-Language, para los mensajes
+}
+
+type claveSolicitud struct{}
+
+// Cambio de un campo entre la versión anterior y la nueva
+type cambioCampo struct {
+	Campo    string      `json:"campo"`
+	Anterior interface{} `json:"anterior"`
+	Nuevo    interface{} `json:"nuevo"`
+}
+
+// Entrada del registro de auditoría (nunca se modifica ni se borra)
+type entradaAuditoria struct {
+	ID        int           `json:"id"`
+	LibroID   int           `json:"libro_id"`
+	Accion    string        `json:"accion"`
+	Actor     string        `json:"actor"`
+	RequestID string        `json:"request_id,omitempty"`
+	Fecha     time.Time     `json:"fecha"`
+	Cambios   []cambioCampo `json:"cambios"`
+}
+
+// Registro en memoria de solo agregado
+type registroAuditoria struct {
+	mu       sync.RWMutex
+	entradas []entradaAuditoria
+}
+
+// Middleware que identifica la petición (X-Request-ID) y a quien la hace (X-Actor)
+func solicitudMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !cabeceraValida(requestID, 128) {
+			b := make([]byte, 16)
+			idAleatorio(b)
+			requestID = hex.EncodeToString(b)
+		}
+		actor := strings.TrimSpace(r.Header.Get("X-Actor"))
+		if !cabeceraValida(actor, 100) {
+			actor = actorAnonimo
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := context.WithValue(r.Context(), claveSolicitud{}, datosSolicitud{
+			RequestID: requestID,
+			Actor:     actor,
+			Idioma:    negociarIdioma(r.Header.Get("Accept-Language")),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// Acepta valores no vacíos, acotados y con caracteres imprimibles
+func cabeceraValida(valor string, maximo int) bool {
+	if valor == "" || len(valor) > maximo {
+		return false
+	}
+	for _, c := range valor {
+		if c < 0x20 || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// Registrar agrega una entrada con el diff entre las dos versiones del libro
+// (anterior es nil al crear)
+func (a *registroAuditoria) Registrar(ctx context.Context, accion string, anterior *Libro, nuevo Libro) {
+	solicitud, ok := ctx.Value(claveSolicitud{}).(datosSolicitud)
+	if !ok {
+		solicitud.Actor = actorSistema
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entradas = append(a.entradas, entradaAuditoria{
+		ID:        len(a.entradas) + 1,
+		LibroID:   nuevo.ID,
+		Accion:    accion,
+		Actor:     solicitud.Actor,
+		RequestID: solicitud.RequestID,
+		Fecha:     time.Now(),
+		Cambios:   diferenciasLibro(anterior, nuevo),
+	})
+}
+
+// Buscar devuelve una copia de las entradas que cumplen el filtro, en orden
+func (a *registroAuditoria) Buscar(incluir func(entradaAuditoria) bool) []entradaAuditoria {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	resultado := []entradaAuditoria{}
+	for _, entrada := range a.entradas {
+		if incluir(entrada) {
+			resultado = append(resultado, entrada)
+		}
+	}
+	return resultado
+}
+
+// Compara campo por campo usando los nombres JSON; sin anterior, todos
+// los campos con valor cuentan como cambio
+func diferenciasLibro(anterior *Libro, nuevo Libro) []cambioCampo {
+	cambios := []cambioCampo{}
+	valorNuevo := reflect.ValueOf(nuevo)
+	tipo := valorNuevo.Type()
+
+	for i := 0; i < tipo.NumField(); i++ {
+		campo := strings.Split(tipo.Field(i).Tag.Get("json"), ",")[0]
+		despues := valorCampo(valorNuevo.Field(i))
+
+		var antes interface{}
+		if anterior != nil {
+			antes = valorCampo(reflect.ValueOf(*anterior).Field(i))
+		}
+		if reflect.DeepEqual(antes, despues) || (anterior == nil && valorNuevo.Field(i).IsZero()) {
+			continue
+		}
+		cambios = append(cambios, cambioCampo{Campo: campo, Anterior: antes, Nuevo: despues})
+	}
+	return cambios
+}
+
+// Valor comparable del campo: los punteros nil quedan como nil
+func valorCampo(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return v.Interface()
+}
+
+// Interpreta una fecha RFC 3339 o AAAA-MM-DD; hasta con solo fecha incluye el día completo
+func parsearFechaConsulta(valor string, finDelDia bool) (time.Time, error) {
+	if fecha, err := time.Parse(time.RFC3339, valor); err == nil {
+		return fecha, nil
+	}
+	fecha, err := time.ParseInLocation(time.DateOnly, valor, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if finDelDia {
+		fecha = fecha.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return fecha, nil
+}
+
+// GET /api/libros/{id}/historial - Cambios registrados de un libro
+func obtenerHistorialLibro(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return
+	}
+
+	// También hay historial de libros en la papelera o ya purgados
+	entradas := s.auditoria.Buscar(func(e entradaAuditoria) bool { return e.LibroID == id })
+	if len(entradas) == 0 {
+		if _, ok := s.repositorio.Obtener(r.Context(), id); !ok {
+			responderError(w, r, http.StatusNotFound, msgLibroNoEncontrado)
+			return
+		}
+	}
+
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"entradas": entradas,
+		"total":    len(entradas),
+	})
+}
+
+// GET /api/auditoria - Registro de auditoría, opcionalmente entre dos fechas
+func obtenerAuditoria(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	var desde, hasta time.Time
+	if valor := r.URL.Query().Get("desde"); valor != "" {
+		fecha, err := parsearFechaConsulta(valor, false)
+		if err != nil {
+			responderError(w, r, http.StatusBadRequest, msgFechaDesdeInvalida)
+			return
+		}
+		desde = fecha
+	}
+	if valor := r.URL.Query().Get("hasta"); valor != "" {
+		fecha, err := parsearFechaConsulta(valor, true)
+		if err != nil {
+			responderError(w, r, http.StatusBadRequest, msgFechaHastaInvalida)
+			return
+		}
+		hasta = fecha
+	}
+	if !desde.IsZero() && !hasta.IsZero() && hasta.Before(desde) {
+		responderError(w, r, http.StatusBadRequest, msgRangoFechasInvertido)
+		return
+	}
+
+	entradas := s.auditoria.Buscar(func(e entradaAuditoria) bool {
+		return (desde.IsZero() || !e.Fecha.Before(desde)) && (hasta.IsZero() || !e.Fecha.After(hasta))
+	})
+
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"entradas": entradas,
+		"total":    len(entradas),
+	})
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pedirComo hace la petición identificándose con X-Actor y X-Request-ID
+func pedirComo(t *testing.T, metodo, url, cuerpo, actor, requestID string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(metodo, url, strings.NewReader(cuerpo))
+	req.Header.Set("Content-Type", "application/json")
+	if actor != "" {
+		req.Header.Set("X-Actor", actor)
+	}
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// historial devuelve las entradas de auditoría de la consulta
+func historial(t *testing.T, url string) []entradaAuditoria {
+	t.Helper()
+	var respuesta struct {
+		Entradas []entradaAuditoria `json:"entradas"`
+		Total    int                `json:"total"`
+	}
+	if estado := pedirJSON(t, http.MethodGet, url, "", &respuesta); estado != http.StatusOK {
+		t.Fatalf("GET %s = %d", url, estado)
+	}
+	if respuesta.Total != len(respuesta.Entradas) {
+		t.Errorf("total %d con %d entradas", respuesta.Total, len(respuesta.Entradas))
+	}
+	return respuesta.Entradas
+}
+
+// cambioDe busca el cambio del campo en la entrada
+func cambioDe(entrada entradaAuditoria, campo string) (cambioCampo, bool) {
+	for _, cambio := range entrada.Cambios {
+		if cambio.Campo == campo {
+			return cambio, true
+		}
+	}
+	return cambioCampo{}, false
+}
+
+// Cada alta, cambio, baja y restauración deja una entrada con quién, qué
+// petición y qué campos cambiaron
+func TestAuditoriaHistorialLibro(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+	api := ts.URL + "/api/libros/"
+
+	var libro Libro
+	pedirJSON(t, http.MethodPost, ts.URL+"/api/libros", `{"titulo":"Rayuela","autor":"Julio Cortázar","año":1963,"genero":"Clásico"}`, &libro)
+	id := api + strconv.Itoa(libro.ID)
+
+	resp := pedirComo(t, http.MethodPut, id, `{"titulo":"Rayuela (edición crítica)","autor":"Julio Cortázar","año":1963,"genero":"Clásico"}`, "carla", "cambio-1")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Request-ID") != "cambio-1" {
+		t.Fatalf("PUT = %d, X-Request-ID %q", resp.StatusCode, resp.Header.Get("X-Request-ID"))
+	}
+	pedirComo(t, http.MethodDelete, id, "", "dani", "")
+	pedirComo(t, http.MethodPost, id+"/restaurar", "", strings.Repeat("e", 101), "")
+
+	entradas := historial(t, id+"/historial")
+	if len(entradas) != 4 {
+		t.Fatalf("%d entradas, se esperaban 4: %+v", len(entradas), entradas)
+	}
+	acciones := []string{eventoCreado, eventoActualizado, eventoEliminado, accionRestaurado}
+	actores := []string{actorAnonimo, "carla", "dani", actorAnonimo} // Un X-Actor demasiado largo no vale
+	for i, entrada := range entradas {
+		if entrada.LibroID != libro.ID || entrada.Accion != acciones[i] || entrada.Actor != actores[i] {
+			t.Errorf("entrada %d: %s por %s, se esperaba %s por %s", i, entrada.Accion, entrada.Actor, acciones[i], actores[i])
+		}
+		if i > 0 && (entrada.ID <= entradas[i-1].ID || entrada.Fecha.Before(entradas[i-1].Fecha)) {
+			t.Errorf("entrada %d fuera de orden", i)
+		}
+	}
+
+	// El alta lista los campos con valor, sin anterior
+	if cambio, ok := cambioDe(entradas[0], "titulo"); !ok || cambio.Anterior != nil || cambio.Nuevo != "Rayuela" {
+		t.Errorf("alta: %+v", entradas[0].Cambios)
+	}
+	if _, ok := cambioDe(entradas[0], "eliminado_en"); ok {
+		t.Error("el alta registra un campo vacío")
+	}
+
+	// El cambio solo lista lo que cambió
+	actualizacion := entradas[1]
+	if actualizacion.RequestID != "cambio-1" {
+		t.Errorf("request_id %q", actualizacion.RequestID)
+	}
+	if cambio, ok := cambioDe(actualizacion, "titulo"); !ok || cambio.Anterior != "Rayuela" || cambio.Nuevo != "Rayuela (edición crítica)" {
+		t.Errorf("cambio de título: %+v", actualizacion.Cambios)
+	}
+	for _, campo := range []string{"autor", "año", "genero", "fecha_creado"} {
+		if _, ok := cambioDe(actualizacion, campo); ok {
+			t.Errorf("se registró %s sin haber cambiado", campo)
+		}
+	}
+	if cambio, ok := cambioDe(entradas[2], "eliminado_en"); !ok || cambio.Anterior != nil || cambio.Nuevo == nil {
+		t.Errorf("baja: %+v", entradas[2].Cambios)
+	}
+	if entradas[1].RequestID == entradas[2].RequestID || entradas[2].RequestID == "" {
+		t.Errorf("sin X-Request-ID se esperaba uno generado: %q", entradas[2].RequestID)
+	}
+
+	if estado := pedirJSON(t, http.MethodGet, api+"999/historial", "", nil); estado != http.StatusNotFound {
+		t.Errorf("historial de un libro inexistente: %d", estado)
+	}
+	if estado := pedirJSON(t, http.MethodGet, api+"abc/historial", "", nil); estado != http.StatusBadRequest {
+		t.Errorf("historial con ID inválido: %d", estado)
+	}
+}
+
+// El historial sobrevive a la purga, que queda registrada como del sistema
+func TestAuditoriaLibroPurgado(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+	pedirJSON(t, http.MethodDelete, ts.URL+"/api/libros/1", "", nil)
+	srv.sucursales.PorDefecto().repositorio.Purgar(context.Background(), time.Now())
+
+	entradas := historial(t, ts.URL+"/api/libros/1/historial")
+	if len(entradas) == 0 {
+		t.Fatal("el libro purgado se quedó sin historial")
+	}
+	if ultima := entradas[len(entradas)-1]; ultima.Accion != accionPurgado || ultima.Actor != actorSistema {
+		t.Errorf("última entrada: %s por %s", ultima.Accion, ultima.Actor)
+	}
+}
+
+// desde y hasta acotan por fecha, incluidos los extremos
+func TestAuditoriaRangoFechas(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+	const cuerpo = `{"titulo":"Rayuela","autor":"Julio Cortázar","año":1963,"genero":"Clásico"}`
+
+	pedirComo(t, http.MethodPost, ts.URL+"/api/libros", cuerpo, "antes", "")
+	time.Sleep(10 * time.Millisecond)
+	corte := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	pedirComo(t, http.MethodPost, ts.URL+"/api/libros", cuerpo, "despues", "")
+
+	actores := func(consulta string) map[string]bool {
+		vistos := map[string]bool{}
+		for _, entrada := range historial(t, ts.URL+"/api/auditoria?"+consulta) {
+			vistos[entrada.Actor] = true
+		}
+		return vistos
+	}
+	marca := url.QueryEscape(corte.Format(time.RFC3339Nano))
+	if vistos := actores("desde=" + marca); vistos["antes"] || !vistos["despues"] {
+		t.Errorf("desde el corte: %v", vistos)
+	}
+	if vistos := actores("hasta=" + marca); !vistos["antes"] || vistos["despues"] {
+		t.Errorf("hasta el corte: %v", vistos)
+	}
+	// Con solo la fecha, hasta incluye el día completo
+	hoy := time.Now().Format(time.DateOnly)
+	if vistos := actores("desde=" + hoy + "&hasta=" + hoy); !vistos["antes"] || !vistos["despues"] {
+		t.Errorf("el día de hoy: %v", vistos)
+	}
+
+	casos := map[string]codigoMensaje{
+		"desde=ayer":                        msgFechaDesdeInvalida,
+		"hasta=2024-13-01":                  msgFechaHastaInvalida,
+		"desde=2024-02-01&hasta=2024-01-31": msgRangoFechasInvertido,
+	}
+	for consulta, codigo := range casos {
+		resp, err := http.Get(ts.URL + "/api/auditoria?" + consulta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cuerpoError struct {
+			Codigo codigoMensaje `json:"codigo"`
+		}
+		json.NewDecoder(resp.Body).Decode(&cuerpoError)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || cuerpoError.Codigo != codigo {
+			t.Errorf("%s: %d %s, se esperaba 400 %s", consulta, resp.StatusCode, cuerpoError.Codigo, codigo)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+// Autores como recurso propio y su relación con los libros
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Estructura de datos para un autor
+type Autor struct {
+	ID               int       `json:"id"`
+	Nombre           string    `json:"nombre"`
+	AñoNacimiento    *int      `json:"año_nacimiento,omitempty"`
+	AñoFallecimiento *int      `json:"año_fallecimiento,omitempty"`
+	Nacionalidad     string    `json:"nacionalidad,omitempty"`
+	FechaCreado      time.Time `json:"fecha_creado"`
+}
+
+// Repositorio de autores protegido con mutex. Orden de bloqueo: si hace
+// falta tomar ambos, primero el de libros y después este.
+type repositorioAutores struct {
+	mu         sync.RWMutex
+	autores    []Autor
+	contadorID int
+}
+
+// Listar devuelve una copia de todos los autores
+func (r *repositorioAutores) Listar() []Autor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.autores)
+}
+
+// Obtener busca un autor por su ID
+func (r *repositorioAutores) Obtener(id int) (Autor, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.obtener(id)
+}
+
+func (r *repositorioAutores) obtener(id int) (Autor, bool) {
+	for _, autor := range r.autores {
+		if autor.ID == id {
+			return autor, true
+		}
+	}
+	return Autor{}, false
+}
+
+// Buscar devuelve el autor que coincide con el nombre (ver mismoAutor)
+func (r *repositorioAutores) Buscar(nombre string) (Autor, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.buscar(nombre)
+}
+
+func (r *repositorioAutores) buscar(nombre string) (Autor, bool) {
+	for _, autor := range r.autores {
+		if mismoAutor(autor.Nombre, nombre) {
+			return autor, true
+		}
+	}
+	return Autor{}, false
+}
+
+// Crear asigna un ID nuevo al autor y lo guarda
+func (r *repositorioAutores) Crear(autor Autor) Autor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.crear(autor)
+}
+
+func (r *repositorioAutores) crear(autor Autor) Autor {
+	autor.ID = r.contadorID
+	r.contadorID++
+	if autor.FechaCreado.IsZero() {
+		autor.FechaCreado = time.Now()
+	}
+	r.autores = append(r.autores, autor)
+	return autor
+}
+
+// BuscarOCrear devuelve el autor con ese nombre, creándolo si no existe.
+// Con mejorarNombre, un nombre más completo reemplaza al guardado
+// ("G. García Márquez" pasa a "Gabriel García Márquez").
+func (r *repositorioAutores) BuscarOCrear(nombre string, mejorarNombre bool) Autor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, autor := range r.autores {
+		if mismoAutor(autor.Nombre, nombre) {
+			if mejorarNombre && completitudNombre(nombre) > completitudNombre(autor.Nombre) {
+				r.autores[i].Nombre = nombre
+			}
+			return r.autores[i]
+		}
+	}
+	return r.crear(Autor{Nombre: nombre})
+}
+
+// Actualizar reemplaza el autor con el mismo ID
+func (r *repositorioAutores) Actualizar(autor Autor) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.autores {
+		if r.autores[i].ID == autor.ID {
+			r.autores[i] = autor
+			return true
+		}
+	}
+	return false
+}
+
+// Eliminar borra el autor con el ID indicado
+func (r *repositorioAutores) Eliminar(id int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	indice := slices.IndexFunc(r.autores, func(a Autor) bool { return a.ID == id })
+	if indice < 0 {
+		return false
+	}
+	r.autores = slices.Delete(r.autores, indice, indice+1)
+	return true
+}
+
+// NOMBRES
+
+// Quita acentos y puntuación y pasa a minúsculas: "G. García" -> ["g", "garcia"]
+func tokensNombre(nombre string) []string {
+	sinAcentos := strings.NewReplacer(
+		"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u",
+		"à", "a", "è", "e", "ì", "i", "ò", "o", "ù", "u",
+		"ä", "a", "ë", "e", "ï", "i", "ö", "o", "ü", "u",
+		"â", "a", "ê", "e", "î", "i", "ô", "o", "û", "u",
+		"ñ", "n", "ç", "c",
+	).Replace(strings.ToLower(nombre))
+	// La puntuación separa palabras: "G.", "Realism (Literature)"
+	return strings.FieldsFunc(sinAcentos, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// mismoAutor compara nombres ignorando acentos, mayúsculas y puntuación, y
+// acepta iniciales en lugar de los nombres de pila (no en el apellido final)
+func mismoAutor(a, b string) bool {
+	ta, tb := tokensNombre(a), tokensNombre(b)
+	if len(ta) == 0 || len(ta) != len(tb) {
+		return false
+	}
+	for i := range ta {
+		if ta[i] == tb[i] {
+			continue
+		}
+		ultimo := i == len(ta)-1
+		inicial := (len(ta[i]) == 1 && strings.HasPrefix(tb[i], ta[i])) ||
+			(len(tb[i]) == 1 && strings.HasPrefix(ta[i], tb[i]))
+		if ultimo || !inicial {
+			return false
+		}
+	}
+	return true
+}
+
+// Cuántas palabras del nombre no son iniciales
+func completitudNombre(nombre string) int {
+	completas := 0
+	for _, token := range tokensNombre(nombre) {
+		if len(token) > 1 {
+			completas++
+		}
+	}
+	return completas
+}
+
+// RELACIÓN CON LOS LIBROS
+
+// nombresAutores arma el texto de Libro.Autor a partir de los IDs
+func (s *sucursal) nombresAutores(ids []int) string {
+	s.autores.mu.RLock()
+	defer s.autores.mu.RUnlock()
+
+	var nombres []string
+	for _, id := range ids {
+		if autor, ok := s.autores.obtener(id); ok {
+			nombres = append(nombres, autor.Nombre)
+		}
+	}
+	return strings.Join(nombres, ", ")
+}
+
+// vincularAutores completa AutoresIDs y Autor: con IDs se deriva el texto,
+// y un libro que solo trae el texto (clientes anteriores, GraphQL, gRPC)
+// se asocia al autor existente o a uno nuevo
+func (s *sucursal) vincularAutores(libro Libro) Libro {
+	if len(libro.AutoresIDs) > 0 {
+		var ids []int
+		for _, id := range libro.AutoresIDs {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		libro.AutoresIDs = ids
+		libro.Autor = s.nombresAutores(libro.AutoresIDs)
+		return libro
+	}
+	if nombre := strings.TrimSpace(libro.Autor); nombre != "" {
+		autor := s.autores.BuscarOCrear(nombre, false)
+		libro.AutoresIDs = []int{autor.ID}
+		libro.Autor = autor.Nombre
+	}
+	return libro
+}
+
+// conservarAutores mantiene los vínculos del libro guardado cuando la
+// actualización no trae autores_ids y el texto del autor no cambió (GraphQL,
+// gRPC o un PUT que reenvía lo que leyó). Si no, "A, B" se tomaría como el
+// nombre de un solo autor.
+func conservarAutores(libro, previo Libro) Libro {
+	if len(libro.AutoresIDs) == 0 && strings.EqualFold(strings.TrimSpace(libro.Autor), previo.Autor) {
+		libro.AutoresIDs = previo.AutoresIDs
+	}
+	return libro
+}
+
+// Valida los IDs de autores de un libro; devuelve el mensaje de error o nil
+func (s *sucursal) validarAutoresLibro(libro Libro) *mensaje {
+	for _, id := range libro.AutoresIDs {
+		if _, ok := s.autores.Obtener(id); !ok {
+			return nuevoMensaje(msgAutorInexistente, id)
+		}
+	}
+	return nil
+}
+
+// migrarAutores convierte los textos de Libro.Autor en autores sin
+// duplicados: primero agrupa las variantes de cada nombre quedándose con
+// la más completa y después reescribe los libros con los IDs
+func (s *sucursal) migrarAutores(ctx context.Context) {
+	antes := len(s.autores.Listar())
+	variantes := 0
+	for _, libro := range s.repositorio.ListarConEliminados(ctx) {
+		if len(libro.AutoresIDs) == 0 && strings.TrimSpace(libro.Autor) != "" {
+			s.autores.BuscarOCrear(strings.TrimSpace(libro.Autor), true)
+			variantes++
+		}
+	}
+	s.repositorio.Reescribir(func(libro Libro) (Libro, bool) {
+		if len(libro.AutoresIDs) > 0 {
+			return libro, false
+		}
+		return s.vincularAutores(libro), true
+	})
+
+	if variantes > 0 {
+		log.Printf("Migración de autores: %d libros, %d autores nuevos", variantes, len(s.autores.Listar())-antes)
+	}
+}
+
+// HANDLERS
+
+// Valida los campos de un autor; devuelve el mensaje de error o nil
+func validarAutor(autor Autor) *mensaje {
+	if strings.TrimSpace(autor.Nombre) == "" {
+		return nuevoMensaje(msgNombreRequerido)
+	}
+	actual := time.Now().Year()
+	if autor.AñoNacimiento != nil && *autor.AñoNacimiento > actual {
+		return nuevoMensaje(msgAñoNacimientoInvalido)
+	}
+	if autor.AñoFallecimiento != nil {
+		if *autor.AñoFallecimiento > actual {
+			return nuevoMensaje(msgAñoFallecimientoInvalido)
+		}
+		if autor.AñoNacimiento != nil && *autor.AñoFallecimiento < *autor.AñoNacimiento {
+			return nuevoMensaje(msgFallecimientoAnterior)
+		}
+	}
+	return nil
+}
+
+// GET /api/autores - Listar autores (?nombre= busca sin acentos ni mayúsculas)
+func obtenerAutores(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	lista := s.autores.Listar()
+	if nombre := r.URL.Query().Get("nombre"); nombre != "" {
+		buscado := strings.Join(tokensNombre(nombre), " ")
+		lista = slices.DeleteFunc(lista, func(a Autor) bool {
+			return !strings.Contains(strings.Join(tokensNombre(a.Nombre), " "), buscado)
+		})
+	}
+
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"autores": lista,
+		"total":   len(lista),
+	})
+}
+
+// POST /api/autores - Crear autor
+func crearAutor(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	var nuevo Autor
+	if err := decodificarJSON(w, r, &nuevo); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	nuevo.Nombre = strings.TrimSpace(nuevo.Nombre)
+	if mensaje := validarAutor(nuevo); mensaje != nil {
+		responderMensaje(w, r, http.StatusBadRequest, mensaje)
+		return
+	}
+	if existente, ok := s.autores.Buscar(nuevo.Nombre); ok {
+		responderError(w, r, http.StatusConflict, msgAutorDuplicado, existente.ID, existente.Nombre)
+		return
+	}
+
+	nuevo.FechaCreado = time.Now()
+	responderJSON(w, http.StatusCreated, s.autores.Crear(nuevo))
+}
+
+// Busca el autor del parámetro {id}; responde el error si no existe
+func autorDeRuta(w http.ResponseWriter, r *http.Request) (Autor, bool) {
+	s := sucursalDe(r.Context())
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return Autor{}, false
+	}
+	autor, ok := s.autores.Obtener(id)
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgAutorNoEncontrado)
+		return Autor{}, false
+	}
+	return autor, true
+}
+
+// GET /api/autores/{id} - Obtener un autor
+func obtenerAutorPorID(w http.ResponseWriter, r *http.Request) {
+	if autor, ok := autorDeRuta(w, r); ok {
+		responderJSON(w, http.StatusOK, autor)
+	}
+}
+
+// PUT /api/autores/{id} - Actualizar autor
+func actualizarAutor(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	original, ok := autorDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	var actualizado Autor
+	if err := decodificarJSON(w, r, &actualizado); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	actualizado.ID = original.ID
+	actualizado.FechaCreado = original.FechaCreado
+	actualizado.Nombre = strings.TrimSpace(actualizado.Nombre)
+	if mensaje := validarAutor(actualizado); mensaje != nil {
+		responderMensaje(w, r, http.StatusBadRequest, mensaje)
+		return
+	}
+	if existente, ok := s.autores.Buscar(actualizado.Nombre); ok && existente.ID != original.ID {
+		responderError(w, r, http.StatusConflict, msgAutorDuplicado, existente.ID, existente.Nombre)
+		return
+	}
+
+	if !s.autores.Actualizar(actualizado) {
+		responderError(w, r, http.StatusNotFound, msgAutorNoEncontrado)
+		return
+	}
+	// Los libros muestran el nombre nuevo
+	if actualizado.Nombre != original.Nombre {
+		s.repositorio.Reescribir(func(libro Libro) (Libro, bool) {
+			if !slices.Contains(libro.AutoresIDs, original.ID) {
+				return libro, false
+			}
+			libro.Autor = s.nombresAutores(libro.AutoresIDs)
+			return libro, true
+		})
+	}
+
+	responderJSON(w, http.StatusOK, actualizado)
+}
+
+// DELETE /api/autores/{id} - Eliminar un autor sin libros
+func eliminarAutor(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	autor, ok := autorDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	// También cuentan los libros en la papelera, que se pueden restaurar
+	for _, libro := range s.repositorio.ListarConEliminados(r.Context()) {
+		if slices.Contains(libro.AutoresIDs, autor.ID) {
+			responderError(w, r, http.StatusConflict, msgAutorConLibros)
+			return
+		}
+	}
+
+	if !s.autores.Eliminar(autor.ID) {
+		responderError(w, r, http.StatusNotFound, msgAutorNoEncontrado)
+		return
+	}
+	responderJSON(w, http.StatusOK, map[string]string{
+		"mensaje": traducir(r.Context(), msgAutorEliminado),
+	})
+}
+
+// GET /api/autores/{id}/libros - Libros de un autor
+func obtenerLibrosDeAutor(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	autor, ok := autorDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	libros := []Libro{}
+	for _, libro := range s.repositorio.Listar(r.Context()) {
+		if slices.Contains(libro.AutoresIDs, autor.ID) {
+			libros = append(libros, libro)
+		}
+	}
+
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"libros": libros,
+		"total":  len(libros),
+	})
+}
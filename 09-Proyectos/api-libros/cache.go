@@ -0,0 +1,104 @@
+// Políticas de caché por ruta y peticiones condicionales
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Cache-Control de cada ruta, indexado por "MÉTODO /patrón" como la documentación.
+// Las rutas que no aparecen (todas las mutaciones, entre otras) usan no-store.
+var politicasCache = map[string]string{
+	// El catálogo cambia en cualquier momento: se puede guardar pero hay que
+	// revalidar con If-Modified-Since en cada uso
+	"GET /api/libros":      "no-cache",
+	"GET /api/libros/{id}": "no-cache",
+
+	"GET /api/estadisticas":           "no-cache",
+	"GET /api/estadisticas/{reporte}": "no-cache",
+
+	// Las URL con ?v= de la versión actual se guardan un año (lo decide el handler)
+	"GET /api/libros/{id}/portada":           "public, no-cache",
+	"GET /api/libros/{id}/portada/miniatura": "public, no-cache",
+
+	"GET /api/libros/{id}/historial": "private, no-cache",
+	"GET /api/auditoria":             "private, no-cache",
+	"GET /api/libros/eventos":        "no-cache",
+
+	// Solo cambian al desplegar una versión nueva
+	"GET /openapi.json":              "public, max-age=300",
+	"GET /docs":                      "public, max-age=3600",
+	"GET /docs/swagger-ui/{archivo}": "public, max-age=86400",
+}
+
+// Política por defecto
+const politicaCachePorDefecto = "no-store"
+
+// Asigna Cache-Control según la ruta; el handler puede sobrescribirlo
+func aplicarPoliticaCache(w http.ResponseWriter, rt ruta) {
+	politica, ok := politicasCache[rt.Metodo+" "+rt.Patron]
+	if !ok {
+		politica = politicaCachePorDefecto
+	}
+	w.Header().Set("Cache-Control", politica)
+}
+
+// etiquetaCatalogo es el ETag de las vistas de todo el catálogo (listado y
+// estadísticas): cambia con cualquier alta, cambio o baja de libros y con
+// los cambios del árbol de géneros, que alteran los filtros y los reportes
+func (s *sucursal) etiquetaCatalogo() string {
+	return fmt.Sprintf(`"%s-%d-%d"`, s.ID, s.repositorio.Version(), s.generos.Version())
+}
+
+// etiquetaLibro es el ETag de un libro: cada cambio le pone otra
+// fecha_actualizado, con resolución de nanosegundos
+func (s *sucursal) etiquetaLibro(libro Libro) string {
+	return fmt.Sprintf(`"%s-%d-%x"`, s.ID, libro.ID, libro.FechaActualizado.UnixNano())
+}
+
+// noModificado envía ETag y Last-Modified y, si el cliente ya tiene esa
+// versión, responde 304 y devuelve true. If-None-Match tiene prioridad
+// sobre If-Modified-Since (RFC 9110, sección 13.2.2).
+func noModificado(w http.ResponseWriter, r *http.Request, modificado time.Time, etiqueta string) bool {
+	if etiqueta != "" {
+		w.Header().Set("ETag", etiqueta)
+	}
+	// Las fechas HTTP tienen resolución de segundos: hasta que termine el
+	// segundo del último cambio puede haber otro con la misma fecha, así que
+	// todavía no sirve como validador
+	segundo := modificado.UTC().Truncate(time.Second)
+	fechaValida := !modificado.IsZero() && time.Since(segundo) >= time.Second
+	if fechaValida {
+		w.Header().Set("Last-Modified", segundo.Format(http.TimeFormat))
+	}
+
+	if condiciones := r.Header.Values("If-None-Match"); len(condiciones) > 0 {
+		if etiqueta == "" || !coincideEtiqueta(condiciones, etiqueta) {
+			return false
+		}
+	} else {
+		desde, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if !fechaValida || err != nil || segundo.After(desde) {
+			return false
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// coincideEtiqueta compara If-None-Match con la comparación débil (la que
+// corresponde a GET): "W/" no cuenta, así sirve la versión comprimida
+func coincideEtiqueta(condiciones []string, etiqueta string) bool {
+	etiqueta = strings.TrimPrefix(etiqueta, "W/")
+	for _, valor := range condiciones {
+		for _, candidata := range strings.Split(valor, ",") {
+			candidata = strings.TrimSpace(candidata)
+			if candidata == "*" || strings.TrimPrefix(candidata, "W/") == etiqueta {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// condicional hace un GET con las cabeceras indicadas y devuelve el estado
+// y el ETag de la respuesta
+func condicional(t *testing.T, url string, cabeceras map[string]string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for nombre, valor := range cabeceras {
+		req.Header.Set(nombre, valor)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Header.Get("ETag")
+}
+
+// Un cambio en el mismo segundo que el GET anterior cambia el ETag: ya no
+// se responde 304 con una copia vieja
+func TestETagCambiaEnElMismoSegundo(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+	const libro = `{"titulo":"1984","autor":"George Orwell","año":1949,"genero":"Distopía","disponible":true}`
+
+	for _, url := range []string{ts.URL + "/api/libros", ts.URL + "/api/libros/2", ts.URL + "/api/estadisticas"} {
+		estado, etiqueta := condicional(t, url, nil)
+		if estado != http.StatusOK || etiqueta == "" {
+			t.Fatalf("%s: %d, ETag %q", url, estado, etiqueta)
+		}
+		if estado, _ := condicional(t, url, map[string]string{"If-None-Match": etiqueta}); estado != http.StatusNotModified {
+			t.Errorf("%s sin cambios: %d, se esperaba 304", url, estado)
+		}
+
+		// Sin esperar a que termine el segundo
+		if estado := pedirJSON(t, http.MethodPut, ts.URL+"/api/libros/2", libro, nil); estado != http.StatusOK {
+			t.Fatalf("PUT = %d", estado)
+		}
+		estado, nueva := condicional(t, url, map[string]string{"If-None-Match": etiqueta})
+		if estado != http.StatusOK || nueva == etiqueta {
+			t.Errorf("%s después del cambio: %d con ETag %q (antes %q)", url, estado, nueva, etiqueta)
+		}
+		if estado, _ := condicional(t, url, map[string]string{"If-None-Match": nueva}); estado != http.StatusNotModified {
+			t.Errorf("%s con el ETag nuevo: %d", url, estado)
+		}
+	}
+}
+
+// Crear o borrar un género cambia el ETag del catálogo
+func TestETagCambiaConLosGeneros(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	_, etiqueta := condicional(t, ts.URL+"/api/libros?genero=Ficción", nil)
+	var genero Genero
+	if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/generos", `{"nombre":"Terror","padre_id":1}`, &genero); estado != http.StatusCreated {
+		t.Fatalf("POST /api/generos = %d", estado)
+	}
+	estado, creado := condicional(t, ts.URL+"/api/libros?genero=Ficción", map[string]string{"If-None-Match": etiqueta})
+	if estado != http.StatusOK || creado == etiqueta {
+		t.Errorf("después de crear un género: %d, ETag %q", estado, creado)
+	}
+
+	pedirJSON(t, http.MethodDelete, ts.URL+"/api/generos/"+strconv.Itoa(genero.ID), "", nil)
+	if estado, borrado := condicional(t, ts.URL+"/api/libros?genero=Ficción", map[string]string{"If-None-Match": creado}); estado != http.StatusOK || borrado == creado {
+		t.Errorf("después de borrar un género: %d, ETag %q", estado, borrado)
+	}
+}
+
+// If-None-Match admite listas, "*" y la forma débil que queda al comprimir;
+// las sucursales no comparten etiquetas
+func TestIfNoneMatch(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	// Con los datos de ejemplo el listado no llega al mínimo para comprimir
+	for range 3 {
+		pedirJSON(t, http.MethodPost, ts.URL+"/api/libros", `{"titulo":"Rayuela","autor":"Julio Cortázar","año":1963,"genero":"Clásico"}`, nil)
+	}
+	_, etiqueta := condicional(t, ts.URL+"/api/libros", map[string]string{"Accept-Encoding": "identity"})
+	estado, comprimida := condicional(t, ts.URL+"/api/libros", map[string]string{"Accept-Encoding": "gzip"})
+	if estado != http.StatusOK || comprimida != "W/"+etiqueta {
+		t.Errorf("ETag comprimido %q, se esperaba W/%s", comprimida, etiqueta)
+	}
+
+	casos := []struct {
+		condicion string
+		estado    int
+	}{
+		{etiqueta, http.StatusNotModified},
+		{comprimida, http.StatusNotModified},
+		{`"otra", ` + etiqueta, http.StatusNotModified},
+		{"*", http.StatusNotModified},
+		{`"otra"`, http.StatusOK},
+	}
+	for _, caso := range casos {
+		if estado, _ := condicional(t, ts.URL+"/api/libros", map[string]string{"If-None-Match": caso.condicion}); estado != caso.estado {
+			t.Errorf("If-None-Match %s: %d, se esperaba %d", caso.condicion, estado, caso.estado)
+		}
+	}
+
+	// If-None-Match manda aunque If-Modified-Since diga que no cambió
+	futuro := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if estado, _ := condicional(t, ts.URL+"/api/libros", map[string]string{"If-None-Match": `"otra"`, "If-Modified-Since": futuro}); estado != http.StatusOK {
+		t.Errorf("If-None-Match distinto con If-Modified-Since: %d", estado)
+	}
+
+	if _, norte := condicional(t, ts.URL+"/api/libros", map[string]string{"X-Sucursal": "norte"}); norte == etiqueta {
+		t.Errorf("centro y norte comparten el ETag %s", norte)
+	}
+}
+
+// Last-Modified no se envía mientras no termine el segundo del último
+// cambio: otro cambio en ese segundo tendría la misma fecha
+func TestLastModifiedSegundoEnCurso(t *testing.T) {
+	t.Parallel()
+	for intento := 0; ; intento++ {
+		ahora := time.Now()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/libros", nil)
+		r.Header.Set("If-Modified-Since", ahora.UTC().Format(http.TimeFormat))
+		noMod := noModificado(w, r, ahora, "")
+		if time.Now().Truncate(time.Second) != ahora.Truncate(time.Second) && intento < 3 {
+			continue // Pasó al segundo siguiente durante la prueba
+		}
+		if noMod || w.Header().Get("Last-Modified") != "" {
+			t.Errorf("cambio en el segundo en curso: 304 %v, Last-Modified %q", noMod, w.Header().Get("Last-Modified"))
+		}
+		break
+	}
+
+	// Un cambio de un segundo ya terminado sí es un validador
+	antes := time.Now().Add(-2 * time.Second)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/libros", nil)
+	r.Header.Set("If-Modified-Since", antes.UTC().Format(http.TimeFormat))
+	if !noModificado(w, r, antes, "") || w.Code != http.StatusNotModified {
+		t.Errorf("cambio de hace dos segundos: %d", w.Code)
+	}
+	if w.Header().Get("Last-Modified") != antes.UTC().Format(http.TimeFormat) {
+		t.Errorf("Last-Modified %q", w.Header().Get("Last-Modified"))
+	}
+}
@@ -0,0 +1,42 @@
+// Claves de API: si se configuran, las peticiones a la API deben traer una
+// de ellas en X-API-Key (además del token de sucursal, si lo hay)
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// clavesAPIConfiguradas lee API_KEYS, una lista separada por comas; vacía
+// deja la API abierta como hasta ahora
+func clavesAPIConfiguradas() []string {
+	var claves []string
+	for _, clave := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if clave = strings.TrimSpace(clave); clave != "" {
+			claves = append(claves, clave)
+		}
+	}
+	return claves
+}
+
+// verificarClaveAPI comprueba X-API-Key (en gRPC, el metadato x-api-key)
+func (srv *servidor) verificarClaveAPI(r *http.Request) *errorSucursal {
+	if len(srv.clavesAPI) == 0 {
+		return nil
+	}
+	recibida := r.Header.Get("X-API-Key")
+	if recibida == "" {
+		return &errorSucursal{http.StatusUnauthorized, nuevoMensaje(msgClaveAPIRequerida)}
+	}
+	// Se comparan todas para no revelar por tiempo cuál coincide
+	valida := 0
+	for _, clave := range srv.clavesAPI {
+		valida |= subtle.ConstantTimeCompare([]byte(recibida), []byte(clave))
+	}
+	if valida == 0 {
+		return &errorSucursal{http.StatusUnauthorized, nuevoMensaje(msgClaveAPIInvalida)}
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+// Package client es un cliente Go tipado para la API de libros.
+//
+// Uso básico:
+//
+//	c := client.New("http://localhost:8080")
+//	libros, err := c.ListLibros(ctx, client.Filtros{Genero: "Distopía"})
+//	if errors.Is(err, client.ErrNoEncontrado) { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Libro tal como lo devuelve la API
+type Libro struct {
+	ID               int        `json:"id"`
+	Titulo           string     `json:"titulo"`
+	Autor            string     `json:"autor"`
+	AutoresIDs       []int      `json:"autores_ids,omitempty"` // Si se envía, tiene prioridad sobre Autor
+	Año              int        `json:"año"`
+	Genero           string     `json:"genero"`
+	Disponible       bool       `json:"disponible"`
+	FechaCreado      time.Time  `json:"fecha_creado"`
+	FechaActualizado time.Time  `json:"fecha_actualizado"`
+	EliminadoEn      *time.Time `json:"eliminado_en,omitempty"` // nil si no está en la papelera
+
+	// Copias físicas (sin las bajas); las calcula el servidor
+	EjemplaresTotal       int `json:"ejemplares_total,omitempty"`
+	EjemplaresDisponibles int `json:"ejemplares_disponibles,omitempty"`
+
+	ISBN    string `json:"isbn,omitempty"`
+	Portada string `json:"portada,omitempty"` // URL de la portada, si tiene
+}
+
+// Filtros opcionales para ListLibros (los campos vacíos no se envían)
+type Filtros struct {
+	Genero            string
+	Disponible        *bool
+	IncluirEliminados bool // También devuelve los libros en la papelera
+}
+
+// ListaLibros es el sobre {"libros": ..., "total": ...} del listado
+type ListaLibros struct {
+	Libros []Libro `json:"libros"`
+	Total  int     `json:"total"`
+}
+
+// Errores comunes para comparar con errors.Is
+var (
+	ErrNoEncontrado     = errors.New("recurso no encontrado")
+	ErrPeticionInvalida = errors.New("petición inválida")
+)
+
+// ErrorAPI es un error devuelto por el servidor con su cuerpo
+// {"error": ..., "codigo": ...}. Mensaje está en el idioma pedido con
+// WithIdioma; Codigo es el mismo en todos los idiomas.
+type ErrorAPI struct {
+	Estado  int
+	Codigo  string
+	Mensaje string
+}
+
+func (e *ErrorAPI) Error() string {
+	return fmt.Sprintf("api-libros: %d %s: %s", e.Estado, http.StatusText(e.Estado), e.Mensaje)
+}
+
+// Is permite usar errors.Is(err, ErrNoEncontrado) y similares
+func (e *ErrorAPI) Is(objetivo error) bool {
+	switch objetivo {
+	case ErrNoEncontrado:
+		return e.Estado == http.StatusNotFound
+	case ErrPeticionInvalida:
+		return e.Estado == http.StatusBadRequest
+	}
+	return false
+}
+
+// Client habla con una instancia de api-libros
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	actor      string
+	sucursal   string
+	token      string
+	idioma     string
+
+	// Reintentos para peticiones idempotentes
+	maxReintentos int
+	esperaBase    time.Duration
+}
+
+// Opcion configura el cliente en New
+type Opcion func(*Client)
+
+// WithHTTPClient usa un *http.Client propio (timeouts, transporte, etc.)
+func WithHTTPClient(h *http.Client) Opcion {
+	return func(c *Client) { c.httpClient = h }
+}
+
+// WithAPIKey envía la clave en el encabezado X-API-Key
+func WithAPIKey(clave string) Opcion {
+	return func(c *Client) { c.apiKey = clave }
+}
+
+// WithActor identifica a quien hace los cambios (X-Actor) en la auditoría
+func WithActor(actor string) Opcion {
+	return func(c *Client) { c.actor = actor }
+}
+
+// WithSucursal elige la sucursal (X-Sucursal); sin ella el servidor usa la de por defecto
+func WithSucursal(sucursal string) Opcion {
+	return func(c *Client) { c.sucursal = sucursal }
+}
+
+// WithToken envía el token de la sucursal en Authorization: Bearer
+func WithToken(token string) Opcion {
+	return func(c *Client) { c.token = token }
+}
+
+// WithIdioma pide los mensajes del servidor en ese idioma (Accept-Language: "es", "en")
+func WithIdioma(idioma string) Opcion {
+	return func(c *Client) { c.idioma = idioma }
+}
+
+// WithReintentos configura cuántas veces reintentar y la espera inicial
+func WithReintentos(max int, esperaBase time.Duration) Opcion {
+	return func(c *Client) {
+		c.maxReintentos = max
+		c.esperaBase = esperaBase
+	}
+}
+
+// New crea un cliente para la URL base, por ejemplo "http://localhost:8080"
+func New(baseURL string, opciones ...Opcion) *Client {
+	c := &Client{
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+		maxReintentos: 3,
+		esperaBase:    200 * time.Millisecond,
+	}
+	for _, opcion := range opciones {
+		opcion(c)
+	}
+	return c
+}
+
+// ListLibros obtiene los libros aplicando los filtros de GET /api/libros
+func (c *Client) ListLibros(ctx context.Context, filtros Filtros) (*ListaLibros, error) {
+	consulta := url.Values{}
+	if filtros.Genero != "" {
+		consulta.Set("genero", filtros.Genero)
+	}
+	if filtros.Disponible != nil {
+		consulta.Set("disponible", strconv.FormatBool(*filtros.Disponible))
+	}
+	if filtros.IncluirEliminados {
+		consulta.Set("incluir_eliminados", "true")
+	}
+
+	ruta := "/api/libros"
+	if len(consulta) > 0 {
+		ruta += "?" + consulta.Encode()
+	}
+
+	var lista ListaLibros
+	if err := c.hacer(ctx, http.MethodGet, ruta, nil, &lista); err != nil {
+		return nil, err
+	}
+	return &lista, nil
+}
+
+// GetLibro obtiene un libro por ID
+func (c *Client) GetLibro(ctx context.Context, id int) (*Libro, error) {
+	var libro Libro
+	if err := c.hacer(ctx, http.MethodGet, rutaLibro(id), nil, &libro); err != nil {
+		return nil, err
+	}
+	return &libro, nil
+}
+
+// CreateLibro crea un libro y devuelve el libro con ID asignado. Envía una
+// Idempotency-Key propia, así que los reintentos no crean duplicados.
+func (c *Client) CreateLibro(ctx context.Context, libro Libro) (*Libro, error) {
+	var creado Libro
+	if err := c.hacerConClave(ctx, http.MethodPost, "/api/libros", nuevaClaveIdempotencia(), libro, &creado); err != nil {
+		return nil, err
+	}
+	return &creado, nil
+}
+
+// CreateLibroFromISBN crea un libro con los datos que el servidor obtiene
+// del catálogo externo para ese ISBN (ErrNoEncontrado si no lo conoce)
+func (c *Client) CreateLibroFromISBN(ctx context.Context, isbn string) (*Libro, error) {
+	var creado Libro
+	cuerpo := map[string]string{"isbn": isbn}
+	if err := c.hacerConClave(ctx, http.MethodPost, "/api/libros/desde-isbn", nuevaClaveIdempotencia(), cuerpo, &creado); err != nil {
+		return nil, err
+	}
+	return &creado, nil
+}
+
+// UpdateLibro reemplaza los datos del libro con el ID indicado
+func (c *Client) UpdateLibro(ctx context.Context, id int, libro Libro) (*Libro, error) {
+	var actualizado Libro
+	if err := c.hacer(ctx, http.MethodPut, rutaLibro(id), libro, &actualizado); err != nil {
+		return nil, err
+	}
+	return &actualizado, nil
+}
+
+// DeleteLibro envía a la papelera el libro con el ID indicado
+func (c *Client) DeleteLibro(ctx context.Context, id int) error {
+	return c.hacer(ctx, http.MethodDelete, rutaLibro(id), nil, nil)
+}
+
+// RestoreLibro saca un libro de la papelera
+func (c *Client) RestoreLibro(ctx context.Context, id int) (*Libro, error) {
+	var restaurado Libro
+	if err := c.hacer(ctx, http.MethodPost, rutaLibro(id)+"/restaurar", nil, &restaurado); err != nil {
+		return nil, err
+	}
+	return &restaurado, nil
+}
+
+func rutaLibro(id int) string {
+	return "/api/libros/" + strconv.Itoa(id)
+}
+
+// Clave aleatoria para Idempotency-Key
+func nuevaClaveIdempotencia() string {
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// hacer envía la petición, reintenta si corresponde y decodifica la respuesta
+func (c *Client) hacer(ctx context.Context, metodo, ruta string, cuerpo, destino interface{}) error {
+	return c.hacerConClave(ctx, metodo, ruta, "", cuerpo, destino)
+}
+
+// hacerConClave es hacer con una Idempotency-Key opcional, que vuelve
+// seguro reintentar un POST
+func (c *Client) hacerConClave(ctx context.Context, metodo, ruta, clave string, cuerpo, destino interface{}) error {
+	var datos []byte
+	if cuerpo != nil {
+		var err error
+		if datos, err = json.Marshal(cuerpo); err != nil {
+			return fmt.Errorf("codificando petición: %w", err)
+		}
+	}
+
+	// POST sin clave no es idempotente: reintentarlo podría crear libros duplicados
+	intentos := 1
+	if metodo != http.MethodPost || clave != "" {
+		intentos += c.maxReintentos
+	}
+
+	var ultimoErr error
+	for intento := 0; intento < intentos; intento++ {
+		if intento > 0 {
+			if err := esperar(ctx, c.espera(intento)); err != nil {
+				return err
+			}
+		}
+
+		reintentar, err := c.intentar(ctx, metodo, ruta, clave, datos, destino)
+		if err == nil {
+			return nil
+		}
+		ultimoErr = err
+		if !reintentar {
+			break
+		}
+	}
+	return ultimoErr
+}
+
+// intentar hace una sola petición e indica si el fallo es transitorio
+func (c *Client) intentar(ctx context.Context, metodo, ruta, clave string, datos []byte, destino interface{}) (bool, error) {
+	var cuerpo io.Reader
+	if datos != nil {
+		cuerpo = bytes.NewReader(datos)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, metodo, c.baseURL+ruta, cuerpo)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if datos != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.actor != "" {
+		req.Header.Set("X-Actor", c.actor)
+	}
+	if c.sucursal != "" {
+		req.Header.Set("X-Sucursal", c.sucursal)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.idioma != "" {
+		req.Header.Set("Accept-Language", c.idioma)
+	}
+	if clave != "" {
+		req.Header.Set("Idempotency-Key", clave)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Un contexto cancelado no se reintenta
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		// 409: el intento anterior con la misma clave todavía no terminó
+		enCurso := clave != "" && resp.StatusCode == http.StatusConflict
+		return transitorio(resp.StatusCode) || enCurso, decodificarError(resp)
+	}
+
+	if destino == nil {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(destino); err != nil {
+		return false, fmt.Errorf("decodificando respuesta: %w", err)
+	}
+	return false, nil
+}
+
+// Los 429 y 5xx suelen resolverse reintentando
+func transitorio(estado int) bool {
+	return estado == http.StatusTooManyRequests || estado >= 500
+}
+
+// Convierte el cuerpo {"error": "...", "codigo": "..."} en un *ErrorAPI
+func decodificarError(resp *http.Response) error {
+	var cuerpo struct {
+		Error  string `json:"error"`
+		Codigo string `json:"codigo"`
+	}
+	datos, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err := json.Unmarshal(datos, &cuerpo); err != nil || cuerpo.Error == "" {
+		cuerpo.Error = strings.TrimSpace(string(datos))
+	}
+	return &ErrorAPI{Estado: resp.StatusCode, Codigo: cuerpo.Codigo, Mensaje: cuerpo.Error}
+}
+
+// Espera exponencial con algo de azar para no sincronizar a los clientes
+func (c *Client) espera(intento int) time.Duration {
+	base := c.esperaBase << (intento - 1)
+	if base <= 0 {
+		return 0
+	}
+	return base/2 + time.Duration(rand.Int63n(int64(base)/2+1))
+}
+
+func esperar(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,284 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// servidorDePrueba levanta un httptest.Server con el handler y un cliente
+// que reintenta sin esperas largas
+func servidorDePrueba(t *testing.T, handler http.HandlerFunc, opciones ...Opcion) *Client {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	opciones = append([]Opcion{WithReintentos(3, time.Millisecond)}, opciones...)
+	return New(ts.URL+"/", opciones...)
+}
+
+func responder(w http.ResponseWriter, estado int, cuerpo interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(estado)
+	json.NewEncoder(w).Encode(cuerpo)
+}
+
+func TestListLibrosFiltrosYSobre(t *testing.T) {
+	t.Parallel()
+	c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/libros" {
+			t.Errorf("petición inesperada %s %s", r.Method, r.URL.Path)
+		}
+		consulta := r.URL.Query()
+		if consulta.Get("genero") != "Distopía" || consulta.Get("disponible") != "false" || consulta.Get("incluir_eliminados") != "true" {
+			t.Errorf("filtros = %q", r.URL.RawQuery)
+		}
+		responder(w, http.StatusOK, map[string]interface{}{
+			"libros": []map[string]interface{}{{"id": 2, "titulo": "1984", "año": 1949, "genero": "Distopía"}},
+			"total":  1,
+		})
+	})
+
+	disponible := false
+	lista, err := c.ListLibros(context.Background(), Filtros{Genero: "Distopía", Disponible: &disponible, IncluirEliminados: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lista.Total != 1 || len(lista.Libros) != 1 || lista.Libros[0].Titulo != "1984" || lista.Libros[0].Año != 1949 {
+		t.Errorf("lista = %+v", lista)
+	}
+}
+
+func TestListLibrosSinFiltros(t *testing.T) {
+	t.Parallel()
+	c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "" {
+			t.Errorf("consulta = %q, se esperaba vacía", r.URL.RawQuery)
+		}
+		responder(w, http.StatusOK, map[string]interface{}{"libros": []interface{}{}, "total": 0})
+	})
+	if _, err := c.ListLibros(context.Background(), Filtros{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCabecerasDeLasOpciones(t *testing.T) {
+	t.Parallel()
+	esperadas := map[string]string{
+		"X-API-Key":       "clave",
+		"X-Actor":         "ana",
+		"X-Sucursal":      "norte",
+		"Authorization":   "Bearer tok",
+		"Accept-Language": "en",
+		"Accept":          "application/json",
+	}
+	c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+		for nombre, valor := range esperadas {
+			if r.Header.Get(nombre) != valor {
+				t.Errorf("%s = %q, se esperaba %q", nombre, r.Header.Get(nombre), valor)
+			}
+		}
+		responder(w, http.StatusOK, map[string]interface{}{"id": 1})
+	}, WithAPIKey("clave"), WithActor("ana"), WithSucursal("norte"), WithToken("tok"), WithIdioma("en"))
+
+	if _, err := c.GetLibro(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestErroresTipados(t *testing.T) {
+	t.Parallel()
+	casos := []struct {
+		nombre   string
+		estado   int
+		cuerpo   string
+		objetivo error
+		codigo   string
+		mensaje  string
+	}{
+		{"no encontrado", 404, `{"error":"Libro no encontrado","codigo":"libro_no_encontrado"}`, ErrNoEncontrado, "libro_no_encontrado", "Libro no encontrado"},
+		{"inválido", 400, `{"error":"El título es requerido","codigo":"titulo_requerido"}`, ErrPeticionInvalida, "titulo_requerido", "El título es requerido"},
+		{"sin JSON", 403, "prohibido\n", nil, "", "prohibido"},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			t.Parallel()
+			c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(caso.estado)
+				w.Write([]byte(caso.cuerpo))
+			})
+			_, err := c.GetLibro(context.Background(), 7)
+
+			var errAPI *ErrorAPI
+			if !errors.As(err, &errAPI) {
+				t.Fatalf("err = %v, se esperaba *ErrorAPI", err)
+			}
+			if errAPI.Estado != caso.estado || errAPI.Codigo != caso.codigo || errAPI.Mensaje != caso.mensaje {
+				t.Errorf("ErrorAPI = %+v", errAPI)
+			}
+			if caso.objetivo != nil && !errors.Is(err, caso.objetivo) {
+				t.Errorf("errors.Is(%v, %v) = false", err, caso.objetivo)
+			}
+		})
+	}
+}
+
+func TestReintentaErroresTransitorios(t *testing.T) {
+	t.Parallel()
+	var llamadas atomic.Int32
+	c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+		if llamadas.Add(1) < 3 {
+			responder(w, http.StatusServiceUnavailable, map[string]string{"error": "ocupado"})
+			return
+		}
+		responder(w, http.StatusOK, map[string]interface{}{"id": 3, "titulo": "Dune"})
+	})
+
+	libro, err := c.GetLibro(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if libro.Titulo != "Dune" || llamadas.Load() != 3 {
+		t.Errorf("libro = %+v tras %d llamadas", libro, llamadas.Load())
+	}
+}
+
+func TestAgotaLosReintentos(t *testing.T) {
+	t.Parallel()
+	var llamadas atomic.Int32
+	c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+		llamadas.Add(1)
+		responder(w, http.StatusTooManyRequests, map[string]string{"error": "despacio"})
+	})
+
+	_, err := c.GetLibro(context.Background(), 3)
+	var errAPI *ErrorAPI
+	if !errors.As(err, &errAPI) || errAPI.Estado != http.StatusTooManyRequests {
+		t.Fatalf("err = %v", err)
+	}
+	if llamadas.Load() != 4 {
+		t.Errorf("llamadas = %d, se esperaban 4 (1 + 3 reintentos)", llamadas.Load())
+	}
+}
+
+func TestNoReintentaErroresDelCliente(t *testing.T) {
+	t.Parallel()
+	var llamadas atomic.Int32
+	c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+		llamadas.Add(1)
+		responder(w, http.StatusNotFound, map[string]string{"error": "no está"})
+	})
+
+	if err := c.DeleteLibro(context.Background(), 9); !errors.Is(err, ErrNoEncontrado) {
+		t.Fatalf("err = %v", err)
+	}
+	if llamadas.Load() != 1 {
+		t.Errorf("llamadas = %d, se esperaba 1", llamadas.Load())
+	}
+}
+
+// Los reintentos de CreateLibro repiten la misma Idempotency-Key
+func TestCreateLibroReintentaConLaMismaClave(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var claves []string
+	c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+		var libro Libro
+		if err := json.NewDecoder(r.Body).Decode(&libro); err != nil || libro.Titulo != "Rayuela" {
+			t.Errorf("cuerpo = %+v (%v)", libro, err)
+		}
+		mu.Lock()
+		claves = append(claves, r.Header.Get("Idempotency-Key"))
+		n := len(claves)
+		mu.Unlock()
+		if n == 1 {
+			responder(w, http.StatusBadGateway, map[string]string{"error": "caído"})
+			return
+		}
+		libro.ID = 10
+		responder(w, http.StatusCreated, libro)
+	})
+
+	creado, err := c.CreateLibro(context.Background(), Libro{Titulo: "Rayuela", Autor: "Julio Cortázar", Año: 1963})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creado.ID != 10 {
+		t.Errorf("ID = %d", creado.ID)
+	}
+	if len(claves) != 2 || claves[0] == "" || claves[0] != claves[1] {
+		t.Errorf("claves = %q, se esperaban dos iguales", claves)
+	}
+}
+
+// Un POST sin Idempotency-Key no se reintenta
+func TestRestoreLibroNoSeReintenta(t *testing.T) {
+	t.Parallel()
+	var llamadas atomic.Int32
+	c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+		llamadas.Add(1)
+		if r.Method != http.MethodPost || r.URL.Path != "/api/libros/4/restaurar" {
+			t.Errorf("petición inesperada %s %s", r.Method, r.URL.Path)
+		}
+		responder(w, http.StatusServiceUnavailable, map[string]string{"error": "ocupado"})
+	})
+
+	if _, err := c.RestoreLibro(context.Background(), 4); err == nil {
+		t.Fatal("se esperaba un error")
+	}
+	if llamadas.Load() != 1 {
+		t.Errorf("llamadas = %d, se esperaba 1", llamadas.Load())
+	}
+}
+
+func TestUpdateYDeleteLibro(t *testing.T) {
+	t.Parallel()
+	c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			var libro Libro
+			json.NewDecoder(r.Body).Decode(&libro)
+			libro.ID = 5
+			responder(w, http.StatusOK, libro)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("método inesperado %s", r.Method)
+		}
+	})
+
+	actualizado, err := c.UpdateLibro(context.Background(), 5, Libro{Titulo: "Nuevo", Disponible: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actualizado.ID != 5 || actualizado.Titulo != "Nuevo" || !actualizado.Disponible {
+		t.Errorf("actualizado = %+v", actualizado)
+	}
+	if err := c.DeleteLibro(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Un contexto cancelado corta la petición y no se reintenta
+func TestRespetaElContexto(t *testing.T) {
+	t.Parallel()
+	var llamadas atomic.Int32
+	c := servidorDePrueba(t, func(w http.ResponseWriter, r *http.Request) {
+		llamadas.Add(1)
+		<-r.Context().Done()
+	})
+
+	ctx, cancelar := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelar()
+	if _, err := c.GetLibro(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, se esperaba DeadlineExceeded", err)
+	}
+	if llamadas.Load() != 1 {
+		t.Errorf("llamadas = %d, se esperaba 1", llamadas.Load())
+	}
+}
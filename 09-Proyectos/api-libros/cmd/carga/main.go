@@ -0,0 +1,419 @@
+// carga - Generador de carga para la API de libros
+// Lanza lecturas y escrituras contra un servidor en marcha y resume las
+// latencias (percentiles) y los errores de cada operación
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mat1520/Aprende-Go/09-Proyectos/api-libros/client"
+)
+
+const ayuda = `Uso: carga [opciones]
+
+Lanza peticiones contra una API en marcha durante el tiempo indicado.
+Las lecturas alternan el listado y GET de un libro; las escrituras crean
+un libro y luego lo envían a la papelera, así el catálogo no crece.
+
+Opciones:
+  --url URL            URL base de la API (LIBROS_URL, por defecto http://localhost:8080)
+  --api-key CLAVE      Clave enviada en X-API-Key (LIBROS_API_KEY)
+  --sucursal ID        Sucursal contra la que se prueba (LIBROS_SUCURSAL)
+  --token TOKEN        Token de la sucursal, si el servidor lo pide (LIBROS_TOKEN)
+  --rps N              Peticiones por segundo en total (0 = sin límite, máximo 1000000; por defecto 50)
+  --concurrencia N     Peticiones simultáneas (por defecto 10)
+  --escrituras F       Fracción de escrituras entre 0 y 1 (por defecto 0.1)
+  --duracion D         Duración de la prueba, por ejemplo 30s o 2m (por defecto 30s)
+  --timeout D          Plazo de cada petición (por defecto 5s)
+  -o FORMATO           Salida: tabla o json (por defecto tabla)
+
+Ctrl+C termina antes de tiempo y muestra el resumen de lo medido.
+`
+
+// Operaciones medidas
+const (
+	opListar   = "listar"
+	opObtener  = "obtener"
+	opCrear    = "crear"
+	opEliminar = "eliminar"
+)
+
+var operaciones = []string{opListar, opObtener, opCrear, opEliminar}
+
+// Parámetros de la prueba
+type parametros struct {
+	rps          int
+	concurrencia int
+	escrituras   float64
+	duracion     time.Duration
+}
+
+// Mediciones de un trabajador; se juntan al final para no compartir locks
+type mediciones struct {
+	latencias map[string][]time.Duration // Por operación, solo las correctas
+	errores   map[string]map[string]int  // Por operación y tipo de error
+}
+
+func nuevasMediciones() *mediciones {
+	return &mediciones{latencias: map[string][]time.Duration{}, errores: map[string]map[string]int{}}
+}
+
+func (m *mediciones) registrar(op string, latencia time.Duration, err error) {
+	if err == nil {
+		m.latencias[op] = append(m.latencias[op], latencia)
+		return
+	}
+	if m.errores[op] == nil {
+		m.errores[op] = map[string]int{}
+	}
+	m.errores[op][tipoError(err)]++
+}
+
+func (m *mediciones) sumar(otra *mediciones) {
+	for op, l := range otra.latencias {
+		m.latencias[op] = append(m.latencias[op], l...)
+	}
+	for op, tipos := range otra.errores {
+		for tipo, n := range tipos {
+			if m.errores[op] == nil {
+				m.errores[op] = map[string]int{}
+			}
+			m.errores[op][tipo] += n
+		}
+	}
+}
+
+// tipoError agrupa los errores por estado HTTP y código de la API
+func tipoError(err error) string {
+	var errAPI *client.ErrorAPI
+	switch {
+	case errors.As(err, &errAPI) && errAPI.Codigo != "":
+		return strconv.Itoa(errAPI.Estado) + " " + errAPI.Codigo
+	case errors.As(err, &errAPI):
+		return strconv.Itoa(errAPI.Estado)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "red"
+	}
+}
+
+// Resumen de una operación (o del total)
+type resumenOperacion struct {
+	Operacion  string         `json:"operacion"`
+	Peticiones int            `json:"peticiones"`
+	Errores    int            `json:"errores"`
+	TasaError  float64        `json:"tasa_error"`
+	P50        float64        `json:"p50_ms"`
+	P90        float64        `json:"p90_ms"`
+	P99        float64        `json:"p99_ms"`
+	Maxima     float64        `json:"max_ms"`
+	PorTipo    map[string]int `json:"errores_por_tipo,omitempty"`
+}
+
+// Resumen de la prueba completa
+type resumen struct {
+	Duracion    float64            `json:"duracion_s"`
+	RPS         float64            `json:"rps"`
+	Total       resumenOperacion   `json:"total"`
+	Operaciones []resumenOperacion `json:"operaciones"`
+}
+
+func main() {
+	if err := ejecutar(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func ejecutar(args []string, salida io.Writer) error {
+	url := entorno("LIBROS_URL", "http://localhost:8080")
+	var p parametros
+
+	fs := flag.NewFlagSet("carga", flag.ContinueOnError)
+	fs.StringVar(&url, "url", url, "URL base de la API")
+	apiKey := fs.String("api-key", os.Getenv("LIBROS_API_KEY"), "clave de la API")
+	sucursal := fs.String("sucursal", os.Getenv("LIBROS_SUCURSAL"), "sucursal")
+	token := fs.String("token", os.Getenv("LIBROS_TOKEN"), "token de la sucursal")
+	fs.IntVar(&p.rps, "rps", 50, "peticiones por segundo (0 = sin límite)")
+	fs.IntVar(&p.concurrencia, "concurrencia", 10, "peticiones simultáneas")
+	fs.Float64Var(&p.escrituras, "escrituras", 0.1, "fracción de escrituras")
+	fs.DurationVar(&p.duracion, "duracion", 30*time.Second, "duración de la prueba")
+	timeout := fs.Duration("timeout", 5*time.Second, "plazo de cada petición")
+	formato := fs.String("o", "tabla", "formato de salida: tabla o json")
+	fs.Usage = func() { fmt.Fprint(fs.Output(), ayuda) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case p.rps < 0:
+		return errors.New("--rps no puede ser negativo")
+	case p.rps > rpsMaximo:
+		return fmt.Errorf("--rps no puede superar %d (0 = sin límite)", rpsMaximo)
+	case p.concurrencia < 1:
+		return errors.New("--concurrencia debe ser al menos 1")
+	case p.escrituras < 0 || p.escrituras > 1:
+		return errors.New("--escrituras debe estar entre 0 y 1")
+	case p.duracion <= 0:
+		return errors.New("--duracion debe ser positiva")
+	case *formato != "tabla" && *formato != "json":
+		return fmt.Errorf("formato desconocido %q", *formato)
+	}
+
+	// Sin reintentos: cada petición fallida cuenta como error. El transporte
+	// guarda tantas conexiones como trabajadores para no abrir una por petición.
+	transporte := http.DefaultTransport.(*http.Transport).Clone()
+	transporte.MaxIdleConnsPerHost = p.concurrencia
+	c := client.New(url,
+		client.WithHTTPClient(&http.Client{Timeout: *timeout, Transport: transporte}),
+		client.WithReintentos(0, 0),
+		client.WithAPIKey(*apiKey), client.WithActor("carga"),
+		client.WithSucursal(*sucursal), client.WithToken(*token))
+
+	ctx, cancelar := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancelar()
+
+	// Los IDs existentes sirven para las lecturas de un libro
+	lista, err := c.ListLibros(ctx, client.Filtros{})
+	if err != nil {
+		return fmt.Errorf("no se pudo consultar la API: %w", err)
+	}
+	ids := make([]int, len(lista.Libros))
+	for i, libro := range lista.Libros {
+		ids[i] = libro.ID
+	}
+
+	limite := "sin límite"
+	if p.rps > 0 {
+		limite = strconv.Itoa(p.rps) + " rps"
+	}
+	fmt.Fprintf(os.Stderr, "Probando %s durante %s (%s, %d simultáneas, %.0f%% escrituras)\n",
+		url, p.duracion, limite, p.concurrencia, p.escrituras*100)
+
+	r := probar(ctx, c, p, ids)
+	if *formato == "json" {
+		enc := json.NewEncoder(salida)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	imprimirResumen(salida, r)
+	return nil
+}
+
+func entorno(nombre, defecto string) string {
+	if v := os.Getenv(nombre); v != "" {
+		return v
+	}
+	return defecto
+}
+
+// probar lanza los trabajadores hasta que termine la duración (o Ctrl+C)
+func probar(ctx context.Context, c *client.Client, p parametros, ids []int) resumen {
+	ctx, cancelar := context.WithTimeout(ctx, p.duracion)
+	defer cancelar()
+
+	// Con límite, cada petición necesita un turno; los turnos que nadie
+	// recoge a tiempo se pierden en lugar de acumularse
+	var turnos chan struct{}
+	if p.rps > 0 {
+		turnos = make(chan struct{})
+		go repartirTurnos(ctx, turnos, p.rps)
+	}
+
+	inicio := time.Now()
+	total := nuevasMediciones()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range p.concurrencia {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := trabajar(ctx, c, p, ids, turnos)
+			mu.Lock()
+			total.sumar(m)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return resumir(total, time.Since(inicio))
+}
+
+// Con más turnos por segundo el intervalo del ticker se acerca a cero (y
+// time.NewTicker entra en pánico); a ese ritmo conviene --rps 0
+const rpsMaximo = 1_000_000
+
+func repartirTurnos(ctx context.Context, turnos chan<- struct{}, rps int) {
+	ticker := time.NewTicker(time.Second / time.Duration(rps))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			select {
+			case turnos <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// trabajar hace peticiones hasta que se cancele ctx. Los libros que crea
+// los elimina en la siguiente escritura, y los que quedan al final también.
+func trabajar(ctx context.Context, c *client.Client, p parametros, ids []int, turnos <-chan struct{}) *mediciones {
+	m := nuevasMediciones()
+	var creados []int
+	defer func() {
+		limpieza, cancelar := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelar()
+		for _, id := range creados {
+			c.DeleteLibro(limpieza, id)
+		}
+	}()
+
+	for n := 0; ; n++ {
+		if turnos != nil {
+			select {
+			case <-ctx.Done():
+				return m
+			case <-turnos:
+			}
+		} else if ctx.Err() != nil {
+			return m
+		}
+
+		var op string
+		var err error
+		inicio := time.Now()
+		switch escritura := rand.Float64() < p.escrituras; {
+		case escritura && len(creados) > 0:
+			op = opEliminar
+			id := creados[len(creados)-1]
+			if err = c.DeleteLibro(ctx, id); err == nil || errors.Is(err, client.ErrNoEncontrado) {
+				creados = creados[:len(creados)-1]
+			}
+		case escritura:
+			op = opCrear
+			var libro *client.Libro
+			libro, err = c.CreateLibro(ctx, client.Libro{
+				Titulo: fmt.Sprintf("Prueba de carga %d", n),
+				Autor:  "carga",
+				Año:    2024,
+			})
+			if err == nil {
+				creados = append(creados, libro.ID)
+			}
+		case len(ids) > 0 && rand.IntN(2) == 0:
+			op = opObtener
+			_, err = c.GetLibro(ctx, ids[rand.IntN(len(ids))])
+		default:
+			op = opListar
+			_, err = c.ListLibros(ctx, client.Filtros{})
+		}
+		latencia := time.Since(inicio)
+
+		// Las peticiones cortadas por el fin de la prueba no cuentan
+		if ctx.Err() != nil {
+			return m
+		}
+		m.registrar(op, latencia, err)
+	}
+}
+
+func resumir(m *mediciones, duracion time.Duration) resumen {
+	r := resumen{Duracion: duracion.Seconds()}
+	var todas []time.Duration
+	todosErrores := map[string]int{}
+	for _, op := range operaciones {
+		latencias := m.latencias[op]
+		if len(latencias) == 0 && len(m.errores[op]) == 0 {
+			continue
+		}
+		r.Operaciones = append(r.Operaciones, resumirOperacion(op, latencias, m.errores[op]))
+		todas = append(todas, latencias...)
+		for tipo, n := range m.errores[op] {
+			todosErrores[tipo] += n
+		}
+	}
+	r.Total = resumirOperacion("total", todas, todosErrores)
+	if duracion > 0 {
+		r.RPS = float64(r.Total.Peticiones) / duracion.Seconds()
+	}
+	return r
+}
+
+func resumirOperacion(op string, latencias []time.Duration, errores map[string]int) resumenOperacion {
+	slices.Sort(latencias)
+	ro := resumenOperacion{
+		Operacion: op,
+		P50:       milisegundos(percentil(latencias, 0.50)),
+		P90:       milisegundos(percentil(latencias, 0.90)),
+		P99:       milisegundos(percentil(latencias, 0.99)),
+		Maxima:    milisegundos(percentil(latencias, 1)),
+	}
+	for _, n := range errores {
+		ro.Errores += n
+	}
+	if len(errores) > 0 {
+		ro.PorTipo = errores
+	}
+	ro.Peticiones = len(latencias) + ro.Errores
+	if ro.Peticiones > 0 {
+		ro.TasaError = float64(ro.Errores) / float64(ro.Peticiones)
+	}
+	return ro
+}
+
+// percentil por el método del rango más cercano; latencias ya ordenadas
+func percentil(latencias []time.Duration, p float64) time.Duration {
+	if len(latencias) == 0 {
+		return 0
+	}
+	i := int(float64(len(latencias))*p+0.999999) - 1
+	return latencias[max(0, min(i, len(latencias)-1))]
+}
+
+func milisegundos(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func imprimirResumen(salida io.Writer, r resumen) {
+	fmt.Fprintf(salida, "Duración: %.1fs  Peticiones: %d  RPS: %.1f  Errores: %d (%.2f%%)\n\n",
+		r.Duracion, r.Total.Peticiones, r.RPS, r.Total.Errores, r.Total.TasaError*100)
+
+	tw := tabwriter.NewWriter(salida, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "OPERACIÓN\tPETICIONES\tERRORES\tP50 (ms)\tP90 (ms)\tP99 (ms)\tMÁX (ms)\t")
+	for _, ro := range append(r.Operaciones, r.Total) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t\n",
+			ro.Operacion, ro.Peticiones, ro.Errores, ro.P50, ro.P90, ro.P99, ro.Maxima)
+	}
+	tw.Flush()
+
+	if len(r.Total.PorTipo) == 0 {
+		return
+	}
+	fmt.Fprintln(salida, "\nErrores por tipo:")
+	tipos := make([]string, 0, len(r.Total.PorTipo))
+	for tipo := range r.Total.PorTipo {
+		tipos = append(tipos, tipo)
+	}
+	slices.Sort(tipos)
+	for _, tipo := range tipos {
+		fmt.Fprintf(salida, "  %-40s %d\n", tipo, r.Total.PorTipo[tipo])
+	}
+}
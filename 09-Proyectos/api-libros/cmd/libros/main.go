@@ -0,0 +1,461 @@
+// libros - Herramienta de línea de comandos para administrar el catálogo
+// Habla con la API HTTP de api-libros usando el paquete client
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mat1520/Aprende-Go/09-Proyectos/api-libros/client"
+)
+
+const ayuda = `Uso: libros [opciones] <comando> [argumentos]
+
+Comandos:
+  list     [--genero G] [--disponible true|false]   Listar libros
+  get      <id>                                    Mostrar un libro
+  add      --titulo T --autor A --anio N [--genero G]
+  update   <id> [--titulo T] [--autor A] [--anio N] [--genero G] [--disponible B]
+  rm       <id> [<id>...]                          Eliminar libros
+  import   [archivo.json|archivo.csv]              Crear libros (stdin si no hay archivo)
+  export   [--genero G] [--disponible B]           Exportar el catálogo
+
+Opciones globales:
+  --url URL        URL base de la API (LIBROS_URL)
+  --api-key CLAVE  Clave enviada en X-API-Key (LIBROS_API_KEY)
+  --actor NOMBRE   Quién hace los cambios, para la auditoría (LIBROS_ACTOR, o $USER)
+  --sucursal ID    Sucursal con la que se trabaja (LIBROS_SUCURSAL)
+  --token TOKEN    Token de la sucursal, si el servidor lo pide (LIBROS_TOKEN)
+  -o FORMATO       Salida: tabla, json o csv (por defecto tabla; export usa json)
+
+Configuración opcional en %s:
+  {"url": "http://localhost:8080", "api_key": "...", "actor": "...", "sucursal": "...", "token": "..."}
+`
+
+// Configuración de conexión
+type configuracion struct {
+	URL      string `json:"url"`
+	APIKey   string `json:"api_key"`
+	Actor    string `json:"actor"`
+	Sucursal string `json:"sucursal"`
+	Token    string `json:"token"`
+}
+
+// Columnas usadas en tabla y CSV
+var columnas = []string{"id", "titulo", "autor", "año", "genero", "disponible"}
+
+func main() {
+	if err := ejecutar(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func rutaConfiguracion() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "libros.json"
+	}
+	return filepath.Join(dir, "libros", "config.json")
+}
+
+// Prioridad: flags > variables de entorno > archivo > valores por defecto
+func cargarConfiguracion() configuracion {
+	cfg := configuracion{URL: "http://localhost:8080", Actor: os.Getenv("USER")}
+
+	if datos, err := os.ReadFile(rutaConfiguracion()); err == nil {
+		var archivo configuracion
+		if err := json.Unmarshal(datos, &archivo); err == nil {
+			if archivo.URL != "" {
+				cfg.URL = archivo.URL
+			}
+			cfg.APIKey = archivo.APIKey
+			if archivo.Actor != "" {
+				cfg.Actor = archivo.Actor
+			}
+			cfg.Sucursal = archivo.Sucursal
+			cfg.Token = archivo.Token
+		}
+	}
+	if v := os.Getenv("LIBROS_URL"); v != "" {
+		cfg.URL = v
+	}
+	if v := os.Getenv("LIBROS_API_KEY"); v != "" {
+		cfg.APIKey = v
+	}
+	if v := os.Getenv("LIBROS_ACTOR"); v != "" {
+		cfg.Actor = v
+	}
+	if v := os.Getenv("LIBROS_SUCURSAL"); v != "" {
+		cfg.Sucursal = v
+	}
+	if v := os.Getenv("LIBROS_TOKEN"); v != "" {
+		cfg.Token = v
+	}
+	return cfg
+}
+
+func ejecutar(args []string, entrada io.Reader, salida io.Writer) error {
+	cfg := cargarConfiguracion()
+
+	global := flag.NewFlagSet("libros", flag.ContinueOnError)
+	global.StringVar(&cfg.URL, "url", cfg.URL, "URL base de la API")
+	global.StringVar(&cfg.APIKey, "api-key", cfg.APIKey, "clave de la API")
+	global.StringVar(&cfg.Actor, "actor", cfg.Actor, "quién hace los cambios")
+	global.StringVar(&cfg.Sucursal, "sucursal", cfg.Sucursal, "sucursal")
+	global.StringVar(&cfg.Token, "token", cfg.Token, "token de la sucursal")
+	formato := global.String("o", "", "formato de salida: tabla, json o csv")
+	global.Usage = func() { fmt.Fprintf(global.Output(), ayuda, rutaConfiguracion()) }
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+
+	if global.NArg() == 0 {
+		global.Usage()
+		return errors.New("falta el comando")
+	}
+
+	c := client.New(cfg.URL, client.WithAPIKey(cfg.APIKey), client.WithActor(cfg.Actor),
+		client.WithSucursal(cfg.Sucursal), client.WithToken(cfg.Token))
+	ctx := context.Background()
+	comando, resto := global.Arg(0), global.Args()[1:]
+
+	switch comando {
+	case "list":
+		return cmdList(ctx, c, resto, salida, formato, "tabla")
+	case "get":
+		return cmdGet(ctx, c, resto, salida, formato)
+	case "add":
+		return cmdAdd(ctx, c, resto, salida, formato)
+	case "update":
+		return cmdUpdate(ctx, c, resto, salida, formato)
+	case "rm":
+		return cmdRm(ctx, c, resto, salida)
+	case "import":
+		return cmdImport(ctx, c, resto, entrada, salida)
+	case "export":
+		return cmdList(ctx, c, resto, salida, formato, "json")
+	default:
+		global.Usage()
+		return fmt.Errorf("comando desconocido %q", comando)
+	}
+}
+
+// El flag -o también se acepta después del comando
+func flagFormato(fs *flag.FlagSet, formato *string) {
+	fs.StringVar(formato, "o", *formato, "formato de salida: tabla, json o csv")
+}
+
+func formatoPor(elegido, defecto string) string {
+	if elegido == "" {
+		return defecto
+	}
+	return elegido
+}
+
+// Flags de filtro equivalentes a los de obtenerLibros
+func flagsFiltro(nombre string) (*flag.FlagSet, *string, *string) {
+	fs := flag.NewFlagSet(nombre, flag.ContinueOnError)
+	genero := fs.String("genero", "", "filtrar por género")
+	disponible := fs.String("disponible", "", "filtrar por disponibilidad (true/false)")
+	return fs, genero, disponible
+}
+
+func cmdList(ctx context.Context, c *client.Client, args []string, salida io.Writer, formato *string, defecto string) error {
+	fs, genero, disponible := flagsFiltro("list")
+	flagFormato(fs, formato)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filtros := client.Filtros{Genero: *genero}
+	if *disponible != "" {
+		valor, err := strconv.ParseBool(*disponible)
+		if err != nil {
+			return fmt.Errorf("--disponible debe ser true o false")
+		}
+		filtros.Disponible = &valor
+	}
+
+	lista, err := c.ListLibros(ctx, filtros)
+	if err != nil {
+		return err
+	}
+	return imprimir(salida, formatoPor(*formato, defecto), lista.Libros)
+}
+
+func cmdGet(ctx context.Context, c *client.Client, args []string, salida io.Writer, formato *string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	flagFormato(fs, formato)
+	if len(args) == 0 {
+		return errors.New("uso: libros get <id>")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("ID inválido %q", args[0])
+	}
+
+	libro, err := c.GetLibro(ctx, id)
+	if err != nil {
+		return err
+	}
+	return imprimir(salida, formatoPor(*formato, "tabla"), []client.Libro{*libro})
+}
+
+// Flags con los campos editables de un libro
+type flagsLibro struct {
+	fs         *flag.FlagSet
+	titulo     *string
+	autor      *string
+	anio       *int
+	genero     *string
+	disponible *bool
+}
+
+func nuevosFlagsLibro(nombre string) flagsLibro {
+	fs := flag.NewFlagSet(nombre, flag.ContinueOnError)
+	return flagsLibro{
+		fs:         fs,
+		titulo:     fs.String("titulo", "", "título del libro"),
+		autor:      fs.String("autor", "", "autor del libro"),
+		anio:       fs.Int("anio", 0, "año de publicación"),
+		genero:     fs.String("genero", "", "género"),
+		disponible: fs.Bool("disponible", true, "disponibilidad"),
+	}
+}
+
+// Copia al libro solo los flags que el usuario indicó
+func (f flagsLibro) aplicar(libro *client.Libro) {
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "titulo":
+			libro.Titulo = *f.titulo
+		case "autor":
+			libro.Autor = *f.autor
+		case "anio":
+			libro.Año = *f.anio
+		case "genero":
+			libro.Genero = *f.genero
+		case "disponible":
+			libro.Disponible = *f.disponible
+		}
+	})
+}
+
+func cmdAdd(ctx context.Context, c *client.Client, args []string, salida io.Writer, formato *string) error {
+	f := nuevosFlagsLibro("add")
+	flagFormato(f.fs, formato)
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+
+	var libro client.Libro
+	f.aplicar(&libro)
+	creado, err := c.CreateLibro(ctx, libro)
+	if err != nil {
+		return err
+	}
+	return imprimir(salida, formatoPor(*formato, "tabla"), []client.Libro{*creado})
+}
+
+func cmdUpdate(ctx context.Context, c *client.Client, args []string, salida io.Writer, formato *string) error {
+	if len(args) == 0 {
+		return errors.New("uso: libros update <id> [--titulo T] ...")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("ID inválido %q", args[0])
+	}
+	f := nuevosFlagsLibro("update")
+	flagFormato(f.fs, formato)
+	if err := f.fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	// PUT reemplaza el libro completo: partimos de los datos actuales
+	libro, err := c.GetLibro(ctx, id)
+	if err != nil {
+		return err
+	}
+	f.aplicar(libro)
+
+	actualizado, err := c.UpdateLibro(ctx, id, *libro)
+	if err != nil {
+		return err
+	}
+	return imprimir(salida, formatoPor(*formato, "tabla"), []client.Libro{*actualizado})
+}
+
+func cmdRm(ctx context.Context, c *client.Client, args []string, salida io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("uso: libros rm <id> [<id>...]")
+	}
+
+	var fallos int
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err == nil {
+			err = c.DeleteLibro(ctx, id)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", arg, err)
+			fallos++
+			continue
+		}
+		fmt.Fprintf(salida, "✓ Libro %d eliminado\n", id)
+	}
+
+	if fallos > 0 {
+		return fmt.Errorf("%d de %d libros no se eliminaron", fallos, len(args))
+	}
+	return nil
+}
+
+func cmdImport(ctx context.Context, c *client.Client, args []string, entrada io.Reader, salida io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	formato := fs.String("formato", "", "json o csv (se deduce de la extensión)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		archivo, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer archivo.Close()
+		entrada = archivo
+		if *formato == "" {
+			*formato = strings.TrimPrefix(filepath.Ext(fs.Arg(0)), ".")
+		}
+	}
+
+	var libros []client.Libro
+	var err error
+	switch formatoPor(*formato, "json") {
+	case "json":
+		err = json.NewDecoder(entrada).Decode(&libros)
+	case "csv":
+		libros, err = leerCSV(entrada)
+	default:
+		return fmt.Errorf("formato de importación desconocido %q", *formato)
+	}
+	if err != nil {
+		return fmt.Errorf("leyendo libros: %w", err)
+	}
+
+	var fallos int
+	for i, libro := range libros {
+		creado, err := c.CreateLibro(ctx, libro)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "✗ registro %d (%s): %v\n", i+1, libro.Titulo, err)
+			fallos++
+			continue
+		}
+		fmt.Fprintf(salida, "✓ %d %s\n", creado.ID, creado.Titulo)
+	}
+
+	if fallos > 0 {
+		return fmt.Errorf("%d de %d libros no se importaron", fallos, len(libros))
+	}
+	return nil
+}
+
+// IMPRESIÓN
+
+func imprimir(salida io.Writer, formato string, libros []client.Libro) error {
+	switch formato {
+	case "tabla":
+		return imprimirTabla(salida, libros)
+	case "json":
+		enc := json.NewEncoder(salida)
+		enc.SetIndent("", "  ")
+		return enc.Encode(libros)
+	case "csv":
+		return escribirCSV(salida, libros)
+	default:
+		return fmt.Errorf("formato de salida desconocido %q", formato)
+	}
+}
+
+func imprimirTabla(salida io.Writer, libros []client.Libro) error {
+	tw := tabwriter.NewWriter(salida, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(columnas, "\t")))
+	for _, l := range libros {
+		fmt.Fprintln(tw, strings.Join(filaLibro(l), "\t"))
+	}
+	fmt.Fprintf(tw, "\nTotal: %d\n", len(libros))
+	return tw.Flush()
+}
+
+func filaLibro(l client.Libro) []string {
+	return []string{
+		strconv.Itoa(l.ID),
+		l.Titulo,
+		l.Autor,
+		strconv.Itoa(l.Año),
+		l.Genero,
+		strconv.FormatBool(l.Disponible),
+	}
+}
+
+func escribirCSV(salida io.Writer, libros []client.Libro) error {
+	w := csv.NewWriter(salida)
+	w.Write(columnas)
+	for _, l := range libros {
+		w.Write(filaLibro(l))
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// leerCSV acepta las columnas de export en cualquier orden (id se ignora)
+func leerCSV(entrada io.Reader) ([]client.Libro, error) {
+	registros, err := csv.NewReader(entrada).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(registros) == 0 {
+		return nil, nil
+	}
+
+	indice := map[string]int{}
+	for i, nombre := range registros[0] {
+		indice[strings.ToLower(strings.TrimSpace(nombre))] = i
+	}
+	campo := func(fila []string, nombre string) string {
+		if i, ok := indice[nombre]; ok && i < len(fila) {
+			return strings.TrimSpace(fila[i])
+		}
+		return ""
+	}
+
+	var libros []client.Libro
+	for n, fila := range registros[1:] {
+		libro := client.Libro{
+			Titulo: campo(fila, "titulo"),
+			Autor:  campo(fila, "autor"),
+			Genero: campo(fila, "genero"),
+		}
+		if v := campo(fila, "año"); v != "" {
+			if libro.Año, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("fila %d: año inválido %q", n+2, v)
+			}
+		}
+		libros = append(libros, libro)
+	}
+	return libros, nil
+}
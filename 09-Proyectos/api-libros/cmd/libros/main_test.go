@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mat1520/Aprende-Go/09-Proyectos/api-libros/client"
+)
+
+// catalogoFalso imita las rutas de libros de api-libros en memoria y anota
+// las peticiones que recibe
+type catalogoFalso struct {
+	URL string
+
+	mu         sync.Mutex
+	libros     map[int]client.Libro
+	siguiente  int
+	peticiones []*http.Request
+}
+
+func nuevoCatalogo(t *testing.T, libros ...client.Libro) *catalogoFalso {
+	t.Helper()
+	c := &catalogoFalso{libros: map[int]client.Libro{}, siguiente: 1}
+	for _, libro := range libros {
+		libro.ID = c.siguiente
+		c.libros[libro.ID] = libro
+		c.siguiente++
+	}
+	ts := httptest.NewServer(http.HandlerFunc(c.manejar))
+	t.Cleanup(ts.Close)
+	c.URL = ts.URL
+	return c
+}
+
+func (c *catalogoFalso) manejar(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peticiones = append(c.peticiones, r)
+
+	responder := func(estado int, cuerpo interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(estado)
+		json.NewEncoder(w).Encode(cuerpo)
+	}
+	if r.URL.Path == "/api/libros" {
+		switch r.Method {
+		case http.MethodGet:
+			genero, disponible := r.URL.Query().Get("genero"), r.URL.Query().Get("disponible")
+			libros := []client.Libro{}
+			for id := 1; id < c.siguiente; id++ {
+				libro, ok := c.libros[id]
+				if ok && (genero == "" || libro.Genero == genero) && (disponible == "" || strconv.FormatBool(libro.Disponible) == disponible) {
+					libros = append(libros, libro)
+				}
+			}
+			responder(http.StatusOK, map[string]interface{}{"libros": libros, "total": len(libros)})
+		case http.MethodPost:
+			var libro client.Libro
+			json.NewDecoder(r.Body).Decode(&libro)
+			if libro.Titulo == "" {
+				responder(http.StatusBadRequest, map[string]string{"error": "El título es requerido", "codigo": "titulo_requerido"})
+				return
+			}
+			libro.ID = c.siguiente
+			c.siguiente++
+			c.libros[libro.ID] = libro
+			responder(http.StatusCreated, libro)
+		}
+		return
+	}
+
+	id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/libros/"))
+	libro, ok := c.libros[id]
+	if !ok {
+		responder(http.StatusNotFound, map[string]string{"error": "Libro no encontrado", "codigo": "libro_no_encontrado"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		responder(http.StatusOK, libro)
+	case http.MethodPut:
+		// Como la API, PUT reemplaza el libro entero
+		libro = client.Libro{}
+		json.NewDecoder(r.Body).Decode(&libro)
+		libro.ID = id
+		c.libros[id] = libro
+		responder(http.StatusOK, libro)
+	case http.MethodDelete:
+		delete(c.libros, id)
+		responder(http.StatusOK, map[string]string{"mensaje": "Libro eliminado correctamente"})
+	}
+}
+
+// ultima devuelve la última petición recibida
+func (c *catalogoFalso) ultima() *http.Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peticiones[len(c.peticiones)-1]
+}
+
+// cantidad devuelve cuántas peticiones llegaron
+func (c *catalogoFalso) cantidad() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.peticiones)
+}
+
+// libro devuelve el libro guardado con ese ID
+func (c *catalogoFalso) libro(id int) (client.Libro, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	libro, ok := c.libros[id]
+	return libro, ok
+}
+
+// correr ejecuta la herramienta contra el catálogo y devuelve lo impreso
+func correr(t *testing.T, c *catalogoFalso, entrada string, args ...string) (string, error) {
+	t.Helper()
+	var salida bytes.Buffer
+	err := ejecutar(append([]string{"--url", c.URL}, args...), strings.NewReader(entrada), &salida)
+	return salida.String(), err
+}
+
+var librosEjemplo = []client.Libro{
+	{Titulo: "Cien años de soledad", Autor: "Gabriel García Márquez", Año: 1967, Genero: "Realismo mágico", Disponible: true},
+	{Titulo: "1984", Autor: "George Orwell", Año: 1949, Genero: "Distopía", Disponible: true},
+	{Titulo: "El Quijote", Autor: "Miguel de Cervantes", Año: 1605, Genero: "Clásico", Disponible: false},
+}
+
+// list pasa los filtros como los de obtenerLibros e imprime en los tres formatos
+func TestListFiltrosYFormatos(t *testing.T) {
+	t.Parallel()
+	c := nuevoCatalogo(t, librosEjemplo...)
+
+	salida, err := correr(t, c, "", "list", "--genero", "Distopía", "--disponible", "true", "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consulta := c.ultima().URL.Query(); consulta.Get("genero") != "Distopía" || consulta.Get("disponible") != "true" {
+		t.Errorf("consulta %q", c.ultima().URL.RawQuery)
+	}
+	var libros []client.Libro
+	if err := json.Unmarshal([]byte(salida), &libros); err != nil || len(libros) != 1 || libros[0].Titulo != "1984" {
+		t.Errorf("JSON: %q (%v)", salida, err)
+	}
+
+	// -o también vale antes del comando
+	salida, err = correr(t, c, "", "-o", "csv", "list", "--disponible=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filas, err := csv.NewReader(strings.NewReader(salida)).ReadAll()
+	if err != nil || len(filas) != 2 || strings.Join(filas[0], ",") != strings.Join(columnas, ",") || filas[1][1] != "El Quijote" || filas[1][5] != "false" {
+		t.Errorf("CSV: %q (%v)", filas, err)
+	}
+
+	salida, err = correr(t, c, "", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineas := strings.Split(strings.TrimSpace(salida), "\n")
+	if !strings.HasPrefix(lineas[0], "ID") || !strings.Contains(lineas[0], "TITULO") || lineas[len(lineas)-1] != "Total: 3" || !strings.Contains(salida, "Cien años de soledad") {
+		t.Errorf("tabla:\n%s", salida)
+	}
+
+	antes := c.cantidad()
+	if _, err := correr(t, c, "", "list", "--disponible", "quizás"); err == nil || c.cantidad() != antes {
+		t.Errorf("--disponible inválido: %v, %d peticiones", err, c.cantidad()-antes)
+	}
+	if _, err := correr(t, c, "", "list", "-o", "xml"); err == nil {
+		t.Error("se aceptó un formato de salida desconocido")
+	}
+}
+
+// add crea con los flags; update parte del libro actual y cambia solo lo
+// indicado; rm sigue con los demás IDs si uno falla
+func TestAddUpdateRm(t *testing.T) {
+	t.Parallel()
+	c := nuevoCatalogo(t, librosEjemplo...)
+
+	salida, err := correr(t, c, "", "add", "--titulo", "Rayuela", "--autor", "Julio Cortázar", "--anio", "1963", "--genero", "Clásico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	creado, ok := c.libro(4)
+	if !ok || creado.Titulo != "Rayuela" || creado.Autor != "Julio Cortázar" || creado.Año != 1963 || creado.Genero != "Clásico" {
+		t.Errorf("creado: %+v", creado)
+	}
+	if c.ultima().Header.Get("Idempotency-Key") == "" {
+		t.Error("add no envía Idempotency-Key")
+	}
+	if !strings.Contains(salida, "Rayuela") {
+		t.Errorf("salida de add: %q", salida)
+	}
+
+	if _, err := correr(t, c, "", "update", "2", "--titulo", "Mil novecientos ochenta y cuatro"); err != nil {
+		t.Fatal(err)
+	}
+	if libro, _ := c.libro(2); libro.Titulo != "Mil novecientos ochenta y cuatro" || libro.Autor != "George Orwell" || libro.Año != 1949 || !libro.Disponible {
+		t.Errorf("update del título: %+v", libro)
+	}
+	if _, err := correr(t, c, "", "update", "2", "--disponible=false"); err != nil {
+		t.Fatal(err)
+	}
+	if libro, _ := c.libro(2); libro.Disponible || libro.Titulo != "Mil novecientos ochenta y cuatro" {
+		t.Errorf("update de la disponibilidad: %+v", libro)
+	}
+	if _, err := correr(t, c, "", "update", "99", "--titulo", "X"); err == nil || !strings.Contains(err.Error(), "Libro no encontrado") {
+		t.Errorf("update de un libro inexistente: %v", err)
+	}
+
+	salida, err = correr(t, c, "", "rm", "1", "99", "x", "3")
+	if err == nil || !strings.Contains(err.Error(), "2 de 4") {
+		t.Errorf("rm con fallos: %v", err)
+	}
+	if _, ok := c.libro(1); ok {
+		t.Error("el libro 1 no se eliminó")
+	}
+	if _, ok := c.libro(3); ok {
+		t.Error("después de un fallo no se siguió con el libro 3")
+	}
+	if !strings.Contains(salida, "✓ Libro 1 eliminado") || !strings.Contains(salida, "✓ Libro 3 eliminado") {
+		t.Errorf("salida de rm: %q", salida)
+	}
+}
+
+// Lo exportado en CSV o JSON se vuelve a importar en otro catálogo
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+	origen := nuevoCatalogo(t, librosEjemplo...)
+
+	for _, formato := range []string{"csv", "json"} {
+		exportado, err := correr(t, origen, "", "export", "-o", formato)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// CSV por stdin; JSON desde un archivo, con el formato de la extensión
+		destino := nuevoCatalogo(t)
+		args := []string{"import", "--formato", "csv"}
+		if formato == "json" {
+			archivo := filepath.Join(t.TempDir(), "libros.json")
+			os.WriteFile(archivo, []byte(exportado), 0o644)
+			args = []string{"import", archivo}
+		}
+		salida, err := correr(t, destino, exportado, args...)
+		if err != nil {
+			t.Fatalf("import %s: %v", formato, err)
+		}
+		if strings.Count(salida, "✓") != len(librosEjemplo) {
+			t.Errorf("import %s: %q", formato, salida)
+		}
+		for i, esperado := range librosEjemplo {
+			libro, _ := destino.libro(i + 1)
+			if libro.Titulo != esperado.Titulo || libro.Autor != esperado.Autor || libro.Año != esperado.Año || libro.Genero != esperado.Genero {
+				t.Errorf("import %s, libro %d: %+v", formato, i+1, libro)
+			}
+		}
+	}
+
+	// export sin -o es JSON
+	if salida, _ := correr(t, origen, "", "export", "--genero", "Clásico"); !strings.HasPrefix(salida, "[") {
+		t.Errorf("export por defecto: %q", salida)
+	}
+}
+
+func TestImportConErrores(t *testing.T) {
+	t.Parallel()
+	c := nuevoCatalogo(t)
+
+	// Las columnas pueden venir en otro orden; id se ignora
+	csvDesordenado := "genero,año,titulo,autor,id\nClásico,1963,Rayuela,Julio Cortázar,77\nClásico,1605,,Miguel de Cervantes,78\n"
+	salida, err := correr(t, c, csvDesordenado, "import", "--formato", "csv")
+	if err == nil || !strings.Contains(err.Error(), "1 de 2") {
+		t.Errorf("import con un registro rechazado: %v", err)
+	}
+	if libro, ok := c.libro(1); !ok || libro.Titulo != "Rayuela" || libro.Año != 1963 || !strings.Contains(salida, "✓ 1 Rayuela") {
+		t.Errorf("importado: %+v, salida %q", libro, salida)
+	}
+
+	if _, err := correr(t, c, "titulo,año\nRayuela,mil\n", "import", "--formato", "csv"); err == nil || !strings.Contains(err.Error(), "fila 2") {
+		t.Errorf("año inválido: %v", err)
+	}
+	if _, err := correr(t, c, "{}", "import", "--formato", "xml"); err == nil {
+		t.Error("se aceptó un formato de importación desconocido")
+	}
+}
+
+func TestComandosInvalidos(t *testing.T) {
+	t.Parallel()
+	c := nuevoCatalogo(t, librosEjemplo...)
+	casos := [][]string{
+		{},
+		{"borrar"},
+		{"get"},
+		{"get", "uno"},
+		{"update", "uno"},
+		{"rm"},
+	}
+	for _, args := range casos {
+		if _, err := correr(t, c, "", args...); err == nil {
+			t.Errorf("%q no devolvió error", args)
+		}
+	}
+	if n := c.cantidad(); n != 0 {
+		t.Errorf("los comandos inválidos hicieron %d peticiones", n)
+	}
+}
+
+// La configuración se toma del archivo, las variables de entorno y los
+// flags, en ese orden de prioridad
+func TestConfiguracion(t *testing.T) {
+	c := nuevoCatalogo(t, librosEjemplo...)
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("AppData", dir)
+	for _, variable := range []string{"LIBROS_URL", "LIBROS_API_KEY", "LIBROS_SUCURSAL", "LIBROS_TOKEN"} {
+		t.Setenv(variable, "")
+	}
+	t.Setenv("LIBROS_ACTOR", "entorno")
+
+	ruta := rutaConfiguracion()
+	os.MkdirAll(filepath.Dir(ruta), 0o755)
+	archivo, _ := json.Marshal(configuracion{URL: c.URL, APIKey: "del-archivo", Actor: "archivo", Sucursal: "centro", Token: "tok"})
+	if err := os.WriteFile(ruta, archivo, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var salida bytes.Buffer
+	if err := ejecutar([]string{"--sucursal", "norte", "get", "1"}, strings.NewReader(""), &salida); err != nil {
+		t.Fatal(err)
+	}
+	esperadas := map[string]string{
+		"X-API-Key":     "del-archivo", // Archivo
+		"X-Actor":       "entorno",     // El entorno pisa el archivo
+		"X-Sucursal":    "norte",       // El flag pisa el archivo
+		"Authorization": "Bearer tok",
+	}
+	for nombre, valor := range esperadas {
+		if obtenido := c.ultima().Header.Get(nombre); obtenido != valor {
+			t.Errorf("%s = %q, se esperaba %q", nombre, obtenido, valor)
+		}
+	}
+	if !strings.Contains(salida.String(), "Cien años de soledad") {
+		t.Errorf("get no usó la URL del archivo: %q", salida.String())
+	}
+}
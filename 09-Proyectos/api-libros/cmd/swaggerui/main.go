@@ -0,0 +1,134 @@
+// swaggerui - Trae los archivos de Swagger UI que el servidor incluye con embed
+// Descarga de npm la versión de swaggerui/VERSION, comprueba el hash que
+// publica el registro y copia el CSS, el bundle y la licencia en swaggerui/.
+// Se ejecuta con go generate desde la raíz del proyecto.
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	directorio = "swaggerui"
+	registro   = "https://registry.npmjs.org/swagger-ui-dist/"
+)
+
+// Archivos del paquete que se copian (todos están en package/)
+var archivos = []string{"swagger-ui.css", "swagger-ui-bundle.js", "LICENSE"}
+
+var clienteHTTP = &http.Client{Timeout: 2 * time.Minute}
+
+func main() {
+	if err := ejecutar(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func ejecutar() error {
+	datos, err := os.ReadFile(filepath.Join(directorio, "VERSION"))
+	if err != nil {
+		return err
+	}
+	version := strings.TrimSpace(string(datos))
+
+	// El registro publica la URL del paquete y su hash (sha512 en formato SRI)
+	var metadatos struct {
+		Dist struct {
+			Tarball   string `json:"tarball"`
+			Integrity string `json:"integrity"`
+		} `json:"dist"`
+	}
+	cuerpo, err := descargar(registro + version)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(cuerpo, &metadatos); err != nil {
+		return fmt.Errorf("metadatos de swagger-ui-dist %s: %w", version, err)
+	}
+	esperado, ok := strings.CutPrefix(metadatos.Dist.Integrity, "sha512-")
+	if !ok || metadatos.Dist.Tarball == "" {
+		return fmt.Errorf("swagger-ui-dist %s no trae tarball ni hash sha512", version)
+	}
+
+	paquete, err := descargar(metadatos.Dist.Tarball)
+	if err != nil {
+		return err
+	}
+	suma := sha512.Sum512(paquete)
+	if base64.StdEncoding.EncodeToString(suma[:]) != esperado {
+		return fmt.Errorf("el paquete descargado no coincide con el hash del registro")
+	}
+
+	extraidos, err := extraer(paquete)
+	if err != nil {
+		return err
+	}
+	for _, nombre := range archivos {
+		contenido, ok := extraidos[nombre]
+		if !ok {
+			return fmt.Errorf("el paquete no trae %s", nombre)
+		}
+		if err := os.WriteFile(filepath.Join(directorio, nombre), contenido, 0o644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Swagger UI %s copiado en %s/\n", version, directorio)
+	return nil
+}
+
+func descargar(url string) ([]byte, error) {
+	resp, err := clienteHTTP.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// extraer lee del .tgz solo los archivos que se van a copiar
+func extraer(paquete []byte) (map[string][]byte, error) {
+	descomprimido, err := gzip.NewReader(bytes.NewReader(paquete))
+	if err != nil {
+		return nil, err
+	}
+	lector := tar.NewReader(descomprimido)
+
+	extraidos := map[string][]byte{}
+	for {
+		cabecera, err := lector.Next()
+		if errors.Is(err, io.EOF) {
+			return extraidos, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		nombre, ok := strings.CutPrefix(cabecera.Name, "package/")
+		if !ok || cabecera.Typeflag != tar.TypeReg {
+			continue
+		}
+		for _, buscado := range archivos {
+			if nombre == buscado {
+				if extraidos[nombre], err = io.ReadAll(lector); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+}
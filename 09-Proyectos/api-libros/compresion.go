@@ -0,0 +1,241 @@
+// Compresión de respuestas negociada con Accept-Encoding
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Las respuestas más chicas se envían sin comprimir
+const tamañoMinimoCompresion = 1024
+
+// Nivel de brotli para respuestas generadas al vuelo: comprime más que gzip
+// con un costo de CPU parecido (los niveles altos son para archivos estáticos)
+const nivelBrotli = 4
+
+// Codificador disponible para Content-Encoding
+type codificador struct {
+	Nombre string
+	Nuevo  func(io.Writer) io.WriteCloser
+}
+
+// Codificadores implementados; cada servidor elige cuáles ofrece y en qué
+// orden (configuracionServidor.Compresion)
+var codificadoresDisponibles = map[string]func(io.Writer) io.WriteCloser{
+	"br":   nuevoEscritorBrotli,
+	"gzip": nuevoEscritorGzip,
+}
+
+// elegirCodificadores arma la lista de preferencia a partir de los nombres
+func elegirCodificadores(nombres []string) ([]codificador, error) {
+	elegidos := make([]codificador, 0, len(nombres))
+	for _, nombre := range nombres {
+		nuevo, ok := codificadoresDisponibles[nombre]
+		if !ok {
+			return nil, fmt.Errorf("codificación desconocida: %q", nombre)
+		}
+		elegidos = append(elegidos, codificador{Nombre: nombre, Nuevo: nuevo})
+	}
+	return elegidos, nil
+}
+
+// Reutilizar los compresores evita reservar sus tablas en cada respuesta
+// (~800 KB en gzip)
+var (
+	poolGzip   = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+	poolBrotli = sync.Pool{New: func() interface{} { return brotli.NewWriterLevel(nil, nivelBrotli) }}
+)
+
+type escritorGzip struct{ *gzip.Writer }
+
+func (e escritorGzip) Close() error {
+	err := e.Writer.Close()
+	poolGzip.Put(e.Writer)
+	return err
+}
+
+func nuevoEscritorGzip(w io.Writer) io.WriteCloser {
+	gz := poolGzip.Get().(*gzip.Writer)
+	gz.Reset(w)
+	return escritorGzip{gz}
+}
+
+type escritorBrotli struct{ *brotli.Writer }
+
+func (e escritorBrotli) Close() error {
+	err := e.Writer.Close()
+	poolBrotli.Put(e.Writer)
+	return err
+}
+
+func nuevoEscritorBrotli(w io.Writer) io.WriteCloser {
+	br := poolBrotli.Get().(*brotli.Writer)
+	br.Reset(w)
+	return escritorBrotli{br}
+}
+
+// Elige el codificador con mayor q en Accept-Encoding; a igual q gana el
+// orden de preferencia del servidor. Devuelve nil si no hay ninguno aceptable.
+func negociarCodificacion(codificadores []codificador, aceptadas string) *codificador {
+	calidades := map[string]float64{}
+	for _, parte := range strings.Split(aceptadas, ",") {
+		nombre, parametros, _ := strings.Cut(strings.TrimSpace(parte), ";")
+		if nombre == "" {
+			continue
+		}
+		q := 1.0
+		if valor, ok := strings.CutPrefix(strings.TrimSpace(parametros), "q="); ok {
+			if n, err := strconv.ParseFloat(valor, 64); err == nil {
+				q = n
+			}
+		}
+		calidades[strings.ToLower(nombre)] = q
+	}
+
+	var elegido *codificador
+	mejor := 0.0
+	for i, c := range codificadores {
+		q, ok := calidades[c.Nombre]
+		if !ok {
+			q, ok = calidades["*"]
+		}
+		if ok && q > mejor {
+			elegido, mejor = &codificadores[i], q
+		}
+	}
+	return elegido
+}
+
+// Tipos de contenido que vale la pena comprimir (no los flujos SSE)
+func tipoComprimible(tipo string) bool {
+	tipo, _, _ = strings.Cut(tipo, ";")
+	switch {
+	case tipo == "text/event-stream":
+		return false
+	case strings.HasPrefix(tipo, "text/"), tipo == "application/json", tipo == "application/javascript", tipo == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// ResponseWriter que acumula los primeros bytes para decidir si comprime
+type escritorComprimido struct {
+	http.ResponseWriter
+	codificador *codificador
+	estado      int
+	buffer      []byte
+	decidido    bool
+	tomado      bool // Conexión tomada con Hijack
+	compresor   io.WriteCloser
+}
+
+func (e *escritorComprimido) WriteHeader(estado int) {
+	if e.decidido || e.estado != 0 {
+		return
+	}
+	e.estado = estado
+	// Sin cuerpo o informativas: no hay nada que comprimir
+	if estado < 200 || estado == http.StatusNoContent || estado == http.StatusNotModified {
+		e.decidir(false)
+	}
+}
+
+func (e *escritorComprimido) Write(b []byte) (int, error) {
+	if !e.decidido {
+		e.buffer = append(e.buffer, b...)
+		if len(e.buffer) >= tamañoMinimoCompresion {
+			e.decidir(true)
+		}
+		return len(b), nil
+	}
+	if e.compresor != nil {
+		return e.compresor.Write(b)
+	}
+	return e.ResponseWriter.Write(b)
+}
+
+// Flush antes de llegar al mínimo deja la respuesta sin comprimir (streaming)
+func (e *escritorComprimido) Flush() {
+	if !e.decidido {
+		e.decidir(false)
+	}
+	if f, ok := e.compresor.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := e.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (e *escritorComprimido) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := e.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("la conexión no admite Hijack")
+	}
+	e.decidido, e.tomado = true, true
+	return h.Hijack()
+}
+
+// Escribe las cabeceras y lo acumulado, comprimido o no
+func (e *escritorComprimido) decidir(comprimir bool) {
+	e.decidido = true
+	cabeceras := e.Header()
+	if comprimir && cabeceras.Get("Content-Encoding") == "" && tipoComprimible(cabeceras.Get("Content-Type")) {
+		cabeceras.Set("Content-Encoding", e.codificador.Nombre)
+		cabeceras.Del("Content-Length")
+		// Los bytes ya no son los de la versión sin comprimir: el ETag pasa a
+		// ser débil, que es el que se compara en If-None-Match
+		if etiqueta := cabeceras.Get("ETag"); strings.HasPrefix(etiqueta, `"`) {
+			cabeceras.Set("ETag", "W/"+etiqueta)
+		}
+		e.compresor = e.codificador.Nuevo(e.ResponseWriter)
+	}
+
+	if e.estado == 0 {
+		e.estado = http.StatusOK
+	}
+	e.ResponseWriter.WriteHeader(e.estado)
+	if len(e.buffer) > 0 {
+		e.Write(e.buffer)
+		e.buffer = nil
+	}
+}
+
+// Termina la respuesta: lo que no llegó al mínimo se envía tal cual
+func (e *escritorComprimido) cerrar() {
+	if e.tomado {
+		return
+	}
+	if !e.decidido {
+		e.decidir(false)
+	}
+	if e.compresor != nil {
+		e.compresor.Close()
+	}
+}
+
+// Middleware de compresión (brotli o gzip)
+func compresionMiddleware(codificadores []codificador, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		c := negociarCodificacion(codificadores, r.Header.Get("Accept-Encoding"))
+		if c == nil || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		escritor := &escritorComprimido{ResponseWriter: w, codificador: c}
+		defer escritor.cerrar()
+		next.ServeHTTP(escritor, r)
+	}
+}
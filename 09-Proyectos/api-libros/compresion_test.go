@@ -0,0 +1,154 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Los codificadores que ofrece un servidor sin configuración
+func codificadoresPorDefecto(t *testing.T) []codificador {
+	t.Helper()
+	codificadores, err := elegirCodificadores([]string{"br", "gzip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codificadores
+}
+
+func TestNegociarCodificacion(t *testing.T) {
+	t.Parallel()
+	codificadores := codificadoresPorDefecto(t)
+	casos := []struct {
+		aceptadas string
+		esperado  string // "" = sin comprimir
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"GZIP", "gzip"},
+		{"br", "br"},
+		{"gzip, br", "br"},          // A igual q, la preferencia del servidor
+		{"gzip, deflate, br", "br"}, // Lo que envían los navegadores
+		{"br;q=0.5, gzip", "gzip"},
+		{"gzip;q=0.8, br", "br"},
+		{"gzip;q=1.0, br;q=0.9", "gzip"},
+		{"br;q=0", ""},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", "br"},
+		{"*;q=0, gzip", "gzip"},
+		{"gzip;q=0.5, *;q=0.9", "br"},
+		{"deflate", ""},
+		{"gzip; q=0.3 , br ; q=0.2", "gzip"},
+	}
+	for _, caso := range casos {
+		c := negociarCodificacion(codificadores, caso.aceptadas)
+		obtenido := ""
+		if c != nil {
+			obtenido = c.Nombre
+		}
+		if obtenido != caso.esperado {
+			t.Errorf("Accept-Encoding %q: %q, se esperaba %q", caso.aceptadas, obtenido, caso.esperado)
+		}
+	}
+}
+
+// Handler que responde el tipo indicado con un cuerpo del tamaño pedido
+func handlerTamaño(tamaño int, tipo string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", tipo)
+		w.Write([]byte(strings.Repeat("a", tamaño)))
+	}
+}
+
+func TestCompresionMiddleware(t *testing.T) {
+	t.Parallel()
+	codificadores := codificadoresPorDefecto(t)
+	descomprimir := map[string]func(io.Reader) (io.Reader, error){
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"":     func(r io.Reader) (io.Reader, error) { return r, nil },
+	}
+	casos := []struct {
+		nombre    string
+		aceptadas string
+		tamaño    int
+		tipo      string
+		esperado  string
+	}{
+		{"brotli", "gzip, br", 4096, "application/json", "br"},
+		{"gzip", "gzip", 4096, "application/json", "gzip"},
+		{"chica", "br", 100, "application/json", ""},
+		{"sin aceptar", "", 4096, "application/json", ""},
+		{"binario", "br", 4096, "image/png", ""},
+		{"sse", "br", 4096, "text/event-stream", ""},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", caso.aceptadas)
+			rec := httptest.NewRecorder()
+			compresionMiddleware(codificadores, handlerTamaño(caso.tamaño, caso.tipo))(rec, req)
+
+			if codificacion := rec.Header().Get("Content-Encoding"); codificacion != caso.esperado {
+				t.Fatalf("Content-Encoding = %q, se esperaba %q", codificacion, caso.esperado)
+			}
+			if !strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding") {
+				t.Errorf("falta Vary: Accept-Encoding")
+			}
+			lector, err := descomprimir[caso.esperado](rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cuerpo, err := io.ReadAll(lector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(cuerpo) != strings.Repeat("a", caso.tamaño) {
+				t.Errorf("cuerpo de %d bytes no coincide con el original", len(cuerpo))
+			}
+		})
+	}
+}
+
+// Los compresores se reutilizan desde el pool sin mezclar respuestas
+func TestCompresionReutilizaEscritores(t *testing.T) {
+	t.Parallel()
+	codificadores := codificadoresPorDefecto(t)
+	for i := range 5 {
+		tamaño := 2000 + i*500
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "br")
+		rec := httptest.NewRecorder()
+		compresionMiddleware(codificadores, handlerTamaño(tamaño, "text/plain"))(rec, req)
+
+		cuerpo, err := io.ReadAll(brotli.NewReader(rec.Body))
+		if err != nil || len(cuerpo) != tamaño {
+			t.Fatalf("respuesta %d: %d bytes (%v), se esperaban %d", i, len(cuerpo), err, tamaño)
+		}
+	}
+}
+
+// Cada servidor ofrece solo las codificaciones que se le configuran
+func TestCompresionPorServidor(t *testing.T) {
+	t.Parallel()
+	if _, err := elegirCodificadores([]string{"zstd"}); err == nil {
+		t.Error("se aceptó una codificación desconocida")
+	}
+	soloGzip, err := elegirCodificadores([]string{"gzip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := negociarCodificacion(soloGzip, "br, gzip;q=0.5"); c == nil || c.Nombre != "gzip" {
+		t.Errorf("con solo gzip se eligió %v", c)
+	}
+	if c := negociarCodificacion(nil, "br, gzip"); c != nil {
+		t.Errorf("sin codificadores se eligió %s", c.Nombre)
+	}
+}
@@ -0,0 +1,376 @@
+// Ejemplares: las copias físicas de cada libro
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Estados de un ejemplar
+const (
+	ejemplarDisponible = "disponible"
+	ejemplarPrestado   = "prestado" // Lo maneja /api/prestamos
+	ejemplarReparacion = "reparacion"
+	ejemplarReservado  = "reservado" // Apartado para una reserva lista; lo maneja /api/reservas
+	ejemplarBaja       = "baja"      // Solo con DELETE; el ejemplar queda en el historial
+)
+
+var estadosEjemplar = []string{ejemplarDisponible, ejemplarPrestado, ejemplarReparacion, ejemplarReservado, ejemplarBaja}
+
+// Estados que se pueden asignar con POST y PUT
+var estadosEjemplarEditables = []string{ejemplarDisponible, ejemplarReparacion}
+
+// Condición física de un ejemplar
+var condicionesEjemplar = []string{"nuevo", "bueno", "regular", "dañado"}
+
+// Longitud máxima del código de barras
+const longitudMaximaCodigo = 64
+
+// Copia física de un libro
+type Ejemplar struct {
+	ID           int        `json:"id"`
+	LibroID      int        `json:"libro_id"`
+	CodigoBarras string     `json:"codigo_barras"`
+	Ubicacion    string     `json:"ubicacion"` // Sala y estante, por ejemplo "B-12"
+	Condicion    string     `json:"condicion"`
+	Estado       string     `json:"estado"`
+	FechaAlta    time.Time  `json:"fecha_alta"`
+	FechaBaja    *time.Time `json:"fecha_baja,omitempty"`
+}
+
+// Repositorio de ejemplares protegido con mutex. No se llama al de libros
+// con este bloqueo tomado.
+type repositorioEjemplares struct {
+	mu         sync.RWMutex
+	ejemplares []Ejemplar
+	contadorID int
+}
+
+// DeLibro devuelve los ejemplares de un libro (las bajas solo si se piden)
+func (r *repositorioEjemplares) DeLibro(libroID int, incluirBajas bool) []Ejemplar {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	lista := []Ejemplar{}
+	for _, ejemplar := range r.ejemplares {
+		if ejemplar.LibroID == libroID && (incluirBajas || ejemplar.Estado != ejemplarBaja) {
+			lista = append(lista, ejemplar)
+		}
+	}
+	return lista
+}
+
+// Obtener busca un ejemplar por su ID
+func (r *repositorioEjemplares) Obtener(id int) (Ejemplar, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, ejemplar := range r.ejemplares {
+		if ejemplar.ID == id {
+			return ejemplar, true
+		}
+	}
+	return Ejemplar{}, false
+}
+
+// Crear asigna un ID al ejemplar; falla si el código de barras ya existe
+func (r *repositorioEjemplares) Crear(ejemplar Ejemplar) (Ejemplar, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existente := range r.ejemplares {
+		if strings.EqualFold(existente.CodigoBarras, ejemplar.CodigoBarras) {
+			return Ejemplar{}, nuevoMensaje(msgCodigoBarrasDuplicado, ejemplar.CodigoBarras, existente.ID)
+		}
+	}
+	ejemplar.ID = r.contadorID
+	r.contadorID++
+	if ejemplar.FechaAlta.IsZero() {
+		ejemplar.FechaAlta = time.Now()
+	}
+	r.ejemplares = append(r.ejemplares, ejemplar)
+	return ejemplar, nil
+}
+
+// Modificar aplica f al ejemplar y devuelve la versión guardada
+func (r *repositorioEjemplares) Modificar(id int, f func(*Ejemplar)) (Ejemplar, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.ejemplares {
+		if r.ejemplares[i].ID == id {
+			f(&r.ejemplares[i])
+			return r.ejemplares[i], true
+		}
+	}
+	return Ejemplar{}, false
+}
+
+// Resumen cuenta los ejemplares activos de un libro y los disponibles
+func (r *repositorioEjemplares) Resumen(libroID int) (total, disponibles int) {
+	for _, ejemplar := range r.DeLibro(libroID, false) {
+		total++
+		if ejemplar.Estado == ejemplarDisponible {
+			disponibles++
+		}
+	}
+	return total, disponibles
+}
+
+// aplicarEjemplares copia los conteos al libro. Si tiene ejemplares la
+// disponibilidad se deriva de ellos; si no, se mantiene la que se cargó a mano.
+func aplicarEjemplares(libro Libro, total, disponibles int) Libro {
+	libro.EjemplaresTotal = total
+	libro.EjemplaresDisponibles = disponibles
+	if total > 0 {
+		libro.Disponible = disponibles > 0
+	}
+	return libro
+}
+
+// sincronizarEjemplares recalcula los conteos del libro tras un cambio en sus copias
+func (s *sucursal) sincronizarEjemplares(ctx context.Context, libroID int) {
+	total, disponibles := s.ejemplares.Resumen(libroID)
+	s.repositorio.ActualizarEjemplares(ctx, libroID, total, disponibles)
+}
+
+// Ejemplares de los libros de ejemplo
+func (s *sucursal) inicializarEjemplares() {
+	iniciales := []Ejemplar{
+		{LibroID: 1, CodigoBarras: "LIB-0001-01", Ubicacion: "A-03", Condicion: "bueno", Estado: ejemplarDisponible},
+		{LibroID: 1, CodigoBarras: "LIB-0001-02", Ubicacion: "A-03", Condicion: "regular", Estado: ejemplarPrestado},
+		{LibroID: 2, CodigoBarras: "LIB-0002-01", Ubicacion: "B-12", Condicion: "nuevo", Estado: ejemplarDisponible},
+		{LibroID: 2, CodigoBarras: "LIB-0002-02", Ubicacion: "B-12", Condicion: "bueno", Estado: ejemplarPrestado},
+		{LibroID: 2, CodigoBarras: "LIB-0002-03", Ubicacion: "B-12", Condicion: "bueno", Estado: ejemplarDisponible},
+		{LibroID: 3, CodigoBarras: "LIB-0003-01", Ubicacion: "C-01", Condicion: "dañado", Estado: ejemplarReparacion},
+	}
+	for _, ejemplar := range iniciales {
+		s.ejemplares.Crear(ejemplar)
+	}
+	s.repositorio.Reescribir(func(libro Libro) (Libro, bool) {
+		total, disponibles := s.ejemplares.Resumen(libro.ID)
+		return aplicarEjemplares(libro, total, disponibles), true
+	})
+}
+
+// HANDLERS
+
+// Valida los campos editables de un ejemplar; devuelve el mensaje de error o nil
+func validarEjemplar(ejemplar Ejemplar) *mensaje {
+	if !slices.Contains(condicionesEjemplar, ejemplar.Condicion) {
+		return nuevoMensaje(msgCondicionInvalida, strings.Join(condicionesEjemplar, ", "))
+	}
+	switch {
+	case ejemplar.Estado == ejemplarBaja:
+		return nuevoMensaje(msgBajaConDelete)
+	case ejemplar.Estado == ejemplarReservado:
+		return nuevoMensaje(msgReservaConPost)
+	case ejemplar.Estado == ejemplarPrestado:
+		return nuevoMensaje(msgPrestamoConPost)
+	case !slices.Contains(estadosEjemplarEditables, ejemplar.Estado):
+		return nuevoMensaje(msgEstadoInvalido, strings.Join(estadosEjemplarEditables, ", "))
+	}
+	return nil
+}
+
+// Busca el libro del parámetro {id}; responde el error si no existe
+func libroDeRuta(w http.ResponseWriter, r *http.Request) (Libro, bool) {
+	s := sucursalDe(r.Context())
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return Libro{}, false
+	}
+	libro, ok := s.repositorio.Obtener(r.Context(), id)
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgLibroNoEncontrado)
+		return Libro{}, false
+	}
+	return libro, true
+}
+
+// GET /api/libros/{id}/ejemplares - Ejemplares de un libro (?incluir_bajas=)
+func obtenerEjemplares(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	libro, ok := libroDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	incluirBajas, _ := strconv.ParseBool(r.URL.Query().Get("incluir_bajas"))
+	lista := s.ejemplares.DeLibro(libro.ID, incluirBajas)
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"ejemplares":  lista,
+		"total":       libro.EjemplaresTotal,
+		"disponibles": libro.EjemplaresDisponibles,
+	})
+}
+
+// POST /api/libros/{id}/ejemplares - Agregar un ejemplar al libro
+func crearEjemplar(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	libro, ok := libroDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	var nuevo Ejemplar
+	if err := decodificarJSON(w, r, &nuevo); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	nuevo.CodigoBarras = strings.TrimSpace(nuevo.CodigoBarras)
+	if !cabeceraValida(nuevo.CodigoBarras, longitudMaximaCodigo) {
+		responderError(w, r, http.StatusBadRequest, msgCodigoBarrasRequerido, longitudMaximaCodigo)
+		return
+	}
+	// Valores por defecto de una copia recién llegada
+	if nuevo.Condicion == "" {
+		nuevo.Condicion = "nuevo"
+	}
+	if nuevo.Estado == "" {
+		nuevo.Estado = ejemplarDisponible
+	}
+	if mensaje := validarEjemplar(nuevo); mensaje != nil {
+		responderMensaje(w, r, http.StatusBadRequest, mensaje)
+		return
+	}
+
+	nuevo.LibroID = libro.ID
+	nuevo.FechaAlta = time.Now()
+	nuevo.FechaBaja = nil
+	creado, err := s.ejemplares.Crear(nuevo)
+	if err != nil {
+		responderMensaje(w, r, http.StatusConflict, comoMensaje(err))
+		return
+	}
+	s.sincronizarEjemplares(r.Context(), libro.ID)
+
+	w.Header().Set("Location", fmt.Sprintf("/api/ejemplares/%d", creado.ID))
+	responderJSON(w, http.StatusCreated, creado)
+}
+
+// Busca el ejemplar del parámetro {id}; responde el error si no existe
+func ejemplarDeRuta(w http.ResponseWriter, r *http.Request) (Ejemplar, bool) {
+	s := sucursalDe(r.Context())
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return Ejemplar{}, false
+	}
+	ejemplar, ok := s.ejemplares.Obtener(id)
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgEjemplarNoEncontrado)
+		return Ejemplar{}, false
+	}
+	return ejemplar, true
+}
+
+// GET /api/ejemplares/{id} - Obtener un ejemplar
+func obtenerEjemplarPorID(w http.ResponseWriter, r *http.Request) {
+	if ejemplar, ok := ejemplarDeRuta(w, r); ok {
+		responderJSON(w, http.StatusOK, ejemplar)
+	}
+}
+
+// PUT /api/ejemplares/{id} - Cambiar ubicación, condición o estado
+func actualizarEjemplar(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	original, ok := ejemplarDeRuta(w, r)
+	if !ok {
+		return
+	}
+	if original.Estado == ejemplarBaja {
+		responderError(w, r, http.StatusConflict, msgEjemplarDeBaja)
+		return
+	}
+
+	var cambios Ejemplar
+	if err := decodificarJSON(w, r, &cambios); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	// El código de barras y el libro no cambian
+	if cambios.CodigoBarras != "" && cambios.CodigoBarras != original.CodigoBarras {
+		responderError(w, r, http.StatusBadRequest, msgCodigoBarrasInmutable)
+		return
+	}
+	// Un ejemplar apartado conserva su estado hasta que se retire o cancele la reserva
+	if original.Estado == ejemplarReservado {
+		if cambios.Estado != ejemplarReservado {
+			responderError(w, r, http.StatusConflict, msgEjemplarApartado)
+			return
+		}
+		cambios.Estado = ejemplarDisponible // Solo para validar la condición
+	}
+	// Un ejemplar prestado sigue así hasta que se devuelva el préstamo
+	if original.Estado == ejemplarPrestado {
+		if cambios.Estado != ejemplarPrestado {
+			responderError(w, r, http.StatusConflict, msgPrestamoConPost)
+			return
+		}
+		cambios.Estado = ejemplarDisponible // Solo para validar la condición
+	}
+	if mensaje := validarEjemplar(cambios); mensaje != nil {
+		responderMensaje(w, r, http.StatusBadRequest, mensaje)
+		return
+	}
+
+	// El estado se vuelve a comprobar con el lock: un préstamo o una reserva
+	// pueden haberlo tomado desde que se leyó
+	var estadoPrevio string
+	guardado, ok := s.ejemplares.Modificar(original.ID, func(e *Ejemplar) {
+		estadoPrevio = e.Estado
+		if e.Estado != original.Estado {
+			return
+		}
+		e.Ubicacion = cambios.Ubicacion
+		e.Condicion = cambios.Condicion
+		if e.Estado != ejemplarReservado && e.Estado != ejemplarPrestado {
+			e.Estado = cambios.Estado
+		}
+	})
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgEjemplarNoEncontrado)
+		return
+	}
+	if estadoPrevio != original.Estado {
+		responderError(w, r, http.StatusConflict, msgEjemplarEnEstado, estadoPrevio)
+		return
+	}
+	s.sincronizarEjemplares(r.Context(), guardado.LibroID)
+
+	responderJSON(w, http.StatusOK, guardado)
+}
+
+// DELETE /api/ejemplares/{id} - Dar de baja un ejemplar (queda en el historial)
+func eliminarEjemplar(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	original, ok := ejemplarDeRuta(w, r)
+	if !ok {
+		return
+	}
+	if original.Estado == ejemplarBaja {
+		responderError(w, r, http.StatusConflict, msgEjemplarYaDeBaja)
+		return
+	}
+	if original.Estado == ejemplarPrestado || original.Estado == ejemplarReservado {
+		responderError(w, r, http.StatusConflict, msgEjemplarEnEstado, original.Estado)
+		return
+	}
+
+	ahora := time.Now()
+	guardado, _ := s.ejemplares.Modificar(original.ID, func(e *Ejemplar) {
+		e.Estado = ejemplarBaja
+		e.FechaBaja = &ahora
+	})
+	s.sincronizarEjemplares(r.Context(), guardado.LibroID)
+
+	responderJSON(w, http.StatusOK, guardado)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// El estado prestado solo cambia con /api/prestamos: un PUT no presta ni
+// devuelve, así un ejemplar no queda prestado dos veces ni con un préstamo
+// abierto que sigue sumando multas
+func TestActualizarEjemplarNoCambiaPrestado(t *testing.T) {
+	t.Parallel()
+	srv, err := nuevoServidor(configuracionServidor{Portadas: almacenLocal{dir: t.TempDir()}, DatosEjemplo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// En los datos de ejemplo el ejemplar 1 está disponible y el 2 prestado a ana
+	casos := []struct {
+		nombre   string
+		ejemplar int
+		cuerpo   string
+		estado   int
+		codigo   codigoMensaje
+	}{
+		{"prestar con PUT", 1, `{"condicion":"bueno","estado":"prestado"}`, http.StatusBadRequest, msgPrestamoConPost},
+		{"devolver con PUT", 2, `{"condicion":"regular","estado":"disponible"}`, http.StatusConflict, msgPrestamoConPost},
+		{"a reparación con PUT", 2, `{"condicion":"dañado","estado":"reparacion"}`, http.StatusConflict, msgPrestamoConPost},
+		{"alta prestada", 0, `{"codigo_barras":"LIB-0001-09","estado":"prestado"}`, http.StatusBadRequest, msgPrestamoConPost},
+		{"editar un prestado", 2, `{"ubicacion":"A-04","condicion":"regular","estado":"prestado"}`, http.StatusOK, ""},
+		{"editar un disponible", 1, `{"ubicacion":"A-04","condicion":"bueno","estado":"reparacion"}`, http.StatusOK, ""},
+	}
+	for _, caso := range casos {
+		metodo, url := http.MethodPut, fmt.Sprintf("%s/api/ejemplares/%d", ts.URL, caso.ejemplar)
+		if caso.ejemplar == 0 {
+			metodo, url = http.MethodPost, ts.URL+"/api/libros/1/ejemplares"
+		}
+		var respuesta struct {
+			Codigo codigoMensaje `json:"codigo"`
+			Estado string        `json:"estado"`
+		}
+		if estado := pedirJSON(t, metodo, url, caso.cuerpo, &respuesta); estado != caso.estado {
+			t.Errorf("%s: %d, se esperaba %d", caso.nombre, estado, caso.estado)
+		}
+		if caso.codigo != "" && respuesta.Codigo != caso.codigo {
+			t.Errorf("%s: código %q, se esperaba %q", caso.nombre, respuesta.Codigo, caso.codigo)
+		}
+	}
+
+	var ejemplar Ejemplar
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/ejemplares/2", "", &ejemplar)
+	if ejemplar.Estado != ejemplarPrestado || ejemplar.Ubicacion != "A-04" {
+		t.Errorf("ejemplar 2 = %s en %s, se esperaba prestado en A-04", ejemplar.Estado, ejemplar.Ubicacion)
+	}
+}
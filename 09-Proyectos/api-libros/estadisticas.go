@@ -0,0 +1,340 @@
+// Estadísticas del catálogo en JSON y CSV
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cantidad de autores del ranking si no se indica ?limite=
+const limiteAutoresPorDefecto = 10
+
+// Años que puede abarcar la serie mensual (120 filas por década)
+const añosMaximosEstadisticas = 10
+
+// Resultado de un reporte: los datos para JSON y la misma tabla para CSV
+type tablaEstadistica struct {
+	Datos    interface{}
+	Columnas []string
+	Filas    [][]string
+}
+
+// Opciones de consulta comunes a los reportes
+type opcionesEstadisticas struct {
+	LimiteAutores int
+	Desde, Hasta  time.Time // Rango de la serie mensual (cero = sin límite)
+}
+
+// Reportes disponibles, indexados por el nombre de la ruta
+var reportesEstadisticas = map[string]func(*sucursal, []Libro, opcionesEstadisticas) tablaEstadistica{
+	"disponibilidad": reporteDisponibilidad,
+	"generos":        reporteGeneros,
+	"decadas":        reporteDecadas,
+	"autores":        reporteAutores,
+	"mensual":        reporteMensual,
+}
+
+// Orden de los reportes en GET /api/estadisticas y en la documentación
+var nombresReportes = []string{"disponibilidad", "generos", "decadas", "autores", "mensual"}
+
+type cantidadPorClave struct {
+	Clave  string `json:"clave"`
+	Libros int    `json:"libros"`
+}
+
+// Cuenta los libros por clave y ordena de mayor a menor (a igual cantidad, por clave)
+func contarPor(libros []Libro, clave func(Libro) string) []cantidadPorClave {
+	conteo := map[string]int{}
+	for _, libro := range libros {
+		conteo[clave(libro)]++
+	}
+	lista := []cantidadPorClave{}
+	for c, n := range conteo {
+		lista = append(lista, cantidadPorClave{c, n})
+	}
+	slices.SortFunc(lista, func(a, b cantidadPorClave) int {
+		return cmp.Or(cmp.Compare(b.Libros, a.Libros), strings.Compare(a.Clave, b.Clave))
+	})
+	return lista
+}
+
+func reporteDisponibilidad(_ *sucursal, libros []Libro, _ opcionesEstadisticas) tablaEstadistica {
+	disponibles := 0
+	for _, libro := range libros {
+		if libro.Disponible {
+			disponibles++
+		}
+	}
+	proporcion := 0.0
+	if len(libros) > 0 {
+		proporcion = math.Round(float64(disponibles)/float64(len(libros))*1000) / 1000
+	}
+
+	return tablaEstadistica{
+		Datos: map[string]interface{}{
+			"total":          len(libros),
+			"disponibles":    disponibles,
+			"no_disponibles": len(libros) - disponibles,
+			"proporcion":     proporcion,
+		},
+		Columnas: []string{"total", "disponibles", "no_disponibles", "proporcion"},
+		Filas: [][]string{{
+			strconv.Itoa(len(libros)), strconv.Itoa(disponibles), strconv.Itoa(len(libros) - disponibles),
+			strconv.FormatFloat(proporcion, 'f', 3, 64),
+		}},
+	}
+}
+
+func reporteGeneros(_ *sucursal, libros []Libro, _ opcionesEstadisticas) tablaEstadistica {
+	type fila struct {
+		Genero string `json:"genero"`
+		Libros int    `json:"libros"`
+	}
+	datos := []fila{}
+	tabla := tablaEstadistica{Columnas: []string{"genero", "libros"}}
+	for _, c := range contarPor(libros, func(l Libro) string { return l.Genero }) {
+		datos = append(datos, fila{c.Clave, c.Libros})
+		tabla.Filas = append(tabla.Filas, []string{c.Clave, strconv.Itoa(c.Libros)})
+	}
+	tabla.Datos = datos
+	return tabla
+}
+
+func reporteDecadas(_ *sucursal, libros []Libro, _ opcionesEstadisticas) tablaEstadistica {
+	type fila struct {
+		Decada int `json:"decada"`
+		Libros int `json:"libros"`
+	}
+	conteo := map[int]int{}
+	for _, libro := range libros {
+		conteo[libro.Año/10*10]++
+	}
+	datos := []fila{}
+	for decada, n := range conteo {
+		datos = append(datos, fila{decada, n})
+	}
+	slices.SortFunc(datos, func(a, b fila) int { return cmp.Compare(a.Decada, b.Decada) })
+
+	tabla := tablaEstadistica{Datos: datos, Columnas: []string{"decada", "libros"}}
+	for _, f := range datos {
+		tabla.Filas = append(tabla.Filas, []string{strconv.Itoa(f.Decada), strconv.Itoa(f.Libros)})
+	}
+	return tabla
+}
+
+func reporteAutores(s *sucursal, libros []Libro, opciones opcionesEstadisticas) tablaEstadistica {
+	type fila struct {
+		AutorID int    `json:"autor_id"`
+		Nombre  string `json:"nombre"`
+		Libros  int    `json:"libros"`
+	}
+	// Un libro con varios autores cuenta para cada uno
+	conteo := map[int]int{}
+	for _, libro := range libros {
+		for _, id := range libro.AutoresIDs {
+			conteo[id]++
+		}
+	}
+	datos := []fila{}
+	for id, n := range conteo {
+		autor, _ := s.autores.Obtener(id)
+		datos = append(datos, fila{id, autor.Nombre, n})
+	}
+	slices.SortFunc(datos, func(a, b fila) int {
+		return cmp.Or(cmp.Compare(b.Libros, a.Libros), strings.Compare(a.Nombre, b.Nombre))
+	})
+	if len(datos) > opciones.LimiteAutores {
+		datos = datos[:opciones.LimiteAutores]
+	}
+
+	tabla := tablaEstadistica{Datos: datos, Columnas: []string{"autor_id", "nombre", "libros"}}
+	for _, f := range datos {
+		tabla.Filas = append(tabla.Filas, []string{strconv.Itoa(f.AutorID), f.Nombre, strconv.Itoa(f.Libros)})
+	}
+	return tabla
+}
+
+// Altas por mes según FechaCreado, con los meses sin altas en cero
+func reporteMensual(_ *sucursal, libros []Libro, opciones opcionesEstadisticas) tablaEstadistica {
+	type fila struct {
+		Mes    string `json:"mes"` // AAAA-MM
+		Libros int    `json:"libros"`
+	}
+	mesDe := func(t time.Time) time.Time {
+		t = t.Local()
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+	}
+
+	conteo := map[time.Time]int{}
+	var primero, ultimo time.Time
+	for _, libro := range libros {
+		creado := libro.FechaCreado
+		if (!opciones.Desde.IsZero() && creado.Before(opciones.Desde)) || (!opciones.Hasta.IsZero() && creado.After(opciones.Hasta)) {
+			continue
+		}
+		mes := mesDe(creado)
+		conteo[mes]++
+		if primero.IsZero() || mes.Before(primero) {
+			primero = mes
+		}
+		if mes.After(ultimo) {
+			ultimo = mes
+		}
+	}
+	// El rango pedido manda sobre el de los datos
+	if !opciones.Desde.IsZero() {
+		primero = mesDe(opciones.Desde)
+	}
+	if !opciones.Hasta.IsZero() {
+		ultimo = mesDe(opciones.Hasta)
+	}
+
+	datos := []fila{}
+	tabla := tablaEstadistica{Columnas: []string{"mes", "libros"}}
+	for mes := primero; !primero.IsZero() && !mes.After(ultimo); mes = mes.AddDate(0, 1, 0) {
+		f := fila{mes.Format("2006-01"), conteo[mes]}
+		datos = append(datos, f)
+		tabla.Filas = append(tabla.Filas, []string{f.Mes, strconv.Itoa(f.Libros)})
+	}
+	tabla.Datos = datos
+	return tabla
+}
+
+// Lee ?limite=, ?desde= y ?hasta=; devuelve el mensaje de error o nil
+func leerOpcionesEstadisticas(r *http.Request) (opcionesEstadisticas, *mensaje) {
+	opciones := opcionesEstadisticas{LimiteAutores: limiteAutoresPorDefecto}
+	consulta := r.URL.Query()
+
+	if valor := consulta.Get("limite"); valor != "" {
+		limite, err := strconv.Atoi(valor)
+		if err != nil || limite < 1 {
+			return opciones, nuevoMensaje(msgLimiteInvalido)
+		}
+		opciones.LimiteAutores = limite
+	}
+	var err error
+	if valor := consulta.Get("desde"); valor != "" {
+		if opciones.Desde, err = parsearFechaConsulta(valor, false); err != nil {
+			return opciones, nuevoMensaje(msgFechaDesdeInvalida)
+		}
+	}
+	if valor := consulta.Get("hasta"); valor != "" {
+		if opciones.Hasta, err = parsearFechaConsulta(valor, true); err != nil {
+			return opciones, nuevoMensaje(msgFechaHastaInvalida)
+		}
+	}
+	if !opciones.Desde.IsZero() && !opciones.Hasta.IsZero() && opciones.Hasta.Before(opciones.Desde) {
+		return opciones, nuevoMensaje(msgRangoFechasInvertido)
+	}
+	// La serie mensual recorre todo el rango; el extremo que falta se toma
+	// como hoy (los datos no van más allá)
+	desde, hasta := opciones.Desde, opciones.Hasta
+	if desde.IsZero() {
+		desde = time.Now()
+	}
+	if hasta.IsZero() {
+		hasta = time.Now()
+	}
+	if (!opciones.Desde.IsZero() || !opciones.Hasta.IsZero()) && desde.AddDate(añosMaximosEstadisticas, 0, 0).Before(hasta) {
+		return opciones, nuevoMensaje(msgRangoFechasExcesivo, añosMaximosEstadisticas)
+	}
+	return opciones, nil
+}
+
+// Se pide CSV con ?formato=csv o con Accept: text/csv
+func pideCSV(r *http.Request) bool {
+	if formato := r.URL.Query().Get("formato"); formato != "" {
+		return strings.EqualFold(formato, "csv")
+	}
+	for _, tipo := range strings.Split(r.Header.Get("Accept"), ",") {
+		if medio, _, err := mime.ParseMediaType(strings.TrimSpace(tipo)); err == nil && medio == "text/csv" {
+			return true
+		}
+	}
+	return false
+}
+
+// Escribe la tabla como CSV descargable
+func responderCSV(w http.ResponseWriter, nombre string, tabla tablaEstadistica) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="estadisticas-%s.csv"`, nombre))
+	w.WriteHeader(http.StatusOK)
+
+	escritor := csv.NewWriter(w)
+	escritor.Write(tabla.Columnas)
+	for _, fila := range tabla.Filas {
+		celdas := make([]string, len(fila))
+		for i, celda := range fila {
+			celdas[i] = celdaSegura(celda)
+		}
+		escritor.Write(celdas)
+	}
+	escritor.Flush()
+}
+
+// celdaSegura evita que la planilla interprete como fórmula un título o un
+// autor que empieza con =, +, -, @ (o tabulador y retorno de carro)
+func celdaSegura(celda string) string {
+	if celda != "" && strings.ContainsRune("=+-@\t\r", rune(celda[0])) {
+		return "'" + celda
+	}
+	return celda
+}
+
+// GET /api/estadisticas - Todos los reportes en un solo JSON
+func obtenerEstadisticas(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	opciones, mensaje := leerOpcionesEstadisticas(r)
+	if mensaje != nil {
+		responderMensaje(w, r, http.StatusBadRequest, mensaje)
+		return
+	}
+	if noModificado(w, r, s.repositorio.UltimoCambio(), s.etiquetaCatalogo()) {
+		return
+	}
+
+	libros := s.repositorio.Listar(r.Context())
+	resultado := map[string]interface{}{}
+	for _, nombre := range nombresReportes {
+		resultado[nombre] = reportesEstadisticas[nombre](s, libros, opciones).Datos
+	}
+	responderJSON(w, http.StatusOK, resultado)
+}
+
+// GET /api/estadisticas/{reporte} - Un reporte en JSON o CSV (?formato=csv)
+func obtenerReporteEstadisticas(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	nombre := parametroRuta(r, "reporte")
+	reporte, ok := reportesEstadisticas[nombre]
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgReporteDesconocido, strings.Join(nombresReportes, ", "))
+		return
+	}
+	opciones, mensaje := leerOpcionesEstadisticas(r)
+	if mensaje != nil {
+		responderMensaje(w, r, http.StatusBadRequest, mensaje)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	if noModificado(w, r, s.repositorio.UltimoCambio(), s.etiquetaCatalogo()) {
+		return
+	}
+
+	tabla := reporte(s, s.repositorio.Listar(r.Context()), opciones)
+	if pideCSV(r) {
+		responderCSV(w, nombre, tabla)
+		return
+	}
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"reporte": nombre,
+		"datos":   tabla.Datos,
+	})
+}
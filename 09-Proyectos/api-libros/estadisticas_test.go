@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestLeerOpcionesEstadisticasRango(t *testing.T) {
+	t.Parallel()
+	casos := []struct {
+		consulta string
+		codigo   codigoMensaje // "" = válido
+	}{
+		{"", ""},
+		{"desde=2020-01-01&hasta=2029-12-31", ""},
+		{"desde=2020-01-01&hasta=2030-01-02", msgRangoFechasExcesivo},
+		{"desde=0001-01-01&hasta=9999-12-31", msgRangoFechasExcesivo},
+		{"desde=1900-01-01", msgRangoFechasExcesivo},
+		{"hasta=9999-12-31", msgRangoFechasExcesivo},
+		{"hasta=2000-01-01", ""},
+		{"desde=2030-01-01&hasta=2020-01-01", msgRangoFechasInvertido},
+	}
+	for _, caso := range casos {
+		r := httptest.NewRequest(http.MethodGet, "/api/estadisticas/mensual?"+caso.consulta, nil)
+		_, mensaje := leerOpcionesEstadisticas(r)
+		var codigo codigoMensaje
+		if mensaje != nil {
+			codigo = mensaje.Codigo
+		}
+		if codigo != caso.codigo {
+			t.Errorf("%q: %q, se esperaba %q", caso.consulta, codigo, caso.codigo)
+		}
+	}
+}
+
+// Los nombres que empiezan como una fórmula salen precedidos de '
+func TestCSVEstadisticasSinFormulas(t *testing.T) {
+	t.Parallel()
+	srv, err := nuevoServidor(configuracionServidor{Portadas: almacenLocal{dir: t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for _, autor := range []string{`=HYPERLINK("http://x","y")`, "@SUM(A1)", "Ana"} {
+		cuerpo := `{"titulo":"Libro","autor":` + strconv.Quote(autor) + `,"año":2000}`
+		if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/libros", cuerpo, nil); estado != http.StatusCreated {
+			t.Fatalf("POST /api/libros = %d", estado)
+		}
+	}
+	resp, err := http.Get(ts.URL + "/api/estadisticas/autores?formato=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	filas, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nombres []string
+	for _, fila := range filas[1:] {
+		nombres = append(nombres, fila[1])
+	}
+	for _, esperado := range []string{`'=HYPERLINK("http://x","y")`, "'@SUM(A1)", "Ana"} {
+		if !slices.Contains(nombres, esperado) {
+			t.Errorf("falta %q en %q", esperado, nombres)
+		}
+	}
+}
+
+func TestCeldaSegura(t *testing.T) {
+	t.Parallel()
+	casos := map[string]string{
+		"":         "",
+		"Rayuela":  "Rayuela",
+		"=1+1":     "'=1+1",
+		"+54 11":   "'+54 11",
+		"-2":       "'-2",
+		"@usuario": "'@usuario",
+		"\t=1":     "'\t=1",
+		"2024-01":  "2024-01",
+		"Año 1=1":  "Año 1=1",
+	}
+	for celda, esperado := range casos {
+		if obtenido := celdaSegura(celda); obtenido != esperado {
+			t.Errorf("celdaSegura(%q) = %q, se esperaba %q", celda, obtenido, esperado)
+		}
+	}
+}
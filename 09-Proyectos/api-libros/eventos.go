@@ -0,0 +1,124 @@
+// Difusión de cambios del catálogo a los suscriptores interesados
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Tipos de evento
+const (
+	eventoCreado      = "creado"
+	eventoActualizado = "actualizado"
+	eventoEliminado   = "eliminado"
+)
+
+// Evento de cambio en el catálogo
+type eventoLibro struct {
+	ID    int64     `json:"id"` // Secuencial, para reanudar con Last-Event-ID
+	Tipo  string    `json:"tipo"`
+	Libro Libro     `json:"libro"`
+	Fecha time.Time `json:"fecha"`
+
+	Sucursal string `json:"sucursal"`
+
+	// Estado previo, solo en las actualizaciones
+	Anterior *Libro `json:"anterior,omitempty"`
+}
+
+// Capacidad del canal de cada suscriptor
+const bufferSuscriptor = 64
+
+// Cantidad de eventos recientes que se guardan para reanudar
+const capacidadHistorial = 256
+
+// Difusor reparte cada evento publicado a todos los suscriptores (uno por sucursal)
+type difusor struct {
+	mu           sync.Mutex
+	suscriptores map[chan eventoLibro]struct{}
+	ultimoID     int64
+	historial    []eventoLibro // Últimos eventos, del más antiguo al más reciente
+}
+
+// Suscribir devuelve un canal de eventos y la función para cancelar
+func (d *difusor) Suscribir() (<-chan eventoLibro, func()) {
+	canal, _, _, cancelar := d.SuscribirDesde(-1)
+	return canal, cancelar
+}
+
+// SuscribirDesde además devuelve los eventos guardados con ID mayor a desde
+// (desde < 0 no repite nada). completo es false si alguno ya salió del historial.
+func (d *difusor) SuscribirDesde(desde int64) (canal <-chan eventoLibro, pendientes []eventoLibro, completo bool, cancelar func()) {
+	c := make(chan eventoLibro, bufferSuscriptor)
+
+	// Registrar y copiar el historial bajo el mismo lock: no se pierde ni repite nada
+	d.mu.Lock()
+	d.suscriptores[c] = struct{}{}
+	completo = true
+	if desde >= 0 {
+		for _, evento := range d.historial {
+			if evento.ID > desde {
+				pendientes = append(pendientes, evento)
+			}
+		}
+		// Un ID mayor al último indica un reinicio del servidor
+		completo = desde <= d.ultimoID && (len(pendientes) == 0 || pendientes[0].ID == desde+1)
+	}
+	d.mu.Unlock()
+
+	var una sync.Once
+	cancelar = func() {
+		una.Do(func() {
+			d.mu.Lock()
+			delete(d.suscriptores, c)
+			d.mu.Unlock()
+			close(c)
+		})
+	}
+	return c, pendientes, completo, cancelar
+}
+
+// Publicar numera el evento, lo guarda en el historial y lo envía sin
+// bloquear: un suscriptor lento pierde eventos
+func (d *difusor) Publicar(evento eventoLibro) eventoLibro {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.ultimoID++
+	evento.ID = d.ultimoID
+	if len(d.historial) == capacidadHistorial {
+		d.historial = append(d.historial[:0], d.historial[1:]...)
+	}
+	d.historial = append(d.historial, evento)
+
+	for canal := range d.suscriptores {
+		select {
+		case canal <- evento:
+		default:
+			log.Printf("Suscriptor lento: se descartó el evento %s del libro %d", evento.Tipo, evento.Libro.ID)
+		}
+	}
+	return evento
+}
+
+// publicarCambio crea el evento con la fecha actual, lo difunde y lo
+// entrega a los webhooks suscritos
+func (s *sucursal) publicarCambio(tipo string, libro Libro) {
+	s.notificarCambio(eventoLibro{Tipo: tipo, Libro: libro, Fecha: time.Now()})
+}
+
+// publicarActualizacion incluye el estado previo para detectar qué cambió
+func (s *sucursal) publicarActualizacion(anterior, libro Libro) {
+	s.notificarCambio(eventoLibro{Tipo: eventoActualizado, Libro: libro, Fecha: time.Now(), Anterior: &anterior})
+}
+
+func (s *sucursal) notificarCambio(evento eventoLibro) {
+	evento.Sucursal = s.ID
+	evento = s.eventos.Publicar(evento)
+	s.webhooks.Notificar(evento)
+	// Puede haber reservas esperando este libro
+	if evento.Libro.Disponible && evento.Libro.EliminadoEn == nil {
+		s.reservas.Avisar(evento.Libro.ID)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func nuevoDifusor() *difusor {
+	return &difusor{suscriptores: map[chan eventoLibro]struct{}{}}
+}
+
+// publicarEventos publica n eventos "creado" con libros numerados
+func publicarEventos(d *difusor, n int) {
+	for range n {
+		d.Publicar(eventoLibro{Tipo: eventoCreado, Libro: Libro{ID: int(d.ultimoID) + 1}, Fecha: time.Now()})
+	}
+}
+
+// El historial guarda los últimos 256 eventos; pedir desde antes indica
+// que faltan eventos
+func TestSuscribirDesdeHistorial(t *testing.T) {
+	t.Parallel()
+	d := nuevoDifusor()
+	publicarEventos(d, 300) // El historial queda con 45..300
+
+	casos := []struct {
+		desde          int64
+		primero, total int
+		completo       bool
+	}{
+		{-1, 0, 0, true},     // Sin Last-Event-ID: solo lo nuevo
+		{300, 0, 0, true},    // Al día
+		{250, 251, 50, true}, // Dentro del historial
+		{44, 45, 256, true},  // Justo el más antiguo guardado
+		{43, 45, 256, false}, // El 44 ya salió del historial
+		{0, 45, 256, false},
+		{500, 0, 0, false}, // Posterior al último: el servidor se reinició
+	}
+	for _, caso := range casos {
+		_, pendientes, completo, cancelar := d.SuscribirDesde(caso.desde)
+		cancelar()
+		if len(pendientes) != caso.total || completo != caso.completo {
+			t.Errorf("desde %d: %d pendientes (completo %v), se esperaban %d (completo %v)", caso.desde, len(pendientes), completo, caso.total, caso.completo)
+			continue
+		}
+		for i, evento := range pendientes {
+			if evento.ID != int64(caso.primero+i) {
+				t.Errorf("desde %d: el pendiente %d tiene ID %d", caso.desde, i, evento.ID)
+				break
+			}
+		}
+	}
+}
+
+// Publicar no se bloquea con un suscriptor que no lee: descarta lo que
+// no entra en su buffer y los demás reciben todo
+func TestSuscriptorLentoNoBloquea(t *testing.T) {
+	t.Parallel()
+	d := nuevoDifusor()
+	lento, cancelarLento := d.Suscribir()
+	defer cancelarLento()
+	rapido, cancelarRapido := d.Suscribir()
+	defer cancelarRapido()
+
+	recibidos := make(chan int)
+	go func() {
+		n := 0
+		for range rapido {
+			n++
+		}
+		recibidos <- n
+	}()
+
+	publicado := make(chan struct{})
+	go func() {
+		publicarEventos(d, bufferSuscriptor*3)
+		close(publicado)
+	}()
+	select {
+	case <-publicado:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publicar se bloqueó con un suscriptor lento")
+	}
+
+	if len(lento) != bufferSuscriptor {
+		t.Errorf("el suscriptor lento tiene %d eventos, se esperaba el buffer lleno (%d)", len(lento), bufferSuscriptor)
+	}
+	cancelarRapido()
+	if n := <-recibidos; n < bufferSuscriptor {
+		t.Errorf("el suscriptor rápido recibió %d eventos", n)
+	}
+}
+
+// eventoSSE es un evento leído del flujo
+type eventoSSE struct {
+	id, tipo, datos string
+}
+
+// leerEventosSSE lee n eventos del flujo (sin contar retry ni latidos)
+func leerEventosSSE(t *testing.T, lector *bufio.Reader, n int) []eventoSSE {
+	t.Helper()
+	var eventos []eventoSSE
+	var actual eventoSSE
+	for len(eventos) < n {
+		linea, err := lector.ReadString('\n')
+		if err != nil {
+			t.Fatalf("flujo cortado después de %d eventos: %v", len(eventos), err)
+		}
+		linea = strings.TrimSuffix(linea, "\n")
+		switch {
+		case linea == "":
+			if actual.tipo != "" {
+				eventos = append(eventos, actual)
+			}
+			actual = eventoSSE{}
+		case strings.HasPrefix(linea, "id: "):
+			actual.id = strings.TrimPrefix(linea, "id: ")
+		case strings.HasPrefix(linea, "event: "):
+			actual.tipo = strings.TrimPrefix(linea, "event: ")
+		case strings.HasPrefix(linea, "data: "):
+			actual.datos = strings.TrimPrefix(linea, "data: ")
+		}
+	}
+	return eventos
+}
+
+// abrirSSE abre el flujo con la cabecera Last-Event-ID (vacía = sin ella)
+func abrirSSE(t *testing.T, url, ultimo string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	ctx, cancelar := context.WithCancel(context.Background())
+	t.Cleanup(cancelar)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if ultimo != "" {
+		req.Header.Set("Last-Event-ID", ultimo)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// Reanudar con Last-Event-ID (o ?desde=) repite lo que falta y sigue en vivo;
+// si el hueco ya no está en el historial avisa con "desincronizado"
+func TestSSEReanuda(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+	s := srv.sucursales.PorDefecto()
+	publicarEventos(s.eventos, 300)
+
+	resp, lector := abrirSSE(t, ts.URL+"/api/libros/eventos", "297")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /api/libros/eventos = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if linea, _ := lector.ReadString('\n'); linea != "retry: 3000\n" {
+		t.Errorf("primera línea %q", linea)
+	}
+	eventos := leerEventosSSE(t, lector, 3)
+	for i, evento := range eventos {
+		if evento.id != strconv.Itoa(298+i) || evento.tipo != eventoCreado {
+			t.Errorf("evento %d: %+v", i, evento)
+		}
+	}
+	var libro eventoLibro
+	if err := json.Unmarshal([]byte(eventos[2].datos), &libro); err != nil || libro.ID != 300 || libro.Libro.ID != 300 {
+		t.Errorf("datos del evento 300: %s (%v)", eventos[2].datos, err)
+	}
+
+	// Después de la repetición llegan los eventos nuevos
+	publicarEventos(s.eventos, 1)
+	if vivo := leerEventosSSE(t, lector, 1)[0]; vivo.id != "301" {
+		t.Errorf("evento en vivo: %+v", vivo)
+	}
+
+	// Fuera del historial: aviso y después lo que queda guardado
+	_, lector = abrirSSE(t, ts.URL+"/api/libros/eventos?desde=10", "")
+	eventos = leerEventosSSE(t, lector, 2)
+	if eventos[0].tipo != "desincronizado" || eventos[0].id != "" || eventos[1].id != "46" {
+		t.Errorf("desde 10: %+v", eventos)
+	}
+
+	if estado := pedirJSON(t, http.MethodGet, ts.URL+"/api/libros/eventos?desde=abc", "", nil); estado != http.StatusBadRequest {
+		t.Errorf("?desde=abc = %d", estado)
+	}
+}
+
+// escritorBloqueante es un ResponseWriter cuyas escrituras esperan mientras
+// el test lo pida, para simular un cliente que no lee
+type escritorBloqueante struct {
+	cabeceras  http.Header
+	mu         sync.Mutex
+	datos      bytes.Buffer
+	escrituras int           // Llamadas a Write, incluidas las que esperan
+	paso       chan struct{} // Cerrado = escritura libre
+}
+
+func (e *escritorBloqueante) Header() http.Header { return e.cabeceras }
+func (e *escritorBloqueante) WriteHeader(int)     {}
+func (e *escritorBloqueante) Flush()              {}
+
+func (e *escritorBloqueante) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	e.escrituras++
+	paso := e.paso
+	e.mu.Unlock()
+	<-paso
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.datos.Write(p)
+}
+
+// leer devuelve la cantidad de llamadas a Write y lo escrito hasta ahora
+func (e *escritorBloqueante) leer() (int, string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.escrituras, e.datos.String()
+}
+
+// Un suscriptor SSE que se atrasa más que su buffer pierde eventos y el
+// servidor corta el flujo en lugar de saltearlos; al reconectar con
+// Last-Event-ID los recupera del historial
+func TestSSECortaSuscriptorLento(t *testing.T) {
+	t.Parallel()
+	srv, _ := servidorPrueba(t)
+	s := srv.sucursales.PorDefecto()
+
+	abierto := make(chan struct{})
+	close(abierto)
+	w := &escritorBloqueante{cabeceras: http.Header{}, paso: abierto}
+	r := httptest.NewRequest(http.MethodGet, "/api/libros/eventos", nil)
+	r = r.WithContext(context.WithValue(r.Context(), claveServidor{}, srv))
+
+	terminado := make(chan struct{})
+	go func() {
+		defer close(terminado)
+		transmitirEventos(w, r)
+	}()
+	esperarHasta(t, "la suscripción", func() bool { n, _ := w.leer(); return n > 0 })
+
+	// El cliente deja de leer: el handler queda trabado con el evento 1 y
+	// el buffer se llena con 2..65; el 66 se descarta
+	cerrado := make(chan struct{})
+	w.mu.Lock()
+	w.paso = cerrado
+	antes := w.escrituras
+	w.mu.Unlock()
+	publicarEventos(s.eventos, 1)
+	esperarHasta(t, "el handler trabado", func() bool { n, _ := w.leer(); return n > antes })
+	publicarEventos(s.eventos, bufferSuscriptor+1)
+	close(cerrado)
+	esperarHasta(t, "el evento 65", func() bool { _, salida := w.leer(); return strings.Contains(salida, "id: 65\n") })
+
+	// El 67 llega después del hueco: el handler termina sin escribirlo
+	publicarEventos(s.eventos, 1)
+	select {
+	case <-terminado:
+	case <-time.After(5 * time.Second):
+		t.Fatal("el flujo no se cortó después de perder eventos")
+	}
+	if _, salida := w.leer(); strings.Contains(salida, "id: 66\n") || strings.Contains(salida, "id: 67\n") {
+		t.Errorf("el flujo cortado debía terminar en el evento 65:\n%s", salida[max(0, len(salida)-300):])
+	}
+
+	_, pendientes, completo, cancelar := s.eventos.SuscribirDesde(65)
+	cancelar()
+	if !completo || len(pendientes) != 2 || pendientes[0].ID != 66 {
+		t.Errorf("al reconectar: %d pendientes (completo %v)", len(pendientes), completo)
+	}
+}
@@ -0,0 +1,308 @@
+// Taxonomía de géneros: un árbol administrado en lugar de texto libre
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Nodo del árbol de géneros. Los nombres son únicos en todo el árbol, así
+// Libro.Genero sigue siendo un texto que identifica un solo nodo.
+type Genero struct {
+	ID      int    `json:"id"`
+	Nombre  string `json:"nombre"`
+	PadreID *int   `json:"padre_id,omitempty"` // nil en las raíces
+}
+
+// Repositorio de géneros protegido con mutex (se toma después del de libros)
+type repositorioGeneros struct {
+	mu         sync.RWMutex
+	generos    []Genero
+	contadorID int
+	version    uint64 // Sube con cada cambio del árbol (para el ETag del catálogo)
+}
+
+// Árbol inicial: raíz -> subgéneros
+var generosIniciales = []struct {
+	Nombre     string
+	Subgeneros []string
+}{
+	{"Ficción", []string{"Realismo mágico", "Distopía", "Ciencia ficción", "Fantasía", "Policial"}},
+	{"Clásico", nil},
+	{"No ficción", []string{"Ensayo", "Biografía", "Historia"}},
+	{"Poesía", nil},
+}
+
+// Listar devuelve una copia de todos los géneros
+func (r *repositorioGeneros) Listar() []Genero {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.generos)
+}
+
+// Version devuelve un número que cambia con cada alta o baja de géneros
+func (r *repositorioGeneros) Version() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+// Obtener busca un género por su ID
+func (r *repositorioGeneros) Obtener(id int) (Genero, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, genero := range r.generos {
+		if genero.ID == id {
+			return genero, true
+		}
+	}
+	return Genero{}, false
+}
+
+// Buscar encuentra un género por nombre sin distinguir acentos ni mayúsculas
+func (r *repositorioGeneros) Buscar(nombre string) (Genero, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.buscar(nombre)
+}
+
+func (r *repositorioGeneros) buscar(nombre string) (Genero, bool) {
+	clave := claveGenero(nombre)
+	for _, genero := range r.generos {
+		if claveGenero(genero.Nombre) == clave {
+			return genero, true
+		}
+	}
+	return Genero{}, false
+}
+
+// Crear agrega un género; falla si el nombre existe o el padre no
+func (r *repositorioGeneros) Crear(genero Genero) (Genero, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existente, ok := r.buscar(genero.Nombre); ok {
+		return Genero{}, nuevoMensaje(msgGeneroDuplicado, existente.ID, existente.Nombre)
+	}
+	if genero.PadreID != nil && !slices.ContainsFunc(r.generos, func(g Genero) bool { return g.ID == *genero.PadreID }) {
+		return Genero{}, nuevoMensaje(msgGeneroPadreInexistente, *genero.PadreID)
+	}
+	genero.ID = r.contadorID
+	r.contadorID++
+	r.generos = append(r.generos, genero)
+	r.version++
+	return genero, nil
+}
+
+// Eliminar borra un género sin subgéneros
+func (r *repositorioGeneros) Eliminar(id int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	indice := slices.IndexFunc(r.generos, func(g Genero) bool { return g.ID == id })
+	if indice < 0 {
+		return false
+	}
+	r.generos = slices.Delete(r.generos, indice, indice+1)
+	r.version++
+	return true
+}
+
+// Descendientes devuelve los nombres del género y de todos sus subgéneros
+func (r *repositorioGeneros) Descendientes(id int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var nombres []string
+	pendientes := []int{id}
+	for len(pendientes) > 0 {
+		actual := pendientes[0]
+		pendientes = pendientes[1:]
+		for _, genero := range r.generos {
+			if genero.ID == actual {
+				nombres = append(nombres, genero.Nombre)
+			}
+			if genero.PadreID != nil && *genero.PadreID == actual {
+				pendientes = append(pendientes, genero.ID)
+			}
+		}
+	}
+	return nombres
+}
+
+// Clave de comparación: "Ciencia Ficcion" y "ciencia ficción" son el mismo género
+func claveGenero(nombre string) string {
+	return strings.Join(tokensNombre(nombre), " ")
+}
+
+// Valida que el género del libro exista; devuelve el mensaje de error o nil
+func (s *sucursal) validarGeneroLibro(libro Libro) *mensaje {
+	if libro.Genero == "" {
+		return nil
+	}
+	if _, ok := s.generos.Buscar(libro.Genero); !ok {
+		return nuevoMensaje(msgGeneroDesconocido, libro.Genero)
+	}
+	return nil
+}
+
+// canonizarGenero reemplaza el género del libro por el nombre registrado
+func (s *sucursal) canonizarGenero(libro Libro) Libro {
+	if genero, ok := s.generos.Buscar(libro.Genero); ok {
+		libro.Genero = genero.Nombre
+	}
+	return libro
+}
+
+// coincideGenero arma el filtro de ?genero=: el género pedido y sus
+// subgéneros. Un nombre que no está en el árbol se compara tal cual.
+func (s *sucursal) coincideGenero(genero string) func(Libro) bool {
+	nodo, ok := s.generos.Buscar(genero)
+	if !ok {
+		return func(libro Libro) bool { return strings.EqualFold(libro.Genero, genero) }
+	}
+	nombres := s.generos.Descendientes(nodo.ID)
+	return func(libro Libro) bool { return slices.Contains(nombres, libro.Genero) }
+}
+
+// inicializarGeneros carga el árbol inicial y agrega como raíces los
+// géneros de libros que no estén en él, para no dejar libros inválidos
+func (s *sucursal) inicializarGeneros(ctx context.Context) {
+	for _, raiz := range generosIniciales {
+		padre, err := s.generos.Crear(Genero{Nombre: raiz.Nombre})
+		if err != nil {
+			continue
+		}
+		for _, nombre := range raiz.Subgeneros {
+			s.generos.Crear(Genero{Nombre: nombre, PadreID: &padre.ID})
+		}
+	}
+
+	var agregados []string
+	for _, libro := range s.repositorio.ListarConEliminados(ctx) {
+		if s.validarGeneroLibro(libro) == nil {
+			continue
+		}
+		if nuevo, err := s.generos.Crear(Genero{Nombre: strings.TrimSpace(libro.Genero)}); err == nil {
+			agregados = append(agregados, nuevo.Nombre)
+		}
+	}
+	s.repositorio.Reescribir(func(libro Libro) (Libro, bool) {
+		canonico := s.canonizarGenero(libro)
+		return canonico, canonico.Genero != libro.Genero
+	})
+
+	if len(agregados) > 0 {
+		log.Printf("Géneros agregados desde los libros existentes: %s", strings.Join(agregados, ", "))
+	}
+}
+
+// HANDLERS
+
+// Nodo del árbol con conteo de libros
+type nodoGenero struct {
+	Genero
+	Libros      int          `json:"libros"`       // Libros de este género
+	LibrosTotal int          `json:"libros_total"` // Incluyendo los subgéneros
+	Subgeneros  []nodoGenero `json:"subgeneros"`
+}
+
+// arbolGeneros arma los nodos hijos de padre con sus conteos
+func arbolGeneros(lista []Genero, padre *int, porGenero map[string]int) []nodoGenero {
+	nodos := []nodoGenero{}
+	for _, genero := range lista {
+		if (genero.PadreID == nil) != (padre == nil) || (padre != nil && *genero.PadreID != *padre) {
+			continue
+		}
+		nodo := nodoGenero{Genero: genero, Libros: porGenero[genero.Nombre]}
+		nodo.Subgeneros = arbolGeneros(lista, &genero.ID, porGenero)
+		nodo.LibrosTotal = nodo.Libros
+		for _, hijo := range nodo.Subgeneros {
+			nodo.LibrosTotal += hijo.LibrosTotal
+		}
+		nodos = append(nodos, nodo)
+	}
+	return nodos
+}
+
+// GET /api/generos - Árbol de géneros con la cantidad de libros de cada nodo
+func obtenerGeneros(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+
+	// No cuentan los libros de la papelera
+	porGenero := map[string]int{}
+	for _, libro := range s.repositorio.Listar(r.Context()) {
+		porGenero[libro.Genero]++
+	}
+
+	lista := s.generos.Listar()
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"generos": arbolGeneros(lista, nil, porGenero),
+		"total":   len(lista),
+	})
+}
+
+// POST /api/generos - Crear género (padre_id para un subgénero)
+func crearGenero(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	var nuevo Genero
+	if err := decodificarJSON(w, r, &nuevo); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	nuevo.Nombre = strings.TrimSpace(nuevo.Nombre)
+	if nuevo.Nombre == "" {
+		responderError(w, r, http.StatusBadRequest, msgNombreRequerido)
+		return
+	}
+
+	if existente, ok := s.generos.Buscar(nuevo.Nombre); ok {
+		responderError(w, r, http.StatusConflict, msgGeneroDuplicado, existente.ID, existente.Nombre)
+		return
+	}
+	creado, err := s.generos.Crear(nuevo)
+	if err != nil {
+		responderMensaje(w, r, http.StatusBadRequest, comoMensaje(err))
+		return
+	}
+	responderJSON(w, http.StatusCreated, creado)
+}
+
+// DELETE /api/generos/{id} - Eliminar un género sin subgéneros ni libros
+func eliminarGenero(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return
+	}
+	genero, ok := s.generos.Obtener(id)
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgGeneroNoEncontrado)
+		return
+	}
+
+	if len(s.generos.Descendientes(id)) > 1 {
+		responderError(w, r, http.StatusConflict, msgGeneroConSubgeneros)
+		return
+	}
+	for _, libro := range s.repositorio.ListarConEliminados(r.Context()) {
+		if libro.Genero == genero.Nombre {
+			responderError(w, r, http.StatusConflict, msgGeneroConLibros)
+			return
+		}
+	}
+
+	if !s.generos.Eliminar(id) {
+		responderError(w, r, http.StatusNotFound, msgGeneroNoEncontrado)
+		return
+	}
+	responderJSON(w, http.StatusOK, map[string]string{
+		"mensaje": traducir(r.Context(), msgGeneroEliminado),
+	})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+)
+
+// arbolActual pide GET /api/generos
+func arbolActual(t *testing.T, url string) []nodoGenero {
+	t.Helper()
+	var respuesta struct {
+		Generos []nodoGenero `json:"generos"`
+	}
+	if estado := pedirJSON(t, http.MethodGet, url+"/api/generos", "", &respuesta); estado != http.StatusOK {
+		t.Fatalf("GET /api/generos = %d", estado)
+	}
+	return respuesta.Generos
+}
+
+// buscarNodo recorre el árbol hasta el género con ese nombre
+func buscarNodo(nodos []nodoGenero, nombre string) (nodoGenero, bool) {
+	for _, nodo := range nodos {
+		if nodo.Nombre == nombre {
+			return nodo, true
+		}
+		if encontrado, ok := buscarNodo(nodo.Subgeneros, nombre); ok {
+			return encontrado, true
+		}
+	}
+	return nodoGenero{}, false
+}
+
+// titulosDe devuelve los títulos del listado filtrado, ordenados
+func titulosDe(t *testing.T, url string) []string {
+	t.Helper()
+	var titulos []string
+	for _, libro := range listarIDs(t, url) {
+		titulos = append(titulos, libro.Titulo)
+	}
+	sort.Strings(titulos)
+	return titulos
+}
+
+// El árbol cuenta los libros de cada nodo y, en libros_total, los de sus
+// subgéneros; los de la papelera no cuentan
+func TestGenerosArbolConConteos(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	arbol := arbolActual(t, ts.URL)
+	if len(arbol) != len(generosIniciales) {
+		t.Fatalf("%d raíces, se esperaban %d", len(arbol), len(generosIniciales))
+	}
+	ficcion, _ := buscarNodo(arbol, "Ficción")
+	if ficcion.PadreID != nil || ficcion.Libros != 0 || ficcion.LibrosTotal != 2 || len(ficcion.Subgeneros) != 5 {
+		t.Errorf("Ficción: %d libros, %d en total, %d subgéneros", ficcion.Libros, ficcion.LibrosTotal, len(ficcion.Subgeneros))
+	}
+	distopia, _ := buscarNodo(arbol, "Distopía")
+	if distopia.PadreID == nil || *distopia.PadreID != ficcion.ID || distopia.Libros != 1 || distopia.LibrosTotal != 1 {
+		t.Errorf("Distopía: %+v", distopia.Genero)
+	}
+
+	pedirJSON(t, http.MethodDelete, ts.URL+"/api/libros/2", "", nil)
+	arbol = arbolActual(t, ts.URL)
+	if ficcion, _ := buscarNodo(arbol, "Ficción"); ficcion.LibrosTotal != 1 {
+		t.Errorf("Ficción cuenta %d libros con 1984 en la papelera", ficcion.LibrosTotal)
+	}
+}
+
+// Los libros deben usar un género del árbol; se acepta sin acentos ni
+// mayúsculas y se guarda con el nombre registrado
+func TestGenerosValidanLibros(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	var libro Libro
+	if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/libros", `{"titulo":"Fundación","autor":"Isaac Asimov","año":1951,"genero":"ciencia FICCION"}`, &libro); estado != http.StatusCreated {
+		t.Fatalf("POST con el género sin acentos = %d", estado)
+	}
+	if libro.Genero != "Ciencia ficción" {
+		t.Errorf("género guardado %q, se esperaba el registrado", libro.Genero)
+	}
+
+	casos := []struct {
+		metodo, ruta string
+	}{
+		{http.MethodPost, "/api/libros"},
+		{http.MethodPut, fmt.Sprintf("/api/libros/%d", libro.ID)},
+	}
+	for _, caso := range casos {
+		var respuesta struct {
+			Codigo codigoMensaje `json:"codigo"`
+		}
+		estado := pedirJSON(t, caso.metodo, ts.URL+caso.ruta, `{"titulo":"Fundación","autor":"Isaac Asimov","año":1951,"genero":"Ficcion cientifica"}`, &respuesta)
+		if estado != http.StatusBadRequest || respuesta.Codigo != msgGeneroDesconocido {
+			t.Errorf("%s %s con un género inexistente: %d %q", caso.metodo, caso.ruta, estado, respuesta.Codigo)
+		}
+	}
+}
+
+// Filtrar por un género incluye todos sus descendientes
+func TestGenerosFiltroIncluyeSubgeneros(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	distopia, _ := buscarNodo(arbolActual(t, ts.URL), "Distopía")
+	var ucronia Genero
+	if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/generos", fmt.Sprintf(`{"nombre":"Ucronía","padre_id":%d}`, distopia.ID), &ucronia); estado != http.StatusCreated {
+		t.Fatalf("POST /api/generos = %d", estado)
+	}
+	pedirJSON(t, http.MethodPost, ts.URL+"/api/libros", `{"titulo":"El hombre en el castillo","autor":"Philip K. Dick","año":1962,"genero":"Ucronía"}`, nil)
+
+	casos := map[string][]string{
+		"Ficción":  {"1984", "Cien años de soledad", "El hombre en el castillo"},
+		"ficcion":  {"1984", "Cien años de soledad", "El hombre en el castillo"},
+		"Distopía": {"1984", "El hombre en el castillo"},
+		"Ucronía":  {"El hombre en el castillo"},
+		"Clásico":  {"El Quijote"},
+		"Ensayo":   nil,
+	}
+	for genero, esperados := range casos {
+		if titulos := titulosDe(t, ts.URL+"/api/libros?genero="+genero); fmt.Sprint(titulos) != fmt.Sprint(esperados) {
+			t.Errorf("?genero=%s: %q, se esperaba %q", genero, titulos, esperados)
+		}
+	}
+	if ficcion, _ := buscarNodo(arbolActual(t, ts.URL), "Ficción"); ficcion.LibrosTotal != 3 {
+		t.Errorf("Ficción cuenta %d libros con el nieto", ficcion.LibrosTotal)
+	}
+}
+
+// Altas y bajas del árbol: nombres únicos, padre existente y solo se
+// borran hojas sin libros (tampoco en la papelera)
+func TestGenerosCrearYEliminar(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+	arbol := arbolActual(t, ts.URL)
+	ficcion, _ := buscarNodo(arbol, "Ficción")
+	clasico, _ := buscarNodo(arbol, "Clásico")
+
+	altas := []struct {
+		cuerpo string
+		estado int
+		codigo codigoMensaje
+	}{
+		{`{"nombre":"DISTOPIA"}`, http.StatusConflict, msgGeneroDuplicado},
+		{`{"nombre":"Terror","padre_id":999}`, http.StatusBadRequest, msgGeneroPadreInexistente},
+		{`{"nombre":"  "}`, http.StatusBadRequest, msgNombreRequerido},
+	}
+	for _, alta := range altas {
+		var respuesta struct {
+			Codigo codigoMensaje `json:"codigo"`
+		}
+		if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/generos", alta.cuerpo, &respuesta); estado != alta.estado || respuesta.Codigo != alta.codigo {
+			t.Errorf("POST %s: %d %q, se esperaba %d %q", alta.cuerpo, estado, respuesta.Codigo, alta.estado, alta.codigo)
+		}
+	}
+
+	var terror Genero
+	pedirJSON(t, http.MethodPost, ts.URL+"/api/generos", `{"nombre":" Terror "}`, &terror)
+	if terror.Nombre != "Terror" || terror.PadreID != nil {
+		t.Errorf("género creado: %+v", terror)
+	}
+
+	pedirJSON(t, http.MethodDelete, ts.URL+"/api/libros/3", "", nil) // El Quijote a la papelera
+	bajas := []struct {
+		id     int
+		estado int
+		codigo codigoMensaje
+	}{
+		{ficcion.ID, http.StatusConflict, msgGeneroConSubgeneros},
+		{clasico.ID, http.StatusConflict, msgGeneroConLibros},
+		{999, http.StatusNotFound, msgGeneroNoEncontrado},
+		{terror.ID, http.StatusOK, ""},
+		{terror.ID, http.StatusNotFound, msgGeneroNoEncontrado},
+	}
+	for _, baja := range bajas {
+		var respuesta struct {
+			Codigo codigoMensaje `json:"codigo"`
+		}
+		if estado := pedirJSON(t, http.MethodDelete, fmt.Sprintf("%s/api/generos/%d", ts.URL, baja.id), "", &respuesta); estado != baja.estado || respuesta.Codigo != baja.codigo {
+			t.Errorf("DELETE /api/generos/%d: %d %q, se esperaba %d %q", baja.id, estado, respuesta.Codigo, baja.estado, baja.codigo)
+		}
+	}
+	if _, ok := buscarNodo(arbolActual(t, ts.URL), "Terror"); ok {
+		t.Error("el género borrado sigue en el árbol")
+	}
+}
@@ -0,0 +1,5 @@
+module github.com/mat1520/Aprende-Go/09-Proyectos/api-libros
+
+go 1.24
+
+require github.com/andybalholm/brotli v1.2.6
@@ -0,0 +1,1746 @@
+// Endpoint GraphQL para libros
+// Implementación mínima del lenguaje: lexer, parser, ejecutor con fragmentos,
+// variables, directivas @skip/@include, introspección y límites de profundidad
+// y complejidad. Usa el mismo repositorio que los handlers REST.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Límites para evitar consultas abusivas
+const (
+	profundidadMaximaGQL = 10
+	complejidadMaximaGQL = 1000
+	primerosPorDefecto   = 20
+	primerosMaximo       = 100
+	tamañoListaEstimado  = 10
+
+	// Se controlan al parsear, antes del análisis: un documento muy anidado
+	// agotaría la pila y miles de alias multiplican la respuesta
+	anidamientoMaximoGQL = 64
+	aliasMaximosGQL      = 30
+)
+
+// SISTEMA DE TIPOS
+
+// Referencia a un tipo: con nombre o un modificador LIST / NON_NULL
+type tipoRef struct {
+	Modificador string // "LIST", "NON_NULL" o "" para un tipo con nombre
+	Nombre      string
+	De          *tipoRef
+}
+
+func nombrado(nombre string) *tipoRef { return &tipoRef{Nombre: nombre} }
+func noNulo(t *tipoRef) *tipoRef      { return &tipoRef{Modificador: "NON_NULL", De: t} }
+func listaDe(t *tipoRef) *tipoRef     { return &tipoRef{Modificador: "LIST", De: t} }
+
+// Nombre del tipo sin modificadores
+func (t *tipoRef) base() string {
+	for t.Modificador != "" {
+		t = t.De
+	}
+	return t.Nombre
+}
+
+func (t *tipoRef) String() string {
+	switch t.Modificador {
+	case "NON_NULL":
+		return t.De.String() + "!"
+	case "LIST":
+		return "[" + t.De.String() + "]"
+	}
+	return t.Nombre
+}
+
+// Argumento de un campo o campo de un input
+type argumentoGQL struct {
+	Nombre      string
+	Descripcion string
+	Tipo        *tipoRef
+	Defecto     interface{}
+}
+
+// Función que calcula el valor de un campo
+type resolverGQL func(ctx context.Context, padre interface{}, args map[string]interface{}) (interface{}, error)
+
+type campoGQL struct {
+	Nombre      string
+	Descripcion string
+	Args        []argumentoGQL
+	Tipo        *tipoRef
+	Resolver    resolverGQL
+}
+
+type tipoGQL struct {
+	Tipo          string // OBJECT, SCALAR, INPUT_OBJECT o ENUM
+	Nombre        string
+	Descripcion   string
+	Campos        []*campoGQL
+	CamposEntrada []argumentoGQL
+	ValoresEnum   []string
+	Meta          []*campoGQL // Campos implícitos (__schema, __type) que no se listan
+}
+
+func (t *tipoGQL) campo(nombre string) *campoGQL {
+	for _, c := range t.Campos {
+		if c.Nombre == nombre {
+			return c
+		}
+	}
+	for _, c := range t.Meta {
+		if c.Nombre == nombre {
+			return c
+		}
+	}
+	return nil
+}
+
+type directivaGQL struct {
+	Nombre      string
+	Descripcion string
+	Ubicaciones []string
+	Args        []argumentoGQL
+}
+
+type esquemaGQL struct {
+	Tipos       map[string]*tipoGQL
+	Orden       []string
+	Query       string
+	Mutation    string
+	Directivas  []*directivaGQL
+	Descripcion string
+}
+
+func (e *esquemaGQL) agregar(tipos ...*tipoGQL) {
+	for _, t := range tipos {
+		e.Tipos[t.Nombre] = t
+		e.Orden = append(e.Orden, t.Nombre)
+	}
+}
+
+// ESQUEMA DE LA API
+
+// Cursor opaco para la paginación
+func cursorLibro(id int) string {
+	return base64.StdEncoding.EncodeToString([]byte("libro:" + strconv.Itoa(id)))
+}
+
+func idDeCursor(cursor string) (int, error) {
+	datos, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(datos), "libro:") {
+		return 0, nuevoMensaje(msgGQLCursorInvalido)
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(string(datos), "libro:"))
+	if err != nil {
+		return 0, nuevoMensaje(msgGQLCursorInvalido)
+	}
+	return id, nil
+}
+
+// Campo de Libro que solo lee un atributo
+func campoLibro(nombre string, tipo *tipoRef, valor func(Libro) interface{}) *campoGQL {
+	return &campoGQL{
+		Nombre: nombre,
+		Tipo:   tipo,
+		Resolver: func(_ context.Context, padre interface{}, _ map[string]interface{}) (interface{}, error) {
+			return valor(padre.(Libro)), nil
+		},
+	}
+}
+
+// Convierte el argumento ID (string) a entero
+func argumentoID(args map[string]interface{}) (int, error) {
+	id, err := strconv.Atoi(fmt.Sprint(args["id"]))
+	if err != nil {
+		return 0, nuevoMensaje(msgIDInvalido)
+	}
+	return id, nil
+}
+
+// Construye un Libro a partir de LibroInput
+func libroDesdeInput(input map[string]interface{}) (Libro, *mensaje) {
+	return aplicarLibroInput(Libro{}, input)
+}
+
+// aplicarLibroInput copia en el libro los campos de LibroInput; los
+// opcionales que no se envían conservan el valor actual
+func aplicarLibroInput(libro Libro, input map[string]interface{}) (Libro, *mensaje) {
+	libro.Titulo = input["titulo"].(string)
+	libro.Año = input["anio"].(int)
+	if ids, ok := input["autoresIds"].([]interface{}); ok {
+		// Con IDs el texto del autor se deriva de ellos
+		libro.AutoresIDs = make([]int, 0, len(ids))
+		for _, valor := range ids {
+			id, err := strconv.Atoi(valor.(string))
+			if err != nil {
+				return Libro{}, nuevoMensaje(msgIDInvalido)
+			}
+			libro.AutoresIDs = append(libro.AutoresIDs, id)
+		}
+	} else if autor, ok := input["autor"].(string); ok {
+		// Se vuelve a vincular por el texto (el repositorio conserva los
+		// vínculos si no cambió)
+		libro.Autor = autor
+		libro.AutoresIDs = nil
+	}
+	if genero, ok := input["genero"].(string); ok {
+		libro.Genero = genero
+	}
+	if disponible, ok := input["disponible"].(bool); ok {
+		libro.Disponible = disponible
+	}
+	return libro, nil
+}
+
+// Página de resultados para LibroConnection
+type paginaLibros struct {
+	Libros       []Libro
+	Total        int
+	HaySiguiente bool
+}
+
+func nuevoEsquemaLibros() *esquemaGQL {
+	e := &esquemaGQL{
+		Tipos:       map[string]*tipoGQL{},
+		Query:       "Query",
+		Mutation:    "Mutation",
+		Descripcion: "API de Libros",
+	}
+
+	for _, escalar := range []string{"ID", "String", "Int", "Float", "Boolean"} {
+		e.agregar(&tipoGQL{Tipo: "SCALAR", Nombre: escalar})
+	}
+
+	libro := &tipoGQL{Tipo: "OBJECT", Nombre: "Libro", Descripcion: "Un libro del catálogo"}
+	libro.Campos = []*campoGQL{
+		campoLibro("id", noNulo(nombrado("ID")), func(l Libro) interface{} { return strconv.Itoa(l.ID) }),
+		campoLibro("titulo", noNulo(nombrado("String")), func(l Libro) interface{} { return l.Titulo }),
+		campoLibro("autor", noNulo(nombrado("String")), func(l Libro) interface{} { return l.Autor }),
+		campoLibro("autoresIds", noNulo(listaDe(noNulo(nombrado("ID")))), func(l Libro) interface{} {
+			ids := make([]interface{}, len(l.AutoresIDs))
+			for i, id := range l.AutoresIDs {
+				ids[i] = strconv.Itoa(id)
+			}
+			return ids
+		}),
+		campoLibro("anio", noNulo(nombrado("Int")), func(l Libro) interface{} { return l.Año }),
+		campoLibro("genero", noNulo(nombrado("String")), func(l Libro) interface{} { return l.Genero }),
+		campoLibro("disponible", noNulo(nombrado("Boolean")), func(l Libro) interface{} { return l.Disponible }),
+		campoLibro("fechaCreado", noNulo(nombrado("String")), func(l Libro) interface{} { return l.FechaCreado.Format("2006-01-02T15:04:05Z07:00") }),
+		{
+			Nombre:      "delMismoAutor",
+			Descripcion: "Otros libros que comparten algún autor",
+			Tipo:        noNulo(listaDe(noNulo(nombrado("Libro")))),
+			Resolver: func(ctx context.Context, padre interface{}, _ map[string]interface{}) (interface{}, error) {
+				s := sucursalDe(ctx)
+				actual := padre.(Libro)
+				var otros []interface{}
+				for _, l := range s.repositorio.Listar(ctx) {
+					comparten := slices.ContainsFunc(l.AutoresIDs, func(id int) bool {
+						return slices.Contains(actual.AutoresIDs, id)
+					})
+					if l.ID != actual.ID && comparten {
+						otros = append(otros, l)
+					}
+				}
+				return otros, nil
+			},
+		},
+	}
+
+	borde := &tipoGQL{Tipo: "OBJECT", Nombre: "LibroEdge"}
+	borde.Campos = []*campoGQL{
+		campoLibro("cursor", noNulo(nombrado("String")), func(l Libro) interface{} { return cursorLibro(l.ID) }),
+		campoLibro("node", noNulo(nombrado("Libro")), func(l Libro) interface{} { return l }),
+	}
+
+	infoPagina := &tipoGQL{Tipo: "OBJECT", Nombre: "PageInfo"}
+	infoPagina.Campos = []*campoGQL{
+		{Nombre: "hasNextPage", Tipo: noNulo(nombrado("Boolean")), Resolver: func(_ context.Context, padre interface{}, _ map[string]interface{}) (interface{}, error) {
+			return padre.(paginaLibros).HaySiguiente, nil
+		}},
+		{Nombre: "endCursor", Tipo: nombrado("String"), Resolver: func(_ context.Context, padre interface{}, _ map[string]interface{}) (interface{}, error) {
+			p := padre.(paginaLibros)
+			if len(p.Libros) == 0 {
+				return nil, nil
+			}
+			return cursorLibro(p.Libros[len(p.Libros)-1].ID), nil
+		}},
+	}
+
+	conexion := &tipoGQL{Tipo: "OBJECT", Nombre: "LibroConnection"}
+	conexion.Campos = []*campoGQL{
+		{Nombre: "edges", Tipo: noNulo(listaDe(noNulo(nombrado("LibroEdge")))), Resolver: func(_ context.Context, padre interface{}, _ map[string]interface{}) (interface{}, error) {
+			return aInterfaces(padre.(paginaLibros).Libros), nil
+		}},
+		{Nombre: "nodes", Tipo: noNulo(listaDe(noNulo(nombrado("Libro")))), Resolver: func(_ context.Context, padre interface{}, _ map[string]interface{}) (interface{}, error) {
+			return aInterfaces(padre.(paginaLibros).Libros), nil
+		}},
+		{Nombre: "pageInfo", Tipo: noNulo(nombrado("PageInfo")), Resolver: func(_ context.Context, padre interface{}, _ map[string]interface{}) (interface{}, error) {
+			return padre, nil
+		}},
+		{Nombre: "totalCount", Tipo: noNulo(nombrado("Int")), Resolver: func(_ context.Context, padre interface{}, _ map[string]interface{}) (interface{}, error) {
+			return padre.(paginaLibros).Total, nil
+		}},
+	}
+
+	entrada := &tipoGQL{Tipo: "INPUT_OBJECT", Nombre: "LibroInput", CamposEntrada: []argumentoGQL{
+		{Nombre: "titulo", Tipo: noNulo(nombrado("String"))},
+		{Nombre: "autor", Tipo: nombrado("String")},
+		{Nombre: "autoresIds", Tipo: listaDe(noNulo(nombrado("ID")))},
+		{Nombre: "anio", Tipo: noNulo(nombrado("Int"))},
+		{Nombre: "genero", Tipo: nombrado("String")},
+		{Nombre: "disponible", Tipo: nombrado("Boolean")},
+	}}
+
+	query := &tipoGQL{Tipo: "OBJECT", Nombre: "Query"}
+	query.Campos = []*campoGQL{
+		{
+			Nombre:      "libros",
+			Descripcion: "Libros con filtros y paginación por cursor",
+			Args: []argumentoGQL{
+				{Nombre: "genero", Tipo: nombrado("String")},
+				{Nombre: "disponible", Tipo: nombrado("Boolean")},
+				{Nombre: "first", Tipo: nombrado("Int"), Defecto: primerosPorDefecto},
+				{Nombre: "after", Tipo: nombrado("String")},
+			},
+			Tipo:     noNulo(nombrado("LibroConnection")),
+			Resolver: resolverLibros,
+		},
+		{
+			Nombre: "libro",
+			Args:   []argumentoGQL{{Nombre: "id", Tipo: noNulo(nombrado("ID"))}},
+			Tipo:   nombrado("Libro"),
+			Resolver: func(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				s := sucursalDe(ctx)
+				id, err := argumentoID(args)
+				if err != nil {
+					return nil, err
+				}
+				if libro, ok := s.repositorio.Obtener(ctx, id); ok {
+					return libro, nil
+				}
+				return nil, nil
+			},
+		},
+	}
+
+	mutation := &tipoGQL{Tipo: "OBJECT", Nombre: "Mutation"}
+	mutation.Campos = []*campoGQL{
+		{
+			Nombre: "crearLibro",
+			Args:   []argumentoGQL{{Nombre: "input", Tipo: noNulo(nombrado("LibroInput"))}},
+			Tipo:   noNulo(nombrado("Libro")),
+			Resolver: func(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				s := sucursalDe(ctx)
+				libro, mensaje := libroDesdeInput(args["input"].(map[string]interface{}))
+				if mensaje == nil {
+					mensaje = s.validarLibroNuevo(libro)
+				}
+				if mensaje != nil {
+					return nil, mensaje
+				}
+				return s.registrarLibroNuevo(ctx, libro), nil
+			},
+		},
+		{
+			Nombre: "actualizarLibro",
+			Args: []argumentoGQL{
+				{Nombre: "id", Tipo: noNulo(nombrado("ID"))},
+				{Nombre: "input", Tipo: noNulo(nombrado("LibroInput"))},
+			},
+			Tipo: noNulo(nombrado("Libro")),
+			Resolver: func(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				s := sucursalDe(ctx)
+				id, err := argumentoID(args)
+				if err != nil {
+					return nil, err
+				}
+				original, ok := s.repositorio.Obtener(ctx, id)
+				if !ok {
+					return nil, nuevoMensaje(msgLibroNoEncontrado)
+				}
+				libro, mensaje := aplicarLibroInput(original, args["input"].(map[string]interface{}))
+				if mensaje == nil {
+					mensaje = s.validarLibro(libro)
+				}
+				if mensaje != nil {
+					return nil, mensaje
+				}
+				actualizado, ok := s.repositorio.Actualizar(ctx, libro)
+				if !ok {
+					return nil, nuevoMensaje(msgLibroNoEncontrado)
+				}
+				return actualizado, nil
+			},
+		},
+		{
+			Nombre: "eliminarLibro",
+			Args:   []argumentoGQL{{Nombre: "id", Tipo: noNulo(nombrado("ID"))}},
+			Tipo:   noNulo(nombrado("Boolean")),
+			Resolver: func(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				s := sucursalDe(ctx)
+				id, err := argumentoID(args)
+				if err != nil {
+					return nil, err
+				}
+				if !s.repositorio.Eliminar(ctx, id) {
+					return nil, nuevoMensaje(msgLibroNoEncontrado)
+				}
+				return true, nil
+			},
+		},
+	}
+
+	e.agregar(libro, borde, infoPagina, conexion, entrada, query, mutation)
+	agregarIntrospeccion(e)
+	return e
+}
+
+// Query.libros: mismos filtros que GET /api/libros más paginación
+func resolverLibros(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	s := sucursalDe(ctx)
+	genero, _ := args["genero"].(string)
+	disponible := ""
+	if valor, ok := args["disponible"].(bool); ok {
+		disponible = strconv.FormatBool(valor)
+	}
+	libros := s.filtrarLibros(s.repositorio.Listar(ctx), genero, disponible)
+
+	primeros := args["first"].(int)
+	if primeros < 0 || primeros > primerosMaximo {
+		return nil, nuevoMensaje(msgGQLFirstFueraDeRango, primerosMaximo)
+	}
+
+	inicio := 0
+	if after, ok := args["after"].(string); ok {
+		id, err := idDeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		inicio = len(libros)
+		for i, libro := range libros {
+			if libro.ID > id {
+				inicio = i
+				break
+			}
+		}
+	}
+
+	fin := inicio + primeros
+	if fin > len(libros) {
+		fin = len(libros)
+	}
+	return paginaLibros{
+		Libros:       libros[inicio:fin],
+		Total:        len(libros),
+		HaySiguiente: fin < len(libros),
+	}, nil
+}
+
+func aInterfaces(libros []Libro) []interface{} {
+	resultado := make([]interface{}, len(libros))
+	for i, l := range libros {
+		resultado[i] = l
+	}
+	return resultado
+}
+
+// INTROSPECCIÓN
+
+// El esquema se describe a sí mismo con los tipos __Schema, __Type, etc.
+func agregarIntrospeccion(e *esquemaGQL) {
+	e.Directivas = []*directivaGQL{
+		{
+			Nombre:      "skip",
+			Descripcion: "Omite el campo si el argumento es verdadero",
+			Ubicaciones: []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+			Args:        []argumentoGQL{{Nombre: "if", Tipo: noNulo(nombrado("Boolean"))}},
+		},
+		{
+			Nombre:      "include",
+			Descripcion: "Incluye el campo solo si el argumento es verdadero",
+			Ubicaciones: []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+			Args:        []argumentoGQL{{Nombre: "if", Tipo: noNulo(nombrado("Boolean"))}},
+		},
+	}
+
+	// Atajo para resolvers que solo leen del padre
+	leer := func(f func(interface{}) interface{}) resolverGQL {
+		return func(_ context.Context, padre interface{}, _ map[string]interface{}) (interface{}, error) {
+			return f(padre), nil
+		}
+	}
+	textoONulo := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	incluirObsoletos := []argumentoGQL{{Nombre: "includeDeprecated", Tipo: nombrado("Boolean"), Defecto: false}}
+
+	tipoEsquema := &tipoGQL{Tipo: "OBJECT", Nombre: "__Schema", Campos: []*campoGQL{
+		{Nombre: "description", Tipo: nombrado("String"), Resolver: leer(func(p interface{}) interface{} { return textoONulo(p.(*esquemaGQL).Descripcion) })},
+		{Nombre: "types", Tipo: noNulo(listaDe(noNulo(nombrado("__Type")))), Resolver: leer(func(p interface{}) interface{} {
+			var tipos []interface{}
+			for _, nombre := range p.(*esquemaGQL).Orden {
+				tipos = append(tipos, nombrado(nombre))
+			}
+			return tipos
+		})},
+		{Nombre: "queryType", Tipo: noNulo(nombrado("__Type")), Resolver: leer(func(p interface{}) interface{} { return nombrado(p.(*esquemaGQL).Query) })},
+		{Nombre: "mutationType", Tipo: nombrado("__Type"), Resolver: leer(func(p interface{}) interface{} { return nombrado(p.(*esquemaGQL).Mutation) })},
+		{Nombre: "subscriptionType", Tipo: nombrado("__Type"), Resolver: leer(func(interface{}) interface{} { return nil })},
+		{Nombre: "directives", Tipo: noNulo(listaDe(noNulo(nombrado("__Directive")))), Resolver: leer(func(p interface{}) interface{} {
+			var directivas []interface{}
+			for _, d := range p.(*esquemaGQL).Directivas {
+				directivas = append(directivas, d)
+			}
+			return directivas
+		})},
+	}}
+
+	// Los valores de __Type son *tipoRef; los tipos con nombre se buscan en el esquema
+	definicion := func(p interface{}) *tipoGQL {
+		t := p.(*tipoRef)
+		if t.Modificador != "" {
+			return nil
+		}
+		return e.Tipos[t.Nombre]
+	}
+	tipoTipo := &tipoGQL{Tipo: "OBJECT", Nombre: "__Type", Campos: []*campoGQL{
+		{Nombre: "kind", Tipo: noNulo(nombrado("__TypeKind")), Resolver: leer(func(p interface{}) interface{} {
+			if d := definicion(p); d != nil {
+				return d.Tipo
+			}
+			return p.(*tipoRef).Modificador
+		})},
+		{Nombre: "name", Tipo: nombrado("String"), Resolver: leer(func(p interface{}) interface{} { return textoONulo(p.(*tipoRef).Nombre) })},
+		{Nombre: "description", Tipo: nombrado("String"), Resolver: leer(func(p interface{}) interface{} {
+			if d := definicion(p); d != nil {
+				return textoONulo(d.Descripcion)
+			}
+			return nil
+		})},
+		{Nombre: "specifiedByURL", Tipo: nombrado("String"), Resolver: leer(func(interface{}) interface{} { return nil })},
+		{Nombre: "fields", Args: incluirObsoletos, Tipo: listaDe(noNulo(nombrado("__Field"))), Resolver: leer(func(p interface{}) interface{} {
+			d := definicion(p)
+			if d == nil || d.Tipo != "OBJECT" {
+				return nil
+			}
+			campos := []interface{}{}
+			for _, c := range d.Campos {
+				campos = append(campos, c)
+			}
+			return campos
+		})},
+		{Nombre: "interfaces", Tipo: listaDe(noNulo(nombrado("__Type"))), Resolver: leer(func(p interface{}) interface{} {
+			if d := definicion(p); d != nil && d.Tipo == "OBJECT" {
+				return []interface{}{}
+			}
+			return nil
+		})},
+		{Nombre: "possibleTypes", Tipo: listaDe(noNulo(nombrado("__Type"))), Resolver: leer(func(interface{}) interface{} { return nil })},
+		{Nombre: "enumValues", Args: incluirObsoletos, Tipo: listaDe(noNulo(nombrado("__EnumValue"))), Resolver: leer(func(p interface{}) interface{} {
+			d := definicion(p)
+			if d == nil || d.Tipo != "ENUM" {
+				return nil
+			}
+			valores := []interface{}{}
+			for _, v := range d.ValoresEnum {
+				valores = append(valores, v)
+			}
+			return valores
+		})},
+		{Nombre: "inputFields", Tipo: listaDe(noNulo(nombrado("__InputValue"))), Resolver: leer(func(p interface{}) interface{} {
+			d := definicion(p)
+			if d == nil || d.Tipo != "INPUT_OBJECT" {
+				return nil
+			}
+			campos := []interface{}{}
+			for _, c := range d.CamposEntrada {
+				campos = append(campos, c)
+			}
+			return campos
+		})},
+		{Nombre: "ofType", Tipo: nombrado("__Type"), Resolver: leer(func(p interface{}) interface{} {
+			if de := p.(*tipoRef).De; de != nil {
+				return de
+			}
+			return nil
+		})},
+	}}
+
+	argumentos := func(args []argumentoGQL) interface{} {
+		lista := []interface{}{}
+		for _, a := range args {
+			lista = append(lista, a)
+		}
+		return lista
+	}
+	tipoCampo := &tipoGQL{Tipo: "OBJECT", Nombre: "__Field", Campos: []*campoGQL{
+		{Nombre: "name", Tipo: noNulo(nombrado("String")), Resolver: leer(func(p interface{}) interface{} { return p.(*campoGQL).Nombre })},
+		{Nombre: "description", Tipo: nombrado("String"), Resolver: leer(func(p interface{}) interface{} { return textoONulo(p.(*campoGQL).Descripcion) })},
+		{Nombre: "args", Tipo: noNulo(listaDe(noNulo(nombrado("__InputValue")))), Resolver: leer(func(p interface{}) interface{} { return argumentos(p.(*campoGQL).Args) })},
+		{Nombre: "type", Tipo: noNulo(nombrado("__Type")), Resolver: leer(func(p interface{}) interface{} { return p.(*campoGQL).Tipo })},
+		{Nombre: "isDeprecated", Tipo: noNulo(nombrado("Boolean")), Resolver: leer(func(interface{}) interface{} { return false })},
+		{Nombre: "deprecationReason", Tipo: nombrado("String"), Resolver: leer(func(interface{}) interface{} { return nil })},
+	}}
+
+	tipoValorEntrada := &tipoGQL{Tipo: "OBJECT", Nombre: "__InputValue", Campos: []*campoGQL{
+		{Nombre: "name", Tipo: noNulo(nombrado("String")), Resolver: leer(func(p interface{}) interface{} { return p.(argumentoGQL).Nombre })},
+		{Nombre: "description", Tipo: nombrado("String"), Resolver: leer(func(p interface{}) interface{} { return textoONulo(p.(argumentoGQL).Descripcion) })},
+		{Nombre: "type", Tipo: noNulo(nombrado("__Type")), Resolver: leer(func(p interface{}) interface{} { return p.(argumentoGQL).Tipo })},
+		{Nombre: "defaultValue", Tipo: nombrado("String"), Resolver: leer(func(p interface{}) interface{} {
+			if d := p.(argumentoGQL).Defecto; d != nil {
+				texto, _ := json.Marshal(d)
+				return string(texto)
+			}
+			return nil
+		})},
+		{Nombre: "isDeprecated", Tipo: noNulo(nombrado("Boolean")), Resolver: leer(func(interface{}) interface{} { return false })},
+		{Nombre: "deprecationReason", Tipo: nombrado("String"), Resolver: leer(func(interface{}) interface{} { return nil })},
+	}}
+
+	tipoValorEnum := &tipoGQL{Tipo: "OBJECT", Nombre: "__EnumValue", Campos: []*campoGQL{
+		{Nombre: "name", Tipo: noNulo(nombrado("String")), Resolver: leer(func(p interface{}) interface{} { return p })},
+		{Nombre: "description", Tipo: nombrado("String"), Resolver: leer(func(interface{}) interface{} { return nil })},
+		{Nombre: "isDeprecated", Tipo: noNulo(nombrado("Boolean")), Resolver: leer(func(interface{}) interface{} { return false })},
+		{Nombre: "deprecationReason", Tipo: nombrado("String"), Resolver: leer(func(interface{}) interface{} { return nil })},
+	}}
+
+	tipoDirectiva := &tipoGQL{Tipo: "OBJECT", Nombre: "__Directive", Campos: []*campoGQL{
+		{Nombre: "name", Tipo: noNulo(nombrado("String")), Resolver: leer(func(p interface{}) interface{} { return p.(*directivaGQL).Nombre })},
+		{Nombre: "description", Tipo: nombrado("String"), Resolver: leer(func(p interface{}) interface{} { return textoONulo(p.(*directivaGQL).Descripcion) })},
+		{Nombre: "isRepeatable", Tipo: noNulo(nombrado("Boolean")), Resolver: leer(func(interface{}) interface{} { return false })},
+		{Nombre: "locations", Tipo: noNulo(listaDe(noNulo(nombrado("__DirectiveLocation")))), Resolver: leer(func(p interface{}) interface{} {
+			var ubicaciones []interface{}
+			for _, u := range p.(*directivaGQL).Ubicaciones {
+				ubicaciones = append(ubicaciones, u)
+			}
+			return ubicaciones
+		})},
+		{Nombre: "args", Tipo: noNulo(listaDe(noNulo(nombrado("__InputValue")))), Resolver: leer(func(p interface{}) interface{} { return argumentos(p.(*directivaGQL).Args) })},
+	}}
+
+	tipoClase := &tipoGQL{Tipo: "ENUM", Nombre: "__TypeKind", ValoresEnum: []string{
+		"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL",
+	}}
+	tipoUbicacion := &tipoGQL{Tipo: "ENUM", Nombre: "__DirectiveLocation", ValoresEnum: []string{
+		"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT",
+	}}
+
+	e.agregar(tipoEsquema, tipoTipo, tipoCampo, tipoValorEntrada, tipoValorEnum, tipoDirectiva, tipoClase, tipoUbicacion)
+
+	// Campos meta disponibles en Query
+	query := e.Tipos[e.Query]
+	query.Meta = append(query.Meta,
+		&campoGQL{Nombre: "__schema", Tipo: noNulo(nombrado("__Schema")), Resolver: leer(func(interface{}) interface{} { return e })},
+		&campoGQL{
+			Nombre: "__type",
+			Args:   []argumentoGQL{{Nombre: "name", Tipo: noNulo(nombrado("String"))}},
+			Tipo:   nombrado("__Type"),
+			Resolver: func(_ context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				nombre := args["name"].(string)
+				if _, ok := e.Tipos[nombre]; !ok {
+					return nil, nil
+				}
+				return nombrado(nombre), nil
+			},
+		},
+	)
+}
+
+// LEXER
+
+type tokenGQL struct {
+	Tipo  string // "punt", "nombre", "int", "float", "cadena", "fin"
+	Texto string
+	Pos   int
+}
+
+func tokenizarGQL(fuente string) ([]tokenGQL, error) {
+	var tokens []tokenGQL
+	i := 0
+	for i < len(fuente) {
+		c := fuente[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(fuente) && fuente[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(fuente[i:], "..."):
+			tokens = append(tokens, tokenGQL{"punt", "...", i})
+			i += 3
+		case strings.ContainsRune("!$()[]{}:=@|&", rune(c)):
+			tokens = append(tokens, tokenGQL{"punt", string(c), i})
+			i++
+		case c == '_' || (c|0x20 >= 'a' && c|0x20 <= 'z'):
+			inicio := i
+			for i < len(fuente) && (fuente[i] == '_' || (fuente[i]|0x20 >= 'a' && fuente[i]|0x20 <= 'z') || (fuente[i] >= '0' && fuente[i] <= '9')) {
+				i++
+			}
+			tokens = append(tokens, tokenGQL{"nombre", fuente[inicio:i], inicio})
+		case c == '-' || (c >= '0' && c <= '9'):
+			inicio := i
+			tipo := "int"
+			i++
+			for i < len(fuente) && strings.IndexByte("0123456789.eE+-", fuente[i]) >= 0 {
+				if strings.IndexByte(".eE", fuente[i]) >= 0 {
+					tipo = "float"
+				}
+				i++
+			}
+			tokens = append(tokens, tokenGQL{tipo, fuente[inicio:i], inicio})
+		case c == '"':
+			texto, fin, err := leerCadenaGQL(fuente, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tokenGQL{"cadena", texto, i})
+			i = fin
+		default:
+			return nil, nuevoMensaje(msgGQLCaracterInesperado, c, i)
+		}
+	}
+	return append(tokens, tokenGQL{"fin", "", len(fuente)}), nil
+}
+
+// Lee una cadena "..." o un bloque """...""" y devuelve su valor
+func leerCadenaGQL(fuente string, inicio int) (string, int, error) {
+	if strings.HasPrefix(fuente[inicio:], `"""`) {
+		fin := strings.Index(fuente[inicio+3:], `"""`)
+		if fin < 0 {
+			return "", 0, nuevoMensaje(msgGQLBloqueSinCerrar, inicio)
+		}
+		return strings.TrimSpace(fuente[inicio+3 : inicio+3+fin]), inicio + 6 + fin, nil
+	}
+
+	for i := inicio + 1; i < len(fuente); i++ {
+		switch fuente[i] {
+		case '\\':
+			i++
+		case '\n':
+			return "", 0, nuevoMensaje(msgGQLCadenaSinCerrar, inicio)
+		case '"':
+			var valor string
+			if err := json.Unmarshal([]byte(fuente[inicio:i+1]), &valor); err != nil {
+				return "", 0, nuevoMensaje(msgGQLCadenaInvalida, inicio)
+			}
+			return valor, i + 1, nil
+		}
+	}
+	return "", 0, nuevoMensaje(msgGQLCadenaSinCerrar, inicio)
+}
+
+// PARSER
+
+type valorGQL struct {
+	Tipo   string // variable, int, float, string, boolean, null, enum, list, object
+	Texto  string
+	Lista  []valorGQL
+	Objeto map[string]valorGQL
+}
+
+type directivaUso struct {
+	Nombre     string
+	Argumentos map[string]valorGQL
+}
+
+type seleccionGQL struct {
+	// Campo
+	Alias       string
+	Nombre      string
+	Argumentos  map[string]valorGQL
+	Selecciones []seleccionGQL
+
+	// Fragmentos: Fragmento para "...Nombre", EsInline para "... on Tipo { }"
+	Fragmento     string
+	EsInline      bool
+	CondicionTipo string
+
+	Directivas []directivaUso
+}
+
+func (s seleccionGQL) clave() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Nombre
+}
+
+type variableGQL struct {
+	Nombre  string
+	Tipo    *tipoRef
+	Defecto *valorGQL
+}
+
+type operacionGQL struct {
+	Tipo        string // query o mutation
+	Nombre      string
+	Variables   []variableGQL
+	Selecciones []seleccionGQL
+}
+
+type fragmentoGQL struct {
+	Nombre        string
+	CondicionTipo string
+	Selecciones   []seleccionGQL
+}
+
+type documentoGQL struct {
+	Operaciones []*operacionGQL
+	Fragmentos  map[string]*fragmentoGQL
+}
+
+type parserGQL struct {
+	tokens      []tokenGQL
+	pos         int
+	anidamiento int
+}
+
+func (p *parserGQL) actual() tokenGQL { return p.tokens[p.pos] }
+
+func (p *parserGQL) es(texto string) bool {
+	t := p.actual()
+	return (t.Tipo == "punt" || t.Tipo == "nombre") && t.Texto == texto
+}
+
+func (p *parserGQL) esperar(texto string) error {
+	if !p.es(texto) {
+		return p.error(nuevoMensaje(msgGQLSeEsperaba, texto))
+	}
+	p.pos++
+	return nil
+}
+
+// error describe lo que se esperaba y dónde; el detalle se traduce junto
+// con el mensaje
+func (p *parserGQL) error(esperado *mensaje) error {
+	t := p.actual()
+	if t.Tipo == "fin" {
+		return nuevoMensaje(msgGQLSintaxisFin, esperado)
+	}
+	return nuevoMensaje(msgGQLSintaxis, esperado, t.Texto, t.Pos)
+}
+
+func (p *parserGQL) nombre() (string, error) {
+	t := p.actual()
+	if t.Tipo != "nombre" {
+		return "", p.error(nuevoMensaje(msgGQLSeEsperabaNombre))
+	}
+	p.pos++
+	return t.Texto, nil
+}
+
+// entrar cuenta un nivel de anidamiento (conjunto de selección, lista u
+// objeto literal, tipo lista); cada llamada va con un defer p.salir()
+func (p *parserGQL) entrar() error {
+	p.anidamiento++
+	if p.anidamiento > anidamientoMaximoGQL {
+		return nuevoMensaje(msgGQLAnidamiento, anidamientoMaximoGQL, p.actual().Pos)
+	}
+	return nil
+}
+
+func (p *parserGQL) salir() { p.anidamiento-- }
+
+func parsearGQL(fuente string) (*documentoGQL, error) {
+	tokens, err := tokenizarGQL(fuente)
+	if err != nil {
+		return nil, nuevoMensaje(msgGQLSintaxisLexica, comoMensaje(err))
+	}
+	p := &parserGQL{tokens: tokens}
+	doc := &documentoGQL{Fragmentos: map[string]*fragmentoGQL{}}
+
+	for p.actual().Tipo != "fin" {
+		switch {
+		case p.es("{"):
+			selecciones, err := p.conjuntoSeleccion()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operaciones = append(doc.Operaciones, &operacionGQL{Tipo: "query", Selecciones: selecciones})
+		case p.es("query") || p.es("mutation") || p.es("subscription"):
+			op, err := p.operacion()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operaciones = append(doc.Operaciones, op)
+		case p.es("fragment"):
+			f, err := p.fragmento()
+			if err != nil {
+				return nil, err
+			}
+			doc.Fragmentos[f.Nombre] = f
+		default:
+			return nil, p.error(nuevoMensaje(msgGQLSeEsperabaOperacion))
+		}
+	}
+	return doc, nil
+}
+
+func (p *parserGQL) operacion() (*operacionGQL, error) {
+	op := &operacionGQL{Tipo: p.actual().Texto}
+	p.pos++
+
+	if p.actual().Tipo == "nombre" {
+		op.Nombre, _ = p.nombre()
+	}
+
+	if p.es("(") {
+		p.pos++
+		for !p.es(")") {
+			if err := p.esperar("$"); err != nil {
+				return nil, err
+			}
+			nombre, err := p.nombre()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.esperar(":"); err != nil {
+				return nil, err
+			}
+			tipo, err := p.tipo()
+			if err != nil {
+				return nil, err
+			}
+			variable := variableGQL{Nombre: nombre, Tipo: tipo}
+			if p.es("=") {
+				p.pos++
+				defecto, err := p.valor()
+				if err != nil {
+					return nil, err
+				}
+				variable.Defecto = &defecto
+			}
+			op.Variables = append(op.Variables, variable)
+		}
+		p.pos++
+	}
+
+	if _, err := p.directivas(); err != nil {
+		return nil, err
+	}
+	selecciones, err := p.conjuntoSeleccion()
+	if err != nil {
+		return nil, err
+	}
+	op.Selecciones = selecciones
+	return op, nil
+}
+
+func (p *parserGQL) fragmento() (*fragmentoGQL, error) {
+	p.pos++ // fragment
+	nombre, err := p.nombre()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.esperar("on"); err != nil {
+		return nil, err
+	}
+	condicion, err := p.nombre()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.directivas(); err != nil {
+		return nil, err
+	}
+	selecciones, err := p.conjuntoSeleccion()
+	if err != nil {
+		return nil, err
+	}
+	return &fragmentoGQL{Nombre: nombre, CondicionTipo: condicion, Selecciones: selecciones}, nil
+}
+
+func (p *parserGQL) tipo() (*tipoRef, error) {
+	defer p.salir()
+	if err := p.entrar(); err != nil {
+		return nil, err
+	}
+	var t *tipoRef
+	if p.es("[") {
+		p.pos++
+		interno, err := p.tipo()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.esperar("]"); err != nil {
+			return nil, err
+		}
+		t = listaDe(interno)
+	} else {
+		nombre, err := p.nombre()
+		if err != nil {
+			return nil, err
+		}
+		t = nombrado(nombre)
+	}
+	if p.es("!") {
+		p.pos++
+		t = noNulo(t)
+	}
+	return t, nil
+}
+
+func (p *parserGQL) conjuntoSeleccion() ([]seleccionGQL, error) {
+	defer p.salir()
+	if err := p.entrar(); err != nil {
+		return nil, err
+	}
+	if err := p.esperar("{"); err != nil {
+		return nil, err
+	}
+	var selecciones []seleccionGQL
+	alias := 0
+	for !p.es("}") {
+		if p.actual().Tipo == "fin" {
+			return nil, p.error(nuevoMensaje(msgGQLSeEsperaba, "}"))
+		}
+		inicio := p.actual().Pos
+		sel, err := p.seleccion()
+		if err != nil {
+			return nil, err
+		}
+		if sel.Alias != "" {
+			if alias++; alias > aliasMaximosGQL {
+				return nil, nuevoMensaje(msgGQLDemasiadosAlias, aliasMaximosGQL, inicio)
+			}
+		}
+		selecciones = append(selecciones, sel)
+	}
+	p.pos++
+	return selecciones, nil
+}
+
+func (p *parserGQL) seleccion() (seleccionGQL, error) {
+	var sel seleccionGQL
+	var err error
+
+	if p.es("...") {
+		p.pos++
+		switch {
+		case p.es("on"):
+			p.pos++
+			sel.EsInline = true
+			if sel.CondicionTipo, err = p.nombre(); err != nil {
+				return sel, err
+			}
+		case p.actual().Tipo == "nombre":
+			sel.Fragmento, _ = p.nombre()
+		default:
+			sel.EsInline = true
+		}
+		if sel.Directivas, err = p.directivas(); err != nil {
+			return sel, err
+		}
+		if sel.EsInline {
+			sel.Selecciones, err = p.conjuntoSeleccion()
+		}
+		return sel, err
+	}
+
+	if sel.Nombre, err = p.nombre(); err != nil {
+		return sel, err
+	}
+	if p.es(":") {
+		p.pos++
+		sel.Alias = sel.Nombre
+		if sel.Nombre, err = p.nombre(); err != nil {
+			return sel, err
+		}
+	}
+	if sel.Argumentos, err = p.argumentos(); err != nil {
+		return sel, err
+	}
+	if sel.Directivas, err = p.directivas(); err != nil {
+		return sel, err
+	}
+	if p.es("{") {
+		sel.Selecciones, err = p.conjuntoSeleccion()
+	}
+	return sel, err
+}
+
+func (p *parserGQL) argumentos() (map[string]valorGQL, error) {
+	argumentos := map[string]valorGQL{}
+	if !p.es("(") {
+		return argumentos, nil
+	}
+	p.pos++
+	for !p.es(")") {
+		nombre, err := p.nombre()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.esperar(":"); err != nil {
+			return nil, err
+		}
+		valor, err := p.valor()
+		if err != nil {
+			return nil, err
+		}
+		argumentos[nombre] = valor
+	}
+	p.pos++
+	return argumentos, nil
+}
+
+func (p *parserGQL) directivas() ([]directivaUso, error) {
+	var directivas []directivaUso
+	for p.es("@") {
+		p.pos++
+		nombre, err := p.nombre()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.argumentos()
+		if err != nil {
+			return nil, err
+		}
+		directivas = append(directivas, directivaUso{Nombre: nombre, Argumentos: args})
+	}
+	return directivas, nil
+}
+
+func (p *parserGQL) valor() (valorGQL, error) {
+	defer p.salir()
+	if err := p.entrar(); err != nil {
+		return valorGQL{}, err
+	}
+	t := p.actual()
+	switch {
+	case p.es("$"):
+		p.pos++
+		nombre, err := p.nombre()
+		return valorGQL{Tipo: "variable", Texto: nombre}, err
+	case p.es("["):
+		p.pos++
+		v := valorGQL{Tipo: "list"}
+		for !p.es("]") {
+			elemento, err := p.valor()
+			if err != nil {
+				return v, err
+			}
+			v.Lista = append(v.Lista, elemento)
+		}
+		p.pos++
+		return v, nil
+	case p.es("{"):
+		p.pos++
+		v := valorGQL{Tipo: "object", Objeto: map[string]valorGQL{}}
+		for !p.es("}") {
+			nombre, err := p.nombre()
+			if err != nil {
+				return v, err
+			}
+			if err := p.esperar(":"); err != nil {
+				return v, err
+			}
+			if v.Objeto[nombre], err = p.valor(); err != nil {
+				return v, err
+			}
+		}
+		p.pos++
+		return v, nil
+	case t.Tipo == "int" || t.Tipo == "float":
+		p.pos++
+		return valorGQL{Tipo: t.Tipo, Texto: t.Texto}, nil
+	case t.Tipo == "cadena":
+		p.pos++
+		return valorGQL{Tipo: "string", Texto: t.Texto}, nil
+	case t.Tipo == "nombre":
+		p.pos++
+		switch t.Texto {
+		case "true", "false":
+			return valorGQL{Tipo: "boolean", Texto: t.Texto}, nil
+		case "null":
+			return valorGQL{Tipo: "null"}, nil
+		}
+		return valorGQL{Tipo: "enum", Texto: t.Texto}, nil
+	}
+	return valorGQL{}, p.error(nuevoMensaje(msgGQLSeEsperabaValor))
+}
+
+// EJECUCIÓN
+
+// Objeto JSON que conserva el orden de los campos pedidos
+type mapaOrdenado struct {
+	claves  []string
+	valores map[string]interface{}
+}
+
+func (m *mapaOrdenado) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, clave := range m.claves {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(clave)
+		v, err := json.Marshal(m.valores[clave])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type errorGQL struct {
+	Mensaje string        `json:"message"`
+	Ruta    []interface{} `json:"path,omitempty"`
+}
+
+type ejecucionGQL struct {
+	ctx        context.Context
+	esquema    *esquemaGQL
+	fragmentos map[string]*fragmentoGQL
+	variables  map[string]interface{}
+	errores    []errorGQL
+}
+
+// Error que convierte en null el campo no nulo del padre
+var errPropagarNulo = errors.New("valor nulo en campo no nulo")
+
+func (e *ejecucionGQL) registrarError(err error, ruta []interface{}) {
+	copia := append([]interface{}(nil), ruta...)
+	e.errores = append(e.errores, errorGQL{Mensaje: textoErrorGQL(e.ctx, err), Ruta: copia})
+}
+
+// textoErrorGQL traduce los errores del catálogo al idioma de la petición;
+// los demás (de los resolvers) se muestran tal cual
+func textoErrorGQL(ctx context.Context, err error) string {
+	var m *mensaje
+	if errors.As(err, &m) {
+		return m.Traducir(idiomaDe(ctx))
+	}
+	return err.Error()
+}
+
+// Valor literal de la consulta (sustituyendo variables)
+func (e *ejecucionGQL) literal(v valorGQL) interface{} {
+	switch v.Tipo {
+	case "variable":
+		return e.variables[v.Texto]
+	case "int":
+		n, _ := strconv.Atoi(v.Texto)
+		return n
+	case "float":
+		f, _ := strconv.ParseFloat(v.Texto, 64)
+		return f
+	case "string", "enum":
+		return v.Texto
+	case "boolean":
+		return v.Texto == "true"
+	case "list":
+		lista := make([]interface{}, len(v.Lista))
+		for i, elemento := range v.Lista {
+			lista[i] = e.literal(elemento)
+		}
+		return lista
+	case "object":
+		objeto := map[string]interface{}{}
+		for k, elemento := range v.Objeto {
+			objeto[k] = e.literal(elemento)
+		}
+		return objeto
+	}
+	return nil
+}
+
+// coercionar valida un valor de entrada contra su tipo y lo normaliza
+func (e *esquemaGQL) coercionar(t *tipoRef, valor interface{}, ruta string) (interface{}, error) {
+	if t.Modificador == "NON_NULL" {
+		if valor == nil {
+			return nil, nuevoMensaje(msgGQLValorRequerido, ruta, t.String())
+		}
+		return e.coercionar(t.De, valor, ruta)
+	}
+	if valor == nil {
+		return nil, nil
+	}
+	if t.Modificador == "LIST" {
+		elementos, ok := valor.([]interface{})
+		if !ok {
+			elementos = []interface{}{valor}
+		}
+		resultado := make([]interface{}, len(elementos))
+		for i, elemento := range elementos {
+			v, err := e.coercionar(t.De, elemento, fmt.Sprintf("%s[%d]", ruta, i))
+			if err != nil {
+				return nil, err
+			}
+			resultado[i] = v
+		}
+		return resultado, nil
+	}
+
+	invalido := nuevoMensaje(msgGQLTipoValor, ruta, valor, t.Nombre)
+	switch t.Nombre {
+	case "Int":
+		switch n := valor.(type) {
+		case int:
+			return n, nil
+		case float64:
+			if n == float64(int(n)) {
+				return int(n), nil
+			}
+		}
+		return nil, invalido
+	case "Float":
+		switch n := valor.(type) {
+		case int:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+		return nil, invalido
+	case "String":
+		if s, ok := valor.(string); ok {
+			return s, nil
+		}
+		return nil, invalido
+	case "Boolean":
+		if b, ok := valor.(bool); ok {
+			return b, nil
+		}
+		return nil, invalido
+	case "ID":
+		switch v := valor.(type) {
+		case string:
+			return v, nil
+		case int:
+			return strconv.Itoa(v), nil
+		case float64:
+			if v == float64(int(v)) {
+				return strconv.Itoa(int(v)), nil
+			}
+		}
+		return nil, invalido
+	}
+
+	definicion, ok := e.Tipos[t.Nombre]
+	if !ok || definicion.Tipo != "INPUT_OBJECT" {
+		return nil, nuevoMensaje(msgGQLTipoEntrada, ruta, t.Nombre)
+	}
+	objeto, ok := valor.(map[string]interface{})
+	if !ok {
+		return nil, invalido
+	}
+	for clave := range objeto {
+		if !tieneArgumento(definicion.CamposEntrada, clave) {
+			return nil, nuevoMensaje(msgGQLCampoEntrada, ruta, clave, t.Nombre)
+		}
+	}
+	return e.coercionarArgumentos(definicion.CamposEntrada, objeto, ruta)
+}
+
+func tieneArgumento(args []argumentoGQL, nombre string) bool {
+	for _, a := range args {
+		if a.Nombre == nombre {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *esquemaGQL) coercionarArgumentos(definiciones []argumentoGQL, valores map[string]interface{}, ruta string) (map[string]interface{}, error) {
+	resultado := map[string]interface{}{}
+	for _, def := range definiciones {
+		valor, presente := valores[def.Nombre]
+		if !presente && def.Defecto != nil {
+			valor = def.Defecto
+		}
+		v, err := e.coercionar(def.Tipo, valor, ruta+"."+def.Nombre)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			resultado[def.Nombre] = v
+		}
+	}
+	return resultado, nil
+}
+
+// Evalúa @skip e @include
+func (e *ejecucionGQL) incluir(directivas []directivaUso) bool {
+	for _, d := range directivas {
+		valor, _ := e.literal(d.Argumentos["if"]).(bool)
+		if (d.Nombre == "skip" && valor) || (d.Nombre == "include" && !valor) {
+			return false
+		}
+	}
+	return true
+}
+
+// Une los campos de la selección (expandiendo fragmentos) agrupados por clave
+func (e *ejecucionGQL) recolectarCampos(tipo *tipoGQL, selecciones []seleccionGQL, claves *[]string, grupos map[string][]seleccionGQL, visitados map[string]bool) {
+	for _, sel := range selecciones {
+		if !e.incluir(sel.Directivas) {
+			continue
+		}
+		switch {
+		case sel.Fragmento != "":
+			if visitados[sel.Fragmento] {
+				continue
+			}
+			visitados[sel.Fragmento] = true
+			f, ok := e.fragmentos[sel.Fragmento]
+			if !ok || f.CondicionTipo != tipo.Nombre {
+				continue
+			}
+			e.recolectarCampos(tipo, f.Selecciones, claves, grupos, visitados)
+		case sel.EsInline:
+			if sel.CondicionTipo != "" && sel.CondicionTipo != tipo.Nombre {
+				continue
+			}
+			e.recolectarCampos(tipo, sel.Selecciones, claves, grupos, visitados)
+		default:
+			clave := sel.clave()
+			if _, ok := grupos[clave]; !ok {
+				*claves = append(*claves, clave)
+			}
+			grupos[clave] = append(grupos[clave], sel)
+		}
+	}
+}
+
+// ejecutarSeleccion resuelve los campos pedidos sobre un objeto
+func (e *ejecucionGQL) ejecutarSeleccion(tipo *tipoGQL, padre interface{}, selecciones []seleccionGQL, ruta []interface{}) (*mapaOrdenado, error) {
+	var claves []string
+	grupos := map[string][]seleccionGQL{}
+	e.recolectarCampos(tipo, selecciones, &claves, grupos, map[string]bool{})
+
+	resultado := &mapaOrdenado{valores: map[string]interface{}{}}
+	for _, clave := range claves {
+		campos := grupos[clave]
+		rutaCampo := extenderRuta(ruta, clave)
+
+		if campos[0].Nombre == "__typename" {
+			resultado.claves = append(resultado.claves, clave)
+			resultado.valores[clave] = tipo.Nombre
+			continue
+		}
+
+		valor, err := e.ejecutarCampo(tipo, padre, campos, rutaCampo)
+		if err != nil {
+			return nil, err
+		}
+		resultado.claves = append(resultado.claves, clave)
+		resultado.valores[clave] = valor
+	}
+	return resultado, nil
+}
+
+// Copia la ruta antes de extenderla para no compartir el arreglo subyacente
+func extenderRuta(ruta []interface{}, segmento interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(ruta)+1), ruta...), segmento)
+}
+
+// ejecutarCampo devuelve errPropagarNulo solo si el campo es no nulo y quedó en null
+func (e *ejecucionGQL) ejecutarCampo(tipo *tipoGQL, padre interface{}, campos []seleccionGQL, ruta []interface{}) (interface{}, error) {
+	sel := campos[0]
+	def := tipo.campo(sel.Nombre)
+	noNulo := def.Tipo.Modificador == "NON_NULL"
+
+	args := map[string]interface{}{}
+	for nombre, v := range sel.Argumentos {
+		args[nombre] = e.literal(v)
+	}
+	argsFinales, err := e.esquema.coercionarArgumentos(def.Args, args, sel.Nombre)
+	var valor interface{}
+	if err == nil {
+		valor, err = def.Resolver(e.ctx, padre, argsFinales)
+	}
+	if err != nil {
+		e.registrarError(err, ruta)
+		if noNulo {
+			return nil, errPropagarNulo
+		}
+		return nil, nil
+	}
+
+	var subselecciones []seleccionGQL
+	for _, c := range campos {
+		subselecciones = append(subselecciones, c.Selecciones...)
+	}
+	resultado, err := e.completar(def.Tipo, valor, subselecciones, ruta)
+	if err != nil && !noNulo {
+		return nil, nil
+	}
+	return resultado, err
+}
+
+// completar convierte el valor del resolver según el tipo del campo.
+// Devuelve errPropagarNulo cuando el valor quedó en null por un error ya registrado.
+func (e *ejecucionGQL) completar(t *tipoRef, valor interface{}, selecciones []seleccionGQL, ruta []interface{}) (interface{}, error) {
+	if t.Modificador == "NON_NULL" {
+		resultado, err := e.completar(t.De, valor, selecciones, ruta)
+		if err != nil {
+			return nil, err
+		}
+		if resultado == nil {
+			e.registrarError(nuevoMensaje(msgGQLNoNuloEsNulo, t.String()), ruta)
+			return nil, errPropagarNulo
+		}
+		return resultado, nil
+	}
+
+	if valor == nil {
+		return nil, nil
+	}
+
+	if t.Modificador == "LIST" {
+		elementos, _ := valor.([]interface{})
+		lista := make([]interface{}, 0, len(elementos))
+		for i, elemento := range elementos {
+			v, err := e.completar(t.De, elemento, selecciones, extenderRuta(ruta, i))
+			if err != nil {
+				// Un elemento no nulo en null anula toda la lista
+				if t.De.Modificador == "NON_NULL" {
+					return nil, err
+				}
+				v = nil
+			}
+			lista = append(lista, v)
+		}
+		return lista, nil
+	}
+
+	def := e.esquema.Tipos[t.Nombre]
+	if def.Tipo != "OBJECT" {
+		return valor, nil
+	}
+	return e.ejecutarSeleccion(def, valor, selecciones, ruta)
+}
+
+// VALIDACIÓN: campos existentes, profundidad y complejidad
+
+type analisisGQL struct {
+	ejecucion *ejecucionGQL
+	errores   []*mensaje
+}
+
+// analizar recorre la selección y devuelve profundidad y complejidad estimada
+func (a *analisisGQL) analizar(tipo *tipoGQL, selecciones []seleccionGQL, profundidad int, visitados map[string]bool) (int, int) {
+	var claves []string
+	grupos := map[string][]seleccionGQL{}
+	a.ejecucion.recolectarCampos(tipo, selecciones, &claves, grupos, copiarVisitados(visitados))
+
+	maxProfundidad, complejidad := profundidad, 0
+	for _, clave := range claves {
+		sel := grupos[clave][0]
+		if sel.Nombre == "__typename" {
+			continue
+		}
+		def := tipo.campo(sel.Nombre)
+		if def == nil {
+			a.errores = append(a.errores, nuevoMensaje(msgGQLCampoDesconocido, sel.Nombre, tipo.Nombre))
+			continue
+		}
+		for nombre := range sel.Argumentos {
+			if !tieneArgumento(def.Args, nombre) {
+				a.errores = append(a.errores, nuevoMensaje(msgGQLArgumentoDesconocido, nombre, tipo.Nombre, def.Nombre))
+			}
+		}
+
+		hijo := a.ejecucion.esquema.Tipos[def.Tipo.base()]
+		var subselecciones []seleccionGQL
+		for _, s := range grupos[clave] {
+			subselecciones = append(subselecciones, s.Selecciones...)
+		}
+		if hijo.Tipo == "OBJECT" && len(subselecciones) == 0 {
+			a.errores = append(a.errores, nuevoMensaje(msgGQLRequiereSubcampos, sel.Nombre, def.Tipo.String()))
+			continue
+		}
+		if hijo.Tipo != "OBJECT" && len(subselecciones) > 0 {
+			a.errores = append(a.errores, nuevoMensaje(msgGQLSinSubcampos, sel.Nombre, def.Tipo.String()))
+			continue
+		}
+
+		costo, prof := 1, profundidad+1
+		if hijo.Tipo == "OBJECT" {
+			p, c := a.analizar(hijo, subselecciones, profundidad+1, visitados)
+			costo += multiplicador(a.ejecucion, sel, def) * c
+			prof = p
+		}
+		complejidad += costo
+		if prof > maxProfundidad {
+			maxProfundidad = prof
+		}
+	}
+	return maxProfundidad, complejidad
+}
+
+func copiarVisitados(m map[string]bool) map[string]bool {
+	copia := map[string]bool{}
+	for k, v := range m {
+		copia[k] = v
+	}
+	return copia
+}
+
+// Cantidad estimada de elementos que devuelve un campo
+func multiplicador(e *ejecucionGQL, sel seleccionGQL, def *campoGQL) int {
+	if v, ok := sel.Argumentos["first"]; ok {
+		if n, ok := e.literal(v).(int); ok && n > 0 {
+			return n
+		}
+	}
+	for _, arg := range def.Args {
+		if arg.Nombre == "first" {
+			return arg.Defecto.(int)
+		}
+	}
+	t := def.Tipo
+	if t.Modificador == "NON_NULL" {
+		t = t.De
+	}
+	if t.Modificador == "LIST" {
+		return tamañoListaEstimado
+	}
+	return 1
+}
+
+// PETICIÓN HTTP
+
+type peticionGQL struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// POST /graphql y GET /graphql?query=... - Endpoint GraphQL
+func manejarGraphQL(w http.ResponseWriter, r *http.Request) {
+	var peticion peticionGQL
+	if r.Method == "GET" {
+		consulta := r.URL.Query()
+		peticion.Query = consulta.Get("query")
+		peticion.OperationName = consulta.Get("operationName")
+		if v := consulta.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &peticion.Variables); err != nil {
+				responderError(w, r, http.StatusBadRequest, msgVariablesInvalidas)
+				return
+			}
+		}
+	} else {
+		// Sin DisallowUnknownFields: los clientes GraphQL envían "extensions"
+		r.Body = http.MaxBytesReader(w, r.Body, tamañoMaximoCuerpo)
+		if err := json.NewDecoder(r.Body).Decode(&peticion); err != nil {
+			var demasiadoGrande *http.MaxBytesError
+			if errors.As(err, &demasiadoGrande) {
+				responderError(w, r, http.StatusRequestEntityTooLarge, msgCuerpoDemasiadoGrande, demasiadoGrande.Limit)
+				return
+			}
+			responderError(w, r, http.StatusBadRequest, msgJSONInvalido)
+			return
+		}
+	}
+
+	datos, errores := ejecutarGQL(r.Context(), servidorDe(r.Context()).esquema, peticion, r.Method == "GET")
+
+	respuesta := map[string]interface{}{}
+	if datos != nil {
+		respuesta["data"] = datos
+	}
+	if len(errores) > 0 {
+		respuesta["errors"] = errores
+	}
+	responderJSON(w, http.StatusOK, respuesta)
+}
+
+// ejecutarGQL parsea, valida y ejecuta una petición GraphQL
+func ejecutarGQL(ctx context.Context, esquema *esquemaGQL, peticion peticionGQL, soloLectura bool) (interface{}, []errorGQL) {
+	fallo := func(err error) (interface{}, []errorGQL) {
+		return nil, []errorGQL{{Mensaje: textoErrorGQL(ctx, err)}}
+	}
+
+	if strings.TrimSpace(peticion.Query) == "" {
+		return fallo(nuevoMensaje(msgGQLFaltaConsulta))
+	}
+	doc, err := parsearGQL(peticion.Query)
+	if err != nil {
+		return fallo(err)
+	}
+
+	// Elegir la operación
+	var op *operacionGQL
+	for _, candidata := range doc.Operaciones {
+		if peticion.OperationName == "" || candidata.Nombre == peticion.OperationName {
+			if op != nil {
+				return fallo(nuevoMensaje(msgGQLVariasOperaciones))
+			}
+			op = candidata
+		}
+	}
+	if op == nil {
+		return fallo(nuevoMensaje(msgGQLOperacionNoEncontrada, peticion.OperationName))
+	}
+
+	var raiz *tipoGQL
+	switch op.Tipo {
+	case "query":
+		raiz = esquema.Tipos[esquema.Query]
+	case "mutation":
+		if soloLectura {
+			return fallo(nuevoMensaje(msgGQLMutacionConGET))
+		}
+		raiz = esquema.Tipos[esquema.Mutation]
+	default:
+		return fallo(nuevoMensaje(msgGQLOperacionNoSoportada, op.Tipo))
+	}
+
+	// Variables con sus valores por defecto
+	e := &ejecucionGQL{ctx: ctx, esquema: esquema, fragmentos: doc.Fragmentos, variables: map[string]interface{}{}}
+	for _, v := range op.Variables {
+		valor, presente := peticion.Variables[v.Nombre]
+		if !presente && v.Defecto != nil {
+			valor = e.literal(*v.Defecto)
+		}
+		coercionado, err := esquema.coercionar(v.Tipo, valor, "$"+v.Nombre)
+		if err != nil {
+			return fallo(err)
+		}
+		e.variables[v.Nombre] = coercionado
+	}
+
+	// Validación y límites
+	analisis := &analisisGQL{ejecucion: e}
+	profundidad, complejidad := analisis.analizar(raiz, op.Selecciones, 0, map[string]bool{})
+	if len(analisis.errores) > 0 {
+		errores := make([]errorGQL, len(analisis.errores))
+		for i, m := range analisis.errores {
+			errores[i] = errorGQL{Mensaje: m.Traducir(idiomaDe(ctx))}
+		}
+		return nil, errores
+	}
+	if profundidad > profundidadMaximaGQL {
+		return fallo(nuevoMensaje(msgGQLProfundidad, profundidad, profundidadMaximaGQL))
+	}
+	if complejidad > complejidadMaximaGQL {
+		return fallo(nuevoMensaje(msgGQLComplejidad, complejidad, complejidadMaximaGQL))
+	}
+
+	// Las mutaciones de primer nivel se ejecutan en orden, una tras otra
+	datos, err := e.ejecutarSeleccion(raiz, nil, op.Selecciones, nil)
+	if err != nil {
+		return nil, e.errores
+	}
+	return datos, e.errores
+}
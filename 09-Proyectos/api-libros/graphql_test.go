@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Los errores de análisis, validación, coerción y de los resolvers siguen
+// Accept-Language como el resto de la API
+func TestErroresGraphQLTraducidos(t *testing.T) {
+	t.Parallel()
+	srv, err := nuevoServidor(configuracionServidor{Portadas: almacenLocal{dir: t.TempDir()}, DatosEjemplo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	consultar := func(idioma, consulta string) string {
+		cuerpo, _ := json.Marshal(map[string]string{"query": consulta})
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/graphql", strings.NewReader(string(cuerpo)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", idioma)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var respuesta struct {
+			Errors []errorGQL `json:"errors"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&respuesta); err != nil {
+			t.Fatal(err)
+		}
+		if len(respuesta.Errors) == 0 {
+			t.Fatalf("%q: se esperaba un error", consulta)
+		}
+		return respuesta.Errors[0].Mensaje
+	}
+
+	casos := []struct {
+		consulta string
+		en       string
+	}{
+		{``, "the query is missing"},
+		{`{ libros(first: 500) { totalCount } }`, "first must be between 0 and 100"},
+		{`{ libros(after: "zzz") { totalCount } }`, "invalid cursor"},
+		{`{ libro(id: "x") { titulo } }`, "Invalid ID"},
+		{`{ libro(id: 1) { nada } }`, `Cannot query field "nada" on type "Libro"`},
+		{`{ libro(id: 1, foo: 2) { titulo } }`, `Unknown argument "foo" on field Query.libro`},
+		{`{ libro(id: 1) }`, `Field "libro" of type Libro requires a selection of subfields`},
+		{`{ libro(id: 1 { titulo } }`, `syntax error: expected a name but found "{" (position 14)`},
+		{`{ libro(id: 1) { titulo }`, `syntax error: expected "}" at the end of the document`},
+		{`{ libro(id: "1) { titulo } }`, "syntax error: unterminated string at position 12"},
+		{`{ libro(id: 1) { titulo } } ~`, "syntax error: unexpected character '~' at position 28"},
+		{`query A { libros { totalCount } } query B { libros { totalCount } }`, "there are several operations: set operationName"},
+		{`mutation { crearLibro(input: {titulo: 3, anio: 1}) { id } }`, "crearLibro.input.titulo: the value 3 is not of type String"},
+		{`mutation { crearLibro(input: {titulo: "x", anio: 1, precio: 2}) { id } }`, `crearLibro.input: unknown field "precio" in LibroInput`},
+		{`mutation { eliminarLibro(id: 999) }`, "Book not found"},
+	}
+	for _, caso := range casos {
+		if en := consultar("en", caso.consulta); en != caso.en {
+			t.Errorf("%q en inglés: %q, se esperaba %q", caso.consulta, en, caso.en)
+		}
+		if es := consultar("es", caso.consulta); es == caso.en || strings.Contains(es, "%!") {
+			t.Errorf("%q en español: %q", caso.consulta, es)
+		}
+	}
+}
+
+// La introspección cuenta para los límites como cualquier campo, y el parser
+// corta los documentos muy anidados o con demasiados alias
+func TestLimitesGraphQL(t *testing.T) {
+	t.Parallel()
+	srv, err := nuevoServidor(configuracionServidor{Portadas: almacenLocal{dir: t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	anidada := func(campo string, niveles int) string {
+		return strings.Repeat(campo+" { ", niveles) + "name" + strings.Repeat(" }", niveles)
+	}
+	alias := func(n int, seleccion string) string {
+		var b strings.Builder
+		for i := range n {
+			fmt.Fprintf(&b, "a%d: %s ", i, seleccion)
+		}
+		return b.String()
+	}
+
+	casos := []struct {
+		nombre   string
+		consulta string
+		error    string // Vacío = se acepta
+	}{
+		{"introspección simple", `{ __schema { queryType { name } } }`, ""},
+		{"__type anidado", `{ __type(name: "Libro") { ` + anidada("ofType", 12) + ` } }`, "the query has depth 14 (maximum 10)"},
+		{"5000 niveles", `{ __type(name: "Libro") { ` + anidada("ofType", 5000) + ` } }`, "the document is nested more than 64 levels deep"},
+		{"listas anidadas", `{ libro(id: ` + strings.Repeat("[", 5000) + `) { titulo } }`, "the document is nested more than 64 levels deep"},
+		{"alias de __schema", `{ ` + alias(20, "__schema { types { fields { name } } }") + `}`, "the query has complexity 2240 (maximum 1000)"},
+		{"1000 alias", `{ ` + alias(1000, "__schema { types { fields { name } } }") + `}`, "a selection set has more than 30 aliases"},
+	}
+	for _, caso := range casos {
+		cuerpo, _ := json.Marshal(map[string]string{"query": caso.consulta})
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/graphql", strings.NewReader(string(cuerpo)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", "en")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var respuesta struct {
+			Data   map[string]interface{} `json:"data"`
+			Errors []errorGQL             `json:"errors"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&respuesta)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", caso.nombre, err)
+		}
+		switch {
+		case caso.error == "" && (len(respuesta.Errors) > 0 || respuesta.Data == nil):
+			t.Errorf("%s: se esperaban datos, hubo %+v", caso.nombre, respuesta.Errors)
+		case caso.error != "" && (len(respuesta.Errors) == 0 || !strings.HasPrefix(respuesta.Errors[0].Mensaje, caso.error)):
+			t.Errorf("%s: errores %+v, se esperaba %q", caso.nombre, respuesta.Errors, caso.error)
+		case caso.error != "" && respuesta.Data != nil:
+			t.Errorf("%s: se ejecutó igual", caso.nombre)
+		}
+	}
+}
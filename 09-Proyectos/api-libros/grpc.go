@@ -0,0 +1,600 @@
+// Servicio gRPC LibrosService (ver proto/libros.proto)
+// Implementa el protocolo gRPC sobre HTTP/2 sin cifrar (h2c) con la librería
+// estándar: tramas con prefijo de longitud, trailers grpc-status y una
+// codificación protobuf escrita a mano para los mensajes del servicio.
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Códigos de estado gRPC usados por el servicio
+const (
+	grpcOK                = 0
+	grpcCancelado         = 1
+	grpcArgumentoInvalido = 3
+	grpcNoEncontrado      = 5
+	grpcPermisoDenegado   = 7
+	grpcNoImplementado    = 12
+	grpcInterno           = 13
+	grpcNoAutenticado     = 16
+)
+
+// Tamaño máximo aceptado para un mensaje entrante
+const tamañoMaximoGRPC = 4 << 20
+
+// Error con código de estado gRPC
+type estadoGRPC struct {
+	Codigo  int
+	Mensaje string
+}
+
+func (e *estadoGRPC) Error() string {
+	return fmt.Sprintf("grpc %d: %s", e.Codigo, e.Mensaje)
+}
+
+func errorGRPC(codigo int, mensaje string) error {
+	return &estadoGRPC{Codigo: codigo, Mensaje: mensaje}
+}
+
+// CODIFICACIÓN PROTOBUF
+
+// Tipos de cable de protobuf
+const (
+	cableVarint   = 0
+	cable64       = 1
+	cableLongitud = 2
+	cable32       = 5
+)
+
+type escritorProto struct {
+	buf []byte
+}
+
+func (e *escritorProto) etiqueta(numero, tipo int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(numero)<<3|uint64(tipo))
+}
+
+// Los escalares con valor por defecto no se escriben (proto3)
+func (e *escritorProto) entero(numero int, v int64) {
+	if v != 0 {
+		e.etiqueta(numero, cableVarint)
+		e.buf = binary.AppendUvarint(e.buf, uint64(v))
+	}
+}
+
+func (e *escritorProto) booleano(numero int, v bool, siempre bool) {
+	if v || siempre {
+		e.etiqueta(numero, cableVarint)
+		if v {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+	}
+}
+
+func (e *escritorProto) bytes(numero int, v []byte) {
+	e.etiqueta(numero, cableLongitud)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *escritorProto) texto(numero int, v string) {
+	if v != "" {
+		e.bytes(numero, []byte(v))
+	}
+}
+
+// Campo repeated de enteros, empaquetado como indica proto3
+func (e *escritorProto) enteros(numero int, vs []int) {
+	if len(vs) == 0 {
+		return
+	}
+	var empaquetados []byte
+	for _, v := range vs {
+		empaquetados = binary.AppendUvarint(empaquetados, uint64(int64(v)))
+	}
+	e.bytes(numero, empaquetados)
+}
+
+// Campo leído de un mensaje protobuf
+type campoProto struct {
+	Numero int
+	Cable  int
+	Varint uint64
+	Bytes  []byte
+}
+
+// leerProto separa los campos del mensaje; los de tipo fijo quedan con sus
+// bytes sin interpretar (el servicio no declara ninguno)
+func leerProto(datos []byte) ([]campoProto, error) {
+	var campos []campoProto
+	for len(datos) > 0 {
+		clave, n := binary.Uvarint(datos)
+		if n <= 0 {
+			return nil, errors.New("etiqueta protobuf inválida")
+		}
+		datos = datos[n:]
+		campo := campoProto{Numero: int(clave >> 3), Cable: int(clave & 7)}
+
+		switch clave & 7 {
+		case cableVarint:
+			v, n := binary.Uvarint(datos)
+			if n <= 0 {
+				return nil, errors.New("varint inválido")
+			}
+			campo.Varint = v
+			datos = datos[n:]
+		case cableLongitud:
+			largo, n := binary.Uvarint(datos)
+			if n <= 0 || uint64(len(datos)-n) < largo {
+				return nil, errors.New("campo de longitud inválido")
+			}
+			campo.Bytes = datos[n : n+int(largo)]
+			datos = datos[n+int(largo):]
+		case cable64:
+			if len(datos) < 8 {
+				return nil, errors.New("campo fixed64 incompleto")
+			}
+			campo.Bytes = datos[:8]
+			datos = datos[8:]
+		case cable32:
+			if len(datos) < 4 {
+				return nil, errors.New("campo fixed32 incompleto")
+			}
+			campo.Bytes = datos[:4]
+			datos = datos[4:]
+		default:
+			return nil, fmt.Errorf("tipo de cable %d no soportado", clave&7)
+		}
+		campos = append(campos, campo)
+	}
+	return campos, nil
+}
+
+// Valores de un campo repeated de enteros, empaquetado o no (proto3
+// acepta las dos formas)
+func (c campoProto) enteros() ([]int, error) {
+	if c.Cable == cableVarint {
+		return []int{int(int64(c.Varint))}, nil
+	}
+	if c.Cable != cableLongitud {
+		return nil, fmt.Errorf("el campo %d llegó con tipo de cable %d", c.Numero, c.Cable)
+	}
+	var vs []int
+	for datos := c.Bytes; len(datos) > 0; {
+		v, n := binary.Uvarint(datos)
+		if n <= 0 {
+			return nil, errors.New("varint inválido")
+		}
+		vs = append(vs, int(int64(v)))
+		datos = datos[n:]
+	}
+	return vs, nil
+}
+
+// verificarCables comprueba que los campos conocidos lleguen con el tipo de
+// cable de su declaración; protobuf trata la diferencia como un mensaje mal
+// formado. Los campos desconocidos se ignoran.
+func verificarCables(campos []campoProto, cables map[int]int) error {
+	for _, c := range campos {
+		if cable, ok := cables[c.Numero]; ok && c.Cable != cable {
+			return fmt.Errorf("el campo %d llegó con tipo de cable %d, se esperaba %d", c.Numero, c.Cable, cable)
+		}
+	}
+	return nil
+}
+
+// Tipos de cable de los campos de Libro (autores_ids, el 8, admite dos)
+var cablesLibro = map[int]int{
+	1: cableVarint,
+	2: cableLongitud,
+	3: cableLongitud,
+	4: cableVarint,
+	5: cableLongitud,
+	6: cableVarint,
+	7: cableLongitud,
+}
+
+// Mensaje Libro
+func codificarLibroProto(l Libro) []byte {
+	var e escritorProto
+	e.entero(1, int64(l.ID))
+	e.texto(2, l.Titulo)
+	e.texto(3, l.Autor)
+	e.entero(4, int64(l.Año))
+	e.texto(5, l.Genero)
+	e.booleano(6, l.Disponible, false)
+	if !l.FechaCreado.IsZero() {
+		e.texto(7, l.FechaCreado.Format(time.RFC3339Nano))
+	}
+	e.enteros(8, l.AutoresIDs)
+	return e.buf
+}
+
+func decodificarLibroProto(datos []byte) (Libro, error) {
+	var l Libro
+	campos, err := leerProto(datos)
+	if err == nil {
+		err = verificarCables(campos, cablesLibro)
+	}
+	if err != nil {
+		return l, err
+	}
+	for _, c := range campos {
+		switch c.Numero {
+		case 1:
+			l.ID = int(int64(c.Varint))
+		case 2:
+			l.Titulo = string(c.Bytes)
+		case 3:
+			l.Autor = string(c.Bytes)
+		case 4:
+			l.Año = int(int32(c.Varint))
+		case 5:
+			l.Genero = string(c.Bytes)
+		case 6:
+			l.Disponible = c.Varint != 0
+		case 8:
+			ids, err := c.enteros()
+			if err != nil {
+				return l, err
+			}
+			l.AutoresIDs = append(l.AutoresIDs, ids...)
+		}
+	}
+	return l, nil
+}
+
+// Lee el campo 1 (int64 id) de GetLibroRequest y DeleteLibroRequest
+func decodificarIDProto(datos []byte) (int, error) {
+	campos, err := leerProto(datos)
+	if err == nil {
+		err = verificarCables(campos, map[int]int{1: cableVarint})
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range campos {
+		if c.Numero == 1 {
+			return int(int64(c.Varint)), nil
+		}
+	}
+	return 0, nil
+}
+
+// Lee el campo 1 (Libro libro) de CreateLibroRequest y UpdateLibroRequest
+func decodificarLibroEnvueltoProto(datos []byte) (Libro, error) {
+	campos, err := leerProto(datos)
+	if err == nil {
+		err = verificarCables(campos, map[int]int{1: cableLongitud})
+	}
+	if err != nil {
+		return Libro{}, err
+	}
+	for _, c := range campos {
+		if c.Numero == 1 {
+			return decodificarLibroProto(c.Bytes)
+		}
+	}
+	return Libro{}, nil
+}
+
+// MÉTODOS DEL SERVICIO
+
+type metodoUnario func(ctx context.Context, peticion []byte) ([]byte, error)
+
+type metodoStream func(ctx context.Context, peticion []byte, enviar func([]byte) error) error
+
+const prefijoServicio = "/libros.v1.LibrosService/"
+
+var metodosUnarios = map[string]metodoUnario{
+	prefijoServicio + "ListLibros":  grpcListLibros,
+	prefijoServicio + "GetLibro":    grpcGetLibro,
+	prefijoServicio + "CreateLibro": grpcCreateLibro,
+	prefijoServicio + "UpdateLibro": grpcUpdateLibro,
+	prefijoServicio + "DeleteLibro": grpcDeleteLibro,
+}
+
+var metodosStream = map[string]metodoStream{
+	prefijoServicio + "Watch": grpcWatch,
+}
+
+func grpcListLibros(ctx context.Context, peticion []byte) ([]byte, error) {
+	s := sucursalDe(ctx)
+	campos, err := leerProto(peticion)
+	if err == nil {
+		err = verificarCables(campos, map[int]int{1: cableLongitud, 2: cableVarint})
+	}
+	if err != nil {
+		return nil, errorGRPC(grpcArgumentoInvalido, err.Error())
+	}
+	genero, disponible := "", ""
+	for _, c := range campos {
+		switch c.Numero {
+		case 1:
+			genero = string(c.Bytes)
+		case 2:
+			disponible = strconv.FormatBool(c.Varint != 0)
+		}
+	}
+
+	libros := s.filtrarLibros(s.repositorio.Listar(ctx), genero, disponible)
+	var e escritorProto
+	for _, l := range libros {
+		e.bytes(1, codificarLibroProto(l))
+	}
+	e.entero(2, int64(len(libros)))
+	return e.buf, nil
+}
+
+func grpcGetLibro(ctx context.Context, peticion []byte) ([]byte, error) {
+	s := sucursalDe(ctx)
+	id, err := decodificarIDProto(peticion)
+	if err != nil {
+		return nil, errorGRPC(grpcArgumentoInvalido, err.Error())
+	}
+	libro, ok := s.repositorio.Obtener(ctx, id)
+	if !ok {
+		return nil, errorGRPC(grpcNoEncontrado, traducir(ctx, msgLibroNoEncontrado))
+	}
+	return codificarLibroProto(libro), nil
+}
+
+func grpcCreateLibro(ctx context.Context, peticion []byte) ([]byte, error) {
+	s := sucursalDe(ctx)
+	libro, err := decodificarLibroEnvueltoProto(peticion)
+	if err != nil {
+		return nil, errorGRPC(grpcArgumentoInvalido, err.Error())
+	}
+	if mensaje := s.validarLibroNuevo(libro); mensaje != nil {
+		return nil, errorGRPC(grpcArgumentoInvalido, mensaje.Traducir(idiomaDe(ctx)))
+	}
+	return codificarLibroProto(s.registrarLibroNuevo(ctx, libro)), nil
+}
+
+func grpcUpdateLibro(ctx context.Context, peticion []byte) ([]byte, error) {
+	s := sucursalDe(ctx)
+	libro, err := decodificarLibroEnvueltoProto(peticion)
+	if err != nil {
+		return nil, errorGRPC(grpcArgumentoInvalido, err.Error())
+	}
+	original, ok := s.repositorio.Obtener(ctx, libro.ID)
+	if !ok {
+		return nil, errorGRPC(grpcNoEncontrado, traducir(ctx, msgLibroNoEncontrado))
+	}
+
+	// Mantener fecha de creación original y el ISBN, que el mensaje Libro
+	// no tiene
+	libro.FechaCreado = original.FechaCreado
+	libro.ISBN = original.ISBN
+	if mensaje := s.validarLibro(libro); mensaje != nil {
+		return nil, errorGRPC(grpcArgumentoInvalido, mensaje.Traducir(idiomaDe(ctx)))
+	}
+	actualizado, ok := s.repositorio.Actualizar(ctx, libro)
+	if !ok {
+		return nil, errorGRPC(grpcNoEncontrado, traducir(ctx, msgLibroNoEncontrado))
+	}
+	return codificarLibroProto(actualizado), nil
+}
+
+func grpcDeleteLibro(ctx context.Context, peticion []byte) ([]byte, error) {
+	s := sucursalDe(ctx)
+	id, err := decodificarIDProto(peticion)
+	if err != nil {
+		return nil, errorGRPC(grpcArgumentoInvalido, err.Error())
+	}
+	if !s.repositorio.Eliminar(ctx, id) {
+		return nil, errorGRPC(grpcNoEncontrado, traducir(ctx, msgLibroNoEncontrado))
+	}
+	return nil, nil
+}
+
+// Valores del enum LibroEvento.Tipo
+var tiposEventoProto = map[string]int64{
+	eventoCreado:      1,
+	eventoActualizado: 2,
+	eventoEliminado:   3,
+}
+
+func grpcWatch(ctx context.Context, _ []byte, enviar func([]byte) error) error {
+	s := sucursalDe(ctx)
+	canal, cancelar := s.eventos.Suscribir()
+	defer cancelar()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-servidorDe(ctx).apagando:
+			return nil
+		case evento := <-canal:
+			var e escritorProto
+			e.entero(1, tiposEventoProto[evento.Tipo])
+			e.bytes(2, codificarLibroProto(evento.Libro))
+			if err := enviar(e.buf); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// TRANSPORTE
+
+// Lee un mensaje: 1 byte de compresión + 4 bytes de longitud + contenido
+func leerMensajeGRPC(r io.Reader) ([]byte, error) {
+	var cabecera [5]byte
+	if _, err := io.ReadFull(r, cabecera[:]); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if cabecera[0] != 0 {
+		return nil, errorGRPC(grpcNoImplementado, "compresión de mensajes no soportada")
+	}
+	largo := binary.BigEndian.Uint32(cabecera[1:])
+	if largo > tamañoMaximoGRPC {
+		return nil, errorGRPC(grpcArgumentoInvalido, "mensaje demasiado grande")
+	}
+	mensaje := make([]byte, largo)
+	_, err := io.ReadFull(r, mensaje)
+	return mensaje, err
+}
+
+func escribirMensajeGRPC(w http.ResponseWriter, mensaje []byte) error {
+	trama := make([]byte, 5+len(mensaje))
+	binary.BigEndian.PutUint32(trama[1:], uint32(len(mensaje)))
+	copy(trama[5:], mensaje)
+	if _, err := w.Write(trama); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// grpc-message usa codificación porcentual para caracteres no imprimibles
+func codificarMensajeGRPC(mensaje string) string {
+	var b strings.Builder
+	for i := 0; i < len(mensaje); i++ {
+		c := mensaje[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Interpreta grpc-timeout, por ejemplo "500m" o "10S"
+func parsearTimeoutGRPC(valor string) (time.Duration, bool) {
+	if len(valor) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(valor[:len(valor)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	unidades := map[byte]time.Duration{
+		'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+	}
+	unidad, ok := unidades[valor[len(valor)-1]]
+	return time.Duration(n) * unidad, ok
+}
+
+// manejarGRPC atiende las llamadas a LibrosService
+func manejarGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		responderError(w, r, http.StatusUnsupportedMediaType, msgPeticionGRPC)
+		return
+	}
+
+	ctx := extraerTraceparent(r.Context(), r.Header)
+	ctx, span := iniciarSpanConTipo(ctx, strings.TrimPrefix(r.URL.Path, "/"), spanServidor)
+	defer span.Finalizar()
+	span.AsignarAtributo("rpc.system", "grpc")
+
+	if timeout, ok := parsearTimeoutGRPC(r.Header.Get("Grpc-Timeout")); ok {
+		var cancelar context.CancelFunc
+		ctx, cancelar = context.WithTimeout(ctx, timeout)
+		defer cancelar()
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+
+	err := atenderGRPC(ctx, w, r)
+
+	estado := &estadoGRPC{Codigo: grpcOK}
+	if err != nil && !errors.As(err, &estado) {
+		if ctx.Err() != nil {
+			estado = &estadoGRPC{Codigo: grpcCancelado, Mensaje: ctx.Err().Error()}
+		} else {
+			estado = &estadoGRPC{Codigo: grpcInterno, Mensaje: err.Error()}
+		}
+	}
+	span.AsignarAtributo("rpc.grpc.status_code", estado.Codigo)
+	if estado.Codigo != grpcOK {
+		span.RegistrarError(estado.Mensaje)
+	}
+
+	// Los trailers cierran la respuesta con el estado de la llamada
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(estado.Codigo))
+	if estado.Mensaje != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", codificarMensajeGRPC(estado.Mensaje))
+	}
+}
+
+// Código gRPC para cada error al resolver la sucursal
+var codigoGRPCSucursal = map[int]int{
+	http.StatusBadRequest:   grpcArgumentoInvalido,
+	http.StatusUnauthorized: grpcNoAutenticado,
+	http.StatusForbidden:    grpcPermisoDenegado,
+	http.StatusNotFound:     grpcNoEncontrado,
+}
+
+func atenderGRPC(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	unario, esUnario := metodosUnarios[r.URL.Path]
+	stream, esStream := metodosStream[r.URL.Path]
+	if !esUnario && !esStream {
+		return errorGRPC(grpcNoImplementado, "método desconocido "+r.URL.Path)
+	}
+
+	// La sucursal se elige igual que en HTTP: token, x-sucursal o subdominio
+	acceso, errSucursal := servidorDe(ctx).resolverSucursal(r)
+	if errSucursal != nil {
+		return errorGRPC(codigoGRPCSucursal[errSucursal.Estado], errSucursal.Mensaje.Traducir(idiomaDe(ctx)))
+	}
+	ctx = context.WithValue(ctx, claveSucursal{}, acceso)
+
+	peticion, err := leerMensajeGRPC(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if esStream {
+		return stream(ctx, peticion, func(mensaje []byte) error {
+			return escribirMensajeGRPC(w, mensaje)
+		})
+	}
+
+	respuesta, err := unario(ctx, peticion)
+	if err != nil {
+		return err
+	}
+	return escribirMensajeGRPC(w, respuesta)
+}
+
+// iniciarServidorGRPC escucha en un puerto propio solo con HTTP/2 sin TLS
+func iniciarServidorGRPC(direccion string, srv *servidor) *http.Server {
+	var protocolos http.Protocols
+	protocolos.SetUnencryptedHTTP2(true)
+
+	servidor := &http.Server{
+		Addr:      direccion,
+		Handler:   srv.HandlerGRPC(),
+		Protocols: &protocolos,
+	}
+	servidor.RegisterOnShutdown(srv.CerrarFlujos)
+
+	go func() {
+		if err := servidor.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	return servidor
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLibroProtoIdaYVuelta(t *testing.T) {
+	t.Parallel()
+	// fecha_creado solo va del servidor al cliente; al leer se ignora
+	original := Libro{
+		ID:          7,
+		Titulo:      "Obra conjunta",
+		Autor:       "Gabriel García Márquez, George Orwell",
+		AutoresIDs:  []int{1, 2, 300},
+		Año:         2000,
+		Genero:      "Novela",
+		Disponible:  true,
+		FechaCreado: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+	libro, err := decodificarLibroProto(codificarLibroProto(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if libro.ID != original.ID || libro.Titulo != original.Titulo || libro.Autor != original.Autor ||
+		libro.Año != original.Año || libro.Genero != original.Genero || !libro.Disponible {
+		t.Errorf("libro = %+v, se esperaba %+v", libro, original)
+	}
+	if !slices.Equal(libro.AutoresIDs, original.AutoresIDs) {
+		t.Errorf("autores_ids = %v, se esperaba %v", libro.AutoresIDs, original.AutoresIDs)
+	}
+}
+
+// autores_ids también puede llegar sin empaquetar, un varint por valor
+func TestLibroProtoAutoresSinEmpaquetar(t *testing.T) {
+	t.Parallel()
+	var e escritorProto
+	e.texto(2, "Obra conjunta")
+	e.entero(8, 1)
+	e.entero(8, 2)
+	libro, err := decodificarLibroProto(e.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(libro.AutoresIDs, []int{1, 2}) {
+		t.Errorf("autores_ids = %v, se esperaba [1 2]", libro.AutoresIDs)
+	}
+}
+
+// Sin autores_ids y con el mismo autor se conservan los vínculos guardados
+func TestConservarAutores(t *testing.T) {
+	t.Parallel()
+	previo := Libro{Autor: "A, B", AutoresIDs: []int{1, 2}}
+	casos := []struct {
+		nombre   string
+		libro    Libro
+		esperado []int
+	}{
+		{"mismo texto", Libro{Autor: "A, B"}, []int{1, 2}},
+		{"mayúsculas y espacios", Libro{Autor: " a, b "}, []int{1, 2}},
+		{"otro autor", Libro{Autor: "C"}, nil},
+		{"con ids", Libro{Autor: "A, B", AutoresIDs: []int{3}}, []int{3}},
+	}
+	for _, caso := range casos {
+		if obtenido := conservarAutores(caso.libro, previo).AutoresIDs; !slices.Equal(obtenido, caso.esperado) {
+			t.Errorf("%s: %v, se esperaba %v", caso.nombre, obtenido, caso.esperado)
+		}
+	}
+}
+
+// Los campos desconocidos se saltean, de cualquier tipo de cable
+func TestLibroProtoCamposDesconocidos(t *testing.T) {
+	t.Parallel()
+	var e escritorProto
+	e.entero(1, 7)
+	e.entero(20, 99)
+	e.texto(2, "Rayuela")
+	e.texto(21, "ignorado")
+	e.etiqueta(22, cable64)
+	e.buf = append(e.buf, 1, 2, 3, 4, 5, 6, 7, 8)
+	e.etiqueta(23, cable32)
+	e.buf = append(e.buf, 1, 2, 3, 4)
+	e.entero(4, 1963)
+
+	libro, err := decodificarLibroProto(e.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if libro.ID != 7 || libro.Titulo != "Rayuela" || libro.Año != 1963 {
+		t.Errorf("libro = %+v", libro)
+	}
+}
+
+// Un campo conocido con otro tipo de cable o un mensaje cortado son errores
+func TestLibroProtoMalFormado(t *testing.T) {
+	t.Parallel()
+	conCampo := func(escribir func(e *escritorProto)) []byte {
+		var e escritorProto
+		escribir(&e)
+		return e.buf
+	}
+	casos := []struct {
+		nombre string
+		datos  []byte
+	}{
+		{"título como varint", conCampo(func(e *escritorProto) { e.entero(2, 5) })},
+		{"id como texto", conCampo(func(e *escritorProto) { e.texto(1, "7") })},
+		{"disponible como fixed32", conCampo(func(e *escritorProto) { e.etiqueta(6, cable32); e.buf = append(e.buf, 1, 0, 0, 0) })},
+		{"autores_ids como fixed64", conCampo(func(e *escritorProto) { e.etiqueta(8, cable64); e.buf = append(e.buf, make([]byte, 8)...) })},
+		{"tipo de cable 3 (grupo)", conCampo(func(e *escritorProto) { e.etiqueta(9, 3) })},
+		{"tipo de cable 7", conCampo(func(e *escritorProto) { e.etiqueta(9, 7) })},
+		{"varint cortado", []byte{0x08, 0x80}},
+		{"etiqueta cortada", []byte{0x80}},
+		{"texto más largo que el mensaje", []byte{0x12, 0x05, 'a', 'b'}},
+		{"fixed64 cortado", []byte{0xb1, 0x01, 1, 2, 3}},
+		{"autores_ids con varint cortado", conCampo(func(e *escritorProto) { e.bytes(8, []byte{0x80}) })},
+	}
+	for _, caso := range casos {
+		if libro, err := decodificarLibroProto(caso.datos); err == nil {
+			t.Errorf("%s: se aceptó como %+v", caso.nombre, libro)
+		}
+	}
+
+	if _, err := decodificarIDProto(conCampo(func(e *escritorProto) { e.texto(1, "7") })); err == nil {
+		t.Error("GetLibroRequest con el id como texto se aceptó")
+	}
+	if _, err := decodificarLibroEnvueltoProto(conCampo(func(e *escritorProto) { e.entero(1, 7) })); err == nil {
+		t.Error("CreateLibroRequest con el libro como varint se aceptó")
+	}
+}
+
+// clienteGRPC habla h2c con el servidor gRPC de prueba
+type clienteGRPC struct {
+	url     string
+	cliente *http.Client
+}
+
+// servidorGRPC sirve HandlerGRPC por h2c con la clave de API "clave-buena"
+func servidorGRPC(t *testing.T) (*servidor, clienteGRPC) {
+	t.Helper()
+	srv, err := nuevoServidor(configuracionServidor{
+		Sucursales:   []string{"centro", "norte"},
+		ClavesAPI:    []string{"clave-buena"},
+		Portadas:     almacenLocal{dir: t.TempDir()},
+		DatosEjemplo: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var protocolos http.Protocols
+	protocolos.SetUnencryptedHTTP2(true)
+	ts := httptest.NewUnstartedServer(srv.HandlerGRPC())
+	ts.Config.Protocols = &protocolos
+	ts.Start()
+	t.Cleanup(func() {
+		srv.CerrarFlujos()
+		ts.Close()
+	})
+	return srv, clienteGRPC{url: ts.URL, cliente: &http.Client{Transport: &http.Transport{Protocols: &protocolos}}}
+}
+
+// tramaGRPC arma un mensaje con el prefijo de compresión y longitud
+func tramaGRPC(mensaje []byte) []byte {
+	return binary.BigEndian.AppendUint32([]byte{0}, uint32(len(mensaje))) // Sin comprimir
+}
+
+// peticion arma la llamada con la clave de API; un valor vacío en cabeceras
+// quita esa cabecera
+func (c clienteGRPC) peticion(ctx context.Context, metodo string, peticion []byte, cabeceras map[string]string) *http.Request {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, c.url+prefijoServicio+metodo, bytes.NewReader(append(tramaGRPC(peticion), peticion...)))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("X-API-Key", "clave-buena")
+	for nombre, valor := range cabeceras {
+		if valor == "" {
+			req.Header.Del(nombre)
+		} else {
+			req.Header.Set(nombre, valor)
+		}
+	}
+	return req
+}
+
+// llamar envía una petición gRPC y devuelve la respuesta sin leer el body
+func (c clienteGRPC) llamar(t *testing.T, metodo string, peticion []byte, cabeceras map[string]string) *http.Response {
+	t.Helper()
+	resp, err := c.cliente.Do(c.peticion(context.Background(), metodo, peticion, cabeceras))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/grpc" {
+		t.Fatalf("%s: %s %d %s", metodo, resp.Proto, resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return resp
+}
+
+// unario hace una llamada y devuelve el mensaje, el grpc-status y el grpc-message
+func (c clienteGRPC) unario(t *testing.T, metodo string, peticion []byte, cabeceras map[string]string) ([]byte, int, string) {
+	t.Helper()
+	resp := c.llamar(t, metodo, peticion, cabeceras)
+	mensaje, err := leerMensajeGRPC(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body) // Los trailers llegan al terminar el body
+	estado, err := strconv.Atoi(resp.Trailer.Get("Grpc-Status"))
+	if err != nil {
+		t.Fatalf("%s: grpc-status %q", metodo, resp.Trailer.Get("Grpc-Status"))
+	}
+	return mensaje, estado, resp.Trailer.Get("Grpc-Message")
+}
+
+func TestGRPCUnario(t *testing.T) {
+	t.Parallel()
+	_, c := servidorGRPC(t)
+
+	var pedido escritorProto
+	pedido.entero(1, 2)
+	mensaje, estado, detalle := c.unario(t, "GetLibro", pedido.buf, nil)
+	if estado != grpcOK || detalle != "" {
+		t.Fatalf("GetLibro: estado %d %q", estado, detalle)
+	}
+	if libro, err := decodificarLibroProto(mensaje); err != nil || libro.ID != 2 || libro.Titulo == "" {
+		t.Errorf("GetLibro: %+v %v", libro, err)
+	}
+
+	var nuevo, creacion escritorProto
+	nuevo.texto(2, "Rayuela")
+	nuevo.texto(3, "Julio Cortázar")
+	nuevo.entero(4, 1963)
+	nuevo.texto(5, "Clásico")
+	nuevo.booleano(6, true, true)
+	creacion.bytes(1, nuevo.buf)
+	mensaje, estado, _ = c.unario(t, "CreateLibro", creacion.buf, nil)
+	if libro, err := decodificarLibroProto(mensaje); estado != grpcOK || err != nil || libro.ID == 0 || libro.Titulo != "Rayuela" {
+		t.Errorf("CreateLibro: estado %d, %+v %v", estado, libro, err)
+	}
+
+	var filtro escritorProto
+	filtro.texto(1, "Clásico")
+	mensaje, estado, _ = c.unario(t, "ListLibros", filtro.buf, nil)
+	campos, _ := leerProto(mensaje)
+	if estado != grpcOK || len(campos) != 3 || campos[2].Numero != 2 || campos[2].Varint != 2 {
+		t.Errorf("ListLibros de Clásico: estado %d, campos %+v", estado, campos)
+	}
+}
+
+// Cada error termina con su código gRPC en los trailers
+func TestGRPCCodigosDeEstado(t *testing.T) {
+	t.Parallel()
+	_, c := servidorGRPC(t)
+	var inexistente, malFormado, invalido escritorProto
+	inexistente.entero(1, 999)
+	malFormado.texto(1, "2")
+	var sinTitulo escritorProto
+	sinTitulo.texto(3, "Anónimo")
+	invalido.bytes(1, sinTitulo.buf)
+
+	casos := []struct {
+		nombre    string
+		metodo    string
+		peticion  []byte
+		cabeceras map[string]string
+		estado    int
+	}{
+		{"sin clave de API", "GetLibro", nil, map[string]string{"X-API-Key": ""}, grpcNoAutenticado},
+		{"clave de API inválida", "GetLibro", nil, map[string]string{"X-API-Key": "otra"}, grpcNoAutenticado},
+		{"libro inexistente", "GetLibro", inexistente.buf, nil, grpcNoEncontrado},
+		{"borrar inexistente", "DeleteLibro", inexistente.buf, nil, grpcNoEncontrado},
+		{"tipo de cable equivocado", "GetLibro", malFormado.buf, nil, grpcArgumentoInvalido},
+		{"libro inválido", "CreateLibro", invalido.buf, nil, grpcArgumentoInvalido},
+		{"método desconocido", "BorrarTodo", nil, nil, grpcNoImplementado},
+		{"otra sucursal sin tokens", "GetLibro", inexistente.buf, map[string]string{"X-Sucursal": "norte"}, grpcPermisoDenegado},
+	}
+	for _, caso := range casos {
+		_, estado, detalle := c.unario(t, caso.metodo, caso.peticion, caso.cabeceras)
+		if estado != caso.estado || detalle == "" {
+			t.Errorf("%s: estado %d (%q), se esperaba %d", caso.nombre, estado, detalle, caso.estado)
+		}
+	}
+
+	// Un mensaje comprimido no se admite
+	req, _ := http.NewRequest(http.MethodPost, c.url+prefijoServicio+"GetLibro", bytes.NewReader([]byte{1, 0, 0, 0, 0}))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("X-API-Key", "clave-buena")
+	resp, err := c.cliente.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.Trailer.Get("Grpc-Status") != strconv.Itoa(grpcNoImplementado) {
+		t.Errorf("mensaje comprimido: grpc-status %q", resp.Trailer.Get("Grpc-Status"))
+	}
+
+	// Lo que no es gRPC recibe un error HTTP
+	resp, err = c.cliente.Post(c.url+prefijoServicio+"GetLibro", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("petición JSON: %d", resp.StatusCode)
+	}
+}
+
+// Watch envía un mensaje por cada cambio; sin clave de API termina con
+// UNAUTHENTICATED antes de suscribirse
+func TestGRPCWatch(t *testing.T) {
+	t.Parallel()
+	srv, c := servidorGRPC(t)
+	s := srv.sucursales.PorDefecto()
+
+	_, estado, _ := c.unario(t, "Watch", nil, map[string]string{"X-API-Key": ""})
+	if estado != grpcNoAutenticado {
+		t.Errorf("Watch sin clave: estado %d", estado)
+	}
+
+	// Las cabeceras de la respuesta recién llegan con el primer mensaje
+	ctx, cancelar := context.WithCancel(context.Background())
+	defer cancelar()
+	respuesta, fallo := make(chan *http.Response, 1), make(chan error, 1)
+	go func() {
+		resp, err := c.cliente.Do(c.peticion(ctx, "Watch", nil, nil))
+		if err != nil {
+			fallo <- err
+			return
+		}
+		respuesta <- resp
+	}()
+	esperarHasta(t, "la suscripción de Watch", func() bool {
+		s.eventos.mu.Lock()
+		defer s.eventos.mu.Unlock()
+		return len(s.eventos.suscriptores) == 1
+	})
+
+	var pedido escritorProto
+	pedido.entero(1, 3)
+	if _, estado, _ := c.unario(t, "DeleteLibro", pedido.buf, nil); estado != grpcOK {
+		t.Fatalf("DeleteLibro: estado %d", estado)
+	}
+	var resp *http.Response
+	select {
+	case resp = <-respuesta:
+		defer resp.Body.Close()
+	case err := <-fallo:
+		t.Fatal(err)
+	}
+	mensaje, err := leerMensajeGRPC(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	campos, err := leerProto(mensaje)
+	if err != nil || len(campos) != 2 || int64(campos[0].Varint) != tiposEventoProto[eventoEliminado] {
+		t.Fatalf("evento: %+v %v", campos, err)
+	}
+	if libro, err := decodificarLibroProto(campos[1].Bytes); err != nil || libro.ID != 3 {
+		t.Errorf("libro del evento: %+v %v", libro, err)
+	}
+
+	// Al apagar el servidor el flujo termina bien
+	srv.CerrarFlujos()
+	io.Copy(io.Discard, resp.Body)
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("Watch al apagar: grpc-status %q", resp.Trailer.Get("Grpc-Status"))
+	}
+}
@@ -0,0 +1,159 @@
+// Claves de idempotencia: un POST reintentado devuelve la primera respuesta
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Tiempo que se guarda la respuesta de cada clave
+const ttlIdempotencia = 24 * time.Hour
+
+// Longitud máxima aceptada para Idempotency-Key
+const longitudMaximaClave = 255
+
+// Cabeceras del handler que se repiten; el resto (Content-Encoding,
+// X-Request-ID...) las pone cada petición según corresponda
+var cabecerasRepetidas = []string{"Content-Type", "Location"}
+
+// Respuesta guardada para una clave
+type respuestaIdempotente struct {
+	huella    [32]byte // SHA-256 del body de la primera petición
+	enCurso   bool
+	estado    int
+	cabeceras http.Header
+	cuerpo    []byte
+	expira    time.Time
+}
+
+// Almacén en memoria de claves de idempotencia
+type almacenIdempotencia struct {
+	mu             sync.Mutex
+	respuestas     map[string]*respuestaIdempotente
+	ultimaLimpieza time.Time
+}
+
+// reservar registra la clave como en curso; si ya existe devuelve la entrada previa
+func (a *almacenIdempotencia) reservar(clave string, huella [32]byte) (*respuestaIdempotente, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ahora := time.Now()
+	if ahora.Sub(a.ultimaLimpieza) > time.Minute {
+		for k, r := range a.respuestas {
+			if !r.enCurso && ahora.After(r.expira) {
+				delete(a.respuestas, k)
+			}
+		}
+		a.ultimaLimpieza = ahora
+	}
+
+	if previa, ok := a.respuestas[clave]; ok && (previa.enCurso || ahora.Before(previa.expira)) {
+		copia := *previa
+		return &copia, true
+	}
+	a.respuestas[clave] = &respuestaIdempotente{huella: huella, enCurso: true}
+	return nil, false
+}
+
+// completar guarda la respuesta, o libera la clave si no debe guardarse
+func (a *almacenIdempotencia) completar(clave string, grabador *grabadorRespuesta) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Los errores del servidor no se guardan: el reintento debe poder funcionar
+	if grabador.estado == 0 || grabador.estado >= 500 {
+		delete(a.respuestas, clave)
+		return
+	}
+	r := a.respuestas[clave]
+	r.enCurso = false
+	r.estado = grabador.estado
+	r.cabeceras = http.Header{}
+	for _, nombre := range cabecerasRepetidas {
+		if valor := grabador.Header().Get(nombre); valor != "" {
+			r.cabeceras.Set(nombre, valor)
+		}
+	}
+	r.cuerpo = grabador.cuerpo.Bytes()
+	r.expira = time.Now().Add(ttlIdempotencia)
+}
+
+// ResponseWriter que además copia el estado y el body
+type grabadorRespuesta struct {
+	http.ResponseWriter
+	estado int
+	cuerpo bytes.Buffer
+}
+
+func (g *grabadorRespuesta) WriteHeader(estado int) {
+	if g.estado == 0 {
+		g.estado = estado
+	}
+	g.ResponseWriter.WriteHeader(estado)
+}
+
+func (g *grabadorRespuesta) Write(b []byte) (int, error) {
+	if g.estado == 0 {
+		g.estado = http.StatusOK
+	}
+	g.cuerpo.Write(b)
+	return g.ResponseWriter.Write(b)
+}
+
+// conIdempotencia envuelve un handler de creación para que respete Idempotency-Key
+func conIdempotencia(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clave := r.Header.Get("Idempotency-Key")
+		if clave == "" {
+			next(w, r)
+			return
+		}
+		if !cabeceraValida(clave, longitudMaximaClave) {
+			responderError(w, r, http.StatusBadRequest, msgClaveIdempotenciaInvalida, longitudMaximaClave)
+			return
+		}
+
+		// Leer el body para compararlo con el de la primera petición
+		cuerpo, err := io.ReadAll(http.MaxBytesReader(w, r.Body, tamañoMaximoCuerpo))
+		if err != nil {
+			var demasiadoGrande *http.MaxBytesError
+			if errors.As(err, &demasiadoGrande) {
+				responderError(w, r, http.StatusRequestEntityTooLarge, msgCuerpoDemasiadoGrande, demasiadoGrande.Limit)
+				return
+			}
+			responderError(w, r, http.StatusBadRequest, msgCuerpoIlegible)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(cuerpo))
+
+		// La clave vale para una sucursal y una ruta concretas
+		claveCompleta := sucursalDe(r.Context()).ID + " " + r.Method + " " + r.URL.Path + " " + clave
+		huella := sha256.Sum256(cuerpo)
+
+		idempotencia := servidorDe(r.Context()).idempotencia
+		previa, existe := idempotencia.reservar(claveCompleta, huella)
+		switch {
+		case !existe:
+			grabador := &grabadorRespuesta{ResponseWriter: w}
+			defer idempotencia.completar(claveCompleta, grabador)
+			next(grabador, r)
+		case previa.huella != huella:
+			responderError(w, r, http.StatusUnprocessableEntity, msgClaveIdempotenciaUsada)
+		case previa.enCurso:
+			responderError(w, r, http.StatusConflict, msgClaveIdempotenciaEnCurso)
+		default:
+			for nombre, valores := range previa.cabeceras {
+				w.Header()[nombre] = valores
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(previa.estado)
+			w.Write(previa.cuerpo)
+		}
+	}
+}
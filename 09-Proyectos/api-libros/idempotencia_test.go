@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// postIdempotente envía la petición con Idempotency-Key y devuelve la
+// respuesta con el body ya leído
+func postIdempotente(t *testing.T, metodo, url, clave, cuerpo, sucursal string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(metodo, url, strings.NewReader(cuerpo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", clave)
+	if sucursal != "" {
+		req.Header.Set("X-Sucursal", sucursal)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	datos, _ := io.ReadAll(resp.Body)
+	return resp, datos
+}
+
+// servidorIdempotente sirve handler envuelto en conIdempotencia con los
+// middlewares de servidor y sucursal, como las rutas de la API
+func servidorIdempotente(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	srv, err := nuevoServidor(configuracionServidor{
+		Sucursales:         []string{"centro", "norte"},
+		Portadas:           almacenLocal{dir: t.TempDir()},
+		SucursalesAbiertas: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.middleware(srv.sucursalMiddleware(conIdempotencia(handler))))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+// El reintento recibe el estado, las cabeceras y el body de la primera
+// respuesta, y no se crea otro libro
+func TestIdempotenciaRepite(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+	const cuerpo = `{"isbn":"9780307474728"}`
+
+	primera, datos := postIdempotente(t, http.MethodPost, ts.URL+"/api/libros/desde-isbn", "clave-1", cuerpo, "")
+	if primera.StatusCode != http.StatusCreated || primera.Header.Get("Idempotent-Replayed") != "" {
+		t.Fatalf("primera petición: %d %v", primera.StatusCode, primera.Header)
+	}
+	segunda, repetidos := postIdempotente(t, http.MethodPost, ts.URL+"/api/libros/desde-isbn", "clave-1", cuerpo, "")
+	if segunda.StatusCode != primera.StatusCode || !bytes.Equal(repetidos, datos) {
+		t.Errorf("reintento: %d %s, se esperaba %d %s", segunda.StatusCode, repetidos, primera.StatusCode, datos)
+	}
+	for _, cabecera := range []string{"Content-Type", "Location"} {
+		if segunda.Header.Get(cabecera) != primera.Header.Get(cabecera) || primera.Header.Get(cabecera) == "" {
+			t.Errorf("%s: %q, se esperaba %q", cabecera, segunda.Header.Get(cabecera), primera.Header.Get(cabecera))
+		}
+	}
+	if segunda.Header.Get("Idempotent-Replayed") != "true" {
+		t.Error("falta Idempotent-Replayed en el reintento")
+	}
+
+	var lista struct {
+		Total int `json:"total"`
+	}
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/libros", "", &lista)
+	if lista.Total != 4 {
+		t.Errorf("%d libros, se esperaban 4 (3 de ejemplo y uno nuevo)", lista.Total)
+	}
+}
+
+// La misma clave con otro body es un error del cliente
+func TestIdempotenciaOtroCuerpo(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+	libro := `{"titulo":"Rayuela","autor":"Julio Cortázar","año":1963,"genero":"Clásico"}`
+
+	if resp, _ := postIdempotente(t, http.MethodPost, ts.URL+"/api/libros", "clave-2", libro, ""); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("primera petición: %d", resp.StatusCode)
+	}
+	resp, datos := postIdempotente(t, http.MethodPost, ts.URL+"/api/libros", "clave-2", strings.Replace(libro, "1963", "1964", 1), "")
+	if resp.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(string(datos), string(msgClaveIdempotenciaUsada)) {
+		t.Errorf("otro body con la misma clave: %d %s", resp.StatusCode, datos)
+	}
+}
+
+// Mientras la primera petición no termina, otra con la misma clave recibe 409
+func TestIdempotenciaEnCurso(t *testing.T) {
+	t.Parallel()
+	dentro, soltar := make(chan struct{}), make(chan struct{})
+	var ejecuciones atomic.Int32
+	url := servidorIdempotente(t, func(w http.ResponseWriter, r *http.Request) {
+		if ejecuciones.Add(1) == 1 {
+			close(dentro)
+			<-soltar
+		}
+		responderJSON(w, http.StatusCreated, map[string]int{"id": 1})
+	})
+
+	terminada := make(chan int)
+	go func() {
+		resp, _ := postIdempotente(t, http.MethodPost, url+"/api/cosas", "clave-3", "{}", "")
+		terminada <- resp.StatusCode
+	}()
+	<-dentro
+
+	resp, datos := postIdempotente(t, http.MethodPost, url+"/api/cosas", "clave-3", "{}", "")
+	if resp.StatusCode != http.StatusConflict || !strings.Contains(string(datos), string(msgClaveIdempotenciaEnCurso)) {
+		t.Errorf("petición concurrente: %d %s", resp.StatusCode, datos)
+	}
+	close(soltar)
+	if estado := <-terminada; estado != http.StatusCreated {
+		t.Errorf("primera petición: %d", estado)
+	}
+
+	// Ya terminada, se repite sin volver a ejecutar el handler
+	if resp, _ := postIdempotente(t, http.MethodPost, url+"/api/cosas", "clave-3", "{}", ""); resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("después de terminar: %d sin Idempotent-Replayed", resp.StatusCode)
+	}
+	if n := ejecuciones.Load(); n != 1 {
+		t.Errorf("el handler se ejecutó %d veces", n)
+	}
+}
+
+// Las claves valen por sucursal, método y ruta; los 5xx no se guardan
+func TestIdempotenciaAlcance(t *testing.T) {
+	t.Parallel()
+	var ejecuciones atomic.Int32
+	url := servidorIdempotente(t, func(w http.ResponseWriter, r *http.Request) {
+		n := ejecuciones.Add(1)
+		if r.URL.Path == "/api/falla" && n%2 == 1 {
+			responderError(w, r, http.StatusInternalServerError, msgErrorInterno)
+			return
+		}
+		responderJSON(w, http.StatusCreated, map[string]int32{"ejecucion": n})
+	})
+
+	pasos := []struct {
+		metodo, ruta, sucursal string
+		repetida               bool
+	}{
+		{"POST", "/api/cosas", "", false},
+		{"POST", "/api/cosas", "", true},
+		{"POST", "/api/cosas", "centro", true}, // La de por defecto
+		{"POST", "/api/cosas", "norte", false},
+		{"POST", "/api/cosas", "norte", true},
+		{"PUT", "/api/cosas", "", false},
+		{"POST", "/api/otras", "", false},
+		{"POST", "/api/falla", "", false}, // 500: no se guarda
+		{"POST", "/api/falla", "", false},
+		{"POST", "/api/falla", "", true},
+	}
+	for i, paso := range pasos {
+		resp, datos := postIdempotente(t, paso.metodo, url+paso.ruta, "clave-4", "{}", paso.sucursal)
+		if repetida := resp.Header.Get("Idempotent-Replayed") == "true"; repetida != paso.repetida {
+			t.Errorf("paso %d %s %s (%s): repetida %v, se esperaba %v: %d %s", i, paso.metodo, paso.ruta, paso.sucursal, repetida, paso.repetida, resp.StatusCode, datos)
+		}
+	}
+	if n := ejecuciones.Load(); n != 6 {
+		t.Errorf("el handler se ejecutó %d veces, se esperaban 6", n)
+	}
+}
+
+// Las respuestas se guardan 24 h; después la clave vale de nuevo y la
+// limpieza periódica borra la entrada
+func TestIdempotenciaVence(t *testing.T) {
+	t.Parallel()
+	almacen := &almacenIdempotencia{respuestas: map[string]*respuestaIdempotente{}}
+	huella := sha256.Sum256([]byte("{}"))
+	guardar := func(clave string) {
+		if _, existe := almacen.reservar(clave, huella); existe {
+			t.Fatalf("%s ya estaba reservada", clave)
+		}
+		almacen.completar(clave, &grabadorRespuesta{ResponseWriter: httptest.NewRecorder(), estado: http.StatusCreated})
+	}
+
+	guardar("a")
+	if expira := almacen.respuestas["a"].expira; time.Until(expira) < ttlIdempotencia-time.Minute || time.Until(expira) > ttlIdempotencia {
+		t.Errorf("expira en %v, se esperaban %v", time.Until(expira), ttlIdempotencia)
+	}
+	if previa, existe := almacen.reservar("a", huella); !existe || previa.estado != http.StatusCreated {
+		t.Fatalf("antes de vencer: %+v %v", previa, existe)
+	}
+
+	// Vencida pero todavía sin limpiar: no se repite
+	almacen.respuestas["a"].expira = time.Now().Add(-time.Second)
+	almacen.ultimaLimpieza = time.Now()
+	if _, existe := almacen.reservar("a", huella); existe {
+		t.Error("se repitió una respuesta vencida")
+	}
+
+	// La limpieza (como mucho una vez por minuto) borra las vencidas
+	guardar("b")
+	almacen.respuestas["b"].expira = time.Now().Add(-time.Second)
+	almacen.ultimaLimpieza = time.Now().Add(-2 * time.Minute)
+	guardar("c")
+	if _, ok := almacen.respuestas["b"]; ok {
+		t.Error("la entrada vencida sigue en el almacén")
+	}
+	if _, ok := almacen.respuestas["a"]; !ok {
+		t.Error("se borró una entrada en curso")
+	}
+	if total := len(almacen.respuestas); total != 2 {
+		t.Errorf("%d entradas, se esperaban 2 (%s)", total, fmt.Sprint(almacen.respuestas))
+	}
+}
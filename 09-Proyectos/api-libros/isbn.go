@@ -0,0 +1,371 @@
+// Alta de libros a partir del ISBN con datos de un catálogo externo
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Tiempo máximo para consultar el catálogo externo
+const timeoutCatalogoISBN = 10 * time.Second
+
+// Catálogo de Open Library si no se indica OPENLIBRARY_URL
+const urlOpenLibraryPorDefecto = "https://openlibrary.org"
+
+// Datos de una edición según el catálogo externo
+type metadatosLibro struct {
+	ISBN     string   `json:"isbn"`
+	Titulo   string   `json:"titulo"`
+	Autores  []string `json:"autores"`
+	Año      int      `json:"año"`      // 0 si el catálogo no lo indica
+	Materias []string `json:"materias"` // Temas tal como los nombra el catálogo
+}
+
+// Fuente de metadatos por ISBN (Open Library, un archivo local, otro catálogo)
+type proveedorMetadatos interface {
+	Nombre() string
+	Buscar(ctx context.Context, isbn string) (metadatosLibro, error)
+}
+
+var errISBNNoEncontrado = nuevoMensaje(msgISBNNoEncontrado)
+
+// normalizarISBN quita guiones y espacios, comprueba el dígito de control y
+// devuelve el ISBN-13 (los ISBN-10 se convierten)
+func normalizarISBN(texto string) (string, bool) {
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(texto))
+	switch len(isbn) {
+	case 10:
+		suma := 0
+		for i, c := range isbn {
+			valor := int(c - '0')
+			if c == 'X' && i == 9 {
+				valor = 10
+			} else if c < '0' || c > '9' {
+				return "", false
+			}
+			suma += valor * (10 - i)
+		}
+		if suma%11 != 0 {
+			return "", false
+		}
+		isbn = "978" + isbn[:9]
+		return isbn + string(rune('0'+digitoControlISBN13(isbn))), true
+	case 13:
+		for _, c := range isbn {
+			if c < '0' || c > '9' {
+				return "", false
+			}
+		}
+		if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+			return "", false
+		}
+		if int(isbn[12]-'0') != digitoControlISBN13(isbn[:12]) {
+			return "", false
+		}
+		return isbn, true
+	}
+	return "", false
+}
+
+// Dígito de control de los primeros 12 dígitos de un ISBN-13
+func digitoControlISBN13(doce string) int {
+	suma := 0
+	for i, c := range doce[:12] {
+		peso := 1
+		if i%2 == 1 {
+			peso = 3
+		}
+		suma += int(c-'0') * peso
+	}
+	return (10 - suma%10) % 10
+}
+
+// Normaliza el ISBN del libro si es válido (la validación avisa si no lo es)
+func canonizarISBN(libro Libro) Libro {
+	if isbn, ok := normalizarISBN(libro.ISBN); ok {
+		libro.ISBN = isbn
+	}
+	return libro
+}
+
+// Materias del catálogo (en inglés, como las usa Open Library) que equivalen
+// a nuestros géneros; las que ya coinciden con un género no hace falta listarlas
+var equivalenciasGenero = map[string]string{
+	"fiction":                       "Ficción",
+	"magic realism":                 "Realismo mágico",
+	"magic realism literature":      "Realismo mágico",
+	"dystopias":                     "Distopía",
+	"dystopian fiction":             "Distopía",
+	"science fiction":               "Ciencia ficción",
+	"fantasy":                       "Fantasía",
+	"fantasy fiction":               "Fantasía",
+	"detective and mystery stories": "Policial",
+	"mystery fiction":               "Policial",
+	"classic literature":            "Clásico",
+	"classics":                      "Clásico",
+	"nonfiction":                    "No ficción",
+	"essays":                        "Ensayo",
+	"biography":                     "Biografía",
+	"autobiography":                 "Biografía",
+	"history":                       "Historia",
+	"poetry":                        "Poesía",
+}
+
+// generoDeMaterias elige el género más específico (un subgénero antes que
+// uno raíz) entre las materias reconocidas; "" si ninguna lo es
+func (s *sucursal) generoDeMaterias(materias []string) string {
+	elegido := ""
+	for _, materia := range materias {
+		genero, ok := s.generos.Buscar(materia)
+		if !ok {
+			equivalente, conocido := equivalenciasGenero[claveGenero(materia)]
+			if !conocido {
+				continue
+			}
+			if genero, ok = s.generos.Buscar(equivalente); !ok {
+				continue
+			}
+		}
+		if genero.PadreID != nil {
+			return genero.Nombre
+		}
+		if elegido == "" {
+			elegido = genero.Nombre
+		}
+	}
+	return elegido
+}
+
+// proveedorOpenLibrary consulta la API de libros de Open Library (o un
+// servicio compatible en otra URL)
+type proveedorOpenLibrary struct {
+	base    string
+	cliente *http.Client
+}
+
+func (p proveedorOpenLibrary) Nombre() string { return "Open Library (" + p.base + ")" }
+
+func (p proveedorOpenLibrary) Buscar(ctx context.Context, isbn string) (metadatosLibro, error) {
+	ctx, span := iniciarSpanConTipo(ctx, "isbn.buscar", spanCliente)
+	defer span.Finalizar()
+	span.AsignarAtributo("isbn", isbn)
+
+	clave := "ISBN:" + isbn
+	consulta := url.Values{"bibkeys": {clave}, "format": {"json"}, "jscmd": {"data"}}
+	peticion, err := http.NewRequestWithContext(ctx, http.MethodGet, p.base+"/api/books?"+consulta.Encode(), nil)
+	if err != nil {
+		return metadatosLibro{}, err
+	}
+	peticion.Header.Set("Accept", "application/json")
+	peticion.Header.Set("User-Agent", "api-libros/1.0")
+	inyectarTraceparent(ctx, peticion.Header)
+
+	respuesta, err := p.cliente.Do(peticion)
+	if err != nil {
+		span.RegistrarError(err.Error())
+		return metadatosLibro{}, err
+	}
+	defer respuesta.Body.Close()
+	if respuesta.StatusCode != http.StatusOK {
+		span.RegistrarError(respuesta.Status)
+		return metadatosLibro{}, fmt.Errorf("el catálogo respondió %s", respuesta.Status)
+	}
+
+	// Respuesta: {"ISBN:...": {...}}, o {} si no lo conoce
+	var ediciones map[string]struct {
+		Titulo      string                  `json:"title"`
+		Autores     []struct{ Name string } `json:"authors"`
+		PublishDate string                  `json:"publish_date"`
+		Materias    []struct{ Name string } `json:"subjects"`
+	}
+	if err := json.NewDecoder(io.LimitReader(respuesta.Body, 1<<20)).Decode(&ediciones); err != nil {
+		return metadatosLibro{}, fmt.Errorf("respuesta inválida del catálogo: %w", err)
+	}
+	edicion, ok := ediciones[clave]
+	if !ok {
+		return metadatosLibro{}, errISBNNoEncontrado
+	}
+
+	datos := metadatosLibro{ISBN: isbn, Titulo: strings.TrimSpace(edicion.Titulo), Año: añoPublicacion(edicion.PublishDate)}
+	for _, autor := range edicion.Autores {
+		datos.Autores = append(datos.Autores, autor.Name)
+	}
+	for _, materia := range edicion.Materias {
+		datos.Materias = append(datos.Materias, materia.Name)
+	}
+	return datos, nil
+}
+
+var expresionAño = regexp.MustCompile(`(?:^|\D)(\d{4})(?:\D|$)`)
+
+// añoPublicacion toma el año de textos como "1967", "May 5, 1967" o "c1967"
+func añoPublicacion(fecha string) int {
+	año := 0
+	if coincidencia := expresionAño.FindStringSubmatch(fecha); coincidencia != nil {
+		fmt.Sscan(coincidencia[1], &año)
+	}
+	return año
+}
+
+// proveedorLocal responde con datos fijos, sin salir a la red: sirve para
+// pruebas y para trabajar sin conexión
+type proveedorLocal struct {
+	origen string
+	libros map[string]metadatosLibro
+}
+
+func (p proveedorLocal) Nombre() string {
+	if p.origen == "" {
+		return "datos de ejemplo locales"
+	}
+	return "archivo local " + p.origen
+}
+
+func (p proveedorLocal) Buscar(_ context.Context, isbn string) (metadatosLibro, error) {
+	datos, ok := p.libros[isbn]
+	if !ok {
+		return metadatosLibro{}, errISBNNoEncontrado
+	}
+	return datos, nil
+}
+
+func indexarPorISBN(lista []metadatosLibro) map[string]metadatosLibro {
+	indice := map[string]metadatosLibro{}
+	for _, datos := range lista {
+		if isbn, ok := normalizarISBN(datos.ISBN); ok {
+			datos.ISBN = isbn
+			indice[isbn] = datos
+		}
+	}
+	return indice
+}
+
+// Ediciones del proveedor local si no se indica ISBN_FIXTURES
+var metadatosDeEjemplo = []metadatosLibro{
+	{ISBN: "9780307474728", Titulo: "Cien años de soledad", Autores: []string{"Gabriel García Márquez"}, Año: 2009, Materias: []string{"Fiction", "Magic realism (Literature)"}},
+	{ISBN: "9780060883287", Titulo: "One Hundred Years of Solitude", Autores: []string{"Gabriel García Márquez"}, Año: 2006, Materias: []string{"Magic realism"}},
+	{ISBN: "9780451524935", Titulo: "1984", Autores: []string{"George Orwell"}, Año: 1950, Materias: []string{"Fiction", "Dystopias"}},
+	{ISBN: "9788420412146", Titulo: "Don Quijote de la Mancha", Autores: []string{"Miguel de Cervantes"}, Año: 2004, Materias: []string{"Classic Literature"}},
+	{ISBN: "9781451673319", Titulo: "Fahrenheit 451", Autores: []string{"Ray Bradbury"}, Año: 2012, Materias: []string{"Science fiction", "Dystopias"}},
+	{ISBN: "9788420633121", Titulo: "Ficciones", Autores: []string{"Jorge Luis Borges"}, Año: 1997, Materias: []string{"Fantasy fiction", "Short stories"}},
+}
+
+// proveedorMetadatosConfigurado arma el proveedor según ISBN_PROVEEDOR:
+// "openlibrary" (por defecto, con OPENLIBRARY_URL) o "local" (con
+// ISBN_FIXTURES, un JSON con la lista de ediciones, o los datos de ejemplo)
+func proveedorMetadatosConfigurado() (proveedorMetadatos, error) {
+	switch tipo := os.Getenv("ISBN_PROVEEDOR"); tipo {
+	case "", "openlibrary":
+		base := os.Getenv("OPENLIBRARY_URL")
+		if base == "" {
+			base = urlOpenLibraryPorDefecto
+		}
+		return proveedorOpenLibrary{
+			base:    strings.TrimSuffix(base, "/"),
+			cliente: &http.Client{Timeout: timeoutCatalogoISBN},
+		}, nil
+	case "local":
+		archivo := os.Getenv("ISBN_FIXTURES")
+		if archivo == "" {
+			return proveedorLocal{libros: indexarPorISBN(metadatosDeEjemplo)}, nil
+		}
+		contenido, err := os.ReadFile(archivo)
+		if err != nil {
+			return nil, err
+		}
+		var lista []metadatosLibro
+		if err := json.Unmarshal(contenido, &lista); err != nil {
+			return nil, fmt.Errorf("%s: %w", archivo, err)
+		}
+		return proveedorLocal{origen: archivo, libros: indexarPorISBN(lista)}, nil
+	default:
+		return nil, fmt.Errorf("ISBN_PROVEEDOR desconocido: %q (valores: openlibrary, local)", tipo)
+	}
+}
+
+// HANDLERS
+
+// POST /api/libros/desde-isbn - Crear un libro con los datos del catálogo externo
+func crearLibroDesdeISBN(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	var datos struct {
+		ISBN   string `json:"isbn"`
+		Genero string `json:"genero"` // Opcionales: reemplazan lo que diga el catálogo
+		Año    int    `json:"año"`
+	}
+	if err := decodificarJSON(w, r, &datos); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	isbn, ok := normalizarISBN(datos.ISBN)
+	if !ok {
+		responderError(w, r, http.StatusBadRequest, msgISBNControlInvalido)
+		return
+	}
+	for _, libro := range s.repositorio.Listar(r.Context()) {
+		if libro.ISBN == isbn {
+			w.Header().Set("Location", fmt.Sprintf("/api/libros/%d", libro.ID))
+			responderError(w, r, http.StatusConflict, msgISBNDuplicado, libro.ID)
+			return
+		}
+	}
+
+	ctx, cancelar := context.WithTimeout(r.Context(), timeoutCatalogoISBN)
+	defer cancelar()
+	metadatos, err := servidorDe(r.Context()).catalogoISBN.Buscar(ctx, isbn)
+	if errors.Is(err, errISBNNoEncontrado) {
+		responderMensaje(w, r, http.StatusNotFound, comoMensaje(err))
+		return
+	}
+	if err != nil {
+		log.Printf("ISBN %s: %v", isbn, err)
+		responderError(w, r, http.StatusBadGateway, msgCatalogoNoDisponible)
+		return
+	}
+
+	var nombres []string
+	for _, nombre := range metadatos.Autores {
+		if nombre = strings.TrimSpace(nombre); nombre != "" {
+			nombres = append(nombres, nombre)
+		}
+	}
+	nuevo := Libro{
+		Titulo: metadatos.Titulo,
+		Autor:  strings.Join(nombres, ", "),
+		Año:    metadatos.Año,
+		Genero: s.generoDeMaterias(metadatos.Materias),
+		ISBN:   isbn,
+	}
+	if datos.Genero != "" {
+		nuevo.Genero = datos.Genero
+	}
+	if datos.Año != 0 {
+		nuevo.Año = datos.Año
+	}
+	if nuevo.Genero == "" {
+		responderError(w, r, http.StatusUnprocessableEntity, msgCatalogoSinGenero)
+		return
+	}
+	if mensaje := s.validarLibroNuevo(nuevo); mensaje != nil {
+		responderError(w, r, http.StatusUnprocessableEntity, msgCatalogoIncompleto, mensaje)
+		return
+	}
+	// Los autores se crean recién ahora para no dejar huérfanos si faltan datos
+	for _, nombre := range nombres {
+		nuevo.AutoresIDs = append(nuevo.AutoresIDs, s.autores.BuscarOCrear(nombre, false).ID)
+	}
+
+	nuevo = s.registrarLibroNuevo(r.Context(), nuevo)
+	w.Header().Set("Location", fmt.Sprintf("/api/libros/%d", nuevo.ID))
+	responderJSON(w, http.StatusCreated, nuevo)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTokensNombreSinPuntuacion(t *testing.T) {
+	t.Parallel()
+	casos := map[string][]string{
+		"G. García Márquez":              {"g", "garcia", "marquez"},
+		"Magic realism (Literature)":     {"magic", "realism", "literature"},
+		"Detective and mystery stories.": {"detective", "and", "mystery", "stories"},
+		"O'Brien, Flann":                 {"o", "brien", "flann"},
+		"Science fiction -- History":     {"science", "fiction", "history"},
+	}
+	for nombre, esperado := range casos {
+		if obtenido := tokensNombre(nombre); !slices.Equal(obtenido, esperado) {
+			t.Errorf("tokensNombre(%q) = %q, se esperaba %q", nombre, obtenido, esperado)
+		}
+	}
+}
+
+// El alta por ISBN toma el subgénero de las materias; una actualización
+// por GraphQL (que no lleva ISBN) lo conserva y un PUT sin ISBN lo quita,
+// porque reemplaza el libro entero
+func TestLibroDesdeISBNConservaISBN(t *testing.T) {
+	t.Parallel()
+	srv, err := nuevoServidor(configuracionServidor{Portadas: almacenLocal{dir: t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	var libro Libro
+	if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/libros/desde-isbn", `{"isbn":"9780307474728"}`, &libro); estado != http.StatusCreated {
+		t.Fatalf("POST /api/libros/desde-isbn = %d", estado)
+	}
+	if libro.Genero != "Realismo mágico" {
+		t.Errorf("género %q, se esperaba Realismo mágico", libro.Genero)
+	}
+
+	consulta := `{"query":"mutation { actualizarLibro(id: ` + strconv.Itoa(libro.ID) + `, input: {titulo: \"Cien años de soledad\", anio: 1967}) { id } }"}`
+	if estado := pedirJSON(t, http.MethodPost, ts.URL+"/graphql", consulta, nil); estado != http.StatusOK {
+		t.Fatalf("POST /graphql = %d", estado)
+	}
+	var actualizado Libro
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/libros/"+strconv.Itoa(libro.ID), "", &actualizado)
+	if actualizado.Año != 1967 || actualizado.ISBN != "9780307474728" {
+		t.Errorf("libro actualizado: año %d, isbn %q", actualizado.Año, actualizado.ISBN)
+	}
+
+	cuerpo := `{"titulo":"Cien años de soledad","autor":"Gabriel García Márquez","año":1967,"genero":"Realismo mágico"}`
+	var reemplazado Libro
+	if estado := pedirJSON(t, http.MethodPut, ts.URL+"/api/libros/"+strconv.Itoa(libro.ID), cuerpo, &reemplazado); estado != http.StatusOK {
+		t.Fatalf("PUT = %d", estado)
+	}
+	if reemplazado.ISBN != "" {
+		t.Errorf("PUT sin isbn conservó %q", reemplazado.ISBN)
+	}
+}
+
+func TestAñoPublicacion(t *testing.T) {
+	t.Parallel()
+	casos := map[string]int{
+		"1967":            1967,
+		"May 5, 1967":     1967,
+		"c1967":           1967,
+		"1967-05-30":      1967,
+		"[2009?]":         2009,
+		"Noviembre 2004.": 2004,
+		"":                0,
+		"s.f.":            0,
+		"12345":           0, // Cinco cifras no son un año
+		"Printing 3":      0,
+	}
+	for fecha, año := range casos {
+		if obtenido := añoPublicacion(fecha); obtenido != año {
+			t.Errorf("añoPublicacion(%q) = %d, se esperaba %d", fecha, obtenido, año)
+		}
+	}
+}
+
+// catalogoFalso imita /api/books de Open Library: conoce un ISBN, responde
+// 404 a otro y no responde a un tercero hasta que se corta la conexión
+func catalogoFalso(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		consulta := r.URL.Query()
+		if r.URL.Path != "/api/books" || consulta.Get("format") != "json" || consulta.Get("jscmd") != "data" {
+			t.Errorf("consulta al catálogo: %s", r.URL)
+		}
+		switch consulta.Get("bibkeys") {
+		case "ISBN:9780307474728":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"ISBN:9780307474728": {
+				"title": " Cien años de soledad ",
+				"authors": [{"name": "Gabriel García Márquez", "url": "https://openlibrary.org/authors/OL1A"}],
+				"publish_date": "March 2009",
+				"subjects": [{"name": "Fiction"}, {"name": "Magic realism (Literature)"}],
+				"number_of_pages": 417
+			}}`)
+		case "ISBN:9780451524935":
+			http.NotFound(w, r)
+		case "ISBN:9781451673319":
+			<-r.Context().Done()
+		case "ISBN:9788420633121":
+			io.WriteString(w, `<html>mantenimiento</html>`)
+		default:
+			io.WriteString(w, `{}`)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestProveedorOpenLibrary(t *testing.T) {
+	t.Parallel()
+	catalogo := catalogoFalso(t)
+	proveedor := proveedorOpenLibrary{base: catalogo.URL, cliente: &http.Client{Timeout: 200 * time.Millisecond}}
+
+	datos, err := proveedor.Buscar(context.Background(), "9780307474728")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if datos.ISBN != "9780307474728" || datos.Titulo != "Cien años de soledad" || datos.Año != 2009 ||
+		!slices.Equal(datos.Autores, []string{"Gabriel García Márquez"}) ||
+		!slices.Equal(datos.Materias, []string{"Fiction", "Magic realism (Literature)"}) {
+		t.Errorf("metadatos: %+v", datos)
+	}
+
+	if _, err := proveedor.Buscar(context.Background(), "9788420412146"); !errors.Is(err, errISBNNoEncontrado) {
+		t.Errorf("ISBN desconocido: %v", err)
+	}
+	for isbn, caso := range map[string]string{"9780451524935": "404", "9788420633121": "HTML", "9781451673319": "timeout"} {
+		inicio := time.Now()
+		_, err := proveedor.Buscar(context.Background(), isbn)
+		if err == nil || errors.Is(err, errISBNNoEncontrado) {
+			t.Errorf("%s: %v, se esperaba un error del catálogo", caso, err)
+		}
+		if demora := time.Since(inicio); demora > 5*time.Second {
+			t.Errorf("%s: tardó %v", caso, demora)
+		}
+	}
+}
+
+// El endpoint distingue un ISBN que el catálogo no conoce (404) de un
+// catálogo que falla o no responde (502)
+func TestLibroDesdeISBNConCatalogo(t *testing.T) {
+	t.Parallel()
+	catalogo := catalogoFalso(t)
+	srv, err := nuevoServidor(configuracionServidor{
+		Portadas:     almacenLocal{dir: t.TempDir()},
+		CatalogoISBN: proveedorOpenLibrary{base: catalogo.URL, cliente: &http.Client{Timeout: 200 * time.Millisecond}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	casos := []struct {
+		isbn   string
+		estado int
+		codigo codigoMensaje
+	}{
+		{"978-0-307-47472-8", http.StatusCreated, ""},
+		{"9780307474728", http.StatusConflict, msgISBNDuplicado},
+		{"9788420412146", http.StatusNotFound, msgISBNNoEncontrado},
+		{"9780451524935", http.StatusBadGateway, msgCatalogoNoDisponible},
+		{"9781451673319", http.StatusBadGateway, msgCatalogoNoDisponible},
+		{"9780307474729", http.StatusBadRequest, msgISBNControlInvalido},
+	}
+	for _, caso := range casos {
+		var respuesta struct {
+			Codigo codigoMensaje `json:"codigo"`
+			Libro
+		}
+		estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/libros/desde-isbn", `{"isbn":"`+caso.isbn+`"}`, &respuesta)
+		if estado != caso.estado || respuesta.Codigo != caso.codigo {
+			t.Errorf("%s: %d %q, se esperaba %d %q", caso.isbn, estado, respuesta.Codigo, caso.estado, caso.codigo)
+		}
+		if estado == http.StatusCreated && (respuesta.Autor != "Gabriel García Márquez" || respuesta.Genero != "Realismo mágico" || respuesta.Año != 2009) {
+			t.Errorf("libro creado: %+v", respuesta.Libro)
+		}
+	}
+}
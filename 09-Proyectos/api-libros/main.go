@@ -3,30 +3,45 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
 // Estructura de datos para un libro
 type Libro struct {
-	ID          int       `json:"id"`
-	Titulo      string    `json:"titulo"`
-	Autor       string    `json:"autor"`
-	Año         int       `json:"año"`
-	Genero      string    `json:"genero"`
-	Disponible  bool      `json:"disponible"`
-	FechaCreado time.Time `json:"fecha_creado"`
+	ID               int        `json:"id"`
+	Titulo           string     `json:"titulo"`
+	Autor            string     `json:"autor"`       // Nombres de los autores, separados por ", "
+	AutoresIDs       []int      `json:"autores_ids"` // Ver /api/autores
+	Año              int        `json:"año"`
+	Genero           string     `json:"genero"`
+	Disponible       bool       `json:"disponible"` // Con ejemplares se deriva de su estado
+	FechaCreado      time.Time  `json:"fecha_creado"`
+	FechaActualizado time.Time  `json:"fecha_actualizado"`      // Lo asigna el repositorio en cada cambio
+	EliminadoEn      *time.Time `json:"eliminado_en,omitempty"` // nil si no está en la papelera
+
+	// Conteos de /api/libros/{id}/ejemplares (sin las bajas); solo lectura
+	EjemplaresTotal       int `json:"ejemplares_total"`
+	EjemplaresDisponibles int `json:"ejemplares_disponibles"`
+
+	ISBN string `json:"isbn,omitempty"` // ISBN-13; los ISBN-10 se convierten
+
+	// URL de la imagen subida con PUT /api/libros/{id}/portada; solo lectura
+	Portada string `json:"portada,omitempty"`
 }
 
-// Base de datos en memoria
-var libros []Libro
-var contadorID = 1
-
 // Middleware para logging
 func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -44,7 +59,8 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, traceparent, tracestate, X-Request-ID, X-Actor, X-Sucursal, X-API-Key, Idempotency-Key, If-None-Match, If-Modified-Since")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -62,24 +78,115 @@ func responderJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// Helper para respuestas de error
-func responderError(w http.ResponseWriter, status int, mensaje string) {
-	responderJSON(w, status, map[string]string{"error": mensaje})
+// Tamaño máximo del body de las peticiones JSON
+const tamañoMaximoCuerpo = 1 << 20
+
+// Error al leer el body, con el código HTTP que corresponde
+type errorCuerpo struct {
+	Estado  int
+	Mensaje *mensaje
+}
+
+func (e *errorCuerpo) Error() string { return e.Mensaje.Error() }
+
+// Helper para leer el body JSON: exige Content-Type JSON, limita el tamaño
+// y rechaza campos desconocidos o datos sobrantes
+func decodificarJSON(w http.ResponseWriter, r *http.Request, destino interface{}) *errorCuerpo {
+	tipo, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (tipo != "application/json" && !strings.HasSuffix(tipo, "+json")) {
+		return &errorCuerpo{http.StatusUnsupportedMediaType, nuevoMensaje(msgContentTypeJSON)}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, tamañoMaximoCuerpo)
+	if err := decodificarCuerpoJSON(r.Body, destino); err != nil {
+		var demasiadoGrande *http.MaxBytesError
+		if errors.As(err, &demasiadoGrande) {
+			return &errorCuerpo{http.StatusRequestEntityTooLarge, nuevoMensaje(msgCuerpoDemasiadoGrande, demasiadoGrande.Limit)}
+		}
+		return &errorCuerpo{http.StatusBadRequest, comoMensaje(err)}
+	}
+	return nil
+}
+
+// Decodifica exactamente un valor JSON sin campos desconocidos; los errores
+// son mensajes del catálogo para mostrarlos al cliente
+func decodificarCuerpoJSON(cuerpo io.Reader, destino interface{}) error {
+	decodificador := json.NewDecoder(cuerpo)
+	decodificador.DisallowUnknownFields()
+
+	if err := decodificador.Decode(destino); err != nil {
+		var sintaxis *json.SyntaxError
+		var tipo *json.UnmarshalTypeError
+		var monto errorMonto
+		var demasiadoGrande *http.MaxBytesError
+		switch {
+		case errors.As(err, &demasiadoGrande):
+			return err
+		case errors.Is(err, io.EOF):
+			return nuevoMensaje(msgCuerpoVacio)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return nuevoMensaje(msgJSONIncompleto)
+		case errors.As(err, &sintaxis):
+			return nuevoMensaje(msgJSONInvalidoPosicion, sintaxis.Offset)
+		case errors.As(err, &monto):
+			return nuevoMensaje(msgMontoInvalido, monto.valor)
+		case errors.As(err, &tipo) && tipo.Field != "":
+			return nuevoMensaje(msgJSONTipoCampo, tipo.Field, tipo.Type.String())
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			// encoding/json no exporta un tipo para este error
+			return nuevoMensaje(msgJSONCampoDesconocido, strings.TrimPrefix(err.Error(), "json: unknown field "))
+		}
+		return nuevoMensaje(msgJSONInvalido)
+	}
+
+	// Solo se admite un valor: "{...}{...}" o basura al final es un error
+	if _, err := decodificador.Token(); !errors.Is(err, io.EOF) {
+		var demasiadoGrande *http.MaxBytesError
+		if errors.As(err, &demasiadoGrande) {
+			return err
+		}
+		return nuevoMensaje(msgJSONValorUnico)
+	}
+	return nil
 }
 
 // GET /api/libros - Obtener todos los libros
 func obtenerLibros(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+
 	// Parámetros de consulta opcionales
 	genero := r.URL.Query().Get("genero")
 	disponible := r.URL.Query().Get("disponible")
 
+	// Cualquier cambio del catálogo (incluidas las bajas) invalida el listado
+	if noModificado(w, r, s.repositorio.UltimoCambio(), s.etiquetaCatalogo()) {
+		return
+	}
+
+	// Los libros en la papelera solo aparecen si se piden
+	libros := s.repositorio.Listar(r.Context())
+	if incluir, _ := strconv.ParseBool(r.URL.Query().Get("incluir_eliminados")); incluir {
+		libros = s.repositorio.ListarConEliminados(r.Context())
+	}
+
+	librosResultado := s.filtrarLibros(libros, genero, disponible)
+
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"libros": librosResultado,
+		"total":  len(librosResultado),
+	})
+}
+
+// Aplica los filtros de género y disponibilidad (vacío = sin filtro)
+func (s *sucursal) filtrarLibros(libros []Libro, genero, disponible string) []Libro {
 	librosResultado := libros
 
-	// Filtrar por género si se especifica
+	// Filtrar por género (incluye los subgéneros) si se especifica
 	if genero != "" {
+		coincide := s.coincideGenero(genero)
 		var filtrados []Libro
 		for _, libro := range libros {
-			if strings.EqualFold(libro.Genero, genero) {
+			if coincide(libro) {
 				filtrados = append(filtrados, libro)
 			}
 		}
@@ -98,168 +205,314 @@ func obtenerLibros(w http.ResponseWriter, r *http.Request) {
 		librosResultado = filtrados
 	}
 
-	responderJSON(w, http.StatusOK, map[string]interface{}{
-		"libros": librosResultado,
-		"total":  len(librosResultado),
-	})
+	return librosResultado
+}
+
+// Valida los campos requeridos; devuelve el mensaje de error o nil
+func (s *sucursal) validarLibro(libro Libro) *mensaje {
+	if libro.Titulo == "" {
+		return nuevoMensaje(msgTituloRequerido)
+	}
+	if libro.Autor == "" && len(libro.AutoresIDs) == 0 {
+		return nuevoMensaje(msgAutorRequerido)
+	}
+	if _, ok := normalizarISBN(libro.ISBN); libro.ISBN != "" && !ok {
+		return nuevoMensaje(msgISBNInvalido)
+	}
+	if mensaje := s.validarGeneroLibro(libro); mensaje != nil {
+		return mensaje
+	}
+	return s.validarAutoresLibro(libro)
+}
+
+// Validaciones de un libro nuevo (incluye el año)
+func (s *sucursal) validarLibroNuevo(libro Libro) *mensaje {
+	if mensaje := s.validarLibro(libro); mensaje != nil {
+		return mensaje
+	}
+	if libro.Año < 1000 || libro.Año > time.Now().Year() {
+		return nuevoMensaje(msgAñoInvalido)
+	}
+	return nil
+}
+
+// Completa los datos por defecto de un libro nuevo y lo guarda
+func (s *sucursal) registrarLibroNuevo(ctx context.Context, libro Libro) Libro {
+	// Asignar fecha
+	libro.FechaCreado = time.Now()
+	libro.Disponible = true // Por defecto disponible
+
+	// Agregar a la base de datos (asigna el ID)
+	return s.repositorio.Crear(ctx, libro)
 }
 
 // GET /api/libros/{id} - Obtener un libro específico
 func obtenerLibroPorID(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+
 	// Extraer ID de la URL
-	path := strings.TrimPrefix(r.URL.Path, "/api/libros/")
-	id, err := strconv.Atoi(path)
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
 	if err != nil {
-		responderError(w, http.StatusBadRequest, "ID inválido")
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
 		return
 	}
 
 	// Buscar el libro
-	for _, libro := range libros {
-		if libro.ID == id {
-			responderJSON(w, http.StatusOK, libro)
-			return
-		}
+	libro, ok := s.repositorio.Obtener(r.Context(), id)
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgLibroNoEncontrado)
+		return
+	}
+	if noModificado(w, r, libro.FechaActualizado, s.etiquetaLibro(libro)) {
+		return
 	}
 
-	responderError(w, http.StatusNotFound, "Libro no encontrado")
+	responderJSON(w, http.StatusOK, libro)
 }
 
 // POST /api/libros - Crear un nuevo libro
 func crearLibro(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
 	var nuevoLibro Libro
 
 	// Decodificar JSON del body
-	if err := json.NewDecoder(r.Body).Decode(&nuevoLibro); err != nil {
-		responderError(w, http.StatusBadRequest, "JSON inválido")
+	if err := decodificarJSON(w, r, &nuevoLibro); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
 		return
 	}
 
 	// Validaciones
-	if nuevoLibro.Titulo == "" {
-		responderError(w, http.StatusBadRequest, "El título es requerido")
+	if mensaje := s.validarLibroNuevo(nuevoLibro); mensaje != nil {
+		responderMensaje(w, r, http.StatusBadRequest, mensaje)
 		return
 	}
-	if nuevoLibro.Autor == "" {
-		responderError(w, http.StatusBadRequest, "El autor es requerido")
-		return
-	}
-	if nuevoLibro.Año < 1000 || nuevoLibro.Año > time.Now().Year() {
-		responderError(w, http.StatusBadRequest, "Año inválido")
-		return
-	}
-
-	// Asignar ID y fecha
-	nuevoLibro.ID = contadorID
-	contadorID++
-	nuevoLibro.FechaCreado = time.Now()
-	nuevoLibro.Disponible = true // Por defecto disponible
 
-	// Agregar a la base de datos
-	libros = append(libros, nuevoLibro)
+	nuevoLibro = s.registrarLibroNuevo(r.Context(), nuevoLibro)
 
 	responderJSON(w, http.StatusCreated, nuevoLibro)
 }
 
 // PUT /api/libros/{id} - Actualizar un libro
 func actualizarLibro(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+
 	// Extraer ID
-	path := strings.TrimPrefix(r.URL.Path, "/api/libros/")
-	id, err := strconv.Atoi(path)
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
 	if err != nil {
-		responderError(w, http.StatusBadRequest, "ID inválido")
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
 		return
 	}
 
 	// Buscar el libro
-	indice := -1
-	for i, libro := range libros {
-		if libro.ID == id {
-			indice = i
-			break
-		}
-	}
-
-	if indice == -1 {
-		responderError(w, http.StatusNotFound, "Libro no encontrado")
+	libroOriginal, ok := s.repositorio.Obtener(r.Context(), id)
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgLibroNoEncontrado)
 		return
 	}
 
 	// Decodificar datos actualizados
 	var libroActualizado Libro
-	if err := json.NewDecoder(r.Body).Decode(&libroActualizado); err != nil {
-		responderError(w, http.StatusBadRequest, "JSON inválido")
+	if err := decodificarJSON(w, r, &libroActualizado); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
 		return
 	}
 
 	// Mantener ID y fecha de creación original
-	libroActualizado.ID = libros[indice].ID
-	libroActualizado.FechaCreado = libros[indice].FechaCreado
+	libroActualizado.ID = libroOriginal.ID
+	libroActualizado.FechaCreado = libroOriginal.FechaCreado
 
 	// Validaciones
-	if libroActualizado.Titulo == "" {
-		responderError(w, http.StatusBadRequest, "El título es requerido")
-		return
-	}
-	if libroActualizado.Autor == "" {
-		responderError(w, http.StatusBadRequest, "El autor es requerido")
+	if mensaje := s.validarLibro(libroActualizado); mensaje != nil {
+		responderMensaje(w, r, http.StatusBadRequest, mensaje)
 		return
 	}
 
 	// Actualizar en la base de datos
-	libros[indice] = libroActualizado
+	guardado, ok := s.repositorio.Actualizar(r.Context(), libroActualizado)
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgLibroNoEncontrado)
+		return
+	}
 
-	responderJSON(w, http.StatusOK, libroActualizado)
+	responderJSON(w, http.StatusOK, guardado)
 }
 
-// DELETE /api/libros/{id} - Eliminar un libro
+// DELETE /api/libros/{id} - Enviar un libro a la papelera
 func eliminarLibro(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+
 	// Extraer ID
-	path := strings.TrimPrefix(r.URL.Path, "/api/libros/")
-	id, err := strconv.Atoi(path)
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
 	if err != nil {
-		responderError(w, http.StatusBadRequest, "ID inválido")
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
 		return
 	}
 
 	// Buscar y eliminar el libro
-	for i, libro := range libros {
-		if libro.ID == id {
-			// Eliminar del slice
-			libros = append(libros[:i], libros[i+1:]...)
-			responderJSON(w, http.StatusOK, map[string]string{
-				"mensaje": "Libro eliminado correctamente",
-			})
-			return
+	if !s.repositorio.Eliminar(r.Context(), id) {
+		responderError(w, r, http.StatusNotFound, msgLibroNoEncontrado)
+		return
+	}
+
+	responderJSON(w, http.StatusOK, map[string]string{
+		"mensaje": traducir(r.Context(), msgLibroEliminado),
+	})
+}
+
+// POST /api/libros/{id}/restaurar - Sacar un libro de la papelera
+func restaurarLibro(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+
+	// Extraer ID
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return
+	}
+
+	libro, ok := s.repositorio.Restaurar(r.Context(), id)
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgLibroNoEnPapelera)
+		return
+	}
+
+	responderJSON(w, http.StatusOK, libro)
+}
+
+// Ruta registrada en el router
+type ruta struct {
+	Metodo      string
+	Patron      string // Los segmentos {nombre} aceptan cualquier valor
+	Nombre      string
+	Descripcion string
+	Handler     http.HandlerFunc
+}
+
+// Tabla de rutas de la API (las rutas literales van antes que las de parámetros)
+func definirRutas() []ruta {
+	return []ruta{
+		{"GET", "/api/libros", "obtenerLibros", "Obtener todos los libros", obtenerLibros},
+		{"POST", "/api/libros", "crearLibro", "Crear nuevo libro (admite Idempotency-Key)", conIdempotencia(crearLibro)},
+		{"POST", "/api/libros/desde-isbn", "crearLibroDesdeISBN", "Crear un libro con los datos del catálogo externo", conIdempotencia(crearLibroDesdeISBN)},
+		{"GET", "/api/libros/eventos", "transmitirEventos", "Cambios en tiempo real (SSE)", transmitirEventos},
+		{"GET", "/api/libros/eventos/ws", "transmitirEventosWS", "Cambios en tiempo real (WebSocket)", transmitirEventosWS},
+		{"GET", "/api/libros/{id}", "obtenerLibroPorID", "Obtener libro por ID", obtenerLibroPorID},
+		{"PUT", "/api/libros/{id}", "actualizarLibro", "Actualizar libro", actualizarLibro},
+		{"DELETE", "/api/libros/{id}", "eliminarLibro", "Enviar libro a la papelera", eliminarLibro},
+		{"GET", "/api/libros/{id}/historial", "obtenerHistorialLibro", "Historial de cambios de un libro", obtenerHistorialLibro},
+		{"GET", "/api/libros/{id}/ejemplares", "obtenerEjemplares", "Ejemplares de un libro (?incluir_bajas=)", obtenerEjemplares},
+		{"POST", "/api/libros/{id}/ejemplares", "crearEjemplar", "Agregar un ejemplar al libro", crearEjemplar},
+		{"PUT", "/api/libros/{id}/portada", "subirPortada", "Subir o reemplazar la portada", subirPortada},
+		{"GET", "/api/libros/{id}/portada", "obtenerPortada", "Imagen original de la portada", obtenerPortada},
+		{"DELETE", "/api/libros/{id}/portada", "eliminarPortada", "Quitar la portada", eliminarPortada},
+		{"GET", "/api/libros/{id}/portada/miniatura", "obtenerMiniaturaPortada", "Miniatura JPEG de la portada", obtenerMiniaturaPortada},
+		{"GET", "/api/libros/{id}/reservas", "obtenerReservasLibro", "Cola de reservas del libro", obtenerReservasLibro},
+		{"POST", "/api/libros/{id}/reservas", "crearReserva", "Reservar un libro", crearReserva},
+		{"POST", "/api/libros/{id}/restaurar", "restaurarLibro", "Restaurar libro de la papelera", restaurarLibro},
+		{"GET", "/api/generos", "obtenerGeneros", "Árbol de géneros con cantidad de libros", obtenerGeneros},
+		{"POST", "/api/generos", "crearGenero", "Crear género o subgénero", crearGenero},
+		{"DELETE", "/api/generos/{id}", "eliminarGenero", "Eliminar género sin subgéneros ni libros", eliminarGenero},
+		{"GET", "/api/estadisticas", "obtenerEstadisticas", "Estadísticas del catálogo", obtenerEstadisticas},
+		{"GET", "/api/estadisticas/{reporte}", "obtenerReporteEstadisticas", "Un reporte en JSON o CSV (?formato=csv)", obtenerReporteEstadisticas},
+		{"GET", "/api/auditoria", "obtenerAuditoria", "Registro de auditoría (?desde=&hasta=)", obtenerAuditoria},
+		{"GET", "/api/ejemplares/{id}", "obtenerEjemplarPorID", "Obtener ejemplar por ID", obtenerEjemplarPorID},
+		{"PUT", "/api/ejemplares/{id}", "actualizarEjemplar", "Cambiar ubicación, condición o estado de un ejemplar", actualizarEjemplar},
+		{"DELETE", "/api/ejemplares/{id}", "eliminarEjemplar", "Dar de baja un ejemplar", eliminarEjemplar},
+		{"GET", "/api/reservas/{id}", "obtenerReservaPorID", "Estado y posición de una reserva", obtenerReservaPorID},
+		{"DELETE", "/api/reservas/{id}", "cancelarReserva", "Cancelar una reserva", cancelarReserva},
+		{"POST", "/api/reservas/{id}/retirar", "retirarReserva", "Retirar el ejemplar de una reserva lista", retirarReserva},
+		{"GET", "/api/prestamos", "obtenerPrestamos", "Listar préstamos (?socio=, ?activos=)", obtenerPrestamos},
+		{"POST", "/api/prestamos", "crearPrestamo", "Prestar un ejemplar disponible", crearPrestamo},
+		{"GET", "/api/prestamos/{id}", "obtenerPrestamoPorID", "Obtener préstamo con la multa al día", obtenerPrestamoPorID},
+		{"POST", "/api/prestamos/{id}/devolver", "devolverPrestamo", "Registrar la devolución (?fecha=)", devolverPrestamo},
+		{"GET", "/api/multas/politica", "obtenerPoliticaMultas", "Política de multas vigente", obtenerPoliticaMultas},
+		{"PUT", "/api/multas/politica", "actualizarPoliticaMultas", "Cambiar la política de multas", actualizarPoliticaMultas},
+		{"GET", "/api/socios/{socio}/saldo", "obtenerSaldoSocio", "Multas, pagos y saldo de un socio", obtenerSaldoSocio},
+		{"POST", "/api/socios/{socio}/pagos", "registrarPago", "Registrar un pago de multas", registrarPago},
+		{"GET", "/api/autores", "obtenerAutores", "Listar autores (?nombre=)", obtenerAutores},
+		{"POST", "/api/autores", "crearAutor", "Crear autor", crearAutor},
+		{"GET", "/api/autores/{id}", "obtenerAutorPorID", "Obtener autor por ID", obtenerAutorPorID},
+		{"PUT", "/api/autores/{id}", "actualizarAutor", "Actualizar autor", actualizarAutor},
+		{"DELETE", "/api/autores/{id}", "eliminarAutor", "Eliminar autor sin libros", eliminarAutor},
+		{"GET", "/api/autores/{id}/libros", "obtenerLibrosDeAutor", "Libros de un autor", obtenerLibrosDeAutor},
+		{"GET", "/api/webhooks", "obtenerWebhooks", "Listar suscripciones de webhooks", obtenerWebhooks},
+		{"POST", "/api/webhooks", "crearWebhook", "Crear suscripción de webhook", crearWebhook},
+		{"GET", "/api/webhooks/fallidos", "obtenerWebhooksFallidos", "Entregas que agotaron los reintentos", obtenerWebhooksFallidos},
+		{"POST", "/api/webhooks/fallidos/{id}/reintentar", "reintentarWebhookFallido", "Reintentar una entrega fallida", reintentarWebhookFallido},
+		{"GET", "/api/webhooks/{id}", "obtenerWebhookPorID", "Obtener suscripción de webhook", obtenerWebhookPorID},
+		{"DELETE", "/api/webhooks/{id}", "eliminarWebhook", "Eliminar suscripción de webhook", eliminarWebhook},
+		{"GET", "/api/webhooks/{id}/entregas", "obtenerEntregasWebhook", "Log de entregas de un webhook", obtenerEntregasWebhook},
+		{"GET", "/api/admin/sucursales", "obtenerSucursales", "Resumen de las sucursales (administración)", obtenerSucursales},
+		{"GET", "/api/admin/libros", "obtenerLibrosTodasSucursales", "Libros de todas las sucursales (administración)", obtenerLibrosTodasSucursales},
+		{"POST", "/graphql", "manejarGraphQL", "Consultas y mutaciones GraphQL", manejarGraphQL},
+		{"GET", "/graphql", "manejarGraphQL", "Consultas GraphQL por query string", manejarGraphQL},
+		{"GET", "/openapi.json", "servirOpenAPI", "Especificación OpenAPI 3.1", servirOpenAPI},
+		{"GET", "/docs", "servirDocumentacion", "Documentación interactiva (Swagger UI)", servirDocumentacion},
+		{"GET", "/docs/swagger-ui/{archivo}", "servirSwaggerUI", "Archivos de Swagger UI", servirSwaggerUI},
+	}
+}
+
+type claveParametros struct{}
+
+// Compara un patrón con la ruta y devuelve los parámetros encontrados
+func coincideRuta(patron, path string) (map[string]string, bool) {
+	segPatron := strings.Split(strings.Trim(patron, "/"), "/")
+	segPath := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segPatron) != len(segPath) {
+		return nil, false
+	}
+
+	parametros := map[string]string{}
+	for i, seg := range segPatron {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if segPath[i] == "" {
+				return nil, false
+			}
+			parametros[seg[1:len(seg)-1]] = segPath[i]
+			continue
+		}
+		if seg != segPath[i] {
+			return nil, false
 		}
 	}
+	return parametros, true
+}
 
-	responderError(w, http.StatusNotFound, "Libro no encontrado")
+// parametroRuta devuelve un segmento variable de la ruta, por ejemplo "id"
+func parametroRuta(r *http.Request, nombre string) string {
+	parametros, _ := r.Context().Value(claveParametros{}).(map[string]string)
+	return parametros[nombre]
 }
 
 // Router principal
-func manejarRuta(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
+func (srv *servidor) manejarRuta(w http.ResponseWriter, r *http.Request) {
+	ctx, span := iniciarSpan(r.Context(), "manejarRuta")
+	defer span.Finalizar()
 
-	switch {
-	case path == "/api/libros" && r.Method == "GET":
-		obtenerLibros(w, r)
-	case path == "/api/libros" && r.Method == "POST":
-		crearLibro(w, r)
-	case strings.HasPrefix(path, "/api/libros/") && r.Method == "GET":
-		obtenerLibroPorID(w, r)
-	case strings.HasPrefix(path, "/api/libros/") && r.Method == "PUT":
-		actualizarLibro(w, r)
-	case strings.HasPrefix(path, "/api/libros/") && r.Method == "DELETE":
-		eliminarLibro(w, r)
-	default:
-		responderError(w, http.StatusNotFound, "Endpoint no encontrado")
+	for _, rt := range srv.rutas {
+		if rt.Metodo != r.Method {
+			continue
+		}
+		parametros, ok := coincideRuta(rt.Patron, r.URL.Path)
+		if !ok {
+			continue
+		}
+
+		span.AsignarAtributo("http.route", rt.Patron)
+		aplicarPoliticaCache(w, rt)
+		ctx = context.WithValue(ctx, claveParametros{}, parametros)
+		trazarHandler(rt.Nombre, rt.Handler, w, r.WithContext(ctx))
+		return
 	}
+
+	span.RegistrarError("ruta no encontrada")
+	responderError(w, r, http.StatusNotFound, msgEndpointNoEncontrado)
 }
 
-func inicializarDatos() {
-	// Datos de ejemplo
-	libros = []Libro{
+// cargarDatosEjemplo reemplaza el catálogo de la sucursal por los libros
+// de ejemplo, con sus géneros, autores, ejemplares y préstamos
+func (s *sucursal) cargarDatosEjemplo() {
+	libros := []Libro{
 		{
 			ID:          1,
 			Titulo:      "Cien años de soledad",
@@ -288,30 +541,111 @@ func inicializarDatos() {
 			FechaCreado: time.Now().AddDate(0, 0, -5),
 		},
 	}
-	contadorID = 4
+	s.repositorio.Reiniciar(libros, 4)
+	s.inicializarGeneros(context.Background())
+	s.migrarAutores(context.Background())
+	s.inicializarEjemplares()
+	s.inicializarPrestamos()
 }
 
 func main() {
-	// Inicializar datos de ejemplo
-	inicializarDatos()
+	// Sucursales (ver SUCURSALES, SUCURSALES_SECRETO y SUCURSALES_ABIERTAS)
+	ids, err := idsSucursales()
+	if err != nil {
+		log.Fatalf("SUCURSALES: %v", err)
+	}
+
+	// Exportador de trazas (ver TRAZAS_EXPORTADOR y OTEL_EXPORTER_OTLP_ENDPOINT)
+	trazas := exportadorTrazasConfigurado()
+	if trazas != nil {
+		defer trazas.Cerrar()
+	}
+
+	// Catálogo externo para POST /api/libros/desde-isbn (ver ISBN_PROVEEDOR)
+	proveedor, err := proveedorMetadatosConfigurado()
+	if err != nil {
+		log.Fatalf("Proveedor de metadatos por ISBN: %v", err)
+	}
 
-	// Configurar rutas
-	handler := corsMiddleware(loggingMiddleware(manejarRuta))
-	http.HandleFunc("/", handler)
+	// Sucursales con los datos de ejemplo, rutas y especificación OpenAPI
+	srv, err := nuevoServidor(configuracionServidor{
+		Sucursales:   ids,
+		Secreto:      []byte(os.Getenv("SUCURSALES_SECRETO")),
+		ClavesAPI:    clavesAPIConfiguradas(),
+		CatalogoISBN: proveedor,
+		Portadas:     almacenLocal{dir: directorioPortadas()},
+		DatosEjemplo: true,
+		Trazas:       trazas,
+
+		SucursalesAbiertas:    os.Getenv("SUCURSALES_ABIERTAS") == "true",
+		WebhooksRedesPrivadas: os.Getenv("WEBHOOKS_REDES_PRIVADAS") == "true",
+	})
+	if err != nil {
+		log.Fatalf("No se pudo crear el servidor: %v", err)
+	}
 
-	// Información de inicio
+	// Información de inicio, en el idioma de IDIOMA o LANG
+	idioma := idiomaServidor()
+	imprimir := func(codigo codigoMensaje, args ...interface{}) {
+		fmt.Println(nuevoMensaje(codigo, args...).Traducir(idioma))
+	}
 	puerto := ":8080"
-	fmt.Printf("🚀 Servidor API de Libros iniciado en http://localhost%s\n", puerto)
-	fmt.Println("📚 Endpoints disponibles:")
-	fmt.Println("  GET    /api/libros           - Obtener todos los libros")
-	fmt.Println("  GET    /api/libros/{id}      - Obtener libro por ID")
-	fmt.Println("  POST   /api/libros           - Crear nuevo libro")
-	fmt.Println("  PUT    /api/libros/{id}      - Actualizar libro")
-	fmt.Println("  DELETE /api/libros/{id}      - Eliminar libro")
-	fmt.Println("\n💡 Ejemplos de uso con curl:")
+	imprimir(msgInicioServidor, puerto)
+	imprimir(msgInicioEndpoints)
+	for _, rt := range srv.rutas {
+		fmt.Printf("  %-6s %-38s - %s\n", rt.Metodo, rt.Patron, rt.Descripcion)
+	}
+	imprimir(msgInicioDocs, puerto)
+	imprimir(msgInicioISBN, proveedor.Nombre())
+	imprimir(msgInicioSucursales, strings.Join(ids, ", "), ids[0])
+	switch {
+	case len(srv.secreto) > 0:
+	case srv.abiertas:
+		imprimir(msgInicioAbiertas)
+	default:
+		imprimir(msgInicioSinSecreto)
+	}
+	fmt.Println()
+	imprimir(msgInicioEjemplos)
 	fmt.Println("  curl http://localhost:8080/api/libros")
 	fmt.Println("  curl -X POST -H 'Content-Type: application/json' -d '{\"titulo\":\"Mi Libro\",\"autor\":\"Mi Autor\",\"año\":2023,\"genero\":\"Ficción\"}' http://localhost:8080/api/libros")
 
 	// Iniciar servidor
-	log.Fatal(http.ListenAndServe(puerto, nil))
+	servidorHTTP := &http.Server{Addr: puerto, Handler: srv.Handler()}
+	servidorHTTP.RegisterOnShutdown(srv.CerrarFlujos)
+	go func() {
+		if err := servidorHTTP.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Servidor gRPC en un puerto separado, sobre el mismo repositorio
+	puertoGRPC := ":9090"
+	servidorGRPC := iniciarServidorGRPC(puertoGRPC, srv)
+	imprimir(msgInicioGRPC, puertoGRPC)
+
+	// Apagado ordenado con Ctrl+C para no perder las trazas pendientes
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Webhooks, vencimiento de reservas (RESERVAS_PLAZO) y purga de la
+	// papelera (PAPELERA_RETENCION) en segundo plano
+	retencion := retencionPapelera()
+	plazo := plazoRetiroReservas()
+	srv.Iniciar(ctx, plazo, retencion)
+	imprimir(msgInicioPapelera, retencion)
+	imprimir(msgInicioReservas, plazo)
+
+	<-ctx.Done()
+
+	log.Println(nuevoMensaje(msgInicioApagando).Traducir(idioma))
+	ctxApagado, cancelar := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelar()
+	if err := servidorHTTP.Shutdown(ctxApagado); err != nil {
+		log.Printf("Error al apagar: %v", err)
+	}
+	if err := servidorGRPC.Shutdown(ctxApagado); err != nil {
+		log.Printf("Error al apagar gRPC: %v", err)
+	}
+	srv.Detener()
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// decodificar pasa el cuerpo por decodificarJSON como lo haría un handler
+func decodificar(tipo string, cuerpo []byte, destino interface{}) *errorCuerpo {
+	req := httptest.NewRequest(http.MethodPost, "/api/libros", bytes.NewReader(cuerpo))
+	if tipo != "" {
+		req.Header.Set("Content-Type", tipo)
+	}
+	return decodificarJSON(httptest.NewRecorder(), req, destino)
+}
+
+func TestDecodificarJSON(t *testing.T) {
+	t.Parallel()
+	casos := []struct {
+		nombre string
+		tipo   string
+		cuerpo string
+		estado int // 0 = sin error
+		codigo codigoMensaje
+	}{
+		{"válido", "application/json", `{"titulo":"Rayuela","año":1963}`, 0, ""},
+		{"con charset", "application/json; charset=utf-8", `{"titulo":"Rayuela"}`, 0, ""},
+		{"sufijo +json", "application/merge-patch+json", `{"titulo":"Rayuela"}`, 0, ""},
+		{"sin Content-Type", "", `{"titulo":"Rayuela"}`, 415, msgContentTypeJSON},
+		{"texto plano", "text/plain", `{"titulo":"Rayuela"}`, 415, msgContentTypeJSON},
+		{"vacío", "application/json", ``, 400, msgCuerpoVacio},
+		{"incompleto", "application/json", `{"titulo":`, 400, msgJSONIncompleto},
+		{"sintaxis", "application/json", `{"titulo" "x"}`, 400, msgJSONInvalidoPosicion},
+		{"tipo equivocado", "application/json", `{"año":"1963"}`, 400, msgJSONTipoCampo},
+		{"campo desconocido", "application/json", `{"titulo":"x","precio":3}`, 400, msgJSONCampoDesconocido},
+		{"dos valores", "application/json", `{"titulo":"a"}{"titulo":"b"}`, 400, msgJSONValorUnico},
+		{"basura al final", "application/json", `{"titulo":"a"} x`, 400, msgJSONValorUnico},
+		{"no es objeto", "application/json", `[1,2]`, 400, msgJSONInvalido},
+		{"demasiado grande", "application/json", `{"titulo":"` + strings.Repeat("a", tamañoMaximoCuerpo) + `"}`, 413, msgCuerpoDemasiadoGrande},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			t.Parallel()
+			var libro Libro
+			err := decodificar(caso.tipo, []byte(caso.cuerpo), &libro)
+			switch {
+			case caso.estado == 0 && err != nil:
+				t.Fatalf("error inesperado %d %s", err.Estado, err.Mensaje.Codigo)
+			case caso.estado == 0:
+				return
+			case err == nil:
+				t.Fatalf("se esperaba %d %s y no hubo error", caso.estado, caso.codigo)
+			case err.Estado != caso.estado || err.Mensaje.Codigo != caso.codigo:
+				t.Errorf("error %d %s, se esperaba %d %s", err.Estado, err.Mensaje.Codigo, caso.estado, caso.codigo)
+			}
+		})
+	}
+}
+
+// Montos: los errores del UnmarshalJSON propio llegan como msgMontoInvalido
+func TestDecodificarJSONMonto(t *testing.T) {
+	t.Parallel()
+	var politica politicaMultas
+	if err := decodificar("application/json", []byte(`{"tarifa_diaria":"0.50"}`), &politica); err != nil {
+		t.Fatalf("error inesperado %s", err.Mensaje.Codigo)
+	}
+	if politica.TarifaDiaria != 50 {
+		t.Errorf("tarifa = %d centavos, se esperaban 50", politica.TarifaDiaria)
+	}
+	err := decodificar("application/json", []byte(`{"tarifa_diaria":"1,5"}`), &politica)
+	if err == nil || err.Estado != http.StatusBadRequest || err.Mensaje.Codigo != msgMontoInvalido {
+		t.Errorf("err = %+v, se esperaba 400 %s", err, msgMontoInvalido)
+	}
+}
+
+// El decodificador nunca entra en pánico: devuelve un valor o un error 4xx
+// con un mensaje del catálogo que se puede mostrar en todos los idiomas
+func FuzzDecodificarCuerpoJSON(f *testing.F) {
+	semillas := []struct {
+		tipo   string
+		cuerpo string
+	}{
+		{"application/json", `{"titulo":"Rayuela","autor":"Julio Cortázar","año":1963,"genero":"Novela","disponible":true}`},
+		{"application/json", `{"autores_ids":[1,2],"isbn":"978-84-376-0494-7"}`},
+		{"application/json", `{"tarifa_diaria":"0.50","tope":12,"dias_gracia":2}`},
+		{"application/json", `{"titulo":"a"}{"titulo":"b"}`},
+		{"application/json", `{"año":"1963"}`},
+		{"application/json", `{"monto":"-1"}`},
+		{"application/json", `[`},
+		{"application/json", ``},
+		{"application/json; charset=utf-8", `null`},
+		{"text/plain", `{}`},
+		{"", `{}`},
+		{"application/json;;", `{}`},
+	}
+	for _, s := range semillas {
+		f.Add(s.tipo, []byte(s.cuerpo), false)
+		f.Add(s.tipo, []byte(s.cuerpo), true)
+	}
+
+	f.Fuzz(func(t *testing.T, tipo string, cuerpo []byte, comoPolitica bool) {
+		var destino interface{} = &Libro{}
+		if comoPolitica {
+			destino = &politicaMultas{}
+		}
+
+		err := decodificar(tipo, cuerpo, destino)
+		if err == nil {
+			// Lo aceptado era un único valor JSON válido y se puede volver a serializar
+			if !json.Valid(bytes.TrimSpace(cuerpo)) {
+				t.Fatalf("se aceptó un cuerpo que no es JSON válido: %q", cuerpo)
+			}
+			if _, errMarshal := json.Marshal(destino); errMarshal != nil {
+				t.Fatalf("el valor decodificado no se puede serializar: %v", errMarshal)
+			}
+			return
+		}
+
+		switch err.Estado {
+		case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		default:
+			t.Fatalf("estado %d para %q: solo se esperan 400, 413 o 415", err.Estado, cuerpo)
+		}
+		if err.Mensaje == nil {
+			t.Fatal("error sin mensaje")
+		}
+		for _, idioma := range idiomas {
+			if texto := err.Mensaje.Traducir(idioma); texto == "" || strings.Contains(texto, "%!") {
+				t.Fatalf("mensaje %s mal formado en %s: %q", err.Mensaje.Codigo, idioma, texto)
+			}
+		}
+	})
+}
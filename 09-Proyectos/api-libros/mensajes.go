@@ -0,0 +1,686 @@
+// Catálogo de mensajes de la API en español e inglés
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Código estable de un mensaje; es lo que conviene comparar en los clientes
+type codigoMensaje string
+
+// Errores generales y del body
+const (
+	msgErrorInterno          codigoMensaje = "error_interno"
+	msgIDInvalido            codigoMensaje = "id_invalido"
+	msgEndpointNoEncontrado  codigoMensaje = "endpoint_no_encontrado"
+	msgContentTypeJSON       codigoMensaje = "content_type_json"
+	msgCuerpoDemasiadoGrande codigoMensaje = "cuerpo_demasiado_grande"
+	msgCuerpoVacio           codigoMensaje = "cuerpo_vacio"
+	msgCuerpoIlegible        codigoMensaje = "cuerpo_ilegible"
+	msgJSONIncompleto        codigoMensaje = "json_incompleto"
+	msgJSONInvalido          codigoMensaje = "json_invalido"
+	msgJSONInvalidoPosicion  codigoMensaje = "json_invalido_posicion"
+	msgJSONTipoCampo         codigoMensaje = "json_tipo_campo"
+	msgJSONCampoDesconocido  codigoMensaje = "json_campo_desconocido"
+	msgJSONValorUnico        codigoMensaje = "json_valor_unico"
+	msgVariablesInvalidas    codigoMensaje = "variables_invalidas"
+	msgFechaDesdeInvalida    codigoMensaje = "fecha_desde_invalida"
+	msgFechaHastaInvalida    codigoMensaje = "fecha_hasta_invalida"
+	msgRangoFechasInvertido  codigoMensaje = "rango_fechas_invertido"
+	msgRangoFechasExcesivo   codigoMensaje = "rango_fechas_excesivo"
+	msgLimiteInvalido        codigoMensaje = "limite_invalido"
+	msgReporteDesconocido    codigoMensaje = "reporte_desconocido"
+)
+
+// Libros, autores y géneros
+const (
+	msgLibroNoEncontrado        codigoMensaje = "libro_no_encontrado"
+	msgLibroNoEnPapelera        codigoMensaje = "libro_no_en_papelera"
+	msgLibroEliminado           codigoMensaje = "libro_eliminado"
+	msgTituloRequerido          codigoMensaje = "titulo_requerido"
+	msgAutorRequerido           codigoMensaje = "autor_requerido"
+	msgISBNInvalido             codigoMensaje = "isbn_invalido"
+	msgAñoInvalido              codigoMensaje = "anio_invalido"
+	msgAutorInexistente         codigoMensaje = "autor_inexistente"
+	msgAutorNoEncontrado        codigoMensaje = "autor_no_encontrado"
+	msgAutorDuplicado           codigoMensaje = "autor_duplicado"
+	msgAutorConLibros           codigoMensaje = "autor_con_libros"
+	msgAutorEliminado           codigoMensaje = "autor_eliminado"
+	msgNombreRequerido          codigoMensaje = "nombre_requerido"
+	msgAñoNacimientoInvalido    codigoMensaje = "anio_nacimiento_invalido"
+	msgAñoFallecimientoInvalido codigoMensaje = "anio_fallecimiento_invalido"
+	msgFallecimientoAnterior    codigoMensaje = "fallecimiento_anterior_nacimiento"
+	msgGeneroDesconocido        codigoMensaje = "genero_desconocido"
+	msgGeneroNoEncontrado       codigoMensaje = "genero_no_encontrado"
+	msgGeneroDuplicado          codigoMensaje = "genero_duplicado"
+	msgGeneroPadreInexistente   codigoMensaje = "genero_padre_inexistente"
+	msgGeneroConSubgeneros      codigoMensaje = "genero_con_subgeneros"
+	msgGeneroConLibros          codigoMensaje = "genero_con_libros"
+	msgGeneroEliminado          codigoMensaje = "genero_eliminado"
+)
+
+// Ejemplares, préstamos, multas y reservas
+const (
+	msgEjemplarNoEncontrado    codigoMensaje = "ejemplar_no_encontrado"
+	msgEjemplarEnEstado        codigoMensaje = "ejemplar_en_estado"
+	msgEjemplarDeBaja          codigoMensaje = "ejemplar_de_baja"
+	msgEjemplarYaDeBaja        codigoMensaje = "ejemplar_ya_de_baja"
+	msgEjemplarApartado        codigoMensaje = "ejemplar_apartado"
+	msgCodigoBarrasRequerido   codigoMensaje = "codigo_barras_requerido"
+	msgCodigoBarrasDuplicado   codigoMensaje = "codigo_barras_duplicado"
+	msgCodigoBarrasInmutable   codigoMensaje = "codigo_barras_inmutable"
+	msgCondicionInvalida       codigoMensaje = "condicion_invalida"
+	msgEstadoInvalido          codigoMensaje = "estado_invalido"
+	msgBajaConDelete           codigoMensaje = "baja_con_delete"
+	msgReservaConPost          codigoMensaje = "reserva_con_post"
+	msgPrestamoConPost         codigoMensaje = "prestamo_con_post"
+	msgSocioRequerido          codigoMensaje = "socio_requerido"
+	msgPrestamoNoEncontrado    codigoMensaje = "prestamo_no_encontrado"
+	msgPrestamoDevuelto        codigoMensaje = "prestamo_devuelto"
+	msgDevolucionAnterior      codigoMensaje = "devolucion_anterior"
+	msgFechaDevolucionInvalida codigoMensaje = "fecha_devolucion_invalida"
+	msgDiasGraciaNegativos     codigoMensaje = "dias_gracia_negativos"
+	msgPlazoPrestamoInvalido   codigoMensaje = "plazo_prestamo_invalido"
+	msgFeriadoInvalido         codigoMensaje = "feriado_invalido"
+	msgMontoInvalido           codigoMensaje = "monto_invalido"
+	msgMontoNoPositivo         codigoMensaje = "monto_no_positivo"
+	msgPagoExcedeSaldo         codigoMensaje = "pago_excede_saldo"
+	msgReservaNoEncontrada     codigoMensaje = "reserva_no_encontrada"
+	msgReservaDuplicada        codigoMensaje = "reserva_duplicada"
+	msgReservaEnEstado         codigoMensaje = "reserva_en_estado"
+	msgReservaNoLista          codigoMensaje = "reserva_no_lista"
+)
+
+// Idempotencia, ISBN y portadas
+const (
+	msgClaveIdempotenciaInvalida codigoMensaje = "idempotencia_clave_invalida"
+	msgClaveIdempotenciaUsada    codigoMensaje = "idempotencia_otro_cuerpo"
+	msgClaveIdempotenciaEnCurso  codigoMensaje = "idempotencia_en_curso"
+	msgISBNControlInvalido       codigoMensaje = "isbn_control_invalido"
+	msgISBNDuplicado             codigoMensaje = "isbn_duplicado"
+	msgISBNNoEncontrado          codigoMensaje = "isbn_no_encontrado"
+	msgCatalogoNoDisponible      codigoMensaje = "catalogo_no_disponible"
+	msgCatalogoSinGenero         codigoMensaje = "catalogo_sin_genero"
+	msgCatalogoIncompleto        codigoMensaje = "catalogo_incompleto"
+	msgSinPortada                codigoMensaje = "sin_portada"
+	msgPortadaIlegible           codigoMensaje = "portada_ilegible"
+	msgPortadaNoGuardada         codigoMensaje = "portada_no_guardada"
+	msgPortadaTipo               codigoMensaje = "portada_tipo"
+	msgMiniaturaFallida          codigoMensaje = "miniatura_fallida"
+	msgMultipartInvalido         codigoMensaje = "multipart_invalido"
+	msgFaltaCampoPortada         codigoMensaje = "falta_campo_portada"
+	msgImagenVacia               codigoMensaje = "imagen_vacia"
+	msgImagenIlegible            codigoMensaje = "imagen_ilegible"
+	msgImagenDañada              codigoMensaje = "imagen_danada"
+	msgImagenExcedeBytes         codigoMensaje = "imagen_excede_bytes"
+	msgImagenExcedeLado          codigoMensaje = "imagen_excede_lado"
+)
+
+// Eventos, webhooks y sucursales
+const (
+	msgStreamingNoSoportado codigoMensaje = "streaming_no_soportado"
+	msgIDEventoInvalido     codigoMensaje = "id_evento_invalido"
+	msgWebSocketEsperado    codigoMensaje = "websocket_esperado"
+	msgWebSocketVersion     codigoMensaje = "websocket_version"
+	msgWebSocketFaltaClave  codigoMensaje = "websocket_falta_clave"
+	msgWebSocketNoSoportado codigoMensaje = "websocket_no_soportado"
+	msgURLInvalida          codigoMensaje = "url_invalida"
+	msgURLPrivada           codigoMensaje = "url_privada"
+	msgEventosRequeridos    codigoMensaje = "eventos_requeridos"
+	msgEventoDesconocido    codigoMensaje = "evento_desconocido"
+	msgWebhookNoEncontrado  codigoMensaje = "webhook_no_encontrado"
+	msgWebhookEliminado     codigoMensaje = "webhook_eliminado"
+	msgEntregaNoEncontrada  codigoMensaje = "entrega_no_encontrada"
+	msgEntregaEncolada      codigoMensaje = "entrega_encolada"
+	msgColaEntregasLlena    codigoMensaje = "cola_entregas_llena"
+	msgSucursalSubdominio   codigoMensaje = "sucursal_subdominio"
+	msgSucursalDesconocida  codigoMensaje = "sucursal_desconocida"
+	msgSucursalSinSecreto   codigoMensaje = "sucursal_sin_secreto"
+	msgTokenRequerido       codigoMensaje = "token_requerido"
+	msgTokenMalFormado      codigoMensaje = "token_mal_formado"
+	msgTokenAlgoritmo       codigoMensaje = "token_algoritmo"
+	msgTokenFirmaInvalida   codigoMensaje = "token_firma_invalida"
+	msgTokenVencido         codigoMensaje = "token_vencido"
+	msgTokenSinSucursal     codigoMensaje = "token_sin_sucursal"
+	msgTokenSinAcceso       codigoMensaje = "token_sin_acceso"
+	msgTokenAdminRequerido  codigoMensaje = "token_admin_requerido"
+	msgClaveAPIRequerida    codigoMensaje = "clave_api_requerida"
+	msgClaveAPIInvalida     codigoMensaje = "clave_api_invalida"
+	msgEventosPerdidos      codigoMensaje = "eventos_perdidos"
+	msgPeticionGRPC         codigoMensaje = "peticion_grpc"
+)
+
+// Consultas GraphQL: análisis, validación y ejecución
+const (
+	msgGQLFaltaConsulta         codigoMensaje = "gql_falta_consulta"
+	msgGQLVariasOperaciones     codigoMensaje = "gql_varias_operaciones"
+	msgGQLOperacionNoEncontrada codigoMensaje = "gql_operacion_no_encontrada"
+	msgGQLMutacionConGET        codigoMensaje = "gql_mutacion_con_get"
+	msgGQLOperacionNoSoportada  codigoMensaje = "gql_operacion_no_soportada"
+	msgGQLProfundidad           codigoMensaje = "gql_profundidad"
+	msgGQLComplejidad           codigoMensaje = "gql_complejidad"
+	msgGQLAnidamiento           codigoMensaje = "gql_anidamiento"
+	msgGQLDemasiadosAlias       codigoMensaje = "gql_demasiados_alias"
+	msgGQLSintaxis              codigoMensaje = "gql_sintaxis"
+	msgGQLSintaxisFin           codigoMensaje = "gql_sintaxis_fin"
+	msgGQLSintaxisLexica        codigoMensaje = "gql_sintaxis_lexica"
+	msgGQLSeEsperaba            codigoMensaje = "gql_se_esperaba"
+	msgGQLSeEsperabaNombre      codigoMensaje = "gql_se_esperaba_nombre"
+	msgGQLSeEsperabaOperacion   codigoMensaje = "gql_se_esperaba_operacion"
+	msgGQLSeEsperabaValor       codigoMensaje = "gql_se_esperaba_valor"
+	msgGQLCaracterInesperado    codigoMensaje = "gql_caracter_inesperado"
+	msgGQLCadenaSinCerrar       codigoMensaje = "gql_cadena_sin_cerrar"
+	msgGQLBloqueSinCerrar       codigoMensaje = "gql_bloque_sin_cerrar"
+	msgGQLCadenaInvalida        codigoMensaje = "gql_cadena_invalida"
+	msgGQLValorRequerido        codigoMensaje = "gql_valor_requerido"
+	msgGQLTipoValor             codigoMensaje = "gql_tipo_valor"
+	msgGQLTipoEntrada           codigoMensaje = "gql_tipo_entrada"
+	msgGQLCampoEntrada          codigoMensaje = "gql_campo_entrada"
+	msgGQLCampoDesconocido      codigoMensaje = "gql_campo_desconocido"
+	msgGQLArgumentoDesconocido  codigoMensaje = "gql_argumento_desconocido"
+	msgGQLRequiereSubcampos     codigoMensaje = "gql_requiere_subcampos"
+	msgGQLSinSubcampos          codigoMensaje = "gql_sin_subcampos"
+	msgGQLNoNuloEsNulo          codigoMensaje = "gql_no_nulo_es_nulo"
+	msgGQLCursorInvalido        codigoMensaje = "gql_cursor_invalido"
+	msgGQLFirstFueraDeRango     codigoMensaje = "gql_first_fuera_de_rango"
+)
+
+// Líneas fijas del mensaje de inicio
+const (
+	msgInicioServidor   codigoMensaje = "inicio_servidor"
+	msgInicioEndpoints  codigoMensaje = "inicio_endpoints"
+	msgInicioDocs       codigoMensaje = "inicio_docs"
+	msgInicioISBN       codigoMensaje = "inicio_isbn"
+	msgInicioSucursales codigoMensaje = "inicio_sucursales"
+	msgInicioSinSecreto codigoMensaje = "inicio_sin_secreto"
+	msgInicioAbiertas   codigoMensaje = "inicio_abiertas"
+	msgInicioEjemplos   codigoMensaje = "inicio_ejemplos"
+	msgInicioGRPC       codigoMensaje = "inicio_grpc"
+	msgInicioPapelera   codigoMensaje = "inicio_papelera"
+	msgInicioReservas   codigoMensaje = "inicio_reservas"
+	msgInicioApagando   codigoMensaje = "inicio_apagando"
+)
+
+// Idiomas disponibles y el de respaldo (el de los textos originales)
+var idiomas = []string{"es", "en"}
+
+const idiomaPorDefecto = "es"
+
+// Plantillas de cada mensaje por idioma (formato de fmt)
+var catalogoMensajes = map[string]map[codigoMensaje]string{
+	"es": {
+		msgErrorInterno:          "Error interno",
+		msgIDInvalido:            "ID inválido",
+		msgEndpointNoEncontrado:  "Endpoint no encontrado",
+		msgContentTypeJSON:       "El Content-Type debe ser application/json",
+		msgCuerpoDemasiadoGrande: "El cuerpo supera el máximo de %d bytes",
+		msgCuerpoVacio:           "El cuerpo está vacío",
+		msgCuerpoIlegible:        "No se pudo leer el cuerpo",
+		msgJSONIncompleto:        "JSON incompleto",
+		msgJSONInvalido:          "JSON inválido",
+		msgJSONInvalidoPosicion:  "JSON inválido en la posición %d",
+		msgJSONTipoCampo:         "El campo %q debe ser de tipo %s",
+		msgJSONCampoDesconocido:  "Campo desconocido: %s",
+		msgJSONValorUnico:        "El cuerpo debe contener un único valor JSON",
+		msgVariablesInvalidas:    "variables inválidas",
+		msgFechaDesdeInvalida:    "Fecha 'desde' inválida (usa RFC 3339 o AAAA-MM-DD)",
+		msgFechaHastaInvalida:    "Fecha 'hasta' inválida (usa RFC 3339 o AAAA-MM-DD)",
+		msgRangoFechasInvertido:  "'hasta' es anterior a 'desde'",
+		msgRangoFechasExcesivo:   "El rango entre 'desde' y 'hasta' no puede superar %d años",
+		msgLimiteInvalido:        "Parámetro limite inválido",
+		msgReporteDesconocido:    "Reporte desconocido (valores: %s)",
+
+		msgLibroNoEncontrado:        "Libro no encontrado",
+		msgLibroNoEnPapelera:        "Libro no encontrado en la papelera",
+		msgLibroEliminado:           "Libro eliminado correctamente",
+		msgTituloRequerido:          "El título es requerido",
+		msgAutorRequerido:           "El autor es requerido",
+		msgISBNInvalido:             "ISBN inválido",
+		msgAñoInvalido:              "Año inválido",
+		msgAutorInexistente:         "El autor %d no existe",
+		msgAutorNoEncontrado:        "Autor no encontrado",
+		msgAutorDuplicado:           "Ya existe el autor %d (%s)",
+		msgAutorConLibros:           "El autor tiene libros asociados",
+		msgAutorEliminado:           "Autor eliminado correctamente",
+		msgNombreRequerido:          "El nombre es requerido",
+		msgAñoNacimientoInvalido:    "Año de nacimiento inválido",
+		msgAñoFallecimientoInvalido: "Año de fallecimiento inválido",
+		msgFallecimientoAnterior:    "El año de fallecimiento es anterior al de nacimiento",
+		msgGeneroDesconocido:        "Género desconocido: %q (ver /api/generos)",
+		msgGeneroNoEncontrado:       "Género no encontrado",
+		msgGeneroDuplicado:          "Ya existe el género %d (%s)",
+		msgGeneroPadreInexistente:   "El género padre %d no existe",
+		msgGeneroConSubgeneros:      "El género tiene subgéneros",
+		msgGeneroConLibros:          "El género tiene libros asociados",
+		msgGeneroEliminado:          "Género eliminado correctamente",
+
+		msgEjemplarNoEncontrado:    "Ejemplar no encontrado",
+		msgEjemplarEnEstado:        "El ejemplar está %s",
+		msgEjemplarDeBaja:          "El ejemplar está dado de baja",
+		msgEjemplarYaDeBaja:        "El ejemplar ya está dado de baja",
+		msgEjemplarApartado:        "El ejemplar está apartado para una reserva",
+		msgCodigoBarrasRequerido:   "El código de barras es requerido (máximo %d caracteres)",
+		msgCodigoBarrasDuplicado:   "El código de barras %s ya es del ejemplar %d",
+		msgCodigoBarrasInmutable:   "El código de barras no se puede modificar",
+		msgCondicionInvalida:       "Condición inválida (valores: %s)",
+		msgEstadoInvalido:          "Estado inválido (valores: %s)",
+		msgBajaConDelete:           "Para dar de baja un ejemplar use DELETE /api/ejemplares/{id}",
+		msgReservaConPost:          "Los ejemplares se apartan con POST /api/libros/{id}/reservas",
+		msgPrestamoConPost:         "Los ejemplares se prestan y se devuelven con /api/prestamos",
+		msgSocioRequerido:          "El socio es requerido (máximo %d caracteres)",
+		msgPrestamoNoEncontrado:    "Préstamo no encontrado",
+		msgPrestamoDevuelto:        "El préstamo ya fue devuelto",
+		msgDevolucionAnterior:      "La devolución es anterior al préstamo",
+		msgFechaDevolucionInvalida: "Parámetro fecha inválido (RFC 3339 o AAAA-MM-DD, no futura)",
+		msgDiasGraciaNegativos:     "Los días de gracia no pueden ser negativos",
+		msgPlazoPrestamoInvalido:   "El plazo de préstamo debe estar entre 1 y 365 días",
+		msgFeriadoInvalido:         "Feriado inválido: %q (formato AAAA-MM-DD)",
+		msgMontoInvalido:           "Monto inválido: %q (use un decimal no negativo con hasta 2 cifras, por ejemplo \"12.50\")",
+		msgMontoNoPositivo:         "El monto debe ser mayor que cero",
+		msgPagoExcedeSaldo:         "El pago (%s) supera el saldo pendiente (%s)",
+		msgReservaNoEncontrada:     "Reserva no encontrada",
+		msgReservaDuplicada:        "El socio ya tiene la reserva %d para este libro",
+		msgReservaEnEstado:         "La reserva ya está %s",
+		msgReservaNoLista:          "La reserva todavía no está lista",
+
+		msgClaveIdempotenciaInvalida: "Idempotency-Key inválida (máximo %d caracteres imprimibles)",
+		msgClaveIdempotenciaUsada:    "La Idempotency-Key ya se usó con otro cuerpo",
+		msgClaveIdempotenciaEnCurso:  "Hay una petición en curso con la misma Idempotency-Key",
+		msgISBNControlInvalido:       "ISBN inválido (10 o 13 dígitos con el dígito de control correcto)",
+		msgISBNDuplicado:             "El libro %d ya tiene ese ISBN",
+		msgISBNNoEncontrado:          "El catálogo no tiene datos de ese ISBN",
+		msgCatalogoNoDisponible:      "No se pudo consultar el catálogo externo",
+		msgCatalogoSinGenero:         "El catálogo no indica un género conocido: envíe \"genero\"",
+		msgCatalogoIncompleto:        "Datos incompletos del catálogo: %s",
+		msgSinPortada:                "El libro no tiene portada",
+		msgPortadaIlegible:           "No se pudo leer la portada",
+		msgPortadaNoGuardada:         "No se pudo guardar la portada",
+		msgPortadaTipo:               "La portada debe ser una imagen JPEG, PNG o GIF",
+		msgMiniaturaFallida:          "No se pudo generar la miniatura",
+		msgMultipartInvalido:         "Formulario multipart inválido",
+		msgFaltaCampoPortada:         `Falta el campo "portada" en el formulario`,
+		msgImagenVacia:               "La imagen está vacía",
+		msgImagenIlegible:            "No se pudo leer la imagen",
+		msgImagenDañada:              "La imagen está dañada o incompleta",
+		msgImagenExcedeBytes:         "La imagen supera el máximo de %d bytes",
+		msgImagenExcedeLado:          "La imagen supera los %d píxeles de lado",
+
+		msgStreamingNoSoportado: "Streaming no soportado",
+		msgIDEventoInvalido:     "ID de evento inválido",
+		msgWebSocketEsperado:    "Se esperaba una petición de WebSocket",
+		msgWebSocketVersion:     "Versión de WebSocket no soportada",
+		msgWebSocketFaltaClave:  "Falta Sec-WebSocket-Key",
+		msgWebSocketNoSoportado: "WebSocket no soportado",
+		msgURLInvalida:          "La URL debe ser absoluta (http o https)",
+		msgURLPrivada:           "La URL apunta a una dirección local o privada (ver WEBHOOKS_REDES_PRIVADAS)",
+		msgEventosRequeridos:    "Se requiere al menos un evento",
+		msgEventoDesconocido:    "Evento desconocido: %s",
+		msgWebhookNoEncontrado:  "Webhook no encontrado",
+		msgWebhookEliminado:     "Webhook eliminado correctamente",
+		msgEntregaNoEncontrada:  "Entrega fallida no encontrada",
+		msgEntregaEncolada:      "Entrega encolada de nuevo",
+		msgColaEntregasLlena:    "Cola de entregas llena",
+		msgSucursalSubdominio:   "X-Sucursal no coincide con el subdominio",
+		msgSucursalDesconocida:  "Sucursal desconocida: %q",
+		msgSucursalSinSecreto:   "Para usar la sucursal %q se requiere un token (configure SUCURSALES_SECRETO)",
+		msgTokenRequerido:       "Se requiere un token (Authorization: Bearer ...)",
+		msgTokenMalFormado:      "Token mal formado",
+		msgTokenAlgoritmo:       "Algoritmo de token no soportado: %q",
+		msgTokenFirmaInvalida:   "Firma del token inválida",
+		msgTokenVencido:         "Token vencido",
+		msgTokenSinSucursal:     "El token no indica ninguna sucursal",
+		msgTokenSinAcceso:       "El token no da acceso a la sucursal %q",
+		msgTokenAdminRequerido:  "Se requiere un token de administrador",
+		msgClaveAPIRequerida:    "Se requiere una clave de API (X-API-Key)",
+		msgClaveAPIInvalida:     "Clave de API inválida",
+		msgEventosPerdidos:      "Se perdieron eventos; vuelve a cargar el catálogo",
+		msgPeticionGRPC:         "Se esperaba una petición gRPC",
+
+		msgGQLFaltaConsulta:         "falta la consulta",
+		msgGQLVariasOperaciones:     "hay varias operaciones: indique operationName",
+		msgGQLOperacionNoEncontrada: "operación %q no encontrada",
+		msgGQLMutacionConGET:        "las mutaciones requieren POST",
+		msgGQLOperacionNoSoportada:  "operación %s no soportada",
+		msgGQLProfundidad:           "la consulta tiene profundidad %d (máximo %d)",
+		msgGQLComplejidad:           "la consulta tiene complejidad %d (máximo %d)",
+		msgGQLAnidamiento:           "el documento tiene más de %d niveles de anidamiento (posición %d)",
+		msgGQLDemasiadosAlias:       "un conjunto de selección tiene más de %d alias (posición %d)",
+		msgGQLSintaxis:              "error de sintaxis: %s pero se encontró %q (posición %d)",
+		msgGQLSintaxisFin:           "error de sintaxis: %s al final del documento",
+		msgGQLSintaxisLexica:        "error de sintaxis: %s",
+		msgGQLSeEsperaba:            "se esperaba %q",
+		msgGQLSeEsperabaNombre:      "se esperaba un nombre",
+		msgGQLSeEsperabaOperacion:   "se esperaba una operación o un fragmento",
+		msgGQLSeEsperabaValor:       "se esperaba un valor",
+		msgGQLCaracterInesperado:    "carácter inesperado %q en la posición %d",
+		msgGQLCadenaSinCerrar:       "cadena sin cerrar en la posición %d",
+		msgGQLBloqueSinCerrar:       "cadena de bloque sin cerrar en la posición %d",
+		msgGQLCadenaInvalida:        "cadena inválida en la posición %d",
+		msgGQLValorRequerido:        "%s: se requiere un valor de tipo %s",
+		msgGQLTipoValor:             "%s: el valor %v no es de tipo %s",
+		msgGQLTipoEntrada:           "%s: tipo de entrada desconocido %s",
+		msgGQLCampoEntrada:          "%s: campo desconocido %q en %s",
+		msgGQLCampoDesconocido:      "No se puede consultar el campo %q en el tipo %q",
+		msgGQLArgumentoDesconocido:  "Argumento desconocido %q en el campo %s.%s",
+		msgGQLRequiereSubcampos:     "El campo %q de tipo %s requiere una selección de subcampos",
+		msgGQLSinSubcampos:          "El campo %q de tipo %s no admite subcampos",
+		msgGQLNoNuloEsNulo:          "el campo no nulo de tipo %s devolvió null",
+		msgGQLCursorInvalido:        "cursor inválido",
+		msgGQLFirstFueraDeRango:     "first debe estar entre 0 y %d",
+
+		msgInicioServidor:   "🚀 Servidor API de Libros iniciado en http://localhost%s",
+		msgInicioEndpoints:  "📚 Endpoints disponibles:",
+		msgInicioDocs:       "📖 Documentación: http://localhost%s/docs",
+		msgInicioISBN:       "🔎 Metadatos por ISBN: %s",
+		msgInicioSucursales: "🏢 Sucursales: %s (por defecto: %s)",
+		msgInicioSinSecreto: "🔒 Sin SUCURSALES_SECRETO: solo se atiende la sucursal por defecto y /api/admin está cerrada",
+		msgInicioAbiertas:   "⚠️  SUCURSALES_ABIERTAS: sin tokens, cualquiera elige sucursal y /api/admin queda abierta",
+		msgInicioEjemplos:   "💡 Ejemplos de uso con curl:",
+		msgInicioGRPC:       "🔌 Servicio gRPC libros.v1.LibrosService en localhost%s (h2c)",
+		msgInicioPapelera:   "🗑️  Los libros eliminados se conservan %v en la papelera",
+		msgInicioReservas:   "📌 Las reservas listas se pueden retirar durante %v",
+		msgInicioApagando:   "Apagando servidor...",
+	},
+	"en": {
+		msgErrorInterno:          "Internal error",
+		msgIDInvalido:            "Invalid ID",
+		msgEndpointNoEncontrado:  "Endpoint not found",
+		msgContentTypeJSON:       "Content-Type must be application/json",
+		msgCuerpoDemasiadoGrande: "The body exceeds the maximum of %d bytes",
+		msgCuerpoVacio:           "The body is empty",
+		msgCuerpoIlegible:        "The body could not be read",
+		msgJSONIncompleto:        "Incomplete JSON",
+		msgJSONInvalido:          "Invalid JSON",
+		msgJSONInvalidoPosicion:  "Invalid JSON at position %d",
+		msgJSONTipoCampo:         "Field %q must be of type %s",
+		msgJSONCampoDesconocido:  "Unknown field: %s",
+		msgJSONValorUnico:        "The body must contain a single JSON value",
+		msgVariablesInvalidas:    "invalid variables",
+		msgFechaDesdeInvalida:    "Invalid 'desde' date (use RFC 3339 or YYYY-MM-DD)",
+		msgFechaHastaInvalida:    "Invalid 'hasta' date (use RFC 3339 or YYYY-MM-DD)",
+		msgRangoFechasInvertido:  "'hasta' is before 'desde'",
+		msgRangoFechasExcesivo:   "The range between 'desde' and 'hasta' cannot exceed %d years",
+		msgLimiteInvalido:        "Invalid limite parameter",
+		msgReporteDesconocido:    "Unknown report (values: %s)",
+
+		msgLibroNoEncontrado:        "Book not found",
+		msgLibroNoEnPapelera:        "Book not found in the trash",
+		msgLibroEliminado:           "Book deleted successfully",
+		msgTituloRequerido:          "The title is required",
+		msgAutorRequerido:           "The author is required",
+		msgISBNInvalido:             "Invalid ISBN",
+		msgAñoInvalido:              "Invalid year",
+		msgAutorInexistente:         "Author %d does not exist",
+		msgAutorNoEncontrado:        "Author not found",
+		msgAutorDuplicado:           "Author %d (%s) already exists",
+		msgAutorConLibros:           "The author has books",
+		msgAutorEliminado:           "Author deleted successfully",
+		msgNombreRequerido:          "The name is required",
+		msgAñoNacimientoInvalido:    "Invalid year of birth",
+		msgAñoFallecimientoInvalido: "Invalid year of death",
+		msgFallecimientoAnterior:    "The year of death is before the year of birth",
+		msgGeneroDesconocido:        "Unknown genre: %q (see /api/generos)",
+		msgGeneroNoEncontrado:       "Genre not found",
+		msgGeneroDuplicado:          "Genre %d (%s) already exists",
+		msgGeneroPadreInexistente:   "Parent genre %d does not exist",
+		msgGeneroConSubgeneros:      "The genre has subgenres",
+		msgGeneroConLibros:          "The genre has books",
+		msgGeneroEliminado:          "Genre deleted successfully",
+
+		msgEjemplarNoEncontrado:    "Copy not found",
+		msgEjemplarEnEstado:        "The copy is %s",
+		msgEjemplarDeBaja:          "The copy has been withdrawn",
+		msgEjemplarYaDeBaja:        "The copy is already withdrawn",
+		msgEjemplarApartado:        "The copy is set aside for a reservation",
+		msgCodigoBarrasRequerido:   "The barcode is required (at most %d characters)",
+		msgCodigoBarrasDuplicado:   "Barcode %s already belongs to copy %d",
+		msgCodigoBarrasInmutable:   "The barcode cannot be changed",
+		msgCondicionInvalida:       "Invalid condition (values: %s)",
+		msgEstadoInvalido:          "Invalid status (values: %s)",
+		msgBajaConDelete:           "To withdraw a copy use DELETE /api/ejemplares/{id}",
+		msgReservaConPost:          "Copies are set aside with POST /api/libros/{id}/reservas",
+		msgPrestamoConPost:         "Copies are lent and returned through /api/prestamos",
+		msgSocioRequerido:          "The member is required (at most %d characters)",
+		msgPrestamoNoEncontrado:    "Loan not found",
+		msgPrestamoDevuelto:        "The loan was already returned",
+		msgDevolucionAnterior:      "The return date is before the loan date",
+		msgFechaDevolucionInvalida: "Invalid fecha parameter (RFC 3339 or YYYY-MM-DD, not in the future)",
+		msgDiasGraciaNegativos:     "Grace days cannot be negative",
+		msgPlazoPrestamoInvalido:   "The loan period must be between 1 and 365 days",
+		msgFeriadoInvalido:         "Invalid holiday: %q (format YYYY-MM-DD)",
+		msgMontoInvalido:           "Invalid amount: %q (use a non-negative decimal with up to 2 digits, for example \"12.50\")",
+		msgMontoNoPositivo:         "The amount must be greater than zero",
+		msgPagoExcedeSaldo:         "The payment (%s) exceeds the outstanding balance (%s)",
+		msgReservaNoEncontrada:     "Reservation not found",
+		msgReservaDuplicada:        "The member already has reservation %d for this book",
+		msgReservaEnEstado:         "The reservation is already %s",
+		msgReservaNoLista:          "The reservation is not ready yet",
+
+		msgClaveIdempotenciaInvalida: "Invalid Idempotency-Key (at most %d printable characters)",
+		msgClaveIdempotenciaUsada:    "The Idempotency-Key was already used with a different body",
+		msgClaveIdempotenciaEnCurso:  "A request with the same Idempotency-Key is in progress",
+		msgISBNControlInvalido:       "Invalid ISBN (10 or 13 digits with a correct check digit)",
+		msgISBNDuplicado:             "Book %d already has that ISBN",
+		msgISBNNoEncontrado:          "The catalog has no data for that ISBN",
+		msgCatalogoNoDisponible:      "The external catalog could not be queried",
+		msgCatalogoSinGenero:         "The catalog does not name a known genre: send \"genero\"",
+		msgCatalogoIncompleto:        "Incomplete catalog data: %s",
+		msgSinPortada:                "The book has no cover",
+		msgPortadaIlegible:           "The cover could not be read",
+		msgPortadaNoGuardada:         "The cover could not be saved",
+		msgPortadaTipo:               "The cover must be a JPEG, PNG or GIF image",
+		msgMiniaturaFallida:          "The thumbnail could not be generated",
+		msgMultipartInvalido:         "Invalid multipart form",
+		msgFaltaCampoPortada:         `The form is missing the "portada" field`,
+		msgImagenVacia:               "The image is empty",
+		msgImagenIlegible:            "The image could not be read",
+		msgImagenDañada:              "The image is damaged or incomplete",
+		msgImagenExcedeBytes:         "The image exceeds the maximum of %d bytes",
+		msgImagenExcedeLado:          "The image exceeds %d pixels per side",
+
+		msgStreamingNoSoportado: "Streaming not supported",
+		msgIDEventoInvalido:     "Invalid event ID",
+		msgWebSocketEsperado:    "A WebSocket request was expected",
+		msgWebSocketVersion:     "Unsupported WebSocket version",
+		msgWebSocketFaltaClave:  "Missing Sec-WebSocket-Key",
+		msgWebSocketNoSoportado: "WebSocket not supported",
+		msgURLInvalida:          "The URL must be absolute (http or https)",
+		msgURLPrivada:           "The URL points to a local or private address (see WEBHOOKS_REDES_PRIVADAS)",
+		msgEventosRequeridos:    "At least one event is required",
+		msgEventoDesconocido:    "Unknown event: %s",
+		msgWebhookNoEncontrado:  "Webhook not found",
+		msgWebhookEliminado:     "Webhook deleted successfully",
+		msgEntregaNoEncontrada:  "Failed delivery not found",
+		msgEntregaEncolada:      "Delivery queued again",
+		msgColaEntregasLlena:    "Delivery queue is full",
+		msgSucursalSubdominio:   "X-Sucursal does not match the subdomain",
+		msgSucursalDesconocida:  "Unknown branch: %q",
+		msgSucursalSinSecreto:   "Branch %q requires a token (set SUCURSALES_SECRETO)",
+		msgTokenRequerido:       "A token is required (Authorization: Bearer ...)",
+		msgTokenMalFormado:      "Malformed token",
+		msgTokenAlgoritmo:       "Unsupported token algorithm: %q",
+		msgTokenFirmaInvalida:   "Invalid token signature",
+		msgTokenVencido:         "Token expired",
+		msgTokenSinSucursal:     "The token does not name a branch",
+		msgTokenSinAcceso:       "The token does not grant access to branch %q",
+		msgTokenAdminRequerido:  "An administrator token is required",
+		msgClaveAPIRequerida:    "An API key is required (X-API-Key)",
+		msgClaveAPIInvalida:     "Invalid API key",
+		msgEventosPerdidos:      "Events were lost; reload the catalog",
+		msgPeticionGRPC:         "A gRPC request was expected",
+
+		msgGQLFaltaConsulta:         "the query is missing",
+		msgGQLVariasOperaciones:     "there are several operations: set operationName",
+		msgGQLOperacionNoEncontrada: "operation %q not found",
+		msgGQLMutacionConGET:        "mutations require POST",
+		msgGQLOperacionNoSoportada:  "operation %s is not supported",
+		msgGQLProfundidad:           "the query has depth %d (maximum %d)",
+		msgGQLComplejidad:           "the query has complexity %d (maximum %d)",
+		msgGQLAnidamiento:           "the document is nested more than %d levels deep (position %d)",
+		msgGQLDemasiadosAlias:       "a selection set has more than %d aliases (position %d)",
+		msgGQLSintaxis:              "syntax error: %s but found %q (position %d)",
+		msgGQLSintaxisFin:           "syntax error: %s at the end of the document",
+		msgGQLSintaxisLexica:        "syntax error: %s",
+		msgGQLSeEsperaba:            "expected %q",
+		msgGQLSeEsperabaNombre:      "expected a name",
+		msgGQLSeEsperabaOperacion:   "expected an operation or a fragment",
+		msgGQLSeEsperabaValor:       "expected a value",
+		msgGQLCaracterInesperado:    "unexpected character %q at position %d",
+		msgGQLCadenaSinCerrar:       "unterminated string at position %d",
+		msgGQLBloqueSinCerrar:       "unterminated block string at position %d",
+		msgGQLCadenaInvalida:        "invalid string at position %d",
+		msgGQLValorRequerido:        "%s: a value of type %s is required",
+		msgGQLTipoValor:             "%s: the value %v is not of type %s",
+		msgGQLTipoEntrada:           "%s: unknown input type %s",
+		msgGQLCampoEntrada:          "%s: unknown field %q in %s",
+		msgGQLCampoDesconocido:      "Cannot query field %q on type %q",
+		msgGQLArgumentoDesconocido:  "Unknown argument %q on field %s.%s",
+		msgGQLRequiereSubcampos:     "Field %q of type %s requires a selection of subfields",
+		msgGQLSinSubcampos:          "Field %q of type %s does not accept subfields",
+		msgGQLNoNuloEsNulo:          "the non-null field of type %s returned null",
+		msgGQLCursorInvalido:        "invalid cursor",
+		msgGQLFirstFueraDeRango:     "first must be between 0 and %d",
+
+		msgInicioServidor:   "🚀 Books API server started at http://localhost%s",
+		msgInicioEndpoints:  "📚 Available endpoints:",
+		msgInicioDocs:       "📖 Documentation: http://localhost%s/docs",
+		msgInicioISBN:       "🔎 ISBN metadata: %s",
+		msgInicioSucursales: "🏢 Branches: %s (default: %s)",
+		msgInicioSinSecreto: "🔒 No SUCURSALES_SECRETO: only the default branch is served and /api/admin is closed",
+		msgInicioAbiertas:   "⚠️  SUCURSALES_ABIERTAS: no tokens, anyone can pick a branch and /api/admin is open",
+		msgInicioEjemplos:   "💡 curl examples:",
+		msgInicioGRPC:       "🔌 gRPC service libros.v1.LibrosService at localhost%s (h2c)",
+		msgInicioPapelera:   "🗑️  Deleted books are kept in the trash for %v",
+		msgInicioReservas:   "📌 Ready reservations can be picked up for %v",
+		msgInicioApagando:   "Shutting down server...",
+	},
+}
+
+// Mensaje con su código y los valores de la plantilla. Se usa también
+// como error para que el idioma se elija recién al responder.
+type mensaje struct {
+	Codigo codigoMensaje
+	Args   []interface{}
+}
+
+func nuevoMensaje(codigo codigoMensaje, args ...interface{}) *mensaje {
+	return &mensaje{Codigo: codigo, Args: args}
+}
+
+// Traducir arma el texto en el idioma pedido (o en el de respaldo); los
+// argumentos que también son mensajes se traducen al mismo idioma
+func (m *mensaje) Traducir(idioma string) string {
+	plantilla, ok := catalogoMensajes[idioma][m.Codigo]
+	if !ok {
+		plantilla, ok = catalogoMensajes[idiomaPorDefecto][m.Codigo]
+	}
+	if !ok {
+		return string(m.Codigo)
+	}
+	if len(m.Args) == 0 {
+		return plantilla
+	}
+	args := make([]interface{}, len(m.Args))
+	for i, arg := range m.Args {
+		if anidado, ok := arg.(*mensaje); ok {
+			arg = anidado.Traducir(idioma)
+		}
+		args[i] = arg
+	}
+	return fmt.Sprintf(plantilla, args...)
+}
+
+func (m *mensaje) Error() string { return m.Traducir(idiomaPorDefecto) }
+
+// comoMensaje recupera el mensaje de un error; los que no vienen del
+// catálogo se muestran como error interno
+func comoMensaje(err error) *mensaje {
+	var m *mensaje
+	if errors.As(err, &m) {
+		return m
+	}
+	return nuevoMensaje(msgErrorInterno)
+}
+
+// negociarIdioma elige el idioma según Accept-Language ("en-US,en;q=0.8").
+// Se compara solo el idioma principal; sin coincidencias se usa el de respaldo.
+func negociarIdioma(aceptados string) string {
+	type opcion struct {
+		idioma string
+		peso   float64
+	}
+	var opciones []opcion
+	for _, parte := range strings.Split(aceptados, ",") {
+		etiqueta, parametros, _ := strings.Cut(strings.TrimSpace(parte), ";")
+		peso := 1.0
+		if valor, ok := strings.CutPrefix(strings.TrimSpace(parametros), "q="); ok {
+			q, err := strconv.ParseFloat(valor, 64)
+			if err != nil {
+				continue
+			}
+			peso = q
+		}
+		principal, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(etiqueta)), "-")
+		if principal == "" || peso <= 0 {
+			continue
+		}
+		opciones = append(opciones, opcion{principal, peso})
+	}
+	sort.SliceStable(opciones, func(i, j int) bool { return opciones[i].peso > opciones[j].peso })
+
+	for _, o := range opciones {
+		if o.idioma == "*" {
+			return idiomaPorDefecto
+		}
+		if _, ok := catalogoMensajes[o.idioma]; ok {
+			return o.idioma
+		}
+	}
+	return idiomaPorDefecto
+}
+
+// idiomaDe devuelve el idioma negociado para la petición del contexto
+func idiomaDe(ctx context.Context) string {
+	if solicitud, ok := ctx.Value(claveSolicitud{}).(datosSolicitud); ok && solicitud.Idioma != "" {
+		return solicitud.Idioma
+	}
+	return idiomaPorDefecto
+}
+
+// traducir arma un mensaje en el idioma de la petición
+func traducir(ctx context.Context, codigo codigoMensaje, args ...interface{}) string {
+	return nuevoMensaje(codigo, args...).Traducir(idiomaDe(ctx))
+}
+
+// idiomaServidor elige el idioma de los mensajes de consola: IDIOMA o,
+// si no está, el de LANG ("en_US.UTF-8")
+func idiomaServidor() string {
+	valor := os.Getenv("IDIOMA")
+	if valor == "" {
+		valor, _, _ = strings.Cut(os.Getenv("LANG"), ".")
+	}
+	return negociarIdioma(strings.ReplaceAll(valor, "_", "-"))
+}
+
+// Helper para respuestas de error: el texto va en el idioma de la petición
+// y el código no cambia entre idiomas
+func responderError(w http.ResponseWriter, r *http.Request, status int, codigo codigoMensaje, args ...interface{}) {
+	responderMensaje(w, r, status, nuevoMensaje(codigo, args...))
+}
+
+func responderMensaje(w http.ResponseWriter, r *http.Request, status int, m *mensaje) {
+	idioma := idiomaDe(r.Context())
+	w.Header().Set("Content-Language", idioma)
+	w.Header().Add("Vary", "Accept-Language")
+	responderJSON(w, status, map[string]string{
+		"error":  m.Traducir(idioma),
+		"codigo": string(m.Codigo),
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	iofs "io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Verbos de formato de una plantilla ("%d", "%q", ...), sin contar "%%"
+var expresionVerbo = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func verbosPlantilla(plantilla string) []string {
+	var verbos []string
+	for _, verbo := range expresionVerbo.FindAllString(plantilla, -1) {
+		if verbo != "%%" {
+			verbos = append(verbos, verbo[len(verbo)-1:])
+		}
+	}
+	return verbos
+}
+
+// codigosDeclarados lee del código fuente todas las constantes de tipo
+// codigoMensaje, para no depender de una lista que se mantenga a mano
+func codigosDeclarados(t *testing.T) map[codigoMensaje]string {
+	t.Helper()
+	fset := token.NewFileSet()
+	paquetes, err := parser.ParseDir(fset, ".", func(info iofs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codigos := map[codigoMensaje]string{}
+	for _, archivo := range paquetes["main"].Files {
+		ast.Inspect(archivo, func(n ast.Node) bool {
+			spec, ok := n.(*ast.ValueSpec)
+			if !ok {
+				return true
+			}
+			if tipo, ok := spec.Type.(*ast.Ident); !ok || tipo.Name != "codigoMensaje" {
+				return true
+			}
+			for i, nombre := range spec.Names {
+				literal, ok := spec.Values[i].(*ast.BasicLit)
+				if !ok {
+					t.Fatalf("%s: el código no es un literal", nombre.Name)
+				}
+				valor, _ := strconv.Unquote(literal.Value)
+				codigos[codigoMensaje(valor)] = nombre.Name
+			}
+			return true
+		})
+	}
+	if len(codigos) == 0 {
+		t.Fatal("no se encontraron códigos de mensaje")
+	}
+	return codigos
+}
+
+// Cada código declarado tiene traducción en todos los idiomas, con los
+// mismos verbos de formato que en español, y no sobran traducciones
+func TestCatalogoMensajesCompleto(t *testing.T) {
+	t.Parallel()
+	codigos := codigosDeclarados(t)
+	base := catalogoMensajes[idiomaPorDefecto]
+	for _, idioma := range idiomas {
+		bundle, ok := catalogoMensajes[idioma]
+		if !ok {
+			t.Errorf("falta el idioma %s", idioma)
+			continue
+		}
+		for codigo, constante := range codigos {
+			traduccion, ok := bundle[codigo]
+			switch {
+			case !ok:
+				t.Errorf("%s: falta %s (%s)", idioma, constante, codigo)
+			case !slices.Equal(verbosPlantilla(base[codigo]), verbosPlantilla(traduccion)):
+				t.Errorf("%s: %s no tiene los mismos verbos de formato que en %s", idioma, constante, idiomaPorDefecto)
+			}
+		}
+		for codigo := range bundle {
+			if _, ok := codigos[codigo]; !ok {
+				t.Errorf("%s: %q no corresponde a ningún código declarado", idioma, codigo)
+			}
+		}
+	}
+	if len(catalogoMensajes) != len(idiomas) {
+		t.Errorf("hay idiomas en el catálogo que no están en la lista de idiomas")
+	}
+}
@@ -0,0 +1,313 @@
+// Multas por atraso: política configurable, pagos y saldo por socio
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Monto en centavos. Se serializa como texto decimal ("12.50") para que
+// ningún cliente lo pase por float64 y pierda centavos al redondear.
+type Monto int64
+
+func (m Monto) String() string {
+	signo := ""
+	if m < 0 {
+		signo, m = "-", -m
+	}
+	return fmt.Sprintf("%s%d.%02d", signo, m/100, m%100)
+}
+
+func (m Monto) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// Acepta "12.50" o 12.50; el número se lee como texto, nunca como float64
+func (m *Monto) UnmarshalJSON(datos []byte) error {
+	texto := string(datos)
+	if strings.HasPrefix(texto, `"`) {
+		if err := json.Unmarshal(datos, &texto); err != nil {
+			return errorMonto{texto}
+		}
+	}
+	monto, err := parsearMonto(texto)
+	if err != nil {
+		return err
+	}
+	*m = monto
+	return nil
+}
+
+// Error de un monto mal escrito; decodificarCuerpoJSON lo traduce a msgMontoInvalido
+type errorMonto struct{ valor string }
+
+func (e errorMonto) Error() string {
+	return nuevoMensaje(msgMontoInvalido, e.valor).Error()
+}
+
+// parsearMonto convierte "12", "12.5" o "12.50" a centavos
+func parsearMonto(texto string) (Monto, error) {
+	enteros, decimales, _ := strings.Cut(texto, ".")
+	if enteros == "" || len(enteros) > 12 || len(decimales) > 2 || strings.Contains(texto, ".") && decimales == "" {
+		return 0, errorMonto{texto}
+	}
+	for _, c := range enteros + decimales {
+		if c < '0' || c > '9' {
+			return 0, errorMonto{texto}
+		}
+	}
+	unidades, _ := strconv.ParseInt(enteros, 10, 64)
+	centavos, _ := strconv.ParseInt((decimales + "00")[:2], 10, 64)
+	return Monto(unidades*100 + centavos), nil
+}
+
+// Reglas para calcular las multas
+type politicaMultas struct {
+	TarifaDiaria Monto    `json:"tarifa_diaria"` // Por cada día de atraso cobrable
+	DiasGracia   int      `json:"dias_gracia"`   // Días de atraso que no se cobran
+	Tope         Monto    `json:"tope"`          // Máximo por préstamo; 0 = sin tope
+	Feriados     []string `json:"feriados"`      // AAAA-MM-DD; no cuentan como atraso
+	DiasPrestamo int      `json:"dias_prestamo"` // Plazo de los préstamos nuevos
+
+	ExcluirFinesDeSemana bool `json:"excluir_fines_de_semana"` // Sábados y domingos no cuentan como atraso
+}
+
+// Política con la que arranca cada sucursal
+func politicaMultasPorDefecto() politicaMultas {
+	return politicaMultas{
+		TarifaDiaria: 50,
+		DiasGracia:   2,
+		Tope:         2000,
+		Feriados:     []string{},
+		DiasPrestamo: 14,
+	}
+}
+
+// Política de multas de una sucursal, protegida con mutex
+type configuracionMultas struct {
+	mu       sync.RWMutex
+	politica politicaMultas
+}
+
+// politicaVigente devuelve una copia de la política actual de la sucursal
+func (s *sucursal) politicaVigente() politicaMultas {
+	s.multas.mu.RLock()
+	defer s.multas.mu.RUnlock()
+	return s.multas.politica
+}
+
+// Valida la política; devuelve el mensaje de error o nil
+func validarPoliticaMultas(p politicaMultas) *mensaje {
+	if p.DiasGracia < 0 {
+		return nuevoMensaje(msgDiasGraciaNegativos)
+	}
+	if p.DiasPrestamo < 1 || p.DiasPrestamo > 365 {
+		return nuevoMensaje(msgPlazoPrestamoInvalido)
+	}
+	for _, feriado := range p.Feriados {
+		if _, err := time.Parse(time.DateOnly, feriado); err != nil {
+			return nuevoMensaje(msgFeriadoInvalido, feriado)
+		}
+	}
+	return nil
+}
+
+// DiasAtraso cuenta los días calendario posteriores al vencimiento hasta
+// la fecha indicada (inclusive), sin contar los feriados ni, si la política
+// lo pide, los fines de semana
+func (p politicaMultas) DiasAtraso(vence, hasta time.Time) int {
+	feriados := map[string]bool{}
+	for _, feriado := range p.Feriados {
+		feriados[feriado] = true
+	}
+
+	desde := time.Date(vence.Year(), vence.Month(), vence.Day(), 0, 0, 0, 0, time.Local)
+	fin := time.Date(hasta.Year(), hasta.Month(), hasta.Day(), 0, 0, 0, 0, time.Local)
+	dias := 0
+	for dia := desde.AddDate(0, 0, 1); !dia.After(fin); dia = dia.AddDate(0, 0, 1) {
+		finDeSemana := dia.Weekday() == time.Saturday || dia.Weekday() == time.Sunday
+		if !feriados[dia.Format(time.DateOnly)] && !(p.ExcluirFinesDeSemana && finDeSemana) {
+			dias++
+		}
+	}
+	return dias
+}
+
+// Multa de un préstamo que vence en vence y se devuelve (o se consulta) en hasta
+func (p politicaMultas) Multa(vence, hasta time.Time) Monto {
+	cobrables := p.DiasAtraso(vence.Local(), hasta.Local()) - p.DiasGracia
+	if cobrables <= 0 {
+		return 0
+	}
+	multa := Monto(cobrables) * p.TarifaDiaria
+	if p.Tope > 0 && multa > p.Tope {
+		multa = p.Tope
+	}
+	return multa
+}
+
+// Pago de multas de un socio
+type Pago struct {
+	ID    int       `json:"id"`
+	Socio string    `json:"socio"`
+	Monto Monto     `json:"monto"`
+	Fecha time.Time `json:"fecha"`
+}
+
+// Registro de pagos protegido con mutex
+type registroPagos struct {
+	mu         sync.Mutex
+	pagos      []Pago
+	contadorID int
+}
+
+// DeSocio devuelve los pagos de un socio
+func (g *registroPagos) DeSocio(socio string) []Pago {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	lista := []Pago{}
+	for _, pago := range g.pagos {
+		if strings.EqualFold(pago.Socio, socio) {
+			lista = append(lista, pago)
+		}
+	}
+	return lista
+}
+
+// Registrar guarda el pago si no supera lo que queda por pagar de multas
+func (g *registroPagos) Registrar(socio string, monto, multas Monto) (Pago, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	pendiente := multas
+	for _, pago := range g.pagos {
+		if strings.EqualFold(pago.Socio, socio) {
+			pendiente -= pago.Monto
+		}
+	}
+	if monto > pendiente {
+		return Pago{}, nuevoMensaje(msgPagoExcedeSaldo, monto, pendiente)
+	}
+	pago := Pago{ID: g.contadorID, Socio: socio, Monto: monto, Fecha: time.Now()}
+	g.contadorID++
+	g.pagos = append(g.pagos, pago)
+	return pago, nil
+}
+
+// Multa de un préstamo en el saldo
+type detalleMulta struct {
+	PrestamoID int   `json:"prestamo_id"`
+	LibroID    int   `json:"libro_id"`
+	DiasAtraso int   `json:"dias_atraso"`
+	Multa      Monto `json:"multa"`
+	EnCurso    bool  `json:"en_curso"` // Sin devolver: sigue sumando
+}
+
+// Estado de cuenta de un socio
+type saldoSocio struct {
+	Socio   string         `json:"socio"`
+	Multas  Monto          `json:"multas"`
+	Pagado  Monto          `json:"pagado"`
+	Saldo   Monto          `json:"saldo"`
+	Detalle []detalleMulta `json:"detalle"`
+	Pagos   []Pago         `json:"pagos"`
+}
+
+// calcularSaldo suma las multas (las abiertas, al momento actual) y resta los pagos
+func (s *sucursal) calcularSaldo(socio string) saldoSocio {
+	ahora, politica := time.Now(), s.politicaVigente()
+	saldo := saldoSocio{Socio: socio, Detalle: []detalleMulta{}, Pagos: s.pagos.DeSocio(socio)}
+
+	for _, prestamo := range s.prestamos.Buscar(func(p Prestamo) bool { return strings.EqualFold(p.Socio, socio) }) {
+		prestamo = conMultaAlDia(prestamo, ahora, politica)
+		if *prestamo.Multa == 0 {
+			continue
+		}
+		hasta := ahora
+		if prestamo.DevueltoEn != nil {
+			hasta = *prestamo.DevueltoEn
+		}
+		saldo.Detalle = append(saldo.Detalle, detalleMulta{
+			PrestamoID: prestamo.ID,
+			LibroID:    prestamo.LibroID,
+			DiasAtraso: politica.DiasAtraso(prestamo.VenceEn.Local(), hasta.Local()),
+			Multa:      *prestamo.Multa,
+			EnCurso:    prestamo.DevueltoEn == nil,
+		})
+		saldo.Multas += *prestamo.Multa
+	}
+	for _, pago := range saldo.Pagos {
+		saldo.Pagado += pago.Monto
+	}
+	saldo.Saldo = saldo.Multas - saldo.Pagado
+	return saldo
+}
+
+// HANDLERS
+
+// GET /api/multas/politica - Política de multas vigente
+func obtenerPoliticaMultas(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	responderJSON(w, http.StatusOK, s.politicaVigente())
+}
+
+// PUT /api/multas/politica - Reemplazar la política (las multas ya fijadas no cambian)
+func actualizarPoliticaMultas(w http.ResponseWriter, r *http.Request) {
+	var nueva politicaMultas
+	if err := decodificarJSON(w, r, &nueva); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	if nueva.Feriados == nil {
+		nueva.Feriados = []string{}
+	}
+	if mensaje := validarPoliticaMultas(nueva); mensaje != nil {
+		responderMensaje(w, r, http.StatusBadRequest, mensaje)
+		return
+	}
+
+	s := sucursalDe(r.Context())
+	s.multas.mu.Lock()
+	s.multas.politica = nueva
+	s.multas.mu.Unlock()
+
+	responderJSON(w, http.StatusOK, nueva)
+}
+
+// GET /api/socios/{socio}/saldo - Multas, pagos y saldo pendiente
+func obtenerSaldoSocio(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	socio := parametroRuta(r, "socio")
+	responderJSON(w, http.StatusOK, s.calcularSaldo(socio))
+}
+
+// POST /api/socios/{socio}/pagos - Registrar un pago de multas
+func registrarPago(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	socio := parametroRuta(r, "socio")
+
+	var datos struct {
+		Monto Monto `json:"monto"`
+	}
+	if err := decodificarJSON(w, r, &datos); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	if datos.Monto <= 0 {
+		responderError(w, r, http.StatusBadRequest, msgMontoNoPositivo)
+		return
+	}
+
+	pago, err := s.pagos.Registrar(socio, datos.Monto, s.calcularSaldo(socio).Multas)
+	if err != nil {
+		responderMensaje(w, r, http.StatusConflict, comoMensaje(err))
+		return
+	}
+	responderJSON(w, http.StatusCreated, pago)
+}
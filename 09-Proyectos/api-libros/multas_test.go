@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func fecha(texto string) time.Time {
+	f, err := time.ParseInLocation(time.DateOnly, texto, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return f.Add(15 * time.Hour) // La hora no importa, solo el día
+}
+
+func TestDiasAtraso(t *testing.T) {
+	t.Parallel()
+	navidad := []string{"2024-12-25"}
+	// El 2024-12-20 es viernes
+	casos := []struct {
+		nombre        string
+		feriados      []string
+		finesDeSemana bool // excluir_fines_de_semana
+		vence, hasta  string
+		dias          int
+	}{
+		{"mismo día", nil, false, "2024-12-20", "2024-12-20", 0},
+		{"antes de vencer", nil, false, "2024-12-20", "2024-12-10", 0},
+		{"un día", nil, false, "2024-12-20", "2024-12-21", 1},
+		{"días calendario", nil, false, "2024-12-20", "2024-12-27", 7},
+		{"sin el feriado", navidad, false, "2024-12-20", "2024-12-27", 6},
+		{"sin fin de semana", nil, true, "2024-12-20", "2024-12-27", 5},
+		{"sin fin de semana ni feriado", navidad, true, "2024-12-20", "2024-12-27", 4},
+		{"solo el fin de semana", nil, true, "2024-12-20", "2024-12-22", 0},
+		{"feriado en fin de semana", []string{"2024-12-21"}, true, "2024-12-20", "2024-12-23", 1},
+		{"cambio de año", []string{"2025-01-01"}, false, "2024-12-30", "2025-01-02", 2},
+	}
+	for _, caso := range casos {
+		politica := politicaMultas{Feriados: caso.feriados, ExcluirFinesDeSemana: caso.finesDeSemana}
+		if dias := politica.DiasAtraso(fecha(caso.vence), fecha(caso.hasta)); dias != caso.dias {
+			t.Errorf("%s: %d días, se esperaban %d", caso.nombre, dias, caso.dias)
+		}
+	}
+}
+
+func TestMulta(t *testing.T) {
+	t.Parallel()
+	vence := fecha("2024-03-01")
+	casos := []struct {
+		nombre   string
+		politica politicaMultas
+		hasta    string
+		multa    Monto
+	}{
+		{"en término", politicaMultas{TarifaDiaria: 50, DiasGracia: 2}, "2024-03-01", 0},
+		{"dentro de la gracia", politicaMultas{TarifaDiaria: 50, DiasGracia: 2}, "2024-03-03", 0},
+		{"un día cobrable", politicaMultas{TarifaDiaria: 50, DiasGracia: 2}, "2024-03-04", 50},
+		{"sin gracia", politicaMultas{TarifaDiaria: 50}, "2024-03-11", 500},
+		{"con tope", politicaMultas{TarifaDiaria: 50, DiasGracia: 2, Tope: 200}, "2024-03-31", 200},
+		{"justo en el tope", politicaMultas{TarifaDiaria: 50, Tope: 200}, "2024-03-05", 200},
+		{"tope 0 = sin tope", politicaMultas{TarifaDiaria: 50}, "2024-03-31", 1500},
+		{"feriado y gracia", politicaMultas{TarifaDiaria: 100, DiasGracia: 1, Feriados: []string{"2024-03-02"}}, "2024-03-04", 100},
+	}
+	for _, caso := range casos {
+		if multa := caso.politica.Multa(vence, fecha(caso.hasta)); multa != caso.multa {
+			t.Errorf("%s: multa %s, se esperaba %s", caso.nombre, multa, caso.multa)
+		}
+	}
+}
+
+func TestParsearMonto(t *testing.T) {
+	t.Parallel()
+	casos := []struct {
+		texto string
+		monto Monto
+		ok    bool
+	}{
+		{"12", 1200, true},
+		{"12.5", 1250, true},
+		{"1.5", 150, true},
+		{"12.50", 1250, true},
+		{"0.05", 5, true},
+		{"0", 0, true},
+		{"999999999999.99", 99999999999999, true},
+		{"1.555", 0, false},
+		{"-1", 0, false},
+		{"-1.50", 0, false},
+		{"+1", 0, false},
+		{"1.", 0, false},
+		{".5", 0, false},
+		{"", 0, false},
+		{"1e3", 0, false},
+		{"1,50", 0, false},
+		{"1 000", 0, false},
+		{"1000000000000", 0, false}, // Más de 12 cifras enteras
+		{"99999999999999999999", 0, false},
+	}
+	for _, caso := range casos {
+		monto, err := parsearMonto(caso.texto)
+		if caso.ok != (err == nil) || monto != caso.monto {
+			t.Errorf("parsearMonto(%q) = %d, %v; se esperaba %d (ok %v)", caso.texto, monto, err, caso.monto, caso.ok)
+		}
+		var e errorMonto
+		if err != nil && !errors.As(err, &e) {
+			t.Errorf("parsearMonto(%q): error %T, se esperaba errorMonto", caso.texto, err)
+		}
+	}
+}
+
+func TestMontoJSON(t *testing.T) {
+	t.Parallel()
+	casos := []struct {
+		json  string
+		monto Monto
+		ok    bool
+	}{
+		{`"1.5"`, 150, true},
+		{`1.5`, 150, true},
+		{`"12.50"`, 1250, true},
+		{`7`, 700, true},
+		{`"1.555"`, 0, false},
+		{`1.555`, 0, false},
+		{`"-1.00"`, 0, false},
+		{`-1`, 0, false},
+		{`1e2`, 0, false},
+		{`"99999999999999999999"`, 0, false},
+		{`"abc"`, 0, false},
+		{`null`, 0, false},
+	}
+	for _, caso := range casos {
+		var monto Monto
+		err := json.Unmarshal([]byte(caso.json), &monto)
+		if caso.ok != (err == nil) || monto != caso.monto {
+			t.Errorf("Unmarshal(%s) = %d, %v; se esperaba %d (ok %v)", caso.json, monto, err, caso.monto, caso.ok)
+		}
+	}
+
+	// Se serializa como texto con dos decimales, también los negativos
+	for monto, texto := range map[Monto]string{0: `"0.00"`, 5: `"0.05"`, 1250: `"12.50"`, -150: `"-1.50"`} {
+		if datos, _ := json.Marshal(monto); string(datos) != texto {
+			t.Errorf("Marshal(%d) = %s, se esperaba %s", monto, datos, texto)
+		}
+	}
+}
+
+func TestRegistrarPagoNoSuperaSaldo(t *testing.T) {
+	t.Parallel()
+	var pagos registroPagos
+	if _, err := pagos.Registrar("ana", 300, 500); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pagos.Registrar("ANA", 201, 500); err == nil {
+		t.Error("un pago mayor que lo pendiente se aceptó")
+	}
+	if _, err := pagos.Registrar("Ana", 200, 500); err != nil {
+		t.Errorf("el pago de lo pendiente exacto: %v", err)
+	}
+	if _, err := pagos.Registrar("beto", 1, 0); err == nil {
+		t.Error("un pago sin multas se aceptó")
+	}
+	if total := len(pagos.DeSocio("ana")); total != 2 {
+		t.Errorf("%d pagos de ana, se esperaban 2", total)
+	}
+}
+
+// Un pago mayor que el saldo es 409; el saldo exacto lo deja en cero
+func TestPagosPorHTTP(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	// ana tiene un préstamo vencido en los datos de ejemplo
+	var saldo saldoSocio
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/socios/ana/saldo", "", &saldo)
+	if saldo.Saldo <= 0 || len(saldo.Detalle) != 1 || !saldo.Detalle[0].EnCurso {
+		t.Fatalf("saldo inicial de ana: %+v", saldo)
+	}
+
+	casos := []struct {
+		cuerpo string
+		estado int
+		codigo codigoMensaje
+	}{
+		{`{"monto":"` + (saldo.Saldo + 1).String() + `"}`, http.StatusConflict, msgPagoExcedeSaldo},
+		{`{"monto":"0"}`, http.StatusBadRequest, msgMontoNoPositivo},
+		{`{"monto":"1.555"}`, http.StatusBadRequest, msgMontoInvalido},
+		{`{"monto":-1}`, http.StatusBadRequest, msgMontoInvalido},
+		{`{"monto":"` + saldo.Saldo.String() + `"}`, http.StatusCreated, ""},
+		{`{"monto":"0.01"}`, http.StatusConflict, msgPagoExcedeSaldo},
+	}
+	for _, caso := range casos {
+		var respuesta struct {
+			Codigo codigoMensaje `json:"codigo"`
+		}
+		estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/socios/ana/pagos", caso.cuerpo, &respuesta)
+		if estado != caso.estado || respuesta.Codigo != caso.codigo {
+			t.Errorf("pago %s = %d %q, se esperaba %d %q", caso.cuerpo, estado, respuesta.Codigo, caso.estado, caso.codigo)
+		}
+	}
+
+	var despues saldoSocio
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/socios/ana/saldo", "", &despues)
+	if despues.Saldo != 0 || despues.Pagado != saldo.Saldo || len(despues.Pagos) != 1 {
+		t.Errorf("saldo después de pagar: %+v", despues)
+	}
+}
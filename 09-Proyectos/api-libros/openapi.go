@@ -0,0 +1,1131 @@
+// Especificación OpenAPI 3.1 generada a partir de la tabla de rutas
+package main
+
+import (
+	"embed"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Página de documentación con Swagger UI
+//
+//go:embed docs.html
+var paginaDocumentacion []byte
+
+// Archivos de Swagger UI servidos desde el binario, sin depender de un CDN.
+// La versión está fijada en swaggerui/VERSION; para traerla (o cambiarla):
+//
+//go:generate go run ./cmd/swaggerui
+//go:embed swaggerui
+var archivosSwaggerUI embed.FS
+
+// Archivos de swaggerui/ que se pueden pedir, con su Content-Type
+var recursosSwaggerUI = map[string]string{
+	"swagger-ui.css":       "text/css; charset=utf-8",
+	"swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+}
+
+// Documentación de una operación de la API
+type operacionDoc struct {
+	Resumen    string
+	Etiqueta   string
+	Consulta   []parametroDoc // Parámetros de query string
+	Cabeceras  []parametroDoc // Cabeceras de la petición
+	Cuerpo     string         // Schema del body de la petición
+	Archivo    string         // Body binario: campo multipart que lo trae (o la imagen sola)
+	Respuestas map[int]string // Código HTTP -> schema ("" sin contenido JSON)
+	Contenido  string         // Tipo de contenido si la respuesta no es JSON
+}
+
+// Parámetro de consulta documentado
+type parametroDoc struct {
+	Nombre      string
+	Tipo        string
+	Descripcion string
+}
+
+// Documentación de cada ruta, indexada por "MÉTODO /patrón"
+var documentacionRutas = map[string]operacionDoc{
+	"GET /api/libros": {
+		Resumen:  "Listar libros",
+		Etiqueta: "libros",
+		Consulta: []parametroDoc{
+			{"genero", "string", "Filtra por género, incluidos sus subgéneros (sin distinguir mayúsculas)"},
+			{"disponible", "boolean", "Filtra por disponibilidad"},
+			{"incluir_eliminados", "boolean", "Incluye los libros en la papelera"},
+		},
+		Respuestas: map[int]string{200: "ListaLibros"},
+	},
+	"POST /api/libros": {
+		Resumen:  "Crear libro",
+		Etiqueta: "libros",
+		Cuerpo:   "Libro",
+		Cabeceras: []parametroDoc{
+			{"Idempotency-Key", "string", "Los reintentos con la misma clave y el mismo cuerpo devuelven la primera respuesta (24 h)"},
+		},
+		Respuestas: map[int]string{201: "Libro", 400: "Error", 409: "Error", 413: "Error", 415: "Error", 422: "Error"},
+	},
+	"GET /api/libros/eventos": {
+		Resumen:  "Flujo de cambios del catálogo (Server-Sent Events)",
+		Etiqueta: "eventos",
+		Consulta: []parametroDoc{
+			{"desde", "integer", "Reanuda tras este ID de evento (alternativa a la cabecera Last-Event-ID)"},
+		},
+		Respuestas: map[int]string{200: "", 400: "Error"},
+		Contenido:  "text/event-stream",
+	},
+	"GET /api/libros/eventos/ws": {
+		Resumen:  "Flujo de cambios del catálogo (WebSocket)",
+		Etiqueta: "eventos",
+		Consulta: []parametroDoc{
+			{"desde", "integer", "Reanuda tras este ID de evento"},
+		},
+		Respuestas: map[int]string{101: "", 400: "Error", 426: "Error"},
+	},
+	"POST /api/libros/desde-isbn": {
+		Resumen:  "Crear un libro con los datos del catálogo externo para un ISBN (admite Idempotency-Key)",
+		Etiqueta: "libros",
+		Cuerpo:   "LibroDesdeISBN",
+		Cabeceras: []parametroDoc{
+			{"Idempotency-Key", "string", "Los reintentos con la misma clave y el mismo cuerpo devuelven la primera respuesta (24 h)"},
+		},
+		Respuestas: map[int]string{201: "Libro", 400: "Error", 404: "Error", 409: "Error", 413: "Error", 415: "Error", 422: "Error", 502: "Error"},
+	},
+	"GET /api/libros/{id}": {
+		Resumen:    "Obtener libro por ID",
+		Etiqueta:   "libros",
+		Respuestas: map[int]string{200: "Libro", 400: "Error", 404: "Error"},
+	},
+	"PUT /api/libros/{id}": {
+		Resumen:    "Actualizar libro",
+		Etiqueta:   "libros",
+		Cuerpo:     "Libro",
+		Respuestas: map[int]string{200: "Libro", 400: "Error", 404: "Error", 413: "Error", 415: "Error"},
+	},
+	"DELETE /api/libros/{id}": {
+		Resumen:    "Enviar libro a la papelera",
+		Etiqueta:   "libros",
+		Respuestas: map[int]string{200: "Mensaje", 400: "Error", 404: "Error"},
+	},
+	"GET /api/libros/{id}/historial": {
+		Resumen:    "Historial de cambios de un libro",
+		Etiqueta:   "auditoría",
+		Respuestas: map[int]string{200: "ListaAuditoria", 400: "Error", 404: "Error"},
+	},
+	"GET /api/estadisticas": {
+		Resumen:    "Disponibilidad, libros por género, por década, autores con más libros y altas por mes",
+		Etiqueta:   "estadísticas",
+		Consulta:   consultaEstadisticas,
+		Respuestas: map[int]string{200: "Estadisticas", 400: "Error"},
+	},
+	"GET /api/estadisticas/{reporte}": {
+		Resumen:  "Un reporte (disponibilidad, generos, decadas, autores o mensual) en JSON o CSV",
+		Etiqueta: "estadísticas",
+		Consulta: append([]parametroDoc{
+			{"formato", "string", "csv para descargar el reporte (también con Accept: text/csv)"},
+		}, consultaEstadisticas...),
+		Respuestas: map[int]string{200: "ReporteEstadisticas", 400: "Error", 404: "Error"},
+	},
+	"GET /api/auditoria": {
+		Resumen:  "Registro de auditoría de todas las mutaciones",
+		Etiqueta: "auditoría",
+		Consulta: []parametroDoc{
+			{"desde", "string", "Fecha inicial (RFC 3339 o AAAA-MM-DD)"},
+			{"hasta", "string", "Fecha final, inclusive (RFC 3339 o AAAA-MM-DD)"},
+		},
+		Respuestas: map[int]string{200: "ListaAuditoria", 400: "Error"},
+	},
+	"GET /api/libros/{id}/ejemplares": {
+		Resumen:  "Ejemplares de un libro",
+		Etiqueta: "ejemplares",
+		Consulta: []parametroDoc{
+			{"incluir_bajas", "boolean", "Incluye los ejemplares dados de baja"},
+		},
+		Respuestas: map[int]string{200: "ListaEjemplares", 400: "Error", 404: "Error"},
+	},
+	"POST /api/libros/{id}/ejemplares": {
+		Resumen:    "Agregar un ejemplar (actualiza la disponibilidad del libro)",
+		Etiqueta:   "ejemplares",
+		Cuerpo:     "Ejemplar",
+		Respuestas: map[int]string{201: "Ejemplar", 400: "Error", 404: "Error", 409: "Error", 413: "Error", 415: "Error"},
+	},
+	"PUT /api/libros/{id}/portada": {
+		Resumen:    "Subir o reemplazar la portada (JPEG, PNG o GIF; máximo 5 MB y 4000 px de lado)",
+		Etiqueta:   "portadas",
+		Archivo:    "portada",
+		Respuestas: map[int]string{200: "Portada", 201: "Portada", 400: "Error", 404: "Error", 413: "Error", 415: "Error"},
+	},
+	"GET /api/libros/{id}/portada": {
+		Resumen:  "Imagen original de la portada (con ?v= de la versión actual se guarda un año)",
+		Etiqueta: "portadas",
+		Consulta: []parametroDoc{
+			{"v", "string", "Versión de la portada; la URL del campo portada del libro ya la incluye"},
+		},
+		Respuestas: map[int]string{200: "", 206: "", 400: "Error", 404: "Error"},
+		Contenido:  "image/*",
+	},
+	"DELETE /api/libros/{id}/portada": {
+		Resumen:    "Quitar la portada",
+		Etiqueta:   "portadas",
+		Respuestas: map[int]string{204: "", 400: "Error", 404: "Error"},
+	},
+	"GET /api/libros/{id}/portada/miniatura": {
+		Resumen:  "Miniatura JPEG de 240 px de ancho",
+		Etiqueta: "portadas",
+		Consulta: []parametroDoc{
+			{"v", "string", "Versión de la portada"},
+		},
+		Respuestas: map[int]string{200: "", 206: "", 400: "Error", 404: "Error"},
+		Contenido:  "image/jpeg",
+	},
+	"GET /api/ejemplares/{id}": {
+		Resumen:    "Obtener ejemplar por ID",
+		Etiqueta:   "ejemplares",
+		Respuestas: map[int]string{200: "Ejemplar", 400: "Error", 404: "Error"},
+	},
+	"PUT /api/ejemplares/{id}": {
+		Resumen:    "Cambiar ubicación, condición o estado de un ejemplar",
+		Etiqueta:   "ejemplares",
+		Cuerpo:     "Ejemplar",
+		Respuestas: map[int]string{200: "Ejemplar", 400: "Error", 404: "Error", 409: "Error", 413: "Error", 415: "Error"},
+	},
+	"DELETE /api/ejemplares/{id}": {
+		Resumen:    "Dar de baja un ejemplar (409 si está prestado)",
+		Etiqueta:   "ejemplares",
+		Respuestas: map[int]string{200: "Ejemplar", 400: "Error", 404: "Error", 409: "Error"},
+	},
+	"GET /api/libros/{id}/reservas": {
+		Resumen:  "Cola de reservas del libro, en orden de llegada",
+		Etiqueta: "reservas",
+		Consulta: []parametroDoc{
+			{"incluir_finalizadas", "boolean", "Incluye las retiradas, vencidas y canceladas"},
+		},
+		Respuestas: map[int]string{200: "ListaReservas", 400: "Error", 404: "Error"},
+	},
+	"POST /api/libros/{id}/reservas": {
+		Resumen:    "Reservar un libro (queda lista en el acto si hay un ejemplar libre)",
+		Etiqueta:   "reservas",
+		Cuerpo:     "NuevaReserva",
+		Respuestas: map[int]string{201: "Reserva", 400: "Error", 404: "Error", 409: "Error", 413: "Error", 415: "Error"},
+	},
+	"GET /api/reservas/{id}": {
+		Resumen:    "Estado y posición en la cola de una reserva",
+		Etiqueta:   "reservas",
+		Respuestas: map[int]string{200: "Reserva", 400: "Error", 404: "Error"},
+	},
+	"DELETE /api/reservas/{id}": {
+		Resumen:    "Cancelar una reserva (libera el ejemplar apartado)",
+		Etiqueta:   "reservas",
+		Respuestas: map[int]string{200: "Reserva", 400: "Error", 404: "Error", 409: "Error"},
+	},
+	"POST /api/reservas/{id}/retirar": {
+		Resumen:    "Retirar el ejemplar de una reserva lista (pasa a prestado)",
+		Etiqueta:   "reservas",
+		Respuestas: map[int]string{200: "Reserva", 400: "Error", 404: "Error", 409: "Error"},
+	},
+	"POST /api/libros/{id}/restaurar": {
+		Resumen:    "Restaurar libro de la papelera",
+		Etiqueta:   "libros",
+		Respuestas: map[int]string{200: "Libro", 400: "Error", 404: "Error"},
+	},
+	"GET /api/prestamos": {
+		Resumen:  "Listar préstamos con la multa al día",
+		Etiqueta: "préstamos",
+		Consulta: []parametroDoc{
+			{"socio", "string", "Solo los de este socio"},
+			{"activos", "boolean", "Solo los que no se devolvieron"},
+		},
+		Respuestas: map[int]string{200: "ListaPrestamos"},
+	},
+	"POST /api/prestamos": {
+		Resumen:    "Prestar un ejemplar disponible (vence según dias_prestamo de la política)",
+		Etiqueta:   "préstamos",
+		Cuerpo:     "NuevoPrestamo",
+		Respuestas: map[int]string{201: "Prestamo", 400: "Error", 404: "Error", 409: "Error", 413: "Error", 415: "Error"},
+	},
+	"GET /api/prestamos/{id}": {
+		Resumen:    "Obtener préstamo con la multa al día",
+		Etiqueta:   "préstamos",
+		Respuestas: map[int]string{200: "Prestamo", 400: "Error", 404: "Error"},
+	},
+	"POST /api/prestamos/{id}/devolver": {
+		Resumen:  "Registrar la devolución y fijar la multa",
+		Etiqueta: "préstamos",
+		Consulta: []parametroDoc{
+			{"fecha", "string", "Fecha de devolución si se carga después (RFC 3339 o AAAA-MM-DD)"},
+		},
+		Respuestas: map[int]string{200: "Prestamo", 400: "Error", 404: "Error", 409: "Error"},
+	},
+	"GET /api/multas/politica": {
+		Resumen:    "Política de multas vigente",
+		Etiqueta:   "multas",
+		Respuestas: map[int]string{200: "PoliticaMultas"},
+	},
+	"PUT /api/multas/politica": {
+		Resumen:    "Reemplazar la política (no cambia las multas ya fijadas)",
+		Etiqueta:   "multas",
+		Cuerpo:     "PoliticaMultas",
+		Respuestas: map[int]string{200: "PoliticaMultas", 400: "Error", 413: "Error", 415: "Error"},
+	},
+	"GET /api/socios/{socio}/saldo": {
+		Resumen:    "Multas, pagos y saldo pendiente de un socio",
+		Etiqueta:   "multas",
+		Respuestas: map[int]string{200: "SaldoSocio"},
+	},
+	"POST /api/socios/{socio}/pagos": {
+		Resumen:    "Registrar un pago (409 si supera el saldo)",
+		Etiqueta:   "multas",
+		Cuerpo:     "NuevoPago",
+		Respuestas: map[int]string{201: "Pago", 400: "Error", 409: "Error", 413: "Error", 415: "Error"},
+	},
+	"GET /api/autores": {
+		Resumen:  "Listar autores",
+		Etiqueta: "autores",
+		Consulta: []parametroDoc{
+			{"nombre", "string", "Parte del nombre (sin distinguir acentos ni mayúsculas)"},
+		},
+		Respuestas: map[int]string{200: "ListaAutores"},
+	},
+	"POST /api/autores": {
+		Resumen:    "Crear autor",
+		Etiqueta:   "autores",
+		Cuerpo:     "Autor",
+		Respuestas: map[int]string{201: "Autor", 400: "Error", 409: "Error", 413: "Error", 415: "Error"},
+	},
+	"GET /api/autores/{id}": {
+		Resumen:    "Obtener autor por ID",
+		Etiqueta:   "autores",
+		Respuestas: map[int]string{200: "Autor", 400: "Error", 404: "Error"},
+	},
+	"PUT /api/autores/{id}": {
+		Resumen:    "Actualizar autor (los libros muestran el nombre nuevo)",
+		Etiqueta:   "autores",
+		Cuerpo:     "Autor",
+		Respuestas: map[int]string{200: "Autor", 400: "Error", 404: "Error", 409: "Error", 413: "Error", 415: "Error"},
+	},
+	"DELETE /api/autores/{id}": {
+		Resumen:    "Eliminar autor (409 si tiene libros, también en la papelera)",
+		Etiqueta:   "autores",
+		Respuestas: map[int]string{200: "Mensaje", 400: "Error", 404: "Error", 409: "Error"},
+	},
+	"GET /api/autores/{id}/libros": {
+		Resumen:    "Libros de un autor",
+		Etiqueta:   "autores",
+		Respuestas: map[int]string{200: "ListaLibros", 400: "Error", 404: "Error"},
+	},
+	"GET /api/generos": {
+		Resumen:    "Árbol de géneros con la cantidad de libros de cada nodo",
+		Etiqueta:   "géneros",
+		Respuestas: map[int]string{200: "ArbolGeneros"},
+	},
+	"POST /api/generos": {
+		Resumen:    "Crear género (padre_id para un subgénero)",
+		Etiqueta:   "géneros",
+		Cuerpo:     "Genero",
+		Respuestas: map[int]string{201: "Genero", 400: "Error", 409: "Error", 413: "Error", 415: "Error"},
+	},
+	"DELETE /api/generos/{id}": {
+		Resumen:    "Eliminar género (409 si tiene subgéneros o libros)",
+		Etiqueta:   "géneros",
+		Respuestas: map[int]string{200: "Mensaje", 400: "Error", 404: "Error", 409: "Error"},
+	},
+	"GET /api/webhooks": {
+		Resumen:    "Listar suscripciones de webhooks",
+		Etiqueta:   "webhooks",
+		Respuestas: map[int]string{200: "ListaWebhooks"},
+	},
+	"POST /api/webhooks": {
+		Resumen:    "Crear suscripción (el secreto solo se devuelve aquí)",
+		Etiqueta:   "webhooks",
+		Cuerpo:     "Webhook",
+		Respuestas: map[int]string{201: "Webhook", 400: "Error", 413: "Error", 415: "Error"},
+	},
+	"GET /api/webhooks/fallidos": {
+		Resumen:    "Entregas que agotaron los reintentos (dead-letter)",
+		Etiqueta:   "webhooks",
+		Respuestas: map[int]string{200: "ListaEntregas"},
+	},
+	"POST /api/webhooks/fallidos/{id}/reintentar": {
+		Resumen:    "Volver a encolar una entrega fallida",
+		Etiqueta:   "webhooks",
+		Respuestas: map[int]string{202: "Mensaje", 400: "Error", 404: "Error", 503: "Error"},
+	},
+	"GET /api/webhooks/{id}": {
+		Resumen:    "Obtener suscripción de webhook",
+		Etiqueta:   "webhooks",
+		Respuestas: map[int]string{200: "Webhook", 400: "Error", 404: "Error"},
+	},
+	"DELETE /api/webhooks/{id}": {
+		Resumen:    "Eliminar suscripción de webhook",
+		Etiqueta:   "webhooks",
+		Respuestas: map[int]string{200: "Mensaje", 400: "Error", 404: "Error"},
+	},
+	"GET /api/webhooks/{id}/entregas": {
+		Resumen:    "Log de entregas de una suscripción",
+		Etiqueta:   "webhooks",
+		Respuestas: map[int]string{200: "ListaEntregas", 400: "Error", 404: "Error"},
+	},
+	"GET /api/admin/sucursales": {
+		Resumen:    "Resumen de cada sucursal",
+		Etiqueta:   "administración",
+		Respuestas: map[int]string{200: "ListaSucursales", 403: "Error"},
+	},
+	"GET /api/admin/libros": {
+		Resumen:  "Libros de todas las sucursales",
+		Etiqueta: "administración",
+		Consulta: []parametroDoc{
+			{"sucursal", "string", "Solo los de esta sucursal"},
+			{"incluir_eliminados", "boolean", "Incluir los libros en la papelera"},
+		},
+		Respuestas: map[int]string{200: "ListaLibrosSucursales", 403: "Error", 404: "Error"},
+	},
+	"POST /graphql": {
+		Resumen:    "Ejecutar una consulta o mutación GraphQL",
+		Etiqueta:   "graphql",
+		Cuerpo:     "PeticionGraphQL",
+		Respuestas: map[int]string{200: "RespuestaGraphQL", 400: "Error", 413: "Error"},
+	},
+	"GET /graphql": {
+		Resumen:  "Ejecutar una consulta GraphQL (sin mutaciones)",
+		Etiqueta: "graphql",
+		Consulta: []parametroDoc{
+			{"query", "string", "Documento GraphQL"},
+			{"operationName", "string", "Operación a ejecutar si hay varias"},
+			{"variables", "string", "Variables codificadas en JSON"},
+		},
+		Respuestas: map[int]string{200: "RespuestaGraphQL", 400: "Error"},
+	},
+	"GET /openapi.json": {
+		Resumen:    "Especificación OpenAPI de esta API",
+		Etiqueta:   "documentación",
+		Respuestas: map[int]string{200: ""},
+	},
+	"GET /docs": {
+		Resumen:    "Documentación interactiva",
+		Etiqueta:   "documentación",
+		Respuestas: map[int]string{200: ""},
+		Contenido:  "text/html",
+	},
+	"GET /docs/swagger-ui/{archivo}": {
+		Resumen:    "Archivos de Swagger UI incluidos en el servidor",
+		Etiqueta:   "documentación",
+		Respuestas: map[int]string{200: "", 404: "Error"},
+	},
+}
+
+// Parámetros comunes de los reportes de estadísticas
+var consultaEstadisticas = []parametroDoc{
+	{"limite", "integer", "Cantidad de autores del ranking (por defecto 10)"},
+	{"desde", "string", "Inicio de la serie mensual (RFC 3339 o AAAA-MM-DD)"},
+	{"hasta", "string", "Fin de la serie mensual, inclusive (RFC 3339 o AAAA-MM-DD)"},
+}
+
+// Schemas compartidos por las operaciones
+var schemasOpenAPI = map[string]interface{}{
+	"Libro": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"titulo", "año"},
+		"properties": map[string]interface{}{
+			"id":     map[string]interface{}{"type": "integer", "readOnly": true},
+			"titulo": map[string]interface{}{"type": "string", "minLength": 1},
+			"autor": map[string]interface{}{
+				"type":        "string",
+				"description": "Nombres de los autores; si no se envía autores_ids se asocia al autor con ese nombre o a uno nuevo",
+			},
+			"autores_ids": map[string]interface{}{
+				"type":        []string{"array", "null"},
+				"items":       map[string]interface{}{"type": "integer"},
+				"description": "IDs de /api/autores; tiene prioridad sobre autor",
+			},
+			"año":                    map[string]interface{}{"type": "integer", "minimum": 1000},
+			"genero":                 map[string]interface{}{"type": "string", "description": "Nombre de un género de /api/generos"},
+			"disponible":             map[string]interface{}{"type": "boolean"},
+			"fecha_creado":           map[string]interface{}{"type": "string", "format": "date-time", "readOnly": true},
+			"fecha_actualizado":      map[string]interface{}{"type": "string", "format": "date-time", "readOnly": true},
+			"eliminado_en":           map[string]interface{}{"type": "string", "format": "date-time", "readOnly": true},
+			"ejemplares_total":       map[string]interface{}{"type": "integer", "readOnly": true},
+			"ejemplares_disponibles": map[string]interface{}{"type": "integer", "readOnly": true},
+			"isbn":                   map[string]interface{}{"type": "string", "description": "ISBN-10 o ISBN-13; se guarda como ISBN-13"},
+			"portada":                map[string]interface{}{"type": "string", "readOnly": true, "description": "URL de la portada, si tiene"},
+		},
+	},
+	"LibroDesdeISBN": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"isbn"},
+		"properties": map[string]interface{}{
+			"isbn":   map[string]interface{}{"type": "string"},
+			"genero": map[string]interface{}{"type": "string", "description": "Reemplaza el género deducido del catálogo"},
+			"año":    map[string]interface{}{"type": "integer", "description": "Reemplaza el año del catálogo"},
+		},
+	},
+	"Portada": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"libro_id", "tipo", "tamaño", "ancho", "alto", "version", "url", "miniatura", "fecha_actualizado"},
+		"properties": map[string]interface{}{
+			"libro_id":          map[string]interface{}{"type": "integer"},
+			"tipo":              map[string]interface{}{"type": "string", "enum": []string{"image/jpeg", "image/png", "image/gif"}},
+			"tamaño":            map[string]interface{}{"type": "integer", "description": "Bytes"},
+			"ancho":             map[string]interface{}{"type": "integer"},
+			"alto":              map[string]interface{}{"type": "integer"},
+			"version":           map[string]interface{}{"type": "string", "description": "Hash del contenido"},
+			"url":               map[string]interface{}{"type": "string"},
+			"miniatura":         map[string]interface{}{"type": "string"},
+			"fecha_actualizado": map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	},
+	"Ejemplar": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"codigo_barras"},
+		"properties": map[string]interface{}{
+			"id":            map[string]interface{}{"type": "integer", "readOnly": true},
+			"libro_id":      map[string]interface{}{"type": "integer", "readOnly": true},
+			"codigo_barras": map[string]interface{}{"type": "string", "minLength": 1, "maxLength": longitudMaximaCodigo},
+			"ubicacion":     map[string]interface{}{"type": "string"},
+			"condicion":     map[string]interface{}{"type": "string", "enum": condicionesEjemplar},
+			"estado":        map[string]interface{}{"type": "string", "enum": estadosEjemplar},
+			"fecha_alta":    map[string]interface{}{"type": "string", "format": "date-time", "readOnly": true},
+			"fecha_baja":    map[string]interface{}{"type": "string", "format": "date-time", "readOnly": true},
+		},
+	},
+	"NuevaReserva": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"socio"},
+		"properties": map[string]interface{}{
+			"socio": map[string]interface{}{"type": "string", "minLength": 1, "maxLength": longitudMaximaSocio},
+		},
+	},
+	"Reserva": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"id", "libro_id", "socio", "estado", "fecha_creado"},
+		"properties": map[string]interface{}{
+			"id":            map[string]interface{}{"type": "integer"},
+			"libro_id":      map[string]interface{}{"type": "integer"},
+			"socio":         map[string]interface{}{"type": "string"},
+			"estado":        map[string]interface{}{"type": "string", "enum": estadosReserva},
+			"posicion":      map[string]interface{}{"type": "integer", "description": "Lugar en la cola (solo en espera)"},
+			"ejemplar_id":   map[string]interface{}{"type": "integer", "description": "Ejemplar apartado"},
+			"fecha_creado":  map[string]interface{}{"type": "string", "format": "date-time"},
+			"lista_en":      map[string]interface{}{"type": "string", "format": "date-time"},
+			"vence_en":      map[string]interface{}{"type": "string", "format": "date-time", "description": "Límite para retirarla"},
+			"finalizada_en": map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	},
+	"ListaReservas": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"reservas", "total"},
+		"properties": map[string]interface{}{
+			"reservas": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]string{"$ref": "#/components/schemas/Reserva"},
+			},
+			"total": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"Monto": map[string]interface{}{
+		"type":        "string",
+		"pattern":     `^\d+(\.\d{1,2})?$`,
+		"description": "Importe decimal con hasta 2 cifras (también se acepta como número JSON)",
+		"examples":    []string{"12.50"},
+	},
+	"NuevoPrestamo": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"ejemplar_id", "socio"},
+		"properties": map[string]interface{}{
+			"ejemplar_id": map[string]interface{}{"type": "integer"},
+			"socio":       map[string]interface{}{"type": "string", "minLength": 1, "maxLength": longitudMaximaSocio},
+		},
+	},
+	"Prestamo": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"id", "ejemplar_id", "libro_id", "socio", "prestado_en", "vence_en"},
+		"properties": map[string]interface{}{
+			"id":          map[string]interface{}{"type": "integer"},
+			"ejemplar_id": map[string]interface{}{"type": "integer"},
+			"libro_id":    map[string]interface{}{"type": "integer"},
+			"socio":       map[string]interface{}{"type": "string"},
+			"prestado_en": map[string]interface{}{"type": "string", "format": "date-time"},
+			"vence_en":    map[string]interface{}{"type": "string", "format": "date-time"},
+			"devuelto_en": map[string]interface{}{"type": "string", "format": "date-time"},
+			"multa":       map[string]interface{}{"$ref": "#/components/schemas/Monto", "description": "Fija al devolver; acumulada al momento mientras no se devuelve"},
+		},
+	},
+	"ListaPrestamos": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"prestamos", "total"},
+		"properties": map[string]interface{}{
+			"prestamos": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]string{"$ref": "#/components/schemas/Prestamo"},
+			},
+			"total": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"PoliticaMultas": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"tarifa_diaria", "dias_gracia", "tope", "dias_prestamo"},
+		"properties": map[string]interface{}{
+			"tarifa_diaria": map[string]interface{}{"$ref": "#/components/schemas/Monto"},
+			"dias_gracia":   map[string]interface{}{"type": "integer", "minimum": 0},
+			"tope":          map[string]interface{}{"$ref": "#/components/schemas/Monto", "description": "Máximo por préstamo; 0 = sin tope"},
+			"feriados": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string", "format": "date"},
+			},
+			"dias_prestamo": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 365},
+			"excluir_fines_de_semana": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Sábados y domingos no cuentan como atraso",
+			},
+		},
+	},
+	"NuevoPago": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"monto"},
+		"properties": map[string]interface{}{
+			"monto": map[string]interface{}{"$ref": "#/components/schemas/Monto"},
+		},
+	},
+	"Pago": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"id", "socio", "monto", "fecha"},
+		"properties": map[string]interface{}{
+			"id":    map[string]interface{}{"type": "integer"},
+			"socio": map[string]interface{}{"type": "string"},
+			"monto": map[string]interface{}{"$ref": "#/components/schemas/Monto"},
+			"fecha": map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	},
+	"SaldoSocio": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"socio", "multas", "pagado", "saldo", "detalle", "pagos"},
+		"properties": map[string]interface{}{
+			"socio":  map[string]interface{}{"type": "string"},
+			"multas": map[string]interface{}{"$ref": "#/components/schemas/Monto"},
+			"pagado": map[string]interface{}{"$ref": "#/components/schemas/Monto"},
+			"saldo":  map[string]interface{}{"$ref": "#/components/schemas/Monto"},
+			"detalle": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"prestamo_id": map[string]interface{}{"type": "integer"},
+						"libro_id":    map[string]interface{}{"type": "integer"},
+						"dias_atraso": map[string]interface{}{"type": "integer"},
+						"multa":       map[string]interface{}{"$ref": "#/components/schemas/Monto"},
+						"en_curso":    map[string]interface{}{"type": "boolean"},
+					},
+				},
+			},
+			"pagos": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]string{"$ref": "#/components/schemas/Pago"},
+			},
+		},
+	},
+	"Estadisticas": map[string]interface{}{
+		"type":     "object",
+		"required": nombresReportes,
+		"properties": map[string]interface{}{
+			"disponibilidad": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"total":          map[string]interface{}{"type": "integer"},
+					"disponibles":    map[string]interface{}{"type": "integer"},
+					"no_disponibles": map[string]interface{}{"type": "integer"},
+					"proporcion":     map[string]interface{}{"type": "number", "minimum": 0, "maximum": 1},
+				},
+			},
+			"generos": map[string]interface{}{"type": "array", "items": filaEstadistica("genero", "string")},
+			"decadas": map[string]interface{}{"type": "array", "items": filaEstadistica("decada", "integer")},
+			"autores": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"autor_id": map[string]interface{}{"type": "integer"},
+						"nombre":   map[string]interface{}{"type": "string"},
+						"libros":   map[string]interface{}{"type": "integer"},
+					},
+				},
+			},
+			"mensual": map[string]interface{}{"type": "array", "items": filaEstadistica("mes", "string")},
+		},
+	},
+	"ReporteEstadisticas": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"reporte", "datos"},
+		"properties": map[string]interface{}{
+			"reporte": map[string]interface{}{"type": "string", "enum": nombresReportes},
+			"datos":   map[string]interface{}{"description": "Mismo formato que la clave homónima de Estadisticas"},
+		},
+	},
+	"ListaEjemplares": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"ejemplares", "total", "disponibles"},
+		"properties": map[string]interface{}{
+			"ejemplares": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]string{"$ref": "#/components/schemas/Ejemplar"},
+			},
+			"total":       map[string]interface{}{"type": "integer", "description": "Ejemplares activos"},
+			"disponibles": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"Autor": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"nombre"},
+		"properties": map[string]interface{}{
+			"id":                map[string]interface{}{"type": "integer", "readOnly": true},
+			"nombre":            map[string]interface{}{"type": "string", "minLength": 1},
+			"año_nacimiento":    map[string]interface{}{"type": "integer"},
+			"año_fallecimiento": map[string]interface{}{"type": "integer"},
+			"nacionalidad":      map[string]interface{}{"type": "string"},
+			"fecha_creado":      map[string]interface{}{"type": "string", "format": "date-time", "readOnly": true},
+		},
+	},
+	"ListaAutores": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"autores", "total"},
+		"properties": map[string]interface{}{
+			"autores": map[string]interface{}{
+				"type":  []string{"array", "null"},
+				"items": map[string]string{"$ref": "#/components/schemas/Autor"},
+			},
+			"total": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"Genero": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"nombre"},
+		"properties": map[string]interface{}{
+			"id":       map[string]interface{}{"type": "integer", "readOnly": true},
+			"nombre":   map[string]interface{}{"type": "string", "minLength": 1},
+			"padre_id": map[string]interface{}{"type": "integer", "description": "Ausente en los géneros raíz"},
+		},
+	},
+	"NodoGenero": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"id", "nombre", "libros", "libros_total", "subgeneros"},
+		"properties": map[string]interface{}{
+			"id":           map[string]interface{}{"type": "integer"},
+			"nombre":       map[string]interface{}{"type": "string"},
+			"padre_id":     map[string]interface{}{"type": "integer"},
+			"libros":       map[string]interface{}{"type": "integer", "description": "Libros de este género"},
+			"libros_total": map[string]interface{}{"type": "integer", "description": "Incluyendo los subgéneros"},
+			"subgeneros": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]string{"$ref": "#/components/schemas/NodoGenero"},
+			},
+		},
+	},
+	"ArbolGeneros": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"generos", "total"},
+		"properties": map[string]interface{}{
+			"generos": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]string{"$ref": "#/components/schemas/NodoGenero"},
+			},
+			"total": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"ListaLibros": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"libros", "total"},
+		"properties": map[string]interface{}{
+			"libros": map[string]interface{}{
+				"type":  []string{"array", "null"},
+				"items": map[string]string{"$ref": "#/components/schemas/Libro"},
+			},
+			"total": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"EventoLibro": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"id", "tipo", "libro", "fecha"},
+		"properties": map[string]interface{}{
+			"id":       map[string]interface{}{"type": "integer"},
+			"tipo":     map[string]interface{}{"type": "string", "enum": []string{eventoCreado, eventoActualizado, eventoEliminado}},
+			"libro":    map[string]string{"$ref": "#/components/schemas/Libro"},
+			"fecha":    map[string]interface{}{"type": "string", "format": "date-time"},
+			"sucursal": map[string]interface{}{"type": "string"},
+			"anterior": map[string]interface{}{
+				"$ref":        "#/components/schemas/Libro",
+				"description": "Estado previo (solo en actualizaciones)",
+			},
+		},
+	},
+	"EntradaAuditoria": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"id", "libro_id", "accion", "actor", "fecha", "cambios"},
+		"properties": map[string]interface{}{
+			"id":         map[string]interface{}{"type": "integer"},
+			"libro_id":   map[string]interface{}{"type": "integer"},
+			"accion":     map[string]interface{}{"type": "string", "enum": []string{eventoCreado, eventoActualizado, eventoEliminado, accionRestaurado, accionPurgado}},
+			"actor":      map[string]interface{}{"type": "string", "description": "Cabecera X-Actor de la petición"},
+			"request_id": map[string]interface{}{"type": "string"},
+			"fecha":      map[string]interface{}{"type": "string", "format": "date-time"},
+			"cambios": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"campo", "anterior", "nuevo"},
+					"properties": map[string]interface{}{
+						"campo":    map[string]interface{}{"type": "string"},
+						"anterior": map[string]interface{}{},
+						"nuevo":    map[string]interface{}{},
+					},
+				},
+			},
+		},
+	},
+	"ListaAuditoria": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"entradas", "total"},
+		"properties": map[string]interface{}{
+			"entradas": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]string{"$ref": "#/components/schemas/EntradaAuditoria"},
+			},
+			"total": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"Webhook": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"url", "eventos"},
+		"properties": map[string]interface{}{
+			"id":  map[string]interface{}{"type": "integer", "readOnly": true},
+			"url": map[string]interface{}{"type": "string", "format": "uri"},
+			"eventos": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string", "enum": eventosWebhook},
+			},
+			"secreto":      map[string]interface{}{"type": "string", "description": "Clave HMAC; se genera si no se envía"},
+			"fecha_creado": map[string]interface{}{"type": "string", "format": "date-time", "readOnly": true},
+		},
+	},
+	"ListaWebhooks": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"webhooks", "total"},
+		"properties": map[string]interface{}{
+			"webhooks": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]string{"$ref": "#/components/schemas/Webhook"},
+			},
+			"total": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"EntregaWebhook": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":              map[string]interface{}{"type": "integer"},
+			"suscripcion_id":  map[string]interface{}{"type": "integer"},
+			"evento":          map[string]interface{}{"type": "string"},
+			"evento_id":       map[string]interface{}{"type": "integer"},
+			"estado":          map[string]interface{}{"type": "string", "enum": []string{entregaPendiente, entregaExitosa, entregaFallida}},
+			"proximo_intento": map[string]interface{}{"type": "string", "format": "date-time"},
+			"intentos": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"numero":      map[string]interface{}{"type": "integer"},
+						"fecha":       map[string]interface{}{"type": "string", "format": "date-time"},
+						"codigo_http": map[string]interface{}{"type": "integer"},
+						"error":       map[string]interface{}{"type": "string"},
+						"duracion":    map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+		},
+	},
+	"ListaEntregas": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"entregas", "total"},
+		"properties": map[string]interface{}{
+			"entregas": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]string{"$ref": "#/components/schemas/EntregaWebhook"},
+			},
+			"total": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"Mensaje": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"mensaje"},
+		"properties": map[string]interface{}{
+			"mensaje": map[string]interface{}{"type": "string"},
+		},
+	},
+	"PeticionGraphQL": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"query"},
+		"properties": map[string]interface{}{
+			"query":         map[string]interface{}{"type": "string"},
+			"operationName": map[string]interface{}{"type": "string"},
+			"variables":     map[string]interface{}{"type": "object"},
+		},
+	},
+	"RespuestaGraphQL": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"data": map[string]interface{}{"type": []string{"object", "null"}},
+			"errors": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"message": map[string]interface{}{"type": "string"},
+						"path":    map[string]interface{}{"type": "array"},
+					},
+				},
+			},
+		},
+	},
+	"ResumenSucursal": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":                map[string]interface{}{"type": "string"},
+			"libros":            map[string]interface{}{"type": "integer"},
+			"en_papelera":       map[string]interface{}{"type": "integer"},
+			"autores":           map[string]interface{}{"type": "integer"},
+			"ejemplares":        map[string]interface{}{"type": "integer"},
+			"prestamos_activos": map[string]interface{}{"type": "integer"},
+			"ultimo_cambio":     map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	},
+	"ListaSucursales": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"sucursales": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]string{"$ref": "#/components/schemas/ResumenSucursal"},
+			},
+			"total": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"ListaLibrosSucursales": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"libros": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"allOf": []interface{}{
+						map[string]string{"$ref": "#/components/schemas/Libro"},
+						map[string]interface{}{
+							"type":       "object",
+							"properties": map[string]interface{}{"sucursal": map[string]interface{}{"type": "string"}},
+						},
+					},
+				},
+			},
+			"total": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"Error": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"error", "codigo"},
+		"properties": map[string]interface{}{
+			"error":  map[string]interface{}{"type": "string", "description": "Mensaje en el idioma negociado con Accept-Language"},
+			"codigo": map[string]interface{}{"type": "string", "description": "Código estable del mensaje (igual en todos los idiomas)", "example": "libro_no_encontrado"},
+		},
+	},
+}
+
+// generarOpenAPI construye el documento; las rutas sin documentación se
+// omiten (openapi_test.go comprueba que no falte ninguna)
+func generarOpenAPI(rutas []ruta) map[string]interface{} {
+	paths := map[string]map[string]interface{}{}
+	usados := map[string]bool{}
+
+	for _, rt := range rutas {
+		doc, ok := documentacionRutas[rt.Metodo+" "+rt.Patron]
+		if !ok {
+			continue
+		}
+		if paths[rt.Patron] == nil {
+			paths[rt.Patron] = map[string]interface{}{}
+		}
+		operacion := operacionOpenAPI(rt, doc)
+
+		// operationId debe ser único aunque un handler atienda varios métodos
+		if usados[rt.Nombre] {
+			operacion["operationId"] = rt.Nombre + rt.Metodo[:1] + strings.ToLower(rt.Metodo[1:])
+		}
+		usados[rt.Nombre] = true
+		paths[rt.Patron][strings.ToLower(rt.Metodo)] = operacion
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]string{
+			"title":       "API de Libros",
+			"version":     "1.0.0",
+			"description": "API REST para gestionar un catálogo de libros",
+		},
+		"servers": []map[string]string{{"url": "http://localhost:8080"}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemasOpenAPI,
+			"securitySchemes": map[string]interface{}{
+				"claveAPI": map[string]string{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "X-API-Key",
+					"description": "Solo si se configura API_KEYS",
+				},
+				"tokenSucursal": map[string]string{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "HS256 con los reclamos sucursal y admin; solo si se configura SUCURSALES_SECRETO",
+				},
+			},
+		},
+	}
+}
+
+// Schema de una fila {clave, libros} de las estadísticas
+func filaEstadistica(clave, tipo string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			clave:    map[string]interface{}{"type": tipo},
+			"libros": map[string]interface{}{"type": "integer"},
+		},
+	}
+}
+
+// Convierte la documentación de una ruta en un Operation Object
+func operacionOpenAPI(rt ruta, doc operacionDoc) map[string]interface{} {
+	operacion := map[string]interface{}{
+		"operationId": rt.Nombre,
+		"summary":     doc.Resumen,
+		"description": rt.Descripcion,
+		"tags":        []string{doc.Etiqueta},
+	}
+
+	var parametros []map[string]interface{}
+	for _, seg := range strings.Split(rt.Patron, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			// {id} es numérico; el resto ({socio}, {reporte}) son textos
+			nombre, tipo := seg[1:len(seg)-1], "string"
+			if nombre == "id" {
+				tipo = "integer"
+			}
+			parametros = append(parametros, map[string]interface{}{
+				"name":     nombre,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]string{"type": tipo},
+			})
+		}
+	}
+	for _, p := range doc.Consulta {
+		parametros = append(parametros, map[string]interface{}{
+			"name":        p.Nombre,
+			"in":          "query",
+			"description": p.Descripcion,
+			"schema":      map[string]string{"type": p.Tipo},
+		})
+	}
+	cabeceras := doc.Cabeceras
+	if !rutaSinSucursal(rt.Patron) {
+		cabeceras = append([]parametroDoc{
+			{"X-Sucursal", "string", "Sucursal (por defecto la primera configurada)"},
+			{"Accept-Language", "string", "Idioma de los mensajes: es (por defecto) o en"},
+		}, cabeceras...)
+		operacion["security"] = []map[string][]string{
+			{}, {"claveAPI": {}}, {"tokenSucursal": {}}, {"claveAPI": {}, "tokenSucursal": {}},
+		}
+	}
+	for _, p := range cabeceras {
+		parametros = append(parametros, map[string]interface{}{
+			"name":        p.Nombre,
+			"in":          "header",
+			"description": p.Descripcion,
+			"schema":      map[string]string{"type": p.Tipo},
+		})
+	}
+	if len(parametros) > 0 {
+		operacion["parameters"] = parametros
+	}
+
+	if doc.Cuerpo != "" {
+		operacion["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]string{"$ref": "#/components/schemas/" + doc.Cuerpo},
+				},
+			},
+		}
+	}
+
+	if doc.Archivo != "" {
+		binario := map[string]interface{}{"type": "string", "format": "binary"}
+		operacion["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"image/*": map[string]interface{}{"schema": binario},
+				"multipart/form-data": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"type":       "object",
+						"required":   []string{doc.Archivo},
+						"properties": map[string]interface{}{doc.Archivo: binario},
+					},
+				},
+			},
+		}
+	}
+
+	respuestas := map[string]interface{}{}
+	for codigo, schema := range doc.Respuestas {
+		respuesta := map[string]interface{}{"description": http.StatusText(codigo)}
+		switch {
+		case schema != "":
+			respuesta["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]string{"$ref": "#/components/schemas/" + schema},
+				},
+			}
+		case doc.Contenido != "":
+			respuesta["content"] = map[string]interface{}{doc.Contenido: map[string]interface{}{}}
+		}
+		respuestas[fmt.Sprint(codigo)] = respuesta
+	}
+	operacion["responses"] = respuestas
+
+	return operacion
+}
+
+// GET /openapi.json - Especificación de la API
+func servirOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(servidorDe(r.Context()).especificacion)
+}
+
+// GET /docs - Página con Swagger UI
+func servirDocumentacion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(paginaDocumentacion)
+}
+
+// GET /docs/swagger-ui/{archivo} - CSS y JavaScript de Swagger UI
+func servirSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	archivo := parametroRuta(r, "archivo")
+	tipo, ok := recursosSwaggerUI[archivo]
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgEndpointNoEncontrado)
+		return
+	}
+	datos, err := archivosSwaggerUI.ReadFile("swaggerui/" + archivo)
+	if err != nil {
+		// Falta correr go generate: docs.html avisa en la página
+		responderError(w, r, http.StatusNotFound, msgEndpointNoEncontrado)
+		return
+	}
+	w.Header().Set("Content-Type", tipo)
+	w.Write(datos)
+}
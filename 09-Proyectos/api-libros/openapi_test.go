@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Cada ruta de definirRutas debe aparecer en la especificación generada
+func TestOpenAPIDocumentaTodasLasRutas(t *testing.T) {
+	spec := generarOpenAPI(definirRutas())
+	paths := spec["paths"].(map[string]map[string]interface{})
+
+	for _, rt := range definirRutas() {
+		if _, ok := paths[rt.Patron][strings.ToLower(rt.Metodo)]; !ok {
+			t.Errorf("%s %s no está en la especificación; documéntala en documentacionRutas", rt.Metodo, rt.Patron)
+		}
+	}
+}
+
+// La documentación no debe describir rutas que ya no existen
+func TestOpenAPISinDocumentacionHuerfana(t *testing.T) {
+	existentes := map[string]bool{}
+	for _, rt := range definirRutas() {
+		existentes[rt.Metodo+" "+rt.Patron] = true
+	}
+	for clave := range documentacionRutas {
+		if !existentes[clave] {
+			t.Errorf("documentacionRutas describe %q, que no está en definirRutas", clave)
+		}
+	}
+}
+
+// Los schemas referenciados tienen que existir en components
+func TestOpenAPISchemasReferenciados(t *testing.T) {
+	for clave, doc := range documentacionRutas {
+		nombres := []string{doc.Cuerpo}
+		for _, schema := range doc.Respuestas {
+			nombres = append(nombres, schema)
+		}
+		for _, nombre := range nombres {
+			if _, ok := schemasOpenAPI[nombre]; nombre != "" && !ok {
+				t.Errorf("%s referencia el schema %q, que no existe", clave, nombre)
+			}
+		}
+	}
+}
+
+// La página de documentación no carga nada de otro origen y los archivos de
+// Swagger UI salen del binario
+func TestDocumentacionSinCDN(t *testing.T) {
+	t.Parallel()
+	if pagina := string(paginaDocumentacion); strings.Contains(pagina, "://") {
+		t.Error("docs.html carga recursos de otro origen")
+	}
+	_, ts := servidorPrueba(t)
+
+	for archivo, tipo := range recursosSwaggerUI {
+		resp, err := http.Get(ts.URL + "/docs/swagger-ui/" + archivo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if _, err := fs.Stat(archivosSwaggerUI, "swaggerui/"+archivo); err != nil {
+			t.Logf("%s no está en swaggerui/ (falta go generate)", archivo)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != tipo {
+			t.Errorf("%s: %d %s", archivo, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+	}
+	// Solo se sirven los archivos de la lista
+	if estado := pedirJSON(t, http.MethodGet, ts.URL+"/docs/swagger-ui/VERSION", "", nil); estado != http.StatusNotFound {
+		t.Errorf("GET VERSION = %d", estado)
+	}
+}
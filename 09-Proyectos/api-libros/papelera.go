@@ -0,0 +1,54 @@
+// Purga periódica de los libros en la papelera
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// Tiempo que un libro eliminado se puede restaurar (PAPELERA_RETENCION)
+const retencionPorDefecto = 30 * 24 * time.Hour
+
+// Cada cuánto se revisa la papelera como máximo
+const intervaloMaximoPurga = time.Hour
+
+// retencionPapelera lee PAPELERA_RETENCION con el formato de time.ParseDuration ("720h", "15m")
+func retencionPapelera() time.Duration {
+	valor := os.Getenv("PAPELERA_RETENCION")
+	if valor == "" {
+		return retencionPorDefecto
+	}
+	retencion, err := time.ParseDuration(valor)
+	if err != nil || retencion <= 0 {
+		log.Printf("PAPELERA_RETENCION inválida (%q), se usa %v", valor, retencionPorDefecto)
+		return retencionPorDefecto
+	}
+	return retencion
+}
+
+// iniciarPurgaPapelera borra en segundo plano los libros que superaron la
+// retención en todas las sucursales, hasta que se cancele ctx
+func (srv *servidor) iniciarPurgaPapelera(ctx context.Context, retencion time.Duration) {
+	intervalo := min(retencion, intervaloMaximoPurga)
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				limite := time.Now().Add(-retencion)
+				for _, s := range srv.sucursales.Todas() {
+					if purgados := s.repositorio.Purgar(ctx, limite); purgados > 0 {
+						log.Printf("Papelera (%s): %d libro(s) eliminados definitivamente", s.ID, purgados)
+					}
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// listarIDs devuelve los libros del listado indexados por ID
+func listarIDs(t *testing.T, url string) map[int]Libro {
+	t.Helper()
+	var listado struct {
+		Libros []Libro `json:"libros"`
+	}
+	if estado := pedirJSON(t, http.MethodGet, url, "", &listado); estado != http.StatusOK {
+		t.Fatalf("GET %s = %d", url, estado)
+	}
+	libros := make(map[int]Libro, len(listado.Libros))
+	for _, libro := range listado.Libros {
+		libros[libro.ID] = libro
+	}
+	return libros
+}
+
+// Un libro eliminado deja de verse salvo que se pida la papelera, no se
+// puede editar y se restaura tal como estaba
+func TestPapeleraEliminarYRestaurar(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	var original Libro
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/libros/1", "", &original)
+	if estado := pedirJSON(t, http.MethodDelete, ts.URL+"/api/libros/1", "", nil); estado != http.StatusOK {
+		t.Fatalf("DELETE = %d", estado)
+	}
+
+	if estado := pedirJSON(t, http.MethodGet, ts.URL+"/api/libros/1", "", nil); estado != http.StatusNotFound {
+		t.Errorf("GET de un libro en la papelera: %d", estado)
+	}
+	if _, ok := listarIDs(t, ts.URL+"/api/libros")[1]; ok {
+		t.Error("el listado incluye un libro en la papelera")
+	}
+	eliminado, ok := listarIDs(t, ts.URL+"/api/libros?incluir_eliminados=true")[1]
+	if !ok || eliminado.EliminadoEn == nil {
+		t.Fatalf("con incluir_eliminados: %+v", eliminado)
+	}
+	if estado := pedirJSON(t, http.MethodPut, ts.URL+"/api/libros/1", `{"titulo":"Otro","autor":"Alguien","año":2000,"genero":"Clásico"}`, nil); estado != http.StatusNotFound {
+		t.Errorf("PUT sobre un libro en la papelera: %d", estado)
+	}
+	if estado := pedirJSON(t, http.MethodDelete, ts.URL+"/api/libros/1", "", nil); estado != http.StatusNotFound {
+		t.Errorf("segundo DELETE: %d", estado)
+	}
+
+	var restaurado Libro
+	if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/libros/1/restaurar", "", &restaurado); estado != http.StatusOK {
+		t.Fatalf("restaurar = %d", estado)
+	}
+	if restaurado.EliminadoEn != nil || restaurado.Titulo != original.Titulo || restaurado.Genero != original.Genero {
+		t.Errorf("restaurado %+v, original %+v", restaurado, original)
+	}
+	if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/libros/1/restaurar", "", nil); estado != http.StatusNotFound {
+		t.Errorf("restaurar un libro que no está en la papelera: %d", estado)
+	}
+	if _, ok := listarIDs(t, ts.URL+"/api/libros")[1]; !ok {
+		t.Error("el libro restaurado no vuelve al listado")
+	}
+}
+
+// Purgar borra solo lo que lleva en la papelera más que la retención; lo
+// purgado ya no se puede restaurar
+func TestPapeleraPurgar(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+	repositorio := srv.sucursales.PorDefecto().repositorio
+
+	pedirJSON(t, http.MethodDelete, ts.URL+"/api/libros/1", "", nil)
+	if n := repositorio.Purgar(context.Background(), time.Now().Add(-time.Hour)); n != 0 {
+		t.Errorf("se purgaron %d libros eliminados hace menos de la retención", n)
+	}
+	if n := repositorio.Purgar(context.Background(), time.Now()); n != 1 {
+		t.Fatalf("se purgaron %d libros, se esperaba 1", n)
+	}
+	if _, ok := listarIDs(t, ts.URL+"/api/libros?incluir_eliminados=true")[1]; ok {
+		t.Error("el libro purgado sigue en la papelera")
+	}
+	if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/libros/1/restaurar", "", nil); estado != http.StatusNotFound {
+		t.Errorf("restaurar un libro purgado: %d", estado)
+	}
+	if len(listarIDs(t, ts.URL+"/api/libros")) != 2 {
+		t.Error("la purga tocó libros que no estaban en la papelera")
+	}
+}
+
+// La purga en segundo plano corre sola con la retención configurada
+func TestPapeleraPurgaPeriodica(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+	ctx, cancelar := context.WithCancel(context.Background())
+	t.Cleanup(cancelar)
+	srv.Iniciar(ctx, time.Hour, 20*time.Millisecond)
+	t.Cleanup(srv.Detener)
+
+	pedirJSON(t, http.MethodDelete, ts.URL+"/api/libros/2", "", nil)
+	esperarHasta(t, "la purga del libro 2", func() bool {
+		_, ok := listarIDs(t, ts.URL+"/api/libros?incluir_eliminados=true")[2]
+		return !ok
+	})
+}
@@ -0,0 +1,401 @@
+// Portadas de los libros: subida, miniaturas y almacenamiento de los archivos
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	tamañoMaximoPortada = 5 << 20 // Bytes de la imagen original
+	ladoMaximoPortada   = 4000    // Píxeles; se comprueba antes de decodificar
+	anchoMiniatura      = 240
+	calidadMiniatura    = 85
+
+	// Directorio de PORTADAS_DIR si no se indica
+	directorioPortadasPorDefecto = "datos/portadas"
+)
+
+// Tipos aceptados, detectados por el contenido (no por el Content-Type del cliente)
+var tiposPortada = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Almacenamiento de archivos por clave ("principal/3/original"). Cualquier backend
+// (disco, S3, una base de datos) sirve mientras implemente estas operaciones.
+type almacenBlobs interface {
+	Guardar(clave string, datos []byte) error
+	Abrir(clave string) (io.ReadSeekCloser, error)
+	Eliminar(clave string) error
+}
+
+// almacenLocal guarda cada clave como un archivo dentro de dir
+type almacenLocal struct {
+	dir string
+}
+
+func (a almacenLocal) ruta(clave string) string {
+	return filepath.Join(a.dir, filepath.FromSlash(clave))
+}
+
+// Guardar escribe en un temporal y lo renombra: quien lee nunca ve un
+// archivo a medias
+func (a almacenLocal) Guardar(clave string, datos []byte) error {
+	ruta := a.ruta(clave)
+	if err := os.MkdirAll(filepath.Dir(ruta), 0o755); err != nil {
+		return err
+	}
+	temporal, err := os.CreateTemp(filepath.Dir(ruta), ".subida-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporal.Name())
+
+	if _, err := temporal.Write(datos); err != nil {
+		temporal.Close()
+		return err
+	}
+	if err := temporal.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporal.Name(), ruta)
+}
+
+func (a almacenLocal) Abrir(clave string) (io.ReadSeekCloser, error) {
+	return os.Open(a.ruta(clave))
+}
+
+// Eliminar no falla si el archivo ya no existe
+func (a almacenLocal) Eliminar(clave string) error {
+	if err := os.Remove(a.ruta(clave)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// directorioPortadas lee PORTADAS_DIR
+func directorioPortadas() string {
+	if dir := os.Getenv("PORTADAS_DIR"); dir != "" {
+		return dir
+	}
+	return directorioPortadasPorDefecto
+}
+
+// Datos de la portada de un libro
+type Portada struct {
+	LibroID          int       `json:"libro_id"`
+	Tipo             string    `json:"tipo"`
+	Tamaño           int       `json:"tamaño"`
+	Ancho            int       `json:"ancho"`
+	Alto             int       `json:"alto"`
+	Version          string    `json:"version"` // Hash del contenido; cambia con cada imagen distinta
+	URL              string    `json:"url"`
+	Miniatura        string    `json:"miniatura"`
+	FechaActualizado time.Time `json:"fecha_actualizado"`
+}
+
+// Claves en el almacén, con la sucursal como prefijo ("centro/12/original")
+func (g *registroPortadas) clavePortada(libroID int) string {
+	return fmt.Sprintf("%s/%d/original", g.prefijo, libroID)
+}
+
+func (g *registroPortadas) claveMiniatura(libroID int) string {
+	return fmt.Sprintf("%s/%d/miniatura", g.prefijo, libroID)
+}
+
+// Registro de portadas de una sucursal: los datos en memoria y los archivos
+// en el almacén
+type registroPortadas struct {
+	mu       sync.Mutex
+	portadas map[int]Portada
+	almacen  almacenBlobs
+	prefijo  string
+}
+
+// Obtener devuelve la portada de un libro
+func (g *registroPortadas) Obtener(libroID int) (Portada, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	portada, ok := g.portadas[libroID]
+	return portada, ok
+}
+
+// Guardar reemplaza la imagen y la miniatura del libro
+func (g *registroPortadas) Guardar(portada Portada, original, miniatura []byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.almacen.Guardar(g.clavePortada(portada.LibroID), original); err != nil {
+		return err
+	}
+	if err := g.almacen.Guardar(g.claveMiniatura(portada.LibroID), miniatura); err != nil {
+		return err
+	}
+	g.portadas[portada.LibroID] = portada
+	return nil
+}
+
+// Abrir devuelve el archivo original o la miniatura con sus datos
+func (g *registroPortadas) Abrir(libroID int, miniatura bool) (Portada, io.ReadSeekCloser, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	portada, ok := g.portadas[libroID]
+	if !ok {
+		return Portada{}, nil, fs.ErrNotExist
+	}
+	clave := g.clavePortada(libroID)
+	if miniatura {
+		clave = g.claveMiniatura(libroID)
+	}
+	archivo, err := g.almacen.Abrir(clave)
+	return portada, archivo, err
+}
+
+// Eliminar borra la portada; los errores del almacén solo se registran
+func (g *registroPortadas) Eliminar(libroID int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.portadas[libroID]; !ok {
+		return false
+	}
+	delete(g.portadas, libroID)
+	for _, clave := range []string{g.clavePortada(libroID), g.claveMiniatura(libroID)} {
+		if err := g.almacen.Eliminar(clave); err != nil {
+			log.Printf("Portadas: no se pudo borrar %s: %v", clave, err)
+		}
+	}
+	return true
+}
+
+// leerImagenPortada toma la imagen del campo "portada" de un formulario
+// multipart o, con cualquier otro Content-Type, del body completo
+func leerImagenPortada(w http.ResponseWriter, r *http.Request) ([]byte, *errorCuerpo) {
+	// Margen para las cabeceras y los separadores del formulario
+	r.Body = http.MaxBytesReader(w, r.Body, tamañoMaximoPortada+64<<10)
+
+	var fuente io.Reader = r.Body
+	if tipo, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); tipo == "multipart/form-data" {
+		lector, err := r.MultipartReader()
+		if err != nil {
+			return nil, &errorCuerpo{http.StatusBadRequest, nuevoMensaje(msgMultipartInvalido)}
+		}
+		for {
+			parte, err := lector.NextPart()
+			if err == io.EOF {
+				return nil, &errorCuerpo{http.StatusBadRequest, nuevoMensaje(msgFaltaCampoPortada)}
+			}
+			if err != nil {
+				return nil, errorLecturaPortada(err)
+			}
+			if parte.FormName() == "portada" {
+				fuente = parte
+				break
+			}
+		}
+	}
+
+	datos, err := io.ReadAll(io.LimitReader(fuente, tamañoMaximoPortada+1))
+	if err != nil {
+		return nil, errorLecturaPortada(err)
+	}
+	if len(datos) > tamañoMaximoPortada {
+		return nil, &errorCuerpo{http.StatusRequestEntityTooLarge, nuevoMensaje(msgImagenExcedeBytes, tamañoMaximoPortada)}
+	}
+	if len(datos) == 0 {
+		return nil, &errorCuerpo{http.StatusBadRequest, nuevoMensaje(msgImagenVacia)}
+	}
+	return datos, nil
+}
+
+func errorLecturaPortada(err error) *errorCuerpo {
+	var demasiadoGrande *http.MaxBytesError
+	if errors.As(err, &demasiadoGrande) {
+		return &errorCuerpo{http.StatusRequestEntityTooLarge, nuevoMensaje(msgImagenExcedeBytes, tamañoMaximoPortada)}
+	}
+	return &errorCuerpo{http.StatusBadRequest, nuevoMensaje(msgImagenIlegible)}
+}
+
+// generarMiniatura reduce la imagen al ancho indicado promediando cada
+// bloque de píxeles (sin ampliar las pequeñas) sobre fondo blanco
+func generarMiniatura(origen image.Image, ancho int) *image.RGBA {
+	limites := origen.Bounds()
+	anchoOrigen, altoOrigen := limites.Dx(), limites.Dy()
+	ancho = min(ancho, anchoOrigen)
+	alto := max(1, (altoOrigen*ancho+anchoOrigen/2)/anchoOrigen)
+
+	destino := image.NewRGBA(image.Rect(0, 0, ancho, alto))
+	for y := 0; y < alto; y++ {
+		y0 := limites.Min.Y + y*altoOrigen/alto
+		y1 := max(y0+1, limites.Min.Y+(y+1)*altoOrigen/alto)
+		for x := 0; x < ancho; x++ {
+			x0 := limites.Min.X + x*anchoOrigen/ancho
+			x1 := max(x0+1, limites.Min.X+(x+1)*anchoOrigen/ancho)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := origen.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			// Los colores vienen premultiplicados: sobre blanco se suma lo transparente
+			fondo := 0xffff*n - a
+			destino.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + fondo) / n >> 8),
+				G: uint8((g + fondo) / n >> 8),
+				B: uint8((b + fondo) / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return destino
+}
+
+// servirArchivoPortada envía la imagen con ETag, Last-Modified y rangos. Si
+// la URL trae ?v= de la versión actual se puede guardar para siempre.
+func servirArchivoPortada(w http.ResponseWriter, r *http.Request, miniatura bool) {
+	s := sucursalDe(r.Context())
+	libro, ok := libroDeRuta(w, r)
+	if !ok {
+		return
+	}
+	portada, archivo, err := s.portadas.Abrir(libro.ID, miniatura)
+	if errors.Is(err, fs.ErrNotExist) {
+		responderError(w, r, http.StatusNotFound, msgSinPortada)
+		return
+	}
+	if err != nil {
+		log.Printf("Portadas: no se pudo abrir la del libro %d: %v", libro.ID, err)
+		responderError(w, r, http.StatusInternalServerError, msgPortadaIlegible)
+		return
+	}
+	defer archivo.Close()
+
+	etiqueta, tipo := portada.Version, portada.Tipo
+	if miniatura {
+		etiqueta, tipo = portada.Version+"-m", "image/jpeg"
+	}
+	w.Header().Set("Content-Type", tipo)
+	w.Header().Set("ETag", strconv.Quote(etiqueta))
+	if r.URL.Query().Get("v") == portada.Version {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	http.ServeContent(w, r, "", portada.FechaActualizado, archivo)
+}
+
+// HANDLERS
+
+// PUT /api/libros/{id}/portada - Subir o reemplazar la portada
+func subirPortada(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	libro, ok := libroDeRuta(w, r)
+	if !ok {
+		return
+	}
+	datos, errCuerpo := leerImagenPortada(w, r)
+	if errCuerpo != nil {
+		responderMensaje(w, r, errCuerpo.Estado, errCuerpo.Mensaje)
+		return
+	}
+
+	tipo := http.DetectContentType(datos)
+	if !tiposPortada[tipo] {
+		responderError(w, r, http.StatusUnsupportedMediaType, msgPortadaTipo)
+		return
+	}
+	// Las dimensiones se leen de la cabecera antes de reservar memoria para los píxeles
+	configuracion, _, err := image.DecodeConfig(bytes.NewReader(datos))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgImagenDañada)
+		return
+	}
+	if configuracion.Width > ladoMaximoPortada || configuracion.Height > ladoMaximoPortada {
+		responderError(w, r, http.StatusRequestEntityTooLarge, msgImagenExcedeLado, ladoMaximoPortada)
+		return
+	}
+	imagen, _, err := image.Decode(bytes.NewReader(datos))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgImagenDañada)
+		return
+	}
+	var miniatura bytes.Buffer
+	if err := jpeg.Encode(&miniatura, generarMiniatura(imagen, anchoMiniatura), &jpeg.Options{Quality: calidadMiniatura}); err != nil {
+		responderError(w, r, http.StatusInternalServerError, msgMiniaturaFallida)
+		return
+	}
+
+	suma := sha256.Sum256(datos)
+	version := hex.EncodeToString(suma[:8])
+	portada := Portada{
+		LibroID:          libro.ID,
+		Tipo:             tipo,
+		Tamaño:           len(datos),
+		Ancho:            configuracion.Width,
+		Alto:             configuracion.Height,
+		Version:          version,
+		URL:              fmt.Sprintf("/api/libros/%d/portada?v=%s", libro.ID, version),
+		Miniatura:        fmt.Sprintf("/api/libros/%d/portada/miniatura?v=%s", libro.ID, version),
+		FechaActualizado: time.Now(),
+	}
+	_, existia := s.portadas.Obtener(libro.ID)
+	if err := s.portadas.Guardar(portada, datos, miniatura.Bytes()); err != nil {
+		log.Printf("Portadas: no se pudo guardar la del libro %d: %v", libro.ID, err)
+		responderError(w, r, http.StatusInternalServerError, msgPortadaNoGuardada)
+		return
+	}
+	s.repositorio.ActualizarPortada(r.Context(), libro.ID, portada.URL)
+
+	estado := http.StatusCreated
+	if existia {
+		estado = http.StatusOK
+	}
+	responderJSON(w, estado, portada)
+}
+
+// GET /api/libros/{id}/portada - Imagen original de la portada
+func obtenerPortada(w http.ResponseWriter, r *http.Request) {
+	servirArchivoPortada(w, r, false)
+}
+
+// GET /api/libros/{id}/portada/miniatura - Miniatura JPEG de la portada
+func obtenerMiniaturaPortada(w http.ResponseWriter, r *http.Request) {
+	servirArchivoPortada(w, r, true)
+}
+
+// DELETE /api/libros/{id}/portada - Quitar la portada
+func eliminarPortada(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	libro, ok := libroDeRuta(w, r)
+	if !ok {
+		return
+	}
+	if !s.portadas.Eliminar(libro.ID) {
+		responderError(w, r, http.StatusNotFound, msgSinPortada)
+		return
+	}
+	s.repositorio.ActualizarPortada(r.Context(), libro.ID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
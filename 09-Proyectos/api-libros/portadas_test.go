@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// imagenLisa crea una imagen de un solo color
+func imagenLisa(ancho, alto int, c color.Color) *image.RGBA {
+	imagen := image.NewRGBA(image.Rect(0, 0, ancho, alto))
+	for y := 0; y < alto; y++ {
+		for x := 0; x < ancho; x++ {
+			imagen.Set(x, y, c)
+		}
+	}
+	return imagen
+}
+
+// codificarPNG devuelve la imagen como PNG
+func codificarPNG(t *testing.T, imagen image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, imagen); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// respuestaPortada es lo que devuelve PUT /api/libros/{id}/portada, bien o mal
+type respuestaPortada struct {
+	Portada
+	Codigo codigoMensaje `json:"codigo"`
+}
+
+// subir hace el PUT de la portada con el Content-Type indicado
+func subir(t *testing.T, url, tipo string, cuerpo []byte) (int, respuestaPortada) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(cuerpo))
+	req.Header.Set("Content-Type", tipo)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var respuesta respuestaPortada
+	json.NewDecoder(resp.Body).Decode(&respuesta)
+	return resp.StatusCode, respuesta
+}
+
+// formulario arma un multipart con el archivo en el campo indicado
+func formulario(t *testing.T, campo string, datos []byte) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	escritor := multipart.NewWriter(&buf)
+	escritor.WriteField("descripcion", "tapa")
+	parte, err := escritor.CreateFormFile(campo, "tapa.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parte.Write(datos)
+	escritor.Close()
+	return escritor.FormDataContentType(), buf.Bytes()
+}
+
+// La miniatura promedia bloques, no amplía las chicas y pone lo
+// transparente sobre blanco
+func TestGenerarMiniatura(t *testing.T) {
+	t.Parallel()
+
+	roja := generarMiniatura(imagenLisa(480, 240, color.RGBA{R: 0xff, A: 0xff}), anchoMiniatura)
+	if roja.Bounds().Dx() != 240 || roja.Bounds().Dy() != 120 || roja.RGBAAt(10, 10) != (color.RGBA{R: 0xff, A: 0xff}) {
+		t.Errorf("roja: %v, píxel %v", roja.Bounds(), roja.RGBAAt(10, 10))
+	}
+	if chica := generarMiniatura(imagenLisa(100, 50, color.Black), anchoMiniatura); chica.Bounds().Dx() != 100 || chica.Bounds().Dy() != 50 {
+		t.Errorf("una imagen más chica se redimensionó a %v", chica.Bounds())
+	}
+	if transparente := generarMiniatura(image.NewRGBA(image.Rect(0, 0, 4, 4)), 2); transparente.RGBAAt(0, 0) != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("lo transparente quedó %v, se esperaba blanco", transparente.RGBAAt(0, 0))
+	}
+
+	// Columnas alternadas negras y blancas: a la mitad quedan grises
+	rayas := image.NewRGBA(image.Rect(0, 0, 8, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 8; x++ {
+			if x%2 == 0 {
+				rayas.Set(x, y, color.White)
+			} else {
+				rayas.Set(x, y, color.Black)
+			}
+		}
+	}
+	if gris := generarMiniatura(rayas, 4).RGBAAt(1, 0); gris.R < 0x7e || gris.R > 0x80 || gris.R != gris.G || gris.A != 0xff {
+		t.Errorf("promedio de blanco y negro: %v", gris)
+	}
+}
+
+// Sube una portada cruda y la reemplaza con un formulario; se sirve con su
+// tipo, ETag y caché según la versión, y se puede quitar
+func TestPortadaSubirServirYQuitar(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+	api := ts.URL + "/api/libros/1/portada"
+
+	// El tipo sale del contenido, no de la cabecera
+	original := codificarPNG(t, imagenLisa(600, 900, color.RGBA{B: 0xff, A: 0xff}))
+	estado, portada := subir(t, api, "application/octet-stream", original)
+	if estado != http.StatusCreated || portada.Tipo != "image/png" || portada.Ancho != 600 || portada.Alto != 900 || portada.Tamaño != len(original) {
+		t.Fatalf("PUT cruda: %d %+v", estado, portada)
+	}
+	if !strings.HasSuffix(portada.URL, "?v="+portada.Version) || !strings.HasPrefix(portada.Miniatura, "/api/libros/1/portada/miniatura?v=") {
+		t.Errorf("URLs %q y %q", portada.URL, portada.Miniatura)
+	}
+	var libro Libro
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/libros/1", "", &libro)
+	if libro.Portada != portada.URL {
+		t.Errorf("el libro apunta a %q, se esperaba %q", libro.Portada, portada.URL)
+	}
+
+	var buf bytes.Buffer
+	gif.Encode(&buf, imagenLisa(30, 40, color.White), nil)
+	tipo, cuerpo := formulario(t, "portada", buf.Bytes())
+	estado, reemplazo := subir(t, api, tipo, cuerpo)
+	if estado != http.StatusOK || reemplazo.Tipo != "image/gif" || reemplazo.Version == portada.Version {
+		t.Fatalf("PUT multipart: %d %+v", estado, reemplazo)
+	}
+
+	// Con la versión actual se cachea para siempre; sin ella se revalida
+	resp, err := http.Get(ts.URL + reemplazo.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	datos, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "image/gif" || !bytes.Equal(datos, buf.Bytes()) || resp.Header.Get("ETag") != `"`+reemplazo.Version+`"` {
+		t.Errorf("GET: %s, ETag %s, %d bytes", resp.Header.Get("Content-Type"), resp.Header.Get("ETag"), len(datos))
+	}
+	if cache := resp.Header.Get("Cache-Control"); cache != "public, max-age=31536000, immutable" {
+		t.Errorf("Cache-Control con la versión actual: %q", cache)
+	}
+	resp, err = http.Get(ts.URL + portada.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if cache := resp.Header.Get("Cache-Control"); resp.StatusCode != http.StatusOK || cache != "public, no-cache" {
+		t.Errorf("GET con una versión vieja: %d, Cache-Control %q", resp.StatusCode, cache)
+	}
+	if estado, _ := condicional(t, api, map[string]string{"If-None-Match": `"` + reemplazo.Version + `"`}); estado != http.StatusNotModified {
+		t.Errorf("If-None-Match: %d", estado)
+	}
+	req, _ := http.NewRequest(http.MethodGet, api, nil)
+	req.Header.Set("Range", "bytes=0-5")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	datos, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(datos) != "GIF89a" {
+		t.Errorf("Range: %d %q", resp.StatusCode, datos)
+	}
+
+	// La miniatura es un JPEG que no amplía la imagen
+	resp, err = http.Get(ts.URL + reemplazo.Miniatura)
+	if err != nil {
+		t.Fatal(err)
+	}
+	miniatura, err := jpeg.DecodeConfig(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.Header.Get("Content-Type") != "image/jpeg" || miniatura.Width != 30 || miniatura.Height != 40 {
+		t.Errorf("miniatura: %s %dx%d %v", resp.Header.Get("Content-Type"), miniatura.Width, miniatura.Height, err)
+	}
+
+	if estado := pedirJSON(t, http.MethodDelete, api, "", nil); estado != http.StatusNoContent {
+		t.Fatalf("DELETE = %d", estado)
+	}
+	libro = Libro{}
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/libros/1", "", &libro)
+	if libro.Portada != "" {
+		t.Errorf("el libro sigue con la portada %q", libro.Portada)
+	}
+	for _, ruta := range []string{api, api + "/miniatura"} {
+		var respuesta struct {
+			Codigo codigoMensaje `json:"codigo"`
+		}
+		if estado := pedirJSON(t, http.MethodGet, ruta, "", &respuesta); estado != http.StatusNotFound || respuesta.Codigo != msgSinPortada {
+			t.Errorf("GET %s sin portada: %d %q", ruta, estado, respuesta.Codigo)
+		}
+	}
+	if estado := pedirJSON(t, http.MethodDelete, api, "", nil); estado != http.StatusNotFound {
+		t.Errorf("segundo DELETE: %d", estado)
+	}
+}
+
+// Se rechaza lo que no es una imagen aceptada, lo vacío, lo dañado y lo
+// que supera los límites
+func TestPortadaRechazos(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+	api := ts.URL + "/api/libros/1/portada"
+
+	firmaPNG := codificarPNG(t, imagenLisa(1, 1, color.White))[:16]
+	sinCampo, cuerpoSinCampo := formulario(t, "imagen", codificarPNG(t, imagenLisa(1, 1, color.White)))
+	casos := []struct {
+		nombre string
+		url    string
+		tipo   string
+		cuerpo []byte
+		estado int
+		codigo codigoMensaje
+	}{
+		{"texto con tipo de imagen", api, "image/png", []byte("no soy una imagen"), http.StatusUnsupportedMediaType, msgPortadaTipo},
+		{"vacía", api, "image/png", nil, http.StatusBadRequest, msgImagenVacia},
+		{"formulario sin el campo", api, sinCampo, cuerpoSinCampo, http.StatusBadRequest, msgFaltaCampoPortada},
+		{"multipart sin boundary", api, "multipart/form-data", []byte("x"), http.StatusBadRequest, msgMultipartInvalido},
+		{"PNG truncado", api, "image/png", firmaPNG, http.StatusBadRequest, msgImagenDañada},
+		{"demasiado ancha", api, "image/png", codificarPNG(t, image.NewGray(image.Rect(0, 0, ladoMaximoPortada+1, 1))), http.StatusRequestEntityTooLarge, msgImagenExcedeLado},
+		{"demasiados bytes", api, "image/png", append(bytes.Clone(firmaPNG), make([]byte, tamañoMaximoPortada)...), http.StatusRequestEntityTooLarge, msgImagenExcedeBytes},
+		{"libro inexistente", ts.URL + "/api/libros/999/portada", "image/png", codificarPNG(t, imagenLisa(1, 1, color.White)), http.StatusNotFound, msgLibroNoEncontrado},
+	}
+	for _, caso := range casos {
+		if estado, respuesta := subir(t, caso.url, caso.tipo, caso.cuerpo); estado != caso.estado || respuesta.Codigo != caso.codigo {
+			t.Errorf("%s: %d %q, se esperaba %d %q", caso.nombre, estado, respuesta.Codigo, caso.estado, caso.codigo)
+		}
+	}
+
+	var libro Libro
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/libros/1", "", &libro)
+	if libro.Portada != "" {
+		t.Errorf("un rechazo dejó la portada %q", libro.Portada)
+	}
+}
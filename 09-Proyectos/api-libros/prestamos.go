@@ -0,0 +1,245 @@
+// Préstamos: qué socio tiene cada ejemplar y hasta cuándo
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Préstamo de un ejemplar a un socio
+type Prestamo struct {
+	ID         int        `json:"id"`
+	EjemplarID int        `json:"ejemplar_id"`
+	LibroID    int        `json:"libro_id"`
+	Socio      string     `json:"socio"`
+	PrestadoEn time.Time  `json:"prestado_en"`
+	VenceEn    time.Time  `json:"vence_en"`
+	DevueltoEn *time.Time `json:"devuelto_en,omitempty"`
+	Multa      *Monto     `json:"multa,omitempty"` // Fijada al devolver; antes se calcula al consultar
+}
+
+// Registro de préstamos protegido con mutex
+type registroPrestamos struct {
+	mu         sync.Mutex
+	prestamos  []Prestamo
+	contadorID int
+}
+
+// Crear guarda un préstamo nuevo
+func (g *registroPrestamos) Crear(prestamo Prestamo) Prestamo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	prestamo.ID = g.contadorID
+	g.contadorID++
+	g.prestamos = append(g.prestamos, prestamo)
+	return prestamo
+}
+
+// Obtener busca un préstamo por su ID
+func (g *registroPrestamos) Obtener(id int) (Prestamo, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, prestamo := range g.prestamos {
+		if prestamo.ID == id {
+			return prestamo, true
+		}
+	}
+	return Prestamo{}, false
+}
+
+// Buscar devuelve los préstamos que cumplen el filtro
+func (g *registroPrestamos) Buscar(filtro func(Prestamo) bool) []Prestamo {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	lista := []Prestamo{}
+	for _, prestamo := range g.prestamos {
+		if filtro(prestamo) {
+			lista = append(lista, prestamo)
+		}
+	}
+	return lista
+}
+
+// Devolver cierra el préstamo y fija la multa con la política vigente
+func (g *registroPrestamos) Devolver(id int, devuelto time.Time, politica politicaMultas) (Prestamo, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i := range g.prestamos {
+		prestamo := &g.prestamos[i]
+		if prestamo.ID != id {
+			continue
+		}
+		if prestamo.DevueltoEn != nil {
+			return Prestamo{}, nuevoMensaje(msgPrestamoDevuelto)
+		}
+		if devuelto.Before(prestamo.PrestadoEn) {
+			return Prestamo{}, nuevoMensaje(msgDevolucionAnterior)
+		}
+		multa := politica.Multa(prestamo.VenceEn, devuelto)
+		prestamo.DevueltoEn = &devuelto
+		prestamo.Multa = &multa
+		return *prestamo, nil
+	}
+	return Prestamo{}, errPrestamoNoEncontrado
+}
+
+var errPrestamoNoEncontrado = nuevoMensaje(msgPrestamoNoEncontrado)
+
+// prestarEjemplar registra el préstamo de un ejemplar que ya quedó en
+// estado prestado, con el plazo de la política vigente
+func (s *sucursal) prestarEjemplar(ejemplar Ejemplar, socio string) Prestamo {
+	ahora := time.Now()
+	return s.prestamos.Crear(Prestamo{
+		EjemplarID: ejemplar.ID,
+		LibroID:    ejemplar.LibroID,
+		Socio:      socio,
+		PrestadoEn: ahora,
+		VenceEn:    ahora.AddDate(0, 0, s.politicaVigente().DiasPrestamo),
+	})
+}
+
+// conMultaAlDia completa la multa acumulada de un préstamo sin devolver
+func conMultaAlDia(prestamo Prestamo, ahora time.Time, politica politicaMultas) Prestamo {
+	if prestamo.DevueltoEn == nil {
+		multa := politica.Multa(prestamo.VenceEn, ahora)
+		prestamo.Multa = &multa
+	}
+	return prestamo
+}
+
+// HANDLERS
+
+// GET /api/prestamos - Listar préstamos (?socio=, ?activos=)
+func obtenerPrestamos(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	socio := r.URL.Query().Get("socio")
+	soloActivos, _ := strconv.ParseBool(r.URL.Query().Get("activos"))
+
+	lista := s.prestamos.Buscar(func(p Prestamo) bool {
+		return (socio == "" || strings.EqualFold(p.Socio, socio)) && (!soloActivos || p.DevueltoEn == nil)
+	})
+	ahora, politica := time.Now(), s.politicaVigente()
+	for i := range lista {
+		lista[i] = conMultaAlDia(lista[i], ahora, politica)
+	}
+
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"prestamos": lista,
+		"total":     len(lista),
+	})
+}
+
+// POST /api/prestamos - Prestar un ejemplar disponible
+func crearPrestamo(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	var datos struct {
+		EjemplarID int    `json:"ejemplar_id"`
+		Socio      string `json:"socio"`
+	}
+	if err := decodificarJSON(w, r, &datos); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	datos.Socio = strings.TrimSpace(datos.Socio)
+	if !cabeceraValida(datos.Socio, longitudMaximaSocio) {
+		responderError(w, r, http.StatusBadRequest, msgSocioRequerido, longitudMaximaSocio)
+		return
+	}
+
+	// Cambiar el estado solo si sigue disponible (los apartados se retiran
+	// con POST /api/reservas/{id}/retirar)
+	var estadoPrevio string
+	ejemplar, ok := s.ejemplares.Modificar(datos.EjemplarID, func(e *Ejemplar) {
+		estadoPrevio = e.Estado
+		if e.Estado == ejemplarDisponible {
+			e.Estado = ejemplarPrestado
+		}
+	})
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgEjemplarNoEncontrado)
+		return
+	}
+	if estadoPrevio != ejemplarDisponible {
+		responderError(w, r, http.StatusConflict, msgEjemplarEnEstado, estadoPrevio)
+		return
+	}
+	s.sincronizarEjemplares(r.Context(), ejemplar.LibroID)
+
+	prestamo := s.prestarEjemplar(ejemplar, datos.Socio)
+	w.Header().Set("Location", fmt.Sprintf("/api/prestamos/%d", prestamo.ID))
+	responderJSON(w, http.StatusCreated, prestamo)
+}
+
+// GET /api/prestamos/{id} - Obtener un préstamo con la multa al día
+func obtenerPrestamoPorID(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return
+	}
+	prestamo, ok := s.prestamos.Obtener(id)
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgPrestamoNoEncontrado)
+		return
+	}
+	responderJSON(w, http.StatusOK, conMultaAlDia(prestamo, time.Now(), s.politicaVigente()))
+}
+
+// POST /api/prestamos/{id}/devolver - Registrar la devolución (?fecha= para cargarla después)
+func devolverPrestamo(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return
+	}
+	devuelto := time.Now()
+	if valor := r.URL.Query().Get("fecha"); valor != "" {
+		fecha, err := parsearFechaConsulta(valor, false)
+		if err != nil || fecha.After(devuelto) {
+			responderError(w, r, http.StatusBadRequest, msgFechaDevolucionInvalida)
+			return
+		}
+		devuelto = fecha
+	}
+
+	prestamo, err := s.prestamos.Devolver(id, devuelto, s.politicaVigente())
+	if err == errPrestamoNoEncontrado {
+		responderMensaje(w, r, http.StatusNotFound, comoMensaje(err))
+		return
+	}
+	if err != nil {
+		responderMensaje(w, r, http.StatusConflict, comoMensaje(err))
+		return
+	}
+
+	// El ejemplar vuelve al estante (y puede pasar a la siguiente reserva)
+	s.ejemplares.Modificar(prestamo.EjemplarID, func(e *Ejemplar) {
+		if e.Estado == ejemplarPrestado {
+			e.Estado = ejemplarDisponible
+		}
+	})
+	s.sincronizarEjemplares(r.Context(), prestamo.LibroID)
+
+	responderJSON(w, http.StatusOK, prestamo)
+}
+
+// Préstamos de ejemplo: uno vencido y sin devolver para que haya multas
+func (s *sucursal) inicializarPrestamos() {
+	hace := func(dias int) time.Time { return time.Now().AddDate(0, 0, -dias) }
+	for _, p := range []Prestamo{
+		{EjemplarID: 2, LibroID: 1, Socio: "ana", PrestadoEn: hace(20), VenceEn: hace(6)},
+		{EjemplarID: 4, LibroID: 2, Socio: "beto", PrestadoEn: hace(3), VenceEn: hace(-11)},
+	} {
+		s.prestamos.Crear(p)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Libros por catálogo en los benchmarks
+var tamañosCatalogo = []int{100, 1000, 10000}
+
+// sucursalBenchmark arma una sucursal con n libros repartidos entre los
+// géneros de ejemplo, la mitad disponibles
+func sucursalBenchmark(b *testing.B, n int) (*servidor, *sucursal) {
+	b.Helper()
+	srv, err := nuevoServidor(configuracionServidor{Portadas: almacenLocal{dir: b.TempDir()}, DatosEjemplo: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := srv.sucursales.Todas()[0]
+	generos := []string{"Realismo mágico", "Distopía", "Clásico"}
+	libros := make([]Libro, n)
+	for i := range libros {
+		libros[i] = Libro{
+			ID:          i + 1,
+			Titulo:      fmt.Sprintf("Libro %d", i+1),
+			Autor:       fmt.Sprintf("Autor %d", i%50),
+			Año:         1900 + i%120,
+			Genero:      generos[i%len(generos)],
+			Disponible:  i%2 == 0,
+			FechaCreado: time.Now(),
+		}
+	}
+	s.repositorio.Reiniciar(libros, n+1)
+	return srv, s
+}
+
+func BenchmarkFiltrarLibros(b *testing.B) {
+	filtros := []struct {
+		nombre, genero, disponible string
+	}{
+		{"sin filtro", "", ""},
+		{"genero", "Distopía", ""},
+		{"disponible", "", "true"},
+		{"genero y disponible", "Distopía", "true"},
+	}
+	for _, n := range tamañosCatalogo {
+		_, s := sucursalBenchmark(b, n)
+		libros := s.repositorio.Listar(context.Background())
+		for _, filtro := range filtros {
+			b.Run(fmt.Sprintf("%s/%d", filtro.nombre, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					s.filtrarLibros(libros, filtro.genero, filtro.disponible)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkCodificarJSON(b *testing.B) {
+	for _, n := range tamañosCatalogo {
+		_, s := sucursalBenchmark(b, n)
+		libros := s.repositorio.Listar(context.Background())
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				responderJSON(descartarRespuesta{http.Header{}}, http.StatusOK, map[string]interface{}{
+					"libros": libros,
+					"total":  len(libros),
+				})
+			}
+		})
+	}
+}
+
+// GET /api/libros completo: sucursal, repositorio, filtros y JSON
+func BenchmarkListarLibrosHTTP(b *testing.B) {
+	for _, n := range tamañosCatalogo {
+		srv, _ := sucursalBenchmark(b, n)
+		handler := srv.Handler()
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/libros?genero=Distopía&disponible=true", nil))
+				if w.Code != http.StatusOK {
+					b.Fatalf("GET /api/libros = %d", w.Code)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRepositorio(b *testing.B) {
+	ctx := context.Background()
+	libro := Libro{Titulo: "Rayuela", Autor: "Julio Cortázar", Año: 1963, Genero: "Clásico", Disponible: true}
+
+	b.Run("Crear", func(b *testing.B) {
+		_, s := sucursalBenchmark(b, 0)
+		b.ReportAllocs()
+		for b.Loop() {
+			s.repositorio.Crear(ctx, libro)
+		}
+	})
+	for _, n := range tamañosCatalogo {
+		_, s := sucursalBenchmark(b, n)
+		b.Run(fmt.Sprint("Obtener/", n), func(b *testing.B) {
+			b.ReportAllocs()
+			id := 0
+			for b.Loop() {
+				s.repositorio.Obtener(ctx, id%n+1)
+				id++
+			}
+		})
+		b.Run(fmt.Sprint("ObtenerParalelo/", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				id := 0
+				for pb.Next() {
+					s.repositorio.Obtener(ctx, id%n+1)
+					id++
+				}
+			})
+		})
+		b.Run(fmt.Sprint("Listar/", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				s.repositorio.Listar(ctx)
+			}
+		})
+		b.Run(fmt.Sprint("Actualizar/", n), func(b *testing.B) {
+			b.ReportAllocs()
+			cambio := libro
+			id := 0
+			for b.Loop() {
+				cambio.ID = id%n + 1
+				if _, ok := s.repositorio.Actualizar(ctx, cambio); !ok {
+					b.Fatalf("no se actualizó el libro %d", cambio.ID)
+				}
+				id++
+			}
+		})
+	}
+}
+
+// descartarRespuesta es un http.ResponseWriter que no guarda el cuerpo, para
+// medir solo la codificación
+type descartarRespuesta struct {
+	cabeceras http.Header
+}
+
+func (d descartarRespuesta) Header() http.Header         { return d.cabeceras }
+func (d descartarRespuesta) Write(p []byte) (int, error) { return io.Discard.Write(p) }
+func (d descartarRespuesta) WriteHeader(int)             {}
@@ -0,0 +1,327 @@
+// Repositorio en memoria para los libros
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Repositorio de libros protegido con mutex para acceso concurrente
+type repositorioLibros struct {
+	mu           sync.RWMutex
+	libros       []Libro
+	contadorID   int
+	ultimoCambio time.Time // Último alta, cambio o baja (para Last-Modified)
+	version      uint64    // Sube con cada alta, cambio o baja (para el ETag)
+
+	sucursal *sucursal // Dueña del repositorio: autores, géneros, auditoría y eventos
+}
+
+// Listar devuelve una copia de los libros que no están en la papelera
+func (r *repositorioLibros) Listar(ctx context.Context) []Libro {
+	return r.listar(ctx, false)
+}
+
+// ListarConEliminados incluye también los libros en la papelera
+func (r *repositorioLibros) ListarConEliminados(ctx context.Context) []Libro {
+	return r.listar(ctx, true)
+}
+
+// UltimoCambio devuelve cuándo se modificó el catálogo por última vez
+func (r *repositorioLibros) UltimoCambio() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ultimoCambio
+}
+
+// Version devuelve un número que cambia con cada modificación del catálogo
+func (r *repositorioLibros) Version() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+func (r *repositorioLibros) listar(ctx context.Context, incluirEliminados bool) []Libro {
+	_, span := iniciarSpan(ctx, "repositorio.Listar")
+	defer span.Finalizar()
+	span.AsignarAtributo("libros.incluir_eliminados", incluirEliminados)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	resultado := make([]Libro, 0, len(r.libros))
+	for _, libro := range r.libros {
+		if libro.EliminadoEn == nil || incluirEliminados {
+			resultado = append(resultado, libro)
+		}
+	}
+	span.AsignarAtributo("libros.total", len(resultado))
+	return resultado
+}
+
+// Obtener busca un libro por su ID
+func (r *repositorioLibros) Obtener(ctx context.Context, id int) (Libro, bool) {
+	_, span := iniciarSpan(ctx, "repositorio.Obtener")
+	defer span.Finalizar()
+	span.AsignarAtributo("libro.id", id)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, libro := range r.libros {
+		if libro.ID == id && libro.EliminadoEn == nil {
+			return libro, true
+		}
+	}
+	return Libro{}, false
+}
+
+// Crear asigna un ID nuevo al libro y lo guarda
+func (r *repositorioLibros) Crear(ctx context.Context, libro Libro) Libro {
+	_, span := iniciarSpan(ctx, "repositorio.Crear")
+	defer span.Finalizar()
+
+	libro = canonizarISBN(r.sucursal.canonizarGenero(r.sucursal.vincularAutores(libro)))
+	r.mu.Lock()
+	libro.ID = r.contadorID
+	libro = aplicarEjemplares(libro, 0, 0)
+	libro.EliminadoEn = nil
+	libro.FechaActualizado = time.Now()
+	r.ultimoCambio = libro.FechaActualizado
+	r.version++
+	r.contadorID++
+	r.libros = append(r.libros, libro)
+	r.mu.Unlock()
+
+	span.AsignarAtributo("libro.id", libro.ID)
+	r.sucursal.auditoria.Registrar(ctx, eventoCreado, nil, libro)
+	r.sucursal.publicarCambio(eventoCreado, libro)
+	return libro
+}
+
+// Actualizar reemplaza el libro con el mismo ID (si no está en la papelera)
+// y devuelve la versión guardada, con autores y género normalizados
+func (r *repositorioLibros) Actualizar(ctx context.Context, libro Libro) (Libro, bool) {
+	_, span := iniciarSpan(ctx, "repositorio.Actualizar")
+	defer span.Finalizar()
+	span.AsignarAtributo("libro.id", libro.ID)
+
+	if previo, ok := r.Obtener(ctx, libro.ID); ok {
+		libro = conservarAutores(libro, previo)
+	}
+	libro = canonizarISBN(r.sucursal.canonizarGenero(r.sucursal.vincularAutores(libro)))
+	r.mu.Lock()
+	var anterior *Libro
+	for i := range r.libros {
+		if r.libros[i].ID == libro.ID && r.libros[i].EliminadoEn == nil {
+			previo := r.libros[i]
+			anterior = &previo
+			libro = aplicarEjemplares(libro, previo.EjemplaresTotal, previo.EjemplaresDisponibles)
+			libro.Portada = previo.Portada
+			libro.EliminadoEn = nil
+			libro.FechaActualizado = time.Now()
+			r.libros[i] = libro
+			r.ultimoCambio = libro.FechaActualizado
+			r.version++
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if anterior == nil {
+		return Libro{}, false
+	}
+	r.sucursal.auditoria.Registrar(ctx, eventoActualizado, anterior, libro)
+	r.sucursal.publicarActualizacion(*anterior, libro)
+	return libro, true
+}
+
+// ActualizarEjemplares guarda los conteos de ejemplares del libro y, si
+// cambian, lo registra y notifica como cualquier modificación
+func (r *repositorioLibros) ActualizarEjemplares(ctx context.Context, id, total, disponibles int) {
+	r.modificar(ctx, "repositorio.ActualizarEjemplares", id, func(libro Libro) Libro {
+		return aplicarEjemplares(libro, total, disponibles)
+	})
+}
+
+// ActualizarPortada cambia la URL de la portada ("" si se quitó)
+func (r *repositorioLibros) ActualizarPortada(ctx context.Context, id int, url string) bool {
+	return r.modificar(ctx, "repositorio.ActualizarPortada", id, func(libro Libro) Libro {
+		libro.Portada = url
+		return libro
+	})
+}
+
+// modificar aplica f a los campos del libro que no se editan con PUT; si
+// algo cambió lo registra y notifica
+func (r *repositorioLibros) modificar(ctx context.Context, operacion string, id int, f func(Libro) Libro) bool {
+	_, span := iniciarSpan(ctx, operacion)
+	defer span.Finalizar()
+	span.AsignarAtributo("libro.id", id)
+
+	r.mu.Lock()
+	encontrado := false
+	var anterior *Libro
+	var libro Libro
+	for i := range r.libros {
+		if r.libros[i].ID != id {
+			continue
+		}
+		encontrado = true
+		libro = f(r.libros[i])
+		if reflect.DeepEqual(libro, r.libros[i]) {
+			break
+		}
+		previo := r.libros[i]
+		anterior = &previo
+		libro.FechaActualizado = time.Now()
+		r.libros[i] = libro
+		r.ultimoCambio = libro.FechaActualizado
+		r.version++
+		break
+	}
+	r.mu.Unlock()
+
+	if anterior != nil {
+		r.sucursal.auditoria.Registrar(ctx, eventoActualizado, anterior, libro)
+		r.sucursal.publicarActualizacion(*anterior, libro)
+	}
+	return encontrado
+}
+
+// Eliminar manda el libro a la papelera marcando EliminadoEn
+func (r *repositorioLibros) Eliminar(ctx context.Context, id int) bool {
+	_, span := iniciarSpan(ctx, "repositorio.Eliminar")
+	defer span.Finalizar()
+	span.AsignarAtributo("libro.id", id)
+
+	r.mu.Lock()
+	var anterior, eliminado *Libro
+	for i := range r.libros {
+		if r.libros[i].ID == id && r.libros[i].EliminadoEn == nil {
+			previo := r.libros[i]
+			anterior = &previo
+			ahora := time.Now()
+			r.libros[i].EliminadoEn = &ahora
+			r.libros[i].FechaActualizado = ahora
+			r.ultimoCambio = ahora
+			r.version++
+			copia := r.libros[i]
+			eliminado = &copia
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if eliminado == nil {
+		return false
+	}
+	r.sucursal.auditoria.Registrar(ctx, eventoEliminado, anterior, *eliminado)
+	r.sucursal.publicarCambio(eventoEliminado, *eliminado)
+	return true
+}
+
+// Restaurar saca un libro de la papelera
+func (r *repositorioLibros) Restaurar(ctx context.Context, id int) (Libro, bool) {
+	_, span := iniciarSpan(ctx, "repositorio.Restaurar")
+	defer span.Finalizar()
+	span.AsignarAtributo("libro.id", id)
+
+	r.mu.Lock()
+	var anterior, restaurado Libro
+	encontrado := false
+	for i := range r.libros {
+		if r.libros[i].ID == id && r.libros[i].EliminadoEn != nil {
+			anterior = r.libros[i]
+			r.libros[i].EliminadoEn = nil
+			r.libros[i].FechaActualizado = time.Now()
+			r.ultimoCambio = r.libros[i].FechaActualizado
+			r.version++
+			restaurado = r.libros[i]
+			encontrado = true
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if !encontrado {
+		return Libro{}, false
+	}
+	r.sucursal.auditoria.Registrar(ctx, accionRestaurado, &anterior, restaurado)
+	r.sucursal.publicarActualizacion(anterior, restaurado)
+	return restaurado, true
+}
+
+// Purgar borra definitivamente los libros eliminados antes de la fecha límite
+func (r *repositorioLibros) Purgar(ctx context.Context, limite time.Time) int {
+	_, span := iniciarSpan(ctx, "repositorio.Purgar")
+	defer span.Finalizar()
+
+	r.mu.Lock()
+	var purgados []Libro
+	conservados := r.libros[:0]
+	for _, libro := range r.libros {
+		if libro.EliminadoEn == nil || libro.EliminadoEn.After(limite) {
+			conservados = append(conservados, libro)
+		} else {
+			purgados = append(purgados, libro)
+		}
+	}
+	clear(r.libros[len(conservados):])
+	r.libros = conservados
+	if len(purgados) > 0 {
+		r.ultimoCambio = time.Now()
+		r.version++
+	}
+	r.mu.Unlock()
+
+	// El historial sobrevive a la purga: la última entrada deja constancia
+	for _, libro := range purgados {
+		r.sucursal.auditoria.Registrar(ctx, accionPurgado, &libro, Libro{ID: libro.ID})
+		r.sucursal.portadas.Eliminar(libro.ID)
+	}
+
+	span.AsignarAtributo("libros.purgados", len(purgados))
+	return len(purgados)
+}
+
+// Reescribir aplica f a todos los libros, incluidos los de la papelera, sin
+// publicar eventos ni auditar (migraciones y datos derivados). f indica si
+// cambió el libro, para actualizar su fecha de modificación.
+func (r *repositorioLibros) Reescribir(f func(Libro) (Libro, bool)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ahora := time.Now()
+	for i := range r.libros {
+		libro, cambio := f(r.libros[i])
+		if !cambio {
+			continue
+		}
+		libro.FechaActualizado = ahora
+		r.libros[i] = libro
+		r.ultimoCambio = ahora
+		r.version++
+	}
+}
+
+// Reiniciar reemplaza todo el contenido del repositorio
+func (r *repositorioLibros) Reiniciar(libros []Libro, siguienteID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.libros = libros
+	r.contadorID = siguienteID
+	r.ultimoCambio = time.Time{}
+	r.version++
+	for i := range r.libros {
+		if r.libros[i].FechaActualizado.IsZero() {
+			r.libros[i].FechaActualizado = r.libros[i].FechaCreado
+		}
+		if r.libros[i].FechaActualizado.After(r.ultimoCambio) {
+			r.ultimoCambio = r.libros[i].FechaActualizado
+		}
+	}
+}
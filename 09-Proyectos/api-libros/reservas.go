@@ -0,0 +1,436 @@
+// Reservas: cola FIFO por libro para los socios que esperan un ejemplar
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Estados de una reserva
+const (
+	reservaEnEspera  = "en_espera"
+	reservaLista     = "lista"    // Hay un ejemplar apartado esperando al socio
+	reservaRetirada  = "retirada" // El socio se llevó el ejemplar
+	reservaVencida   = "vencida"  // No se retiró dentro del plazo
+	reservaCancelada = "cancelada"
+)
+
+var estadosReserva = []string{reservaEnEspera, reservaLista, reservaRetirada, reservaVencida, reservaCancelada}
+
+// Plazo para retirar una reserva lista (RESERVAS_PLAZO)
+const plazoRetiroPorDefecto = 72 * time.Hour
+
+// Cada cuánto se revisan los vencimientos como máximo
+const intervaloMaximoReservas = time.Minute
+
+// Longitud máxima del identificador de socio
+const longitudMaximaSocio = 128
+
+// Reserva de un socio sobre un libro
+type Reserva struct {
+	ID           int        `json:"id"`
+	LibroID      int        `json:"libro_id"`
+	Socio        string     `json:"socio"`
+	Estado       string     `json:"estado"`
+	Posicion     int        `json:"posicion,omitempty"`    // Lugar en la cola (solo en espera)
+	EjemplarID   *int       `json:"ejemplar_id,omitempty"` // Ejemplar apartado (lista)
+	FechaCreado  time.Time  `json:"fecha_creado"`
+	ListaEn      *time.Time `json:"lista_en,omitempty"`
+	VenceEn      *time.Time `json:"vence_en,omitempty"` // Límite para retirarla
+	FinalizadaEn *time.Time `json:"finalizada_en,omitempty"`
+}
+
+// Activa: todavía ocupa un lugar en la cola o un ejemplar
+func (r Reserva) activa() bool {
+	return r.Estado == reservaEnEspera || r.Estado == reservaLista
+}
+
+// Registro de reservas. Orden de bloqueo: reservas, después ejemplares y
+// el repositorio de libros (que nunca llama a las reservas con su bloqueo
+// tomado: los cambios solo avisan por el canal).
+type registroReservas struct {
+	mu         sync.Mutex
+	reservas   []Reserva // Ordenadas por ID, que es el orden de llegada
+	contadorID int
+	plazo      time.Duration
+	avisos     chan int // Libros cuya disponibilidad cambió
+
+	sucursal *sucursal // Dueña de la cola: sus ejemplares y su catálogo
+}
+
+// plazoRetiroReservas lee RESERVAS_PLAZO con el formato de time.ParseDuration ("72h", "30m")
+func plazoRetiroReservas() time.Duration {
+	valor := os.Getenv("RESERVAS_PLAZO")
+	if valor == "" {
+		return plazoRetiroPorDefecto
+	}
+	plazo, err := time.ParseDuration(valor)
+	if err != nil || plazo <= 0 {
+		log.Printf("RESERVAS_PLAZO inválido (%q), se usa %v", valor, plazoRetiroPorDefecto)
+		return plazoRetiroPorDefecto
+	}
+	return plazo
+}
+
+// Avisar pide revisar la cola de un libro; no bloquea (si el canal está
+// lleno la próxima revisión periódica se encarga)
+func (g *registroReservas) Avisar(libroID int) {
+	select {
+	case g.avisos <- libroID:
+	default:
+	}
+}
+
+// conPosicion completa la posición de una reserva en espera; requiere g.mu
+func (g *registroReservas) conPosicion(reserva Reserva) Reserva {
+	reserva.Posicion = 0
+	if reserva.Estado != reservaEnEspera {
+		return reserva
+	}
+	for _, otra := range g.reservas {
+		if otra.LibroID == reserva.LibroID && otra.Estado == reservaEnEspera && otra.ID <= reserva.ID {
+			reserva.Posicion++
+		}
+	}
+	return reserva
+}
+
+// Crear agrega una reserva al final de la cola del libro
+func (g *registroReservas) Crear(libroID int, socio string) (Reserva, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, otra := range g.reservas {
+		if otra.LibroID == libroID && otra.activa() && strings.EqualFold(otra.Socio, socio) {
+			return Reserva{}, nuevoMensaje(msgReservaDuplicada, otra.ID)
+		}
+	}
+	reserva := Reserva{
+		ID:          g.contadorID,
+		LibroID:     libroID,
+		Socio:       socio,
+		Estado:      reservaEnEspera,
+		FechaCreado: time.Now(),
+	}
+	g.contadorID++
+	g.reservas = append(g.reservas, reserva)
+	return g.conPosicion(reserva), nil
+}
+
+// Obtener busca una reserva por ID, con su posición actual
+func (g *registroReservas) Obtener(id int) (Reserva, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, reserva := range g.reservas {
+		if reserva.ID == id {
+			return g.conPosicion(reserva), true
+		}
+	}
+	return Reserva{}, false
+}
+
+// DeLibro devuelve la cola del libro en orden (las finalizadas solo si se piden)
+func (g *registroReservas) DeLibro(libroID int, incluirFinalizadas bool) []Reserva {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	lista := []Reserva{}
+	for _, reserva := range g.reservas {
+		if reserva.LibroID == libroID && (incluirFinalizadas || reserva.activa()) {
+			lista = append(lista, g.conPosicion(reserva))
+		}
+	}
+	return lista
+}
+
+// finalizar cierra una reserva activa con el estado indicado y, si tenía un
+// ejemplar apartado, lo pasa a estadoEjemplar; si no lo tenía y se retira,
+// el libro entero queda prestado. Devuelve la reserva guardada.
+func (g *registroReservas) finalizar(ctx context.Context, id int, estado, estadoEjemplar string) (Reserva, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i := range g.reservas {
+		reserva := &g.reservas[i]
+		if reserva.ID != id {
+			continue
+		}
+		if !reserva.activa() {
+			return Reserva{}, nuevoMensaje(msgReservaEnEstado, reserva.Estado)
+		}
+		if estado == reservaRetirada && reserva.Estado != reservaLista {
+			return Reserva{}, nuevoMensaje(msgReservaNoLista)
+		}
+		if reserva.EjemplarID != nil {
+			g.sucursal.ejemplares.Modificar(*reserva.EjemplarID, func(e *Ejemplar) { e.Estado = estadoEjemplar })
+		} else if estado == reservaRetirada {
+			// Con el bloqueo tomado: Promover no puede ver la reserva ya
+			// retirada y el libro todavía disponible
+			if libro, ok := g.sucursal.repositorio.Obtener(ctx, reserva.LibroID); ok && libro.Disponible {
+				libro.Disponible = false
+				g.sucursal.repositorio.Actualizar(ctx, libro)
+			}
+		}
+		ahora := time.Now()
+		reserva.Estado = estado
+		reserva.FinalizadaEn = &ahora
+		return *reserva, nil
+	}
+	return Reserva{}, errReservaNoEncontrada
+}
+
+var errReservaNoEncontrada = nuevoMensaje(msgReservaNoEncontrada)
+
+// Promover pasa a "lista" las primeras reservas en espera mientras haya
+// ejemplares disponibles (o, en libros sin ejemplares, si el libro está
+// disponible y nadie más tiene la suya lista). Devuelve cuántas promovió.
+func (g *registroReservas) Promover(ctx context.Context, libroID int) int {
+	g.mu.Lock()
+	// El libro se lee con el bloqueo tomado para decidir con su estado
+	// actual y no con uno anterior a un retiro
+	libro, ok := g.sucursal.repositorio.Obtener(ctx, libroID)
+	if !ok {
+		g.mu.Unlock()
+		return 0
+	}
+	promovidas := 0
+	for i := range g.reservas {
+		reserva := &g.reservas[i]
+		if reserva.LibroID != libroID || reserva.Estado != reservaEnEspera {
+			continue
+		}
+
+		if libro.EjemplaresTotal > 0 {
+			// Apartar el primer ejemplar disponible
+			var apartado *int
+			for _, ejemplar := range g.sucursal.ejemplares.DeLibro(libroID, false) {
+				if ejemplar.Estado == ejemplarDisponible {
+					g.sucursal.ejemplares.Modificar(ejemplar.ID, func(e *Ejemplar) { e.Estado = ejemplarReservado })
+					apartado = &ejemplar.ID
+					break
+				}
+			}
+			if apartado == nil {
+				break
+			}
+			reserva.EjemplarID = apartado
+		} else if !libro.Disponible || g.hayLista(libroID) {
+			break
+		}
+
+		ahora := time.Now()
+		vence := ahora.Add(g.plazo)
+		reserva.Estado = reservaLista
+		reserva.ListaEn = &ahora
+		reserva.VenceEn = &vence
+		promovidas++
+	}
+	g.mu.Unlock()
+
+	if promovidas > 0 && libro.EjemplaresTotal > 0 {
+		g.sucursal.sincronizarEjemplares(ctx, libroID)
+	}
+	return promovidas
+}
+
+// hayLista indica si el libro tiene una reserva esperando retiro; requiere g.mu
+func (g *registroReservas) hayLista(libroID int) bool {
+	for _, reserva := range g.reservas {
+		if reserva.LibroID == libroID && reserva.Estado == reservaLista {
+			return true
+		}
+	}
+	return false
+}
+
+// librosEnEspera devuelve los libros que tienen reservas en la cola
+func (g *registroReservas) librosEnEspera() []int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var libros []int
+	for _, reserva := range g.reservas {
+		if reserva.Estado == reservaEnEspera && !slices.Contains(libros, reserva.LibroID) {
+			libros = append(libros, reserva.LibroID)
+		}
+	}
+	return libros
+}
+
+// Vencer marca como vencidas las reservas listas que pasaron el plazo,
+// libera sus ejemplares y devuelve los libros afectados
+func (g *registroReservas) Vencer(ahora time.Time) []int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var libros []int
+	for i := range g.reservas {
+		reserva := &g.reservas[i]
+		if reserva.Estado != reservaLista || reserva.VenceEn == nil || ahora.Before(*reserva.VenceEn) {
+			continue
+		}
+		if reserva.EjemplarID != nil {
+			g.sucursal.ejemplares.Modificar(*reserva.EjemplarID, func(e *Ejemplar) { e.Estado = ejemplarDisponible })
+		}
+		reserva.Estado = reservaVencida
+		reserva.FinalizadaEn = &ahora
+		libros = append(libros, reserva.LibroID)
+	}
+	return libros
+}
+
+// iniciarReservas revisa en segundo plano los vencimientos y promueve la
+// siguiente reserva cuando cambia la disponibilidad de un libro
+func (s *sucursal) iniciarReservas(ctx context.Context, plazo time.Duration) {
+	s.reservas.mu.Lock()
+	s.reservas.plazo = plazo
+	s.reservas.mu.Unlock()
+	intervalo := min(plazo, intervaloMaximoReservas)
+
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case libroID := <-s.reservas.avisos:
+				s.reservas.Promover(ctx, libroID)
+			case ahora := <-ticker.C:
+				vencidas := s.reservas.Vencer(ahora)
+				if len(vencidas) > 0 {
+					log.Printf("Reservas: %d vencida(s) sin retirar", len(vencidas))
+				}
+				for _, libroID := range vencidas {
+					s.sincronizarEjemplares(ctx, libroID)
+				}
+				// También cubre los avisos descartados con el canal lleno
+				for _, libroID := range s.reservas.librosEnEspera() {
+					s.reservas.Promover(ctx, libroID)
+				}
+			}
+		}
+	}()
+}
+
+// HANDLERS
+
+// GET /api/libros/{id}/reservas - Cola de reservas del libro (?incluir_finalizadas=)
+func obtenerReservasLibro(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	libro, ok := libroDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	incluir, _ := strconv.ParseBool(r.URL.Query().Get("incluir_finalizadas"))
+	lista := s.reservas.DeLibro(libro.ID, incluir)
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"reservas": lista,
+		"total":    len(lista),
+	})
+}
+
+// POST /api/libros/{id}/reservas - Ponerse en la cola del libro
+func crearReserva(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	libro, ok := libroDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	var datos struct {
+		Socio string `json:"socio"`
+	}
+	if err := decodificarJSON(w, r, &datos); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	datos.Socio = strings.TrimSpace(datos.Socio)
+	if !cabeceraValida(datos.Socio, longitudMaximaSocio) {
+		responderError(w, r, http.StatusBadRequest, msgSocioRequerido, longitudMaximaSocio)
+		return
+	}
+
+	reserva, err := s.reservas.Crear(libro.ID, datos.Socio)
+	if err != nil {
+		responderMensaje(w, r, http.StatusConflict, comoMensaje(err))
+		return
+	}
+	// Si hay un ejemplar libre la reserva queda lista en el acto
+	if s.reservas.Promover(r.Context(), libro.ID) > 0 {
+		reserva, _ = s.reservas.Obtener(reserva.ID)
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/reservas/%d", reserva.ID))
+	responderJSON(w, http.StatusCreated, reserva)
+}
+
+// GET /api/reservas/{id} - Estado y posición en la cola de una reserva
+func obtenerReservaPorID(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return
+	}
+	reserva, ok := s.reservas.Obtener(id)
+	if !ok {
+		responderError(w, r, http.StatusNotFound, msgReservaNoEncontrada)
+		return
+	}
+	responderJSON(w, http.StatusOK, reserva)
+}
+
+// Cierra la reserva de la ruta y actualiza el libro; usado por retirar y cancelar
+func finalizarReserva(w http.ResponseWriter, r *http.Request, estado, estadoEjemplar string) {
+	s := sucursalDe(r.Context())
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return
+	}
+
+	reserva, err := s.reservas.finalizar(r.Context(), id, estado, estadoEjemplar)
+	if err == errReservaNoEncontrada {
+		responderMensaje(w, r, http.StatusNotFound, comoMensaje(err))
+		return
+	}
+	if err != nil {
+		responderMensaje(w, r, http.StatusConflict, comoMensaje(err))
+		return
+	}
+
+	if reserva.EjemplarID != nil {
+		if estado == reservaRetirada {
+			if ejemplar, ok := s.ejemplares.Obtener(*reserva.EjemplarID); ok {
+				s.prestarEjemplar(ejemplar, reserva.Socio)
+			}
+		}
+		s.sincronizarEjemplares(r.Context(), reserva.LibroID)
+	}
+	// Una reserva lista que se libera deja lugar a la siguiente
+	s.reservas.Promover(r.Context(), reserva.LibroID)
+
+	responderJSON(w, http.StatusOK, reserva)
+}
+
+// POST /api/reservas/{id}/retirar - El socio retira el ejemplar apartado (abre el préstamo)
+func retirarReserva(w http.ResponseWriter, r *http.Request) {
+	finalizarReserva(w, r, reservaRetirada, ejemplarPrestado)
+}
+
+// DELETE /api/reservas/{id} - Cancelar una reserva
+func cancelarReserva(w http.ResponseWriter, r *http.Request) {
+	finalizarReserva(w, r, reservaCancelada, ejemplarDisponible)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// reservar pone al socio en la cola del libro
+func reservar(t *testing.T, url string, libroID int, socio string) Reserva {
+	t.Helper()
+	var reserva Reserva
+	if estado := pedirJSON(t, http.MethodPost, fmt.Sprintf("%s/api/libros/%d/reservas", url, libroID), `{"socio":"`+socio+`"}`, &reserva); estado != http.StatusCreated {
+		t.Fatalf("reserva de %s sobre el libro %d: %d", socio, libroID, estado)
+	}
+	return reserva
+}
+
+// reservaActual consulta la reserva por HTTP
+func reservaActual(t *testing.T, url string, id int) Reserva {
+	t.Helper()
+	var reserva Reserva
+	if estado := pedirJSON(t, http.MethodGet, fmt.Sprintf("%s/api/reservas/%d", url, id), "", &reserva); estado != http.StatusOK {
+		t.Fatalf("GET /api/reservas/%d: %d", id, estado)
+	}
+	return reserva
+}
+
+// La cola es FIFO: las primeras se quedan con los ejemplares libres, las
+// demás esperan en orden y avanzan cuando alguien cancela; al devolverse un
+// préstamo se promueve la primera de la cola
+func TestReservasColaFIFO(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+	ctx, cancelar := context.WithCancel(context.Background())
+	t.Cleanup(cancelar)
+	srv.Iniciar(ctx, time.Hour, time.Hour)
+	t.Cleanup(srv.Detener)
+
+	// El libro 2 tiene los ejemplares 3 y 5 disponibles y el 4 prestado a beto
+	ana := reservar(t, ts.URL, 2, "ana")
+	carla := reservar(t, ts.URL, 2, "carla")
+	dani := reservar(t, ts.URL, 2, "dani")
+	eva := reservar(t, ts.URL, 2, "eva")
+	for _, reserva := range []Reserva{ana, carla} {
+		if reserva.Estado != reservaLista || reserva.EjemplarID == nil || reserva.Posicion != 0 || reserva.VenceEn == nil {
+			t.Errorf("%s: %+v, se esperaba lista con un ejemplar", reserva.Socio, reserva)
+		}
+	}
+	if *ana.EjemplarID != 3 || *carla.EjemplarID != 5 {
+		t.Errorf("ejemplares apartados %d y %d, se esperaban 3 y 5", *ana.EjemplarID, *carla.EjemplarID)
+	}
+	if dani.Estado != reservaEnEspera || dani.Posicion != 1 || eva.Posicion != 2 {
+		t.Errorf("en espera: dani %s/%d, eva %d", dani.Estado, dani.Posicion, eva.Posicion)
+	}
+	if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/libros/2/reservas", `{"socio":"ANA"}`, nil); estado != http.StatusConflict {
+		t.Errorf("reserva duplicada: %d", estado)
+	}
+
+	var libro Libro
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/libros/2", "", &libro)
+	if libro.EjemplaresDisponibles != 0 {
+		t.Errorf("%d ejemplares disponibles con dos apartados", libro.EjemplaresDisponibles)
+	}
+
+	// dani cancela: eva pasa al primer lugar
+	if estado := pedirJSON(t, http.MethodDelete, fmt.Sprintf("%s/api/reservas/%d", ts.URL, dani.ID), "", nil); estado != http.StatusOK {
+		t.Fatalf("cancelar: %d", estado)
+	}
+	if actual := reservaActual(t, ts.URL, eva.ID); actual.Posicion != 1 {
+		t.Errorf("eva en la posición %d después de la cancelación", actual.Posicion)
+	}
+	var cola struct {
+		Reservas []Reserva `json:"reservas"`
+	}
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/libros/2/reservas", "", &cola)
+	if len(cola.Reservas) != 3 || cola.Reservas[0].ID != ana.ID || cola.Reservas[2].ID != eva.ID {
+		t.Errorf("cola activa: %+v", cola.Reservas)
+	}
+
+	// beto devuelve el ejemplar 4 (préstamo 2): queda apartado para eva
+	if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/prestamos/2/devolver", "", nil); estado != http.StatusOK {
+		t.Fatalf("devolver: %d", estado)
+	}
+	esperarHasta(t, "la promoción de eva", func() bool { return reservaActual(t, ts.URL, eva.ID).Estado == reservaLista })
+	if actual := reservaActual(t, ts.URL, eva.ID); actual.EjemplarID == nil || *actual.EjemplarID != 4 {
+		t.Errorf("eva: %+v, se esperaba el ejemplar 4", actual)
+	}
+}
+
+// Una reserva lista que no se retira vence, libera el ejemplar y la
+// siguiente de la cola se lo queda
+func TestReservasVencenYPromueven(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+	s := srv.sucursales.PorDefecto()
+
+	// El único ejemplar del libro 3 está en reparación
+	ana := reservar(t, ts.URL, 3, "ana")
+	beto := reservar(t, ts.URL, 3, "beto")
+	if ana.Estado != reservaEnEspera || beto.Posicion != 2 {
+		t.Fatalf("sin ejemplares libres: ana %s, beto en la posición %d", ana.Estado, beto.Posicion)
+	}
+
+	if estado := pedirJSON(t, http.MethodPut, ts.URL+"/api/ejemplares/6", `{"ubicacion":"C-01","condicion":"bueno","estado":"disponible"}`, nil); estado != http.StatusOK {
+		t.Fatalf("reparar el ejemplar: %d", estado)
+	}
+	if n := s.reservas.Promover(context.Background(), 3); n != 1 {
+		t.Fatalf("se promovieron %d reservas con un ejemplar libre", n)
+	}
+	ana = reservaActual(t, ts.URL, ana.ID)
+	if ana.Estado != reservaLista || *ana.EjemplarID != 6 || reservaActual(t, ts.URL, beto.ID).Posicion != 1 {
+		t.Fatalf("después de reparar: ana %+v", ana)
+	}
+
+	// Antes del plazo no vence nada
+	if libros := s.reservas.Vencer(ana.VenceEn.Add(-time.Second)); len(libros) != 0 {
+		t.Errorf("vencieron antes del plazo: %v", libros)
+	}
+	if libros := s.reservas.Vencer(*ana.VenceEn); len(libros) != 1 || libros[0] != 3 {
+		t.Fatalf("libros con reservas vencidas: %v", libros)
+	}
+	if ejemplar, _ := s.ejemplares.Obtener(6); ejemplar.Estado != ejemplarDisponible {
+		t.Errorf("el ejemplar de la reserva vencida quedó %s", ejemplar.Estado)
+	}
+	s.reservas.Promover(context.Background(), 3)
+
+	if actual := reservaActual(t, ts.URL, ana.ID); actual.Estado != reservaVencida || actual.FinalizadaEn == nil {
+		t.Errorf("ana: %+v, se esperaba vencida", actual)
+	}
+	beto = reservaActual(t, ts.URL, beto.ID)
+	if beto.Estado != reservaLista || beto.EjemplarID == nil || *beto.EjemplarID != 6 {
+		t.Fatalf("beto: %+v, se esperaba lista con el ejemplar 6", beto)
+	}
+
+	// Una vencida no se puede retirar; la lista sí, y abre el préstamo
+	if estado := pedirJSON(t, http.MethodPost, fmt.Sprintf("%s/api/reservas/%d/retirar", ts.URL, ana.ID), "", nil); estado != http.StatusConflict {
+		t.Errorf("retirar una vencida: %d", estado)
+	}
+	if estado := pedirJSON(t, http.MethodPost, fmt.Sprintf("%s/api/reservas/%d/retirar", ts.URL, beto.ID), "", nil); estado != http.StatusOK {
+		t.Fatalf("retirar: %d", estado)
+	}
+	if ejemplar, _ := s.ejemplares.Obtener(6); ejemplar.Estado != ejemplarPrestado {
+		t.Errorf("el ejemplar retirado quedó %s", ejemplar.Estado)
+	}
+	var prestamos struct {
+		Total int `json:"total"`
+	}
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/prestamos?socio=beto&activos=true", "", &prestamos)
+	if prestamos.Total != 2 {
+		t.Errorf("beto tiene %d préstamos activos, se esperaban 2", prestamos.Total)
+	}
+}
+
+// Un libro sin ejemplares se reserva entero: una sola reserva lista a la
+// vez y, al retirarla, el libro deja de estar disponible
+func TestReservasLibroSinEjemplares(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+	s := srv.sucursales.PorDefecto()
+
+	var libro Libro
+	pedirJSON(t, http.MethodPost, ts.URL+"/api/libros", `{"titulo":"Rayuela","autor":"Julio Cortázar","año":1963,"genero":"Clásico"}`, &libro)
+	ana := reservar(t, ts.URL, libro.ID, "ana")
+	beto := reservar(t, ts.URL, libro.ID, "beto")
+	if ana.Estado != reservaLista || ana.EjemplarID != nil || beto.Estado != reservaEnEspera || beto.Posicion != 1 {
+		t.Fatalf("ana %+v, beto %+v", ana, beto)
+	}
+
+	// Con el retiro el libro queda prestado antes de que Promover pueda verlo
+	if _, err := s.reservas.finalizar(context.Background(), ana.ID, reservaRetirada, ejemplarPrestado); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.reservas.Promover(context.Background(), libro.ID); n != 0 {
+		t.Errorf("se promovieron %d reservas con el libro prestado", n)
+	}
+	pedirJSON(t, http.MethodGet, fmt.Sprintf("%s/api/libros/%d", ts.URL, libro.ID), "", &libro)
+	if libro.Disponible {
+		t.Error("el libro sigue disponible después del retiro")
+	}
+
+	// Cuando vuelve, la siguiente queda lista
+	cuerpo := fmt.Sprintf(`{"titulo":%q,"autor":%q,"año":%d,"genero":%q,"disponible":true}`, libro.Titulo, libro.Autor, libro.Año, libro.Genero)
+	if estado := pedirJSON(t, http.MethodPut, fmt.Sprintf("%s/api/libros/%d", ts.URL, libro.ID), cuerpo, nil); estado != http.StatusOK {
+		t.Fatalf("devolver el libro: %d", estado)
+	}
+	if n := s.reservas.Promover(context.Background(), libro.ID); n != 1 {
+		t.Errorf("se promovieron %d reservas con el libro de vuelta", n)
+	}
+	if actual := reservaActual(t, ts.URL, beto.ID); actual.Estado != reservaLista {
+		t.Errorf("beto: %+v", actual)
+	}
+}
@@ -0,0 +1,164 @@
+// Servidor de la API: todo el estado de una instancia sale de su configuración
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Configuración del servidor; main la arma con las variables de entorno
+type configuracionServidor struct {
+	Sucursales   []string           // La primera es la de por defecto (vacío = solo "principal")
+	Secreto      []byte             // HS256 de los tokens; vacío = sin tokens
+	ClavesAPI    []string           // Valores aceptados en X-API-Key; vacío = sin clave
+	CatalogoISBN proveedorMetadatos // nil = los metadatos de ejemplo, sin red
+	Portadas     almacenBlobs       // nil = PORTADAS_DIR; cada servidor aislado necesita el suyo
+	DatosEjemplo bool               // Carga los libros de ejemplo en la sucursal por defecto
+	Trazas       Exportador         // A dónde van los spans; nil = no se exportan
+	Compresion   []string           // Content-Encoding ofrecidos, por preferencia; nil = br y gzip
+
+	// Sin Secreto, deja elegir cualquier sucursal y abre /api/admin
+	// (desarrollo); si no, solo se atiende la sucursal por defecto
+	SucursalesAbiertas bool
+
+	// Permite webhooks a loopback y redes privadas (desarrollo y pruebas)
+	WebhooksRedesPrivadas bool
+}
+
+// Una instancia de la API. Dos servidores no comparten datos, así que se
+// pueden levantar varios en el mismo proceso (por ejemplo con httptest).
+type servidor struct {
+	sucursales     *registroSucursales
+	secreto        []byte
+	abiertas       bool // Ver configuracionServidor.SucursalesAbiertas
+	clavesAPI      []string
+	catalogoISBN   proveedorMetadatos
+	idempotencia   *almacenIdempotencia
+	trazas         Exportador
+	codificadores  []codificador
+	esquema        *esquemaGQL
+	rutas          []ruta
+	especificacion []byte // OpenAPI ya serializada para /openapi.json
+
+	// Se cierra al apagar para terminar los flujos abiertos (SSE, WebSocket, gRPC)
+	apagando     chan struct{}
+	cerrarFlujos sync.Once
+}
+
+type claveServidor struct{}
+
+// nuevoServidor crea las sucursales, carga los datos iniciales y prepara
+// las rutas y la especificación OpenAPI
+func nuevoServidor(config configuracionServidor) (*servidor, error) {
+	ids := config.Sucursales
+	if len(ids) == 0 {
+		ids = []string{sucursalPorDefecto}
+	}
+	if config.CatalogoISBN == nil {
+		config.CatalogoISBN = proveedorLocal{libros: indexarPorISBN(metadatosDeEjemplo)}
+	}
+	if config.Portadas == nil {
+		config.Portadas = almacenLocal{dir: directorioPortadas()}
+	}
+	if config.Compresion == nil {
+		config.Compresion = []string{"br", "gzip"}
+	}
+	codificadores, err := elegirCodificadores(config.Compresion)
+	if err != nil {
+		return nil, err
+	}
+	srv := &servidor{
+		sucursales:    &registroSucursales{sucursales: map[string]*sucursal{}},
+		secreto:       config.Secreto,
+		abiertas:      config.SucursalesAbiertas,
+		clavesAPI:     config.ClavesAPI,
+		catalogoISBN:  config.CatalogoISBN,
+		idempotencia:  &almacenIdempotencia{respuestas: map[string]*respuestaIdempotente{}},
+		trazas:        config.Trazas,
+		codificadores: codificadores,
+		esquema:       nuevoEsquemaLibros(),
+		apagando:      make(chan struct{}),
+	}
+	for _, id := range ids {
+		if !expresionSucursal.MatchString(id) {
+			return nil, fmt.Errorf("ID de sucursal inválido: %q", id)
+		}
+		if err := srv.sucursales.Agregar(nuevaSucursal(id, config)); err != nil {
+			return nil, err
+		}
+	}
+	srv.inicializarDatos(config.DatosEjemplo)
+
+	srv.rutas = definirRutas()
+	if srv.especificacion, err = json.MarshalIndent(generarOpenAPI(srv.rutas), "", "  "); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// Handler arma la cadena de middlewares de la API HTTP
+func (srv *servidor) Handler() http.Handler {
+	return srv.middleware(corsMiddleware(compresionMiddleware(srv.codificadores, trazasMiddleware(solicitudMiddleware(loggingMiddleware(srv.sucursalMiddleware(srv.manejarRuta)))))))
+}
+
+// HandlerGRPC atiende libros.v1.LibrosService (necesita HTTP/2)
+func (srv *servidor) HandlerGRPC() http.Handler {
+	return srv.middleware(solicitudMiddleware(manejarGRPC))
+}
+
+// middleware deja el servidor y su exportador de trazas en el contexto de
+// cada petición
+func (srv *servidor) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := conExportador(context.WithValue(r.Context(), claveServidor{}, srv), srv.trazas)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// servidorDe devuelve el servidor que atiende la petición
+func servidorDe(ctx context.Context) *servidor {
+	srv, _ := ctx.Value(claveServidor{}).(*servidor)
+	return srv
+}
+
+// Iniciar arranca las tareas de fondo de todas las sucursales (webhooks,
+// reservas y papelera) hasta que se cancele ctx
+func (srv *servidor) Iniciar(ctx context.Context, plazoReservas, retencion time.Duration) {
+	ctx = conExportador(ctx, srv.trazas)
+	for _, s := range srv.sucursales.Todas() {
+		s.webhooks.Iniciar(trabajadoresWebhook)
+		s.iniciarReservas(ctx, plazoReservas)
+	}
+	srv.iniciarPurgaPapelera(ctx, retencion)
+}
+
+// CerrarFlujos termina los flujos abiertos; se puede llamar varias veces
+func (srv *servidor) CerrarFlujos() {
+	srv.cerrarFlujos.Do(func() { close(srv.apagando) })
+}
+
+// Detener cierra los flujos y espera a los trabajadores de webhooks
+func (srv *servidor) Detener() {
+	srv.CerrarFlujos()
+	for _, s := range srv.sucursales.Todas() {
+		s.webhooks.Detener()
+	}
+}
+
+// inicializarDatos carga el árbol de géneros en cada sucursal y, si se
+// pide, los datos de ejemplo en la de por defecto
+func (srv *servidor) inicializarDatos(datosEjemplo bool) {
+	principal := srv.sucursales.PorDefecto()
+	for _, s := range srv.sucursales.Todas() {
+		if s != principal || !datosEjemplo {
+			s.inicializarGeneros(context.Background())
+		}
+	}
+	if datosEjemplo {
+		principal.cargarDatosEjemplo()
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// servidorPrueba levanta un servidor aislado con los datos de ejemplo y las
+// sucursales abiertas, para poder usar también las rutas de administración
+func servidorPrueba(t *testing.T) (*servidor, *httptest.Server) {
+	t.Helper()
+	srv, err := nuevoServidor(configuracionServidor{
+		Sucursales:         []string{"centro", "norte"},
+		Portadas:           almacenLocal{dir: t.TempDir()},
+		DatosEjemplo:       true,
+		SucursalesAbiertas: true,
+
+		WebhooksRedesPrivadas: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(func() {
+		srv.CerrarFlujos()
+		ts.Close()
+	})
+	return srv, ts
+}
+
+// Un paso del recorrido: "{ultimo}" en la ruta se reemplaza por el id del
+// último recurso creado (la última respuesta 201)
+type pasoRuta struct {
+	metodo string
+	ruta   string
+	cuerpo string
+	estado int
+	tipo   string // Content-Type del cuerpo; por defecto JSON
+}
+
+// Portada PNG de 8x8 para PUT /api/libros/{id}/portada
+func portadaPNG(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// Recorre todas las rutas de manejarRuta contra un servidor real y comprueba
+// que cada patrón de la tabla fue alcanzado por al menos un paso
+func TestRecorridoRutas(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+
+	libro := `{"titulo":"Rayuela","autor":"Julio Cortázar","año":1963,"genero":"Clásico"}`
+	pasos := []pasoRuta{
+		// Libros
+		{"GET", "/api/libros", "", http.StatusOK, ""},
+		{"POST", "/api/libros", libro, http.StatusCreated, ""},
+		{"PUT", "/api/libros/{ultimo}", strings.Replace(libro, "1963", "1964", 1), http.StatusOK, ""},
+		{"GET", "/api/libros/{ultimo}/historial", "", http.StatusOK, ""},
+		{"PUT", "/api/libros/{ultimo}/portada", portadaPNG(t), http.StatusCreated, "image/png"},
+		{"GET", "/api/libros/4/portada", "", http.StatusOK, ""},
+		{"GET", "/api/libros/4/portada/miniatura", "", http.StatusOK, ""},
+		{"DELETE", "/api/libros/4/portada", "", http.StatusNoContent, ""},
+		{"POST", "/api/libros/desde-isbn", `{"isbn":"9780307474728"}`, http.StatusCreated, ""},
+		{"DELETE", "/api/libros/{ultimo}", "", http.StatusOK, ""},
+		{"POST", "/api/libros/5/restaurar", "", http.StatusOK, ""},
+		{"GET", "/api/libros/1", "", http.StatusOK, ""},
+		{"GET", "/api/libros/eventos", "", http.StatusOK, ""},
+		{"GET", "/api/libros/eventos/ws", "", http.StatusBadRequest, ""},
+
+		// Ejemplares
+		{"GET", "/api/libros/1/ejemplares", "", http.StatusOK, ""},
+		{"POST", "/api/libros/4/ejemplares", `{"codigo_barras":"LIB-0004-01","ubicacion":"A-1","condicion":"nuevo"}`, http.StatusCreated, ""},
+		{"GET", "/api/ejemplares/{ultimo}", "", http.StatusOK, ""},
+		{"PUT", "/api/ejemplares/{ultimo}", `{"ubicacion":"B-2","condicion":"bueno","estado":"reparacion"}`, http.StatusOK, ""},
+		{"DELETE", "/api/ejemplares/{ultimo}", "", http.StatusOK, ""},
+
+		// Reservas
+		{"GET", "/api/libros/3/reservas", "", http.StatusOK, ""},
+		{"POST", "/api/libros/3/reservas", `{"socio":"carla"}`, http.StatusCreated, ""},
+		{"GET", "/api/reservas/{ultimo}", "", http.StatusOK, ""},
+		{"DELETE", "/api/reservas/{ultimo}", "", http.StatusOK, ""},
+		{"POST", "/api/libros/1/reservas", `{"socio":"dani"}`, http.StatusCreated, ""},
+		{"POST", "/api/reservas/{ultimo}/retirar", "", http.StatusOK, ""},
+
+		// Géneros
+		{"GET", "/api/generos", "", http.StatusOK, ""},
+		{"POST", "/api/generos", `{"nombre":"Ucronía"}`, http.StatusCreated, ""},
+		{"DELETE", "/api/generos/{ultimo}", "", http.StatusOK, ""},
+
+		// Estadísticas y auditoría
+		{"GET", "/api/estadisticas", "", http.StatusOK, ""},
+		{"GET", "/api/estadisticas/generos?formato=csv", "", http.StatusOK, ""},
+		{"GET", "/api/auditoria", "", http.StatusOK, ""},
+
+		// Préstamos y multas
+		{"GET", "/api/prestamos?activos=true", "", http.StatusOK, ""},
+		{"POST", "/api/prestamos", `{"ejemplar_id":3,"socio":"eva"}`, http.StatusCreated, ""},
+		{"GET", "/api/prestamos/{ultimo}", "", http.StatusOK, ""},
+		{"POST", "/api/prestamos/{ultimo}/devolver", "", http.StatusOK, ""},
+		{"GET", "/api/multas/politica", "", http.StatusOK, ""},
+		{"PUT", "/api/multas/politica", `{"tarifa_diaria":"0.50","dias_gracia":1,"tope":"10.00","dias_prestamo":14}`, http.StatusOK, ""},
+		{"GET", "/api/socios/ana/saldo", "", http.StatusOK, ""},
+		{"POST", "/api/socios/ana/pagos", `{"monto":"1.00"}`, http.StatusCreated, ""},
+
+		// Autores
+		{"GET", "/api/autores?nombre=orwell", "", http.StatusOK, ""},
+		{"GET", "/api/autores/1/libros", "", http.StatusOK, ""},
+		{"POST", "/api/autores", `{"nombre":"Alejandra Pizarnik"}`, http.StatusCreated, ""},
+		{"GET", "/api/autores/{ultimo}", "", http.StatusOK, ""},
+		{"PUT", "/api/autores/{ultimo}", `{"nombre":"Alejandra Pizarnik","nacionalidad":"argentina"}`, http.StatusOK, ""},
+		{"DELETE", "/api/autores/{ultimo}", "", http.StatusOK, ""},
+
+		// Webhooks (sin eventos posteriores, así no hay entregas)
+		{"POST", "/api/webhooks", `{"url":"http://127.0.0.1:1/hook","eventos":["creado"]}`, http.StatusCreated, ""},
+		{"GET", "/api/webhooks", "", http.StatusOK, ""},
+		{"GET", "/api/webhooks/{ultimo}", "", http.StatusOK, ""},
+		{"GET", "/api/webhooks/{ultimo}/entregas", "", http.StatusOK, ""},
+		{"DELETE", "/api/webhooks/{ultimo}", "", http.StatusOK, ""},
+		{"GET", "/api/webhooks/fallidos", "", http.StatusOK, ""},
+		{"POST", "/api/webhooks/fallidos/999/reintentar", "", http.StatusNotFound, ""},
+
+		// Administración, GraphQL y documentación
+		{"GET", "/api/admin/sucursales", "", http.StatusOK, ""},
+		{"GET", "/api/admin/libros", "", http.StatusOK, ""},
+		{"POST", "/graphql", `{"query":"{ libros { totalCount } }"}`, http.StatusOK, ""},
+		{"GET", "/graphql?query=" + url.QueryEscape("{ libro(id: 1) { titulo } }"), "", http.StatusOK, ""},
+		{"GET", "/openapi.json", "", http.StatusOK, ""},
+		{"GET", "/docs", "", http.StatusOK, ""},
+		{"GET", "/docs/swagger-ui/otro.js", "", http.StatusNotFound, ""},
+
+		// Rutas y recursos inexistentes
+		{"GET", "/api/nada", "", http.StatusNotFound, ""},
+		{"PATCH", "/api/libros/1", "{}", http.StatusNotFound, ""},
+		{"GET", "/api/libros/999", "", http.StatusNotFound, ""},
+	}
+
+	cubiertas := map[int]bool{}
+	ultimo := ""
+	for _, paso := range pasos {
+		ruta := strings.ReplaceAll(paso.ruta, "{ultimo}", ultimo)
+		ctx, cancelar := context.WithTimeout(context.Background(), 5*time.Second)
+		req, err := http.NewRequestWithContext(ctx, paso.metodo, ts.URL+ruta, strings.NewReader(paso.cuerpo))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if paso.cuerpo != "" {
+			tipo := paso.tipo
+			if tipo == "" {
+				tipo = "application/json"
+			}
+			req.Header.Set("Content-Type", tipo)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", paso.metodo, ruta, err)
+		}
+		// Los flujos SSE no terminan: basta con la cabecera
+		var datos []byte
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			datos, _ = io.ReadAll(resp.Body)
+		}
+		resp.Body.Close()
+		cancelar()
+
+		if resp.StatusCode != paso.estado {
+			t.Errorf("%s %s = %d, se esperaba %d: %s", paso.metodo, ruta, resp.StatusCode, paso.estado, datos)
+		}
+		if resp.StatusCode == http.StatusCreated {
+			var creado struct {
+				ID int `json:"id"`
+			}
+			json.Unmarshal(datos, &creado)
+			ultimo = strconv.Itoa(creado.ID)
+		}
+
+		// La misma búsqueda que manejarRuta: la primera ruta que coincide
+		camino, _, _ := strings.Cut(ruta, "?")
+		for i, rt := range srv.rutas {
+			if _, ok := coincideRuta(rt.Patron, camino); ok && rt.Metodo == paso.metodo {
+				cubiertas[i] = true
+				break
+			}
+		}
+	}
+
+	for i, rt := range srv.rutas {
+		if !cubiertas[i] {
+			t.Errorf("ninguna prueba recorre %s %s", rt.Metodo, rt.Patron)
+		}
+	}
+}
+
+// Filtros de GET /api/libros sobre los datos de ejemplo
+func TestFiltrosLibros(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	casos := []struct {
+		consulta string
+		titulos  []string
+	}{
+		{"", []string{"Cien años de soledad", "1984", "El Quijote"}},
+		{"?genero=Distopía", []string{"1984"}},
+		{"?genero=distopía", []string{"1984"}},
+		{"?disponible=false", []string{"El Quijote"}},
+		{"?disponible=true&genero=Clásico", nil},
+		{"?genero=Inexistente", nil},
+	}
+	for _, caso := range casos {
+		var respuesta struct {
+			Libros []Libro `json:"libros"`
+			Total  int     `json:"total"`
+		}
+		if estado := pedirJSON(t, http.MethodGet, ts.URL+"/api/libros"+caso.consulta, "", &respuesta); estado != http.StatusOK {
+			t.Fatalf("GET /api/libros%s = %d", caso.consulta, estado)
+		}
+		var titulos []string
+		for _, libro := range respuesta.Libros {
+			titulos = append(titulos, libro.Titulo)
+		}
+		if fmt.Sprint(titulos) != fmt.Sprint(caso.titulos) || respuesta.Total != len(caso.titulos) {
+			t.Errorf("GET /api/libros%s = %q (total %d), se esperaba %q", caso.consulta, titulos, respuesta.Total, caso.titulos)
+		}
+	}
+}
+
+// Validación de los cuerpos y de los parámetros de ruta
+func TestValidacionPeticiones(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	casos := []struct {
+		metodo, ruta, cuerpo string
+		estado               int
+		codigo               codigoMensaje
+	}{
+		{"POST", "/api/libros", `{"autor":"Anónimo","año":1900}`, http.StatusBadRequest, msgTituloRequerido},
+		{"POST", "/api/libros", `{"titulo":"Sin autor","año":1900}`, http.StatusBadRequest, msgAutorRequerido},
+		{"POST", "/api/libros", `{"titulo":"Futuro","autor":"Anónimo","año":3000}`, http.StatusBadRequest, msgAñoInvalido},
+		{"POST", "/api/libros", `{"titulo":"Mal ISBN","autor":"Anónimo","año":1900,"isbn":"123"}`, http.StatusBadRequest, msgISBNInvalido},
+		{"POST", "/api/libros", `{"titulo":`, http.StatusBadRequest, ""},
+		{"GET", "/api/libros/abc", "", http.StatusBadRequest, ""},
+		{"POST", "/api/libros/1/ejemplares", `{"condicion":"rota"}`, http.StatusBadRequest, ""},
+		{"POST", "/api/prestamos", `{"ejemplar_id":2,"socio":"eva"}`, http.StatusConflict, ""},
+		{"GET", "/api/estadisticas/nada", "", http.StatusNotFound, ""},
+		{"DELETE", "/api/autores/999", "", http.StatusNotFound, ""},
+		{"GET", "/api/reservas/999", "", http.StatusNotFound, ""},
+		{"GET", "/api/prestamos/999", "", http.StatusNotFound, ""},
+		{"GET", "/api/webhooks/999", "", http.StatusNotFound, ""},
+	}
+	for _, caso := range casos {
+		var respuesta struct {
+			Error  string        `json:"error"`
+			Codigo codigoMensaje `json:"codigo"`
+		}
+		estado := pedirJSON(t, caso.metodo, ts.URL+caso.ruta, caso.cuerpo, &respuesta)
+		if estado != caso.estado {
+			t.Errorf("%s %s = %d, se esperaba %d (%s)", caso.metodo, caso.ruta, estado, caso.estado, respuesta.Error)
+			continue
+		}
+		if respuesta.Error == "" {
+			t.Errorf("%s %s: respuesta sin mensaje de error", caso.metodo, caso.ruta)
+		}
+		if caso.codigo != "" && respuesta.Codigo != caso.codigo {
+			t.Errorf("%s %s: código %q, se esperaba %q", caso.metodo, caso.ruta, respuesta.Codigo, caso.codigo)
+		}
+	}
+}
+
+// Altas concurrentes: ninguna se pierde y los ids no se repiten
+func TestAltasConcurrentes(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	const altas = 50
+	ids := make(chan int, altas)
+	var wg sync.WaitGroup
+	for i := range altas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cuerpo := fmt.Sprintf(`{"titulo":"Libro %d","autor":"Autor %d","año":2000,"genero":"Clásico"}`, i, i%5)
+			var libro Libro
+			if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/libros", cuerpo, &libro); estado != http.StatusCreated {
+				t.Errorf("POST /api/libros = %d", estado)
+				return
+			}
+			ids <- libro.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	vistos := map[int]bool{}
+	for id := range ids {
+		if vistos[id] {
+			t.Errorf("id %d repetido", id)
+		}
+		vistos[id] = true
+	}
+	var lista struct {
+		Total int `json:"total"`
+	}
+	pedirJSON(t, http.MethodGet, ts.URL+"/api/libros", "", &lista)
+	if len(vistos) != altas || lista.Total != 3+altas {
+		t.Errorf("%d altas con id distinto y %d libros, se esperaban %d y %d", len(vistos), lista.Total, altas, 3+altas)
+	}
+}
+
+// Servidores en paralelo no comparten estado: lo que se crea en uno no
+// aparece en los demás
+func TestServidoresAislados(t *testing.T) {
+	t.Parallel()
+	for i := range 4 {
+		t.Run(fmt.Sprint("servidor ", i), func(t *testing.T) {
+			t.Parallel()
+			_, ts := servidorPrueba(t)
+			for j := range i + 1 {
+				cuerpo := fmt.Sprintf(`{"titulo":"Propio %d-%d","autor":"Anónimo","año":2000,"genero":"Clásico"}`, i, j)
+				if estado := pedirJSON(t, http.MethodPost, ts.URL+"/api/libros", cuerpo, nil); estado != http.StatusCreated {
+					t.Fatalf("POST /api/libros = %d", estado)
+				}
+			}
+			var lista struct {
+				Libros []Libro `json:"libros"`
+			}
+			pedirJSON(t, http.MethodGet, ts.URL+"/api/libros", "", &lista)
+			if len(lista.Libros) != 3+i+1 {
+				t.Fatalf("%d libros, se esperaban %d", len(lista.Libros), 3+i+1)
+			}
+			for _, libro := range lista.Libros[3:] {
+				if !strings.HasPrefix(libro.Titulo, fmt.Sprintf("Propio %d-", i)) {
+					t.Errorf("libro de otro servidor: %q", libro.Titulo)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Flujo de cambios del catálogo con Server-Sent Events
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Intervalo de los comentarios que mantienen viva la conexión
+const intervaloLatido = 15 * time.Second
+
+// Aviso enviado cuando el historial ya no cubre los eventos pedidos
+func avisoDesincronizado(ctx context.Context) map[string]string {
+	return map[string]string{
+		"tipo":    "desincronizado",
+		"mensaje": traducir(ctx, msgEventosPerdidos),
+	}
+}
+
+// Último evento recibido por el cliente: cabecera Last-Event-ID o ?desde=
+// (los navegadores no permiten cabeceras propias en WebSocket). -1 si no hay.
+func ultimoEventoRecibido(r *http.Request) (int64, error) {
+	valor := r.Header.Get("Last-Event-ID")
+	if valor == "" {
+		valor = r.URL.Query().Get("desde")
+	}
+	if valor == "" {
+		return -1, nil
+	}
+	id, err := strconv.ParseInt(valor, 10, 64)
+	if err != nil || id < 0 {
+		return 0, nuevoMensaje(msgIDEventoInvalido)
+	}
+	return id, nil
+}
+
+// GET /api/libros/eventos - Cambios del catálogo como Server-Sent Events
+func transmitirEventos(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		responderError(w, r, http.StatusInternalServerError, msgStreamingNoSoportado)
+		return
+	}
+
+	desde, err := ultimoEventoRecibido(r)
+	if err != nil {
+		responderMensaje(w, r, http.StatusBadRequest, comoMensaje(err))
+		return
+	}
+
+	canal, pendientes, completo, cancelar := s.eventos.SuscribirDesde(desde)
+	defer cancelar()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Tiempo de reconexión sugerido al cliente
+	fmt.Fprint(w, "retry: 3000\n\n")
+	ultimo := desde
+	if !completo {
+		escribirSSE(w, "", "desincronizado", avisoDesincronizado(r.Context()))
+		ultimo = -1
+	}
+
+	for _, evento := range pendientes {
+		escribirSSE(w, strconv.FormatInt(evento.ID, 10), evento.Tipo, evento)
+		ultimo = evento.ID
+	}
+	flusher.Flush()
+
+	latido := time.NewTicker(intervaloLatido)
+	defer latido.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-servidorDe(r.Context()).apagando:
+			return
+		case <-latido.C:
+			fmt.Fprint(w, ": latido\n\n")
+			flusher.Flush()
+		case evento := <-canal:
+			// Si el difusor descartó eventos, cortar: el navegador reconecta
+			// con Last-Event-ID y recupera el hueco desde el historial
+			if ultimo >= 0 && evento.ID != ultimo+1 {
+				return
+			}
+			escribirSSE(w, strconv.FormatInt(evento.ID, 10), evento.Tipo, evento)
+			flusher.Flush()
+			ultimo = evento.ID
+		}
+	}
+}
+
+// Escribe un evento SSE con los datos en JSON (una sola línea)
+func escribirSSE(w http.ResponseWriter, id, tipo string, datos interface{}) {
+	contenido, _ := json.Marshal(datos)
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", tipo, contenido)
+}
@@ -0,0 +1,392 @@
+// Sucursales: cada una tiene su propio catálogo, socios y secuencias de IDs
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sucursal que se usa si no se configura ninguna (SUCURSALES)
+const sucursalPorDefecto = "principal"
+
+// Los IDs van en subdominios, cabeceras y rutas del almacén de portadas
+var expresionSucursal = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+
+// Datos de una sucursal. Los campos reemplazan a los antiguos registros
+// globales; ninguna operación mezcla datos de dos sucursales.
+type sucursal struct {
+	ID string
+
+	repositorio *repositorioLibros
+	autores     *repositorioAutores
+	generos     *repositorioGeneros
+	ejemplares  *repositorioEjemplares
+	reservas    *registroReservas
+	prestamos   *registroPrestamos
+	pagos       *registroPagos
+	multas      *configuracionMultas
+	portadas    *registroPortadas
+	auditoria   *registroAuditoria
+	eventos     *difusor
+	webhooks    *despachadorWebhooks
+}
+
+func nuevaSucursal(id string, config configuracionServidor) *sucursal {
+	s := &sucursal{
+		ID:         id,
+		autores:    &repositorioAutores{contadorID: 1},
+		generos:    &repositorioGeneros{contadorID: 1},
+		ejemplares: &repositorioEjemplares{contadorID: 1},
+		prestamos:  &registroPrestamos{contadorID: 1},
+		pagos:      &registroPagos{contadorID: 1},
+		multas:     &configuracionMultas{politica: politicaMultasPorDefecto()},
+		portadas:   &registroPortadas{portadas: map[int]Portada{}, almacen: config.Portadas, prefijo: id},
+		auditoria:  &registroAuditoria{},
+		eventos:    &difusor{suscriptores: map[chan eventoLibro]struct{}{}},
+		webhooks:   nuevoDespachadorWebhooks(conExportador(context.Background(), config.Trazas), config.WebhooksRedesPrivadas),
+	}
+	s.repositorio = &repositorioLibros{contadorID: 1, sucursal: s}
+	s.reservas = &registroReservas{contadorID: 1, plazo: plazoRetiroPorDefecto, avisos: make(chan int, 256), sucursal: s}
+	return s
+}
+
+// Registro de sucursales de un servidor; se arma al iniciar y después solo se lee
+type registroSucursales struct {
+	mu         sync.RWMutex
+	sucursales map[string]*sucursal
+	orden      []string
+}
+
+// Agregar registra una sucursal nueva
+func (g *registroSucursales) Agregar(s *sucursal) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, existe := g.sucursales[s.ID]; existe {
+		return fmt.Errorf("sucursal repetida: %s", s.ID)
+	}
+	g.sucursales[s.ID] = s
+	g.orden = append(g.orden, s.ID)
+	return nil
+}
+
+// Obtener busca una sucursal por su ID
+func (g *registroSucursales) Obtener(id string) (*sucursal, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	s, ok := g.sucursales[id]
+	return s, ok
+}
+
+// Todas devuelve las sucursales en el orden en que se configuraron
+func (g *registroSucursales) Todas() []*sucursal {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	lista := make([]*sucursal, 0, len(g.orden))
+	for _, id := range g.orden {
+		lista = append(lista, g.sucursales[id])
+	}
+	return lista
+}
+
+// PorDefecto es la primera sucursal configurada; atiende las peticiones que
+// no indican ninguna
+func (g *registroSucursales) PorDefecto() *sucursal {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.sucursales[g.orden[0]]
+}
+
+// idsSucursales lee SUCURSALES, una lista separada por comas ("centro,norte")
+func idsSucursales() ([]string, error) {
+	valor := os.Getenv("SUCURSALES")
+	if strings.TrimSpace(valor) == "" {
+		return []string{sucursalPorDefecto}, nil
+	}
+	var ids []string
+	for _, id := range strings.Split(valor, ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if !expresionSucursal.MatchString(id) {
+			return nil, fmt.Errorf("ID de sucursal inválido: %q (minúsculas, dígitos y guiones; hasta 32 caracteres)", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Reclamos de los tokens: la sucursal del usuario y si es administrador
+type reclamosToken struct {
+	Sucursal string `json:"sucursal"`
+	Admin    bool   `json:"admin"`
+	Exp      int64  `json:"exp,omitempty"`
+}
+
+// verificarToken comprueba un JWT firmado con HS256 y devuelve sus reclamos
+func verificarToken(token string, secreto []byte, ahora time.Time) (reclamosToken, error) {
+	partes := strings.Split(token, ".")
+	if len(partes) != 3 {
+		return reclamosToken{}, nuevoMensaje(msgTokenMalFormado)
+	}
+
+	var cabecera struct {
+		Alg string `json:"alg"`
+	}
+	datos, err := base64.RawURLEncoding.DecodeString(partes[0])
+	if err != nil || json.Unmarshal(datos, &cabecera) != nil {
+		return reclamosToken{}, nuevoMensaje(msgTokenMalFormado)
+	}
+	if cabecera.Alg != "HS256" {
+		return reclamosToken{}, nuevoMensaje(msgTokenAlgoritmo, cabecera.Alg)
+	}
+
+	firma, err := base64.RawURLEncoding.DecodeString(partes[2])
+	if err != nil {
+		return reclamosToken{}, nuevoMensaje(msgTokenMalFormado)
+	}
+	mac := hmac.New(sha256.New, secreto)
+	mac.Write([]byte(partes[0] + "." + partes[1]))
+	if !hmac.Equal(firma, mac.Sum(nil)) {
+		return reclamosToken{}, nuevoMensaje(msgTokenFirmaInvalida)
+	}
+
+	var reclamos reclamosToken
+	datos, err = base64.RawURLEncoding.DecodeString(partes[1])
+	if err != nil || json.Unmarshal(datos, &reclamos) != nil {
+		return reclamosToken{}, nuevoMensaje(msgTokenMalFormado)
+	}
+	if reclamos.Exp != 0 && ahora.Unix() >= reclamos.Exp {
+		return reclamosToken{}, nuevoMensaje(msgTokenVencido)
+	}
+	return reclamos, nil
+}
+
+// Sucursal resuelta para la petición y si quien llama es administrador
+type accesoSucursal struct {
+	Sucursal *sucursal
+	Admin    bool
+}
+
+type claveSucursal struct{}
+
+// Error al resolver la sucursal, con el código HTTP que le corresponde
+type errorSucursal struct {
+	Estado  int
+	Mensaje *mensaje
+}
+
+// resolverSucursal elige la sucursal de la petición. Se indica con el
+// reclamo "sucursal" del token, la cabecera X-Sucursal o el subdominio
+// (centro.ejemplo.com); si vienen varias deben coincidir. Solo un token de
+// administrador puede elegir una sucursal distinta de la suya; sin secreto
+// solo se atiende la de por defecto, salvo con SucursalesAbiertas. Antes se
+// comprueba la clave de API, si el servidor la exige.
+func (srv *servidor) resolverSucursal(r *http.Request) (accesoSucursal, *errorSucursal) {
+	if err := srv.verificarClaveAPI(r); err != nil {
+		return accesoSucursal{}, err
+	}
+	pedida := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Sucursal")))
+	if subdominio := srv.sucursalDelHost(r.Host); subdominio != "" {
+		if pedida != "" && pedida != subdominio {
+			return accesoSucursal{}, &errorSucursal{http.StatusBadRequest, nuevoMensaje(msgSucursalSubdominio)}
+		}
+		pedida = subdominio
+	}
+
+	acceso := accesoSucursal{}
+	switch {
+	case len(srv.secreto) == 0 && srv.abiertas:
+		acceso.Admin = true
+	case len(srv.secreto) == 0:
+		// Sin tokens no hay forma de saber a qué sucursal pertenece el cliente
+		if pedida != "" && pedida != srv.sucursales.PorDefecto().ID {
+			return accesoSucursal{}, &errorSucursal{http.StatusForbidden, nuevoMensaje(msgSucursalSinSecreto, pedida)}
+		}
+	default:
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return accesoSucursal{}, &errorSucursal{http.StatusUnauthorized, nuevoMensaje(msgTokenRequerido)}
+		}
+		reclamos, err := verificarToken(strings.TrimSpace(token), srv.secreto, time.Now())
+		if err != nil {
+			return accesoSucursal{}, &errorSucursal{http.StatusUnauthorized, comoMensaje(err)}
+		}
+		acceso.Admin = reclamos.Admin
+		switch {
+		case reclamos.Admin:
+			if pedida == "" {
+				pedida = reclamos.Sucursal
+			}
+		case reclamos.Sucursal == "":
+			return accesoSucursal{}, &errorSucursal{http.StatusForbidden, nuevoMensaje(msgTokenSinSucursal)}
+		case pedida != "" && pedida != reclamos.Sucursal:
+			return accesoSucursal{}, &errorSucursal{http.StatusForbidden, nuevoMensaje(msgTokenSinAcceso, pedida)}
+		default:
+			pedida = reclamos.Sucursal
+		}
+	}
+
+	if pedida == "" {
+		acceso.Sucursal = srv.sucursales.PorDefecto()
+		return acceso, nil
+	}
+	s, ok := srv.sucursales.Obtener(pedida)
+	if !ok {
+		return accesoSucursal{}, &errorSucursal{http.StatusNotFound, nuevoMensaje(msgSucursalDesconocida, pedida)}
+	}
+	acceso.Sucursal = s
+	return acceso, nil
+}
+
+// sucursalDelHost devuelve la sucursal si la primera etiqueta del host es
+// una sucursal conocida ("norte.localhost:8080" → "norte")
+func (srv *servidor) sucursalDelHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	etiqueta, resto, ok := strings.Cut(strings.ToLower(host), ".")
+	if !ok || resto == "" {
+		return ""
+	}
+	if _, existe := srv.sucursales.Obtener(etiqueta); !existe {
+		return ""
+	}
+	return etiqueta
+}
+
+// Rutas que no dependen de la sucursal (documentación)
+func rutaSinSucursal(path string) bool {
+	return !strings.HasPrefix(path, "/api/") && path != "/graphql"
+}
+
+// sucursalMiddleware resuelve la sucursal de cada petición a la API y la
+// deja en el contexto
+func (srv *servidor) sucursalMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rutaSinSucursal(r.URL.Path) || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+		acceso, err := srv.resolverSucursal(r)
+		if err != nil {
+			responderMensaje(w, r, err.Estado, err.Mensaje)
+			return
+		}
+		w.Header().Add("Vary", "X-Sucursal")
+		next(w, r.WithContext(context.WithValue(r.Context(), claveSucursal{}, acceso)))
+	}
+}
+
+// sucursalDe devuelve la sucursal de la petición (la de por defecto del
+// servidor fuera de la API)
+func sucursalDe(ctx context.Context) *sucursal {
+	if acceso, ok := ctx.Value(claveSucursal{}).(accesoSucursal); ok {
+		return acceso.Sucursal
+	}
+	return servidorDe(ctx).sucursales.PorDefecto()
+}
+
+// esAdministrador indica si la petición puede usar las rutas de /api/admin
+func esAdministrador(ctx context.Context) bool {
+	acceso, ok := ctx.Value(claveSucursal{}).(accesoSucursal)
+	return ok && acceso.Admin
+}
+
+// Libro con la sucursal a la que pertenece (vista de administración)
+type libroSucursal struct {
+	Libro
+	Sucursal string `json:"sucursal"`
+}
+
+// Resumen de una sucursal para la vista de administración
+type resumenSucursal struct {
+	ID               string    `json:"id"`
+	Libros           int       `json:"libros"`
+	EnPapelera       int       `json:"en_papelera"`
+	Autores          int       `json:"autores"`
+	Ejemplares       int       `json:"ejemplares"`
+	PrestamosActivos int       `json:"prestamos_activos"`
+	UltimoCambio     time.Time `json:"ultimo_cambio"`
+}
+
+func (s *sucursal) resumen(ctx context.Context) resumenSucursal {
+	resumen := resumenSucursal{
+		ID:           s.ID,
+		Autores:      len(s.autores.Listar()),
+		UltimoCambio: s.repositorio.UltimoCambio(),
+	}
+	for _, libro := range s.repositorio.ListarConEliminados(ctx) {
+		if libro.EliminadoEn != nil {
+			resumen.EnPapelera++
+			continue
+		}
+		resumen.Libros++
+		total, _ := s.ejemplares.Resumen(libro.ID)
+		resumen.Ejemplares += total
+	}
+	resumen.PrestamosActivos = len(s.prestamos.Buscar(func(p Prestamo) bool { return p.DevueltoEn == nil }))
+	return resumen
+}
+
+// HANDLERS
+
+// GET /api/admin/sucursales - Resumen de todas las sucursales
+func obtenerSucursales(w http.ResponseWriter, r *http.Request) {
+	if !esAdministrador(r.Context()) {
+		responderError(w, r, http.StatusForbidden, msgTokenAdminRequerido)
+		return
+	}
+
+	lista := []resumenSucursal{}
+	for _, s := range servidorDe(r.Context()).sucursales.Todas() {
+		lista = append(lista, s.resumen(r.Context()))
+	}
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"sucursales": lista,
+		"total":      len(lista),
+	})
+}
+
+// GET /api/admin/libros - Libros de todas las sucursales (?sucursal=, ?incluir_eliminados=true)
+func obtenerLibrosTodasSucursales(w http.ResponseWriter, r *http.Request) {
+	if !esAdministrador(r.Context()) {
+		responderError(w, r, http.StatusForbidden, msgTokenAdminRequerido)
+		return
+	}
+
+	registro := servidorDe(r.Context()).sucursales
+	lista := registro.Todas()
+	if id := r.URL.Query().Get("sucursal"); id != "" {
+		s, ok := registro.Obtener(id)
+		if !ok {
+			responderError(w, r, http.StatusNotFound, msgSucursalDesconocida, id)
+			return
+		}
+		lista = []*sucursal{s}
+	}
+	incluirEliminados := r.URL.Query().Get("incluir_eliminados") == "true"
+
+	libros := []libroSucursal{}
+	for _, s := range lista {
+		catalogo := s.repositorio.Listar(r.Context())
+		if incluirEliminados {
+			catalogo = s.repositorio.ListarConEliminados(r.Context())
+		}
+		for _, libro := range catalogo {
+			libros = append(libros, libroSucursal{Libro: libro, Sucursal: s.ID})
+		}
+	}
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"libros": libros,
+		"total":  len(libros),
+	})
+}
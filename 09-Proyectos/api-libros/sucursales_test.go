@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// firmarToken arma un JWT HS256 con los reclamos dados
+func firmarToken(secreto string, reclamos reclamosToken) string {
+	codificar := func(v interface{}) string {
+		datos, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(datos)
+	}
+	contenido := codificar(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + codificar(reclamos)
+	mac := hmac.New(sha256.New, []byte(secreto))
+	mac.Write([]byte(contenido))
+	return contenido + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestResolverSucursal(t *testing.T) {
+	t.Parallel()
+	const secreto = "s3cr3t"
+	centro := firmarToken(secreto, reclamosToken{Sucursal: "centro"})
+	admin := firmarToken(secreto, reclamosToken{Sucursal: "centro", Admin: true})
+
+	casos := []struct {
+		nombre   string
+		config   configuracionServidor
+		pedida   string
+		token    string
+		estado   int    // 0 = resuelta
+		sucursal string // La resuelta
+		esAdmin  bool
+	}{
+		// Sin secreto: solo la de por defecto y sin administración
+		{"sin secreto", configuracionServidor{}, "", "", 0, "centro", false},
+		{"sin secreto, la de por defecto", configuracionServidor{}, "centro", "", 0, "centro", false},
+		{"sin secreto, otra sucursal", configuracionServidor{}, "norte", "", http.StatusForbidden, "", false},
+		{"sin secreto, desconocida", configuracionServidor{}, "sur", "", http.StatusForbidden, "", false},
+		// Abiertas a propósito (desarrollo)
+		{"abiertas", configuracionServidor{SucursalesAbiertas: true}, "norte", "", 0, "norte", true},
+		{"abiertas, desconocida", configuracionServidor{SucursalesAbiertas: true}, "sur", "", http.StatusNotFound, "", false},
+		// Con secreto manda el token, aunque se pida abrirlas
+		{"sin token", configuracionServidor{Secreto: []byte(secreto), SucursalesAbiertas: true}, "", "", http.StatusUnauthorized, "", false},
+		{"token propio", configuracionServidor{Secreto: []byte(secreto)}, "", centro, 0, "centro", false},
+		{"token de otra", configuracionServidor{Secreto: []byte(secreto)}, "norte", centro, http.StatusForbidden, "", false},
+		{"token admin", configuracionServidor{Secreto: []byte(secreto)}, "norte", admin, 0, "norte", true},
+		{"firma inválida", configuracionServidor{Secreto: []byte("otro")}, "", centro, http.StatusUnauthorized, "", false},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			t.Parallel()
+			caso.config.Sucursales = []string{"centro", "norte"}
+			caso.config.Portadas = almacenLocal{dir: t.TempDir()}
+			srv, err := nuevoServidor(caso.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/api/libros", nil)
+			if caso.pedida != "" {
+				r.Header.Set("X-Sucursal", caso.pedida)
+			}
+			if caso.token != "" {
+				r.Header.Set("Authorization", "Bearer "+caso.token)
+			}
+
+			acceso, errSucursal := srv.resolverSucursal(r)
+			if caso.estado != 0 {
+				if errSucursal == nil || errSucursal.Estado != caso.estado {
+					t.Fatalf("error %+v, se esperaba %d", errSucursal, caso.estado)
+				}
+				return
+			}
+			if errSucursal != nil {
+				t.Fatalf("error inesperado %d %s", errSucursal.Estado, errSucursal.Mensaje.Codigo)
+			}
+			if acceso.Sucursal.ID != caso.sucursal || acceso.Admin != caso.esAdmin {
+				t.Errorf("sucursal %s (admin %v), se esperaba %s (admin %v)", acceso.Sucursal.ID, acceso.Admin, caso.sucursal, caso.esAdmin)
+			}
+		})
+	}
+}
+
+// Sin secreto ni SucursalesAbiertas las rutas de administración están cerradas
+func TestAdminCerradaSinSecreto(t *testing.T) {
+	t.Parallel()
+	for _, abiertas := range []bool{false, true} {
+		srv, err := nuevoServidor(configuracionServidor{Portadas: almacenLocal{dir: t.TempDir()}, SucursalesAbiertas: abiertas})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := httptest.NewServer(srv.Handler())
+		esperado := http.StatusForbidden
+		if abiertas {
+			esperado = http.StatusOK
+		}
+		if estado := pedirJSON(t, http.MethodGet, ts.URL+"/api/admin/sucursales", "", nil); estado != esperado {
+			t.Errorf("abiertas=%v: GET /api/admin/sucursales = %d, se esperaba %d", abiertas, estado, esperado)
+		}
+		ts.Close()
+	}
+}
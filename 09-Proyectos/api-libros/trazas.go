@@ -0,0 +1,513 @@
+// Trazas distribuidas compatibles con OpenTelemetry
+// Implementación mínima con la librería estándar: spans, propagación
+// W3C Trace Context (traceparent) y exportadores a consola u OTLP/HTTP
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tipos de span según OTLP
+const (
+	spanInterno  = 1
+	spanServidor = 2
+	spanCliente  = 3
+)
+
+// Código de estado de error según OTLP (0 significa sin definir)
+const estadoError = 2
+
+// Identificadores que viajan entre servicios
+type contextoSpan struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Muestreado bool
+}
+
+// Span representa una operación medida dentro de una traza
+type Span struct {
+	Nombre    string
+	Tipo      int
+	Contexto  contextoSpan
+	PadreID   [8]byte
+	Inicio    time.Time
+	Fin       time.Time
+	Atributos map[string]interface{}
+	Estado    int
+	Mensaje   string
+
+	mu         sync.Mutex
+	finalizado bool
+	exportador Exportador // El del contexto al iniciarlo (nil = no se exporta)
+}
+
+// Exportador recibe los spans terminados
+type Exportador interface {
+	Exportar(spans []*Span) error
+	Cerrar() error
+}
+
+type claveSpan struct{}
+
+type claveExportador struct{}
+
+// Nombre del servicio reportado a los colectores si no se indica otro
+const nombreServicioPorDefecto = "api-libros"
+
+// conExportador indica a dónde se envían los spans que se inicien con el
+// contexto; cada servidor usa el suyo
+func conExportador(ctx context.Context, exportador Exportador) context.Context {
+	if exportador == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, claveExportador{}, exportador)
+}
+
+// Genera bytes aleatorios para los identificadores
+func idAleatorio(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
+
+// iniciarSpan crea un span hijo del que haya en el contexto
+func iniciarSpan(ctx context.Context, nombre string) (context.Context, *Span) {
+	return iniciarSpanConTipo(ctx, nombre, spanInterno)
+}
+
+func iniciarSpanConTipo(ctx context.Context, nombre string, tipo int) (context.Context, *Span) {
+	span := &Span{
+		Nombre:    nombre,
+		Tipo:      tipo,
+		Inicio:    time.Now(),
+		Atributos: map[string]interface{}{},
+	}
+	span.exportador, _ = ctx.Value(claveExportador{}).(Exportador)
+
+	if padre, ok := ctx.Value(claveSpan{}).(contextoSpan); ok {
+		span.Contexto.TraceID = padre.TraceID
+		span.Contexto.Muestreado = padre.Muestreado
+		span.PadreID = padre.SpanID
+	} else {
+		idAleatorio(span.Contexto.TraceID[:])
+		span.Contexto.Muestreado = true
+	}
+	idAleatorio(span.Contexto.SpanID[:])
+
+	return context.WithValue(ctx, claveSpan{}, span.Contexto), span
+}
+
+// AsignarAtributo agrega un par clave/valor al span
+func (s *Span) AsignarAtributo(clave string, valor interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Atributos[clave] = valor
+}
+
+// RegistrarError marca el span como fallido
+func (s *Span) RegistrarError(mensaje string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Estado = estadoError
+	s.Mensaje = mensaje
+}
+
+// Finalizar cierra el span y lo envía al exportador
+func (s *Span) Finalizar() {
+	s.mu.Lock()
+	if s.finalizado {
+		s.mu.Unlock()
+		return
+	}
+	s.finalizado = true
+	s.Fin = time.Now()
+	s.mu.Unlock()
+
+	if s.exportador == nil || !s.Contexto.Muestreado {
+		return
+	}
+	if err := s.exportador.Exportar([]*Span{s}); err != nil {
+		log.Printf("Error exportando span %s: %v", s.Nombre, err)
+	}
+}
+
+// TraceID en hexadecimal
+func (s *Span) TraceID() string {
+	return hex.EncodeToString(s.Contexto.TraceID[:])
+}
+
+// SpanID en hexadecimal
+func (s *Span) SpanID() string {
+	return hex.EncodeToString(s.Contexto.SpanID[:])
+}
+
+// Formatea el encabezado traceparent: version-traceid-spanid-flags
+func formatearTraceparent(c contextoSpan) string {
+	flags := "00"
+	if c.Muestreado {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s",
+		hex.EncodeToString(c.TraceID[:]), hex.EncodeToString(c.SpanID[:]), flags)
+}
+
+// Interpreta el encabezado traceparent según la especificación W3C
+func parsearTraceparent(valor string) (contextoSpan, bool) {
+	var c contextoSpan
+	partes := strings.Split(strings.TrimSpace(valor), "-")
+	if len(partes) < 4 || len(partes[0]) != 2 || partes[0] == "ff" {
+		return c, false
+	}
+	// La versión 00 define exactamente cuatro campos
+	if partes[0] == "00" && len(partes) != 4 {
+		return c, false
+	}
+	if len(partes[1]) != 32 || len(partes[2]) != 16 || len(partes[3]) != 2 {
+		return c, false
+	}
+	if _, err := hex.Decode(c.TraceID[:], []byte(partes[1])); err != nil {
+		return c, false
+	}
+	if _, err := hex.Decode(c.SpanID[:], []byte(partes[2])); err != nil {
+		return c, false
+	}
+	if c.TraceID == [16]byte{} || c.SpanID == [8]byte{} {
+		return c, false
+	}
+	flags, err := strconv.ParseUint(partes[3], 16, 8)
+	if err != nil {
+		return c, false
+	}
+	c.Muestreado = flags&0x01 == 1
+	return c, true
+}
+
+// extraerTraceparent agrega al contexto la traza recibida en los headers
+func extraerTraceparent(ctx context.Context, h http.Header) context.Context {
+	if c, ok := parsearTraceparent(h.Get("traceparent")); ok {
+		return context.WithValue(ctx, claveSpan{}, c)
+	}
+	return ctx
+}
+
+// inyectarTraceparent propaga la traza actual en peticiones salientes
+func inyectarTraceparent(ctx context.Context, h http.Header) {
+	if c, ok := ctx.Value(claveSpan{}).(contextoSpan); ok {
+		h.Set("traceparent", formatearTraceparent(c))
+	}
+}
+
+// ResponseWriter que recuerda el código de estado
+type registroEstado struct {
+	http.ResponseWriter
+	estado int
+}
+
+func (r *registroEstado) WriteHeader(estado int) {
+	r.estado = estado
+	r.ResponseWriter.WriteHeader(estado)
+}
+
+func (r *registroEstado) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack permite tomar la conexión (WebSocket); se registra como 101
+func (r *registroEstado) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("la conexión no admite Hijack")
+	}
+	r.estado = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// Middleware que abre el span de servidor para cada petición
+func trazasMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := extraerTraceparent(r.Context(), r.Header)
+		ctx, span := iniciarSpanConTipo(ctx, r.Method+" "+r.URL.Path, spanServidor)
+		defer span.Finalizar()
+
+		span.AsignarAtributo("http.request.method", r.Method)
+		span.AsignarAtributo("url.path", r.URL.Path)
+		w.Header().Set("traceparent", formatearTraceparent(span.Contexto))
+
+		registro := &registroEstado{ResponseWriter: w, estado: http.StatusOK}
+		next.ServeHTTP(registro, r.WithContext(ctx))
+
+		span.AsignarAtributo("http.response.status_code", registro.estado)
+		if registro.estado >= 500 {
+			span.RegistrarError(http.StatusText(registro.estado))
+		}
+	}
+}
+
+// trazarHandler envuelve un handler en un span con su nombre
+func trazarHandler(nombre string, h http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	ctx, span := iniciarSpan(r.Context(), nombre)
+	defer span.Finalizar()
+	h(w, r.WithContext(ctx))
+}
+
+// EXPORTADOR A CONSOLA: una línea JSON por span, útil en pruebas
+
+type exportadorConsola struct {
+	mu      sync.Mutex
+	destino io.Writer
+}
+
+func nuevoExportadorConsola(destino io.Writer) *exportadorConsola {
+	return &exportadorConsola{destino: destino}
+}
+
+func (e *exportadorConsola) Exportar(spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range spans {
+		linea := map[string]interface{}{
+			"nombre":     s.Nombre,
+			"trace_id":   s.TraceID(),
+			"span_id":    s.SpanID(),
+			"duracion":   s.Fin.Sub(s.Inicio).String(),
+			"atributos":  s.Atributos,
+			"inicio":     s.Inicio,
+			"con_error":  s.Estado == estadoError,
+			"padre_id":   "",
+			"tipo":       s.Tipo,
+			"mensaje":    s.Mensaje,
+			"muestreado": s.Contexto.Muestreado,
+		}
+		if s.PadreID != [8]byte{} {
+			linea["padre_id"] = hex.EncodeToString(s.PadreID[:])
+		}
+		if err := json.NewEncoder(e.destino).Encode(linea); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *exportadorConsola) Cerrar() error {
+	return nil
+}
+
+// EXPORTADOR OTLP: envía lotes en JSON a un colector (/v1/traces)
+
+type exportadorOTLP struct {
+	url      string
+	servicio string // service.name de los spans
+	cliente  *http.Client
+
+	mu         sync.Mutex
+	pendientes []*Span
+	envios     chan struct{}
+	cerrar     chan struct{}
+	termino    chan struct{}
+}
+
+// Tamaño de lote e intervalo máximo entre envíos
+const (
+	loteOTLP      = 256
+	intervaloOTLP = 5 * time.Second
+)
+
+func nuevoExportadorOTLP(endpoint, servicio string) *exportadorOTLP {
+	e := &exportadorOTLP{
+		url:      strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		servicio: servicio,
+		cliente:  &http.Client{Timeout: 10 * time.Second},
+		envios:   make(chan struct{}, 1),
+		cerrar:   make(chan struct{}),
+		termino:  make(chan struct{}),
+	}
+	go e.bucle()
+	return e
+}
+
+func (e *exportadorOTLP) Exportar(spans []*Span) error {
+	e.mu.Lock()
+	e.pendientes = append(e.pendientes, spans...)
+	lleno := len(e.pendientes) >= loteOTLP
+	e.mu.Unlock()
+
+	if lleno {
+		select {
+		case e.envios <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Envía los spans acumulados periódicamente o cuando se llena el lote
+func (e *exportadorOTLP) bucle() {
+	defer close(e.termino)
+	ticker := time.NewTicker(intervaloOTLP)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.envios:
+		case <-e.cerrar:
+			e.vaciar()
+			return
+		}
+		e.vaciar()
+	}
+}
+
+func (e *exportadorOTLP) vaciar() {
+	e.mu.Lock()
+	lote := e.pendientes
+	e.pendientes = nil
+	e.mu.Unlock()
+
+	if len(lote) == 0 {
+		return
+	}
+	if err := e.enviar(lote); err != nil {
+		log.Printf("Error enviando %d spans a %s: %v", len(lote), e.url, err)
+	}
+}
+
+func (e *exportadorOTLP) enviar(spans []*Span) error {
+	cuerpo, err := json.Marshal(peticionOTLP(e.servicio, spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.cliente.Post(e.url, "application/json", bytes.NewReader(cuerpo))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("el colector respondió %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *exportadorOTLP) Cerrar() error {
+	close(e.cerrar)
+	<-e.termino
+	return nil
+}
+
+// Construye el cuerpo ExportTraceServiceRequest en su forma JSON
+func peticionOTLP(servicio string, spans []*Span) map[string]interface{} {
+	lista := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		item := map[string]interface{}{
+			"traceId":           s.TraceID(),
+			"spanId":            s.SpanID(),
+			"name":              s.Nombre,
+			"kind":              s.Tipo,
+			"startTimeUnixNano": strconv.FormatInt(s.Inicio.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.Fin.UnixNano(), 10),
+			"attributes":        atributosOTLP(s.Atributos),
+			"status": map[string]interface{}{
+				"code":    s.Estado,
+				"message": s.Mensaje,
+			},
+		}
+		if s.PadreID != [8]byte{} {
+			item["parentSpanId"] = hex.EncodeToString(s.PadreID[:])
+		}
+		lista = append(lista, item)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": atributosOTLP(map[string]interface{}{
+						"service.name": servicio,
+					}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": servicio},
+						"spans": lista,
+					},
+				},
+			},
+		},
+	}
+}
+
+// Convierte los atributos al formato clave/valor tipado de OTLP
+func atributosOTLP(atributos map[string]interface{}) []map[string]interface{} {
+	resultado := make([]map[string]interface{}, 0, len(atributos))
+	for clave, valor := range atributos {
+		var v map[string]interface{}
+		switch x := valor.(type) {
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(x)}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(x, 10)}
+		case bool:
+			v = map[string]interface{}{"boolValue": x}
+		case float64:
+			v = map[string]interface{}{"doubleValue": x}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(x)}
+		}
+		resultado = append(resultado, map[string]interface{}{"key": clave, "value": v})
+	}
+	return resultado
+}
+
+// exportadorTrazasConfigurado elige el exportador según las variables de
+// entorno (nil = trazas desactivadas):
+//
+//	TRAZAS_EXPORTADOR=consola|otlp|ninguno
+//	OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318
+//	OTEL_SERVICE_NAME=api-libros
+func exportadorTrazasConfigurado() Exportador {
+	servicio := nombreServicioPorDefecto
+	if nombre := os.Getenv("OTEL_SERVICE_NAME"); nombre != "" {
+		servicio = nombre
+	}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	modo := os.Getenv("TRAZAS_EXPORTADOR")
+	if modo == "" && endpoint != "" {
+		modo = "otlp"
+	}
+
+	switch modo {
+	case "consola":
+		return nuevoExportadorConsola(os.Stdout)
+	case "otlp":
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		return nuevoExportadorOTLP(endpoint, servicio)
+	case "", "ninguno":
+		return nil
+	default:
+		log.Printf("Exportador de trazas desconocido %q, trazas desactivadas", modo)
+		return nil
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsearTraceparent(t *testing.T) {
+	t.Parallel()
+	const (
+		traza = "4bf92f3577b34da6a3ce929d0e0e4736"
+		span  = "00f067aa0ba902b7"
+	)
+	casos := []struct {
+		nombre, valor  string
+		ok, muestreado bool
+	}{
+		{"muestreado", "00-" + traza + "-" + span + "-01", true, true},
+		{"sin muestrear", "00-" + traza + "-" + span + "-00", true, false},
+		{"otras banderas", "00-" + traza + "-" + span + "-03", true, true},
+		{"con espacios", "  00-" + traza + "-" + span + "-01 ", true, true},
+		{"versión futura con más campos", "01-" + traza + "-" + span + "-01-extra", true, true},
+		{"versión ff", "ff-" + traza + "-" + span + "-01", false, false},
+		{"versión de un dígito", "0-" + traza + "-" + span + "-01", false, false},
+		{"versión 00 con más campos", "00-" + traza + "-" + span + "-01-extra", false, false},
+		{"faltan campos", "00-" + traza + "-" + span, false, false},
+		{"trace id en ceros", "00-" + strings.Repeat("0", 32) + "-" + span + "-01", false, false},
+		{"span id en ceros", "00-" + traza + "-" + strings.Repeat("0", 16) + "-01", false, false},
+		{"trace id corto", "00-" + traza[2:] + "-" + span + "-01", false, false},
+		{"span id largo", "00-" + traza + "-" + span + "ab-01", false, false},
+		{"banderas de tres dígitos", "00-" + traza + "-" + span + "-001", false, false},
+		{"no hexadecimal", "00-" + strings.Repeat("z", 32) + "-" + span + "-01", false, false},
+		{"banderas no hexadecimales", "00-" + traza + "-" + span + "-zz", false, false},
+		{"vacío", "", false, false},
+	}
+	for _, caso := range casos {
+		c, ok := parsearTraceparent(caso.valor)
+		if ok != caso.ok || c.Muestreado != caso.muestreado {
+			t.Errorf("%s: ok %v muestreado %v, se esperaba ok %v muestreado %v", caso.nombre, ok, c.Muestreado, caso.ok, caso.muestreado)
+			continue
+		}
+		if ok && formatearTraceparent(c)[3:52] != traza+"-"+span {
+			t.Errorf("%s: se formatea como %s", caso.nombre, formatearTraceparent(c))
+		}
+	}
+}
+
+// spanConsola es una línea del exportador a consola
+type spanConsola struct {
+	Nombre     string                 `json:"nombre"`
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	PadreID    string                 `json:"padre_id"`
+	Tipo       int                    `json:"tipo"`
+	Atributos  map[string]interface{} `json:"atributos"`
+	Muestreado bool                   `json:"muestreado"`
+}
+
+// servidorTrazado es servidorPrueba con los spans en un buffer
+func servidorTrazado(t *testing.T) (*httptest.Server, func() map[string]spanConsola) {
+	t.Helper()
+	var salida bytes.Buffer
+	exportador := nuevoExportadorConsola(&salida)
+	srv, err := nuevoServidor(configuracionServidor{
+		Sucursales:   []string{"centro"},
+		Portadas:     almacenLocal{dir: t.TempDir()},
+		DatosEjemplo: true,
+		Trazas:       exportador,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+
+	// spans devuelve los exportados hasta ahora, por nombre
+	spans := func() map[string]spanConsola {
+		exportador.mu.Lock()
+		defer exportador.mu.Unlock()
+		porNombre := map[string]spanConsola{}
+		for _, linea := range strings.Split(strings.TrimSpace(salida.String()), "\n") {
+			var s spanConsola
+			if json.Unmarshal([]byte(linea), &s) == nil {
+				porNombre[s.Nombre] = s
+			}
+		}
+		return porNombre
+	}
+	return ts, spans
+}
+
+// La traza recibida en traceparent sigue por el middleware, el router, el
+// handler y el repositorio, cada span hijo del anterior
+func TestTrazasPropagacion(t *testing.T) {
+	t.Parallel()
+	ts, spans := servidorTrazado(t)
+	const (
+		traza = "4bf92f3577b34da6a3ce929d0e0e4736"
+		padre = "00f067aa0ba902b7"
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/libros/1", nil)
+	req.Header.Set("traceparent", "00-"+traza+"-"+padre+"-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	cadena := []string{"GET /api/libros/1", "manejarRuta", "obtenerLibroPorID", "repositorio.Obtener"}
+	esperarHasta(t, "los spans de la petición", func() bool { return len(spans()) == len(cadena) })
+	exportados := spans()
+
+	anterior := padre
+	for _, nombre := range cadena {
+		s, ok := exportados[nombre]
+		if !ok {
+			t.Fatalf("falta el span %s: %v", nombre, exportados)
+		}
+		if s.TraceID != traza || s.PadreID != anterior || !s.Muestreado {
+			t.Errorf("%s: traza %s padre %s, se esperaba traza %s padre %s", nombre, s.TraceID, s.PadreID, traza, anterior)
+		}
+		anterior = s.SpanID
+	}
+
+	servidor := exportados["GET /api/libros/1"]
+	if servidor.Tipo != spanServidor || servidor.Atributos["http.response.status_code"] != float64(http.StatusOK) {
+		t.Errorf("span de servidor: %+v", servidor)
+	}
+	if ruta := exportados["manejarRuta"].Atributos["http.route"]; ruta != "/api/libros/{id}" {
+		t.Errorf("http.route = %v", ruta)
+	}
+	if respuesta := resp.Header.Get("traceparent"); respuesta != "00-"+traza+"-"+servidor.SpanID+"-01" {
+		t.Errorf("traceparent de la respuesta %q", respuesta)
+	}
+}
+
+// Sin traceparent se empieza una traza nueva; si llega sin muestrear, se
+// propaga la decisión y no se exporta nada
+func TestTrazasRaizYSinMuestrear(t *testing.T) {
+	t.Parallel()
+	ts, spans := servidorTrazado(t)
+
+	resp, err := http.Get(ts.URL + "/api/libros/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	esperarHasta(t, "el span de servidor", func() bool { _, ok := spans()["GET /api/libros/1"]; return ok })
+	if raiz := spans()["GET /api/libros/1"]; raiz.PadreID != "" || len(raiz.TraceID) != 32 {
+		t.Errorf("span raíz: %+v", raiz)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/libros/2", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if c, ok := parsearTraceparent(resp.Header.Get("traceparent")); !ok || c.Muestreado {
+		t.Errorf("traceparent de la respuesta %q", resp.Header.Get("traceparent"))
+	}
+	// La conexión se reutiliza, así que cuando llega el span de la siguiente
+	// petición la anterior ya terminó
+	resp, err = http.Get(ts.URL + "/api/libros/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	esperarHasta(t, "el span siguiente", func() bool { _, ok := spans()["GET /api/libros/3"]; return ok })
+	if _, ok := spans()["GET /api/libros/2"]; ok {
+		t.Error("se exportó un span sin muestrear")
+	}
+}
+
+// El exportador OTLP manda a /v1/traces un ExportTraceServiceRequest en JSON
+func TestExportadorOTLP(t *testing.T) {
+	t.Parallel()
+	type valorOTLP struct {
+		StringValue *string  `json:"stringValue"`
+		IntValue    *string  `json:"intValue"`
+		BoolValue   *bool    `json:"boolValue"`
+		DoubleValue *float64 `json:"doubleValue"`
+	}
+	type atributoOTLP struct {
+		Key   string    `json:"key"`
+		Value valorOTLP `json:"value"`
+	}
+	var peticion struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []atributoOTLP `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Scope struct {
+					Name string `json:"name"`
+				} `json:"scope"`
+				Spans []struct {
+					TraceID           string         `json:"traceId"`
+					SpanID            string         `json:"spanId"`
+					ParentSpanID      string         `json:"parentSpanId"`
+					Name              string         `json:"name"`
+					Kind              int            `json:"kind"`
+					StartTimeUnixNano string         `json:"startTimeUnixNano"`
+					EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+					Attributes        []atributoOTLP `json:"attributes"`
+					Status            struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+
+	recibido := make(chan struct{}, 1)
+	colector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("petición al colector: %s %s %s", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&peticion); err != nil {
+			t.Error(err)
+		}
+		recibido <- struct{}{}
+	}))
+	defer colector.Close()
+
+	exportador := nuevoExportadorOTLP(colector.URL+"/", "prueba")
+	ctx := conExportador(context.Background(), exportador)
+	ctx, raiz := iniciarSpanConTipo(ctx, "GET /api/libros", spanServidor)
+	raiz.AsignarAtributo("http.response.status_code", 500)
+	raiz.AsignarAtributo("url.path", "/api/libros")
+	raiz.AsignarAtributo("cache", true)
+	raiz.AsignarAtributo("proporcion", 0.5)
+	raiz.RegistrarError("Internal Server Error")
+	_, hijo := iniciarSpan(ctx, "repositorio.Listar")
+	hijo.Finalizar()
+	raiz.Finalizar()
+	exportador.Cerrar() // Envía lo pendiente sin esperar el intervalo
+
+	select {
+	case <-recibido:
+	case <-time.After(5 * time.Second):
+		t.Fatal("el colector no recibió los spans")
+	}
+
+	if len(peticion.ResourceSpans) != 1 || len(peticion.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("estructura: %+v", peticion)
+	}
+	recurso := peticion.ResourceSpans[0]
+	if a := recurso.Resource.Attributes; len(a) != 1 || a[0].Key != "service.name" || a[0].Value.StringValue == nil || *a[0].Value.StringValue != "prueba" {
+		t.Errorf("atributos del recurso: %+v", a)
+	}
+	ambito := recurso.ScopeSpans[0]
+	if ambito.Scope.Name != "prueba" || len(ambito.Spans) != 2 {
+		t.Fatalf("scopeSpans: %+v", ambito)
+	}
+
+	h, r := ambito.Spans[0], ambito.Spans[1] // En el orden en que terminaron
+	if h.Name != "repositorio.Listar" || h.Kind != spanInterno || h.ParentSpanID != raiz.SpanID() || h.TraceID != raiz.TraceID() {
+		t.Errorf("span hijo: %+v", h)
+	}
+	if r.Name != "GET /api/libros" || r.Kind != spanServidor || r.ParentSpanID != "" || r.SpanID != raiz.SpanID() {
+		t.Errorf("span raíz: %+v", r)
+	}
+	if r.Status.Code != estadoError || r.Status.Message != "Internal Server Error" || h.Status.Code != 0 {
+		t.Errorf("estados: raíz %+v, hijo %+v", r.Status, h.Status)
+	}
+	if r.StartTimeUnixNano == "" || r.EndTimeUnixNano < r.StartTimeUnixNano {
+		t.Errorf("tiempos: %s .. %s", r.StartTimeUnixNano, r.EndTimeUnixNano)
+	}
+
+	valores := map[string]valorOTLP{}
+	for _, a := range r.Attributes {
+		valores[a.Key] = a.Value
+	}
+	if v := valores["http.response.status_code"]; v.IntValue == nil || *v.IntValue != "500" {
+		t.Errorf("http.response.status_code: %+v", v)
+	}
+	if v := valores["url.path"]; v.StringValue == nil || *v.StringValue != "/api/libros" {
+		t.Errorf("url.path: %+v", v)
+	}
+	if v := valores["cache"]; v.BoolValue == nil || !*v.BoolValue {
+		t.Errorf("cache: %+v", v)
+	}
+	if v := valores["proporcion"]; v.DoubleValue == nil || *v.DoubleValue != 0.5 {
+		t.Errorf("proporcion: %+v", v)
+	}
+}
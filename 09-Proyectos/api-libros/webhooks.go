@@ -0,0 +1,547 @@
+// Webhooks salientes: avisan a otros sistemas de los cambios del catálogo
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Evento exclusivo de webhooks: una actualización que cambia la disponibilidad
+const eventoDisponibilidad = "disponibilidad"
+
+// Eventos a los que se puede suscribir un webhook
+var eventosWebhook = []string{eventoCreado, eventoActualizado, eventoEliminado, eventoDisponibilidad}
+
+// Estados de una entrega
+const (
+	entregaPendiente = "pendiente"
+	entregaExitosa   = "entregado"
+	entregaFallida   = "fallido"
+)
+
+// Configuración de las entregas
+const (
+	trabajadoresWebhook   = 4
+	capacidadColaWebhook  = 256
+	intentosMaximoWebhook = 6
+	esperaInicialWebhook  = time.Second
+	esperaMaximaWebhook   = 5 * time.Minute
+	timeoutWebhook        = 10 * time.Second
+	capacidadRegistro     = 500 // Entregas recientes y fallidas que se conservan
+)
+
+// Suscripción de un sistema externo
+type suscripcionWebhook struct {
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	Eventos     []string  `json:"eventos"`
+	Secreto     string    `json:"secreto,omitempty"` // Solo se muestra al crearla
+	FechaCreado time.Time `json:"fecha_creado"`
+}
+
+// Intento de entrega registrado en el log
+type intentoWebhook struct {
+	Numero     int       `json:"numero"`
+	Fecha      time.Time `json:"fecha"`
+	CodigoHTTP int       `json:"codigo_http,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Duracion   string    `json:"duracion"`
+}
+
+// Entrega de un evento a una suscripción
+type entregaWebhook struct {
+	ID             int              `json:"id"`
+	SuscripcionID  int              `json:"suscripcion_id"`
+	Evento         string           `json:"evento"`
+	EventoID       int64            `json:"evento_id"`
+	Estado         string           `json:"estado"`
+	Intentos       []intentoWebhook `json:"intentos"`
+	ProximoIntento *time.Time       `json:"proximo_intento,omitempty"`
+
+	url             string
+	secreto         string
+	cuerpo          []byte
+	intentosPrevios int // Intentos de rondas anteriores (antes de reintentarla a mano)
+}
+
+// Despachador con la lista de suscripciones y el pool de trabajadores (uno
+// por sucursal, alimentado por notificarCambio)
+type despachadorWebhooks struct {
+	mu              sync.Mutex
+	suscripciones   []suscripcionWebhook
+	contadorID      int
+	contadorEntrega int
+	entregas        []*entregaWebhook // Log de entregas, de la más antigua a la más reciente
+	fallidos        []*entregaWebhook // Dead-letter: agotaron los reintentos
+
+	cola     chan *entregaWebhook
+	cliente  *http.Client
+	ctx      context.Context
+	cancelar context.CancelFunc
+	grupo    sync.WaitGroup
+
+	// Loopback y redes privadas solo se aceptan si se configura así
+	redesPrivadas bool
+	esperaInicial time.Duration
+	esperaMaxima  time.Duration
+}
+
+// nuevoDespachadorWebhooks prepara las entregas; base es el contexto de los
+// trabajadores (lleva el exportador de trazas)
+func nuevoDespachadorWebhooks(base context.Context, redesPrivadas bool) *despachadorWebhooks {
+	ctx, cancelar := context.WithCancel(base)
+	return &despachadorWebhooks{
+		contadorID:    1,
+		cola:          make(chan *entregaWebhook, capacidadColaWebhook),
+		cliente:       clienteWebhooks(redesPrivadas),
+		ctx:           ctx,
+		cancelar:      cancelar,
+		redesPrivadas: redesPrivadas,
+		esperaInicial: esperaInicialWebhook,
+		esperaMaxima:  esperaMaximaWebhook,
+	}
+}
+
+// clienteWebhooks comprueba la IP al conectar, no solo al crear la
+// suscripción: un nombre puede resolver a una dirección interna más tarde
+func clienteWebhooks(redesPrivadas bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeoutWebhook}
+	if !redesPrivadas {
+		dialer.Control = func(_, direccion string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(direccion)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !direccionPublica(ip) {
+				return fmt.Errorf("destino no permitido: %s es una dirección privada o local", host)
+			}
+			return nil
+		}
+	}
+	transporte := http.DefaultTransport.(*http.Transport).Clone()
+	transporte.Proxy = nil // Con proxy, la IP que se comprueba sería la del proxy
+	transporte.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeoutWebhook,
+		Transport: transporte,
+		// Las redirecciones también pasan por la comprobación al conectar
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if len(via) >= 3 {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+// Rango 100.64.0.0/10 (NAT de operador), que net.IP.IsPrivate no incluye
+var redCompartida = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// direccionPublica descarta loopback, redes privadas, link-local (incluida
+// la de metadatos 169.254.169.254), multicast y la red 0.0.0.0/8
+func direccionPublica(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil && (ip4[0] == 0 || redCompartida.Contains(ip4)) {
+		return false
+	}
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// Iniciar arranca los trabajadores que hacen las entregas
+func (d *despachadorWebhooks) Iniciar(trabajadores int) {
+	for i := 0; i < trabajadores; i++ {
+		d.grupo.Add(1)
+		go func() {
+			defer d.grupo.Done()
+			for {
+				select {
+				case <-d.ctx.Done():
+					return
+				case entrega := <-d.cola:
+					d.entregar(entrega)
+				}
+			}
+		}()
+	}
+}
+
+// Detener cancela los reintentos programados y espera a los trabajadores
+func (d *despachadorWebhooks) Detener() {
+	d.cancelar()
+	d.grupo.Wait()
+}
+
+// Tipos de webhook que dispara un evento del catálogo
+func tiposWebhook(evento eventoLibro) []string {
+	tipos := []string{evento.Tipo}
+	if evento.Anterior != nil && evento.Anterior.Disponible != evento.Libro.Disponible {
+		tipos = append(tipos, eventoDisponibilidad)
+	}
+	return tipos
+}
+
+// Notificar encola una entrega por cada suscripción interesada en el evento
+func (d *despachadorWebhooks) Notificar(evento eventoLibro) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, tipo := range tiposWebhook(evento) {
+		carga := evento
+		carga.Tipo = tipo
+		cuerpo, err := json.Marshal(carga)
+		if err != nil {
+			log.Printf("Error al serializar el webhook %s: %v", tipo, err)
+			continue
+		}
+
+		for _, s := range d.suscripciones {
+			if !slices.Contains(s.Eventos, tipo) {
+				continue
+			}
+			d.contadorEntrega++
+			entrega := &entregaWebhook{
+				ID:            d.contadorEntrega,
+				SuscripcionID: s.ID,
+				Evento:        tipo,
+				EventoID:      evento.ID,
+				Estado:        entregaPendiente,
+				url:           s.URL,
+				secreto:       s.Secreto,
+				cuerpo:        cuerpo,
+			}
+			d.entregas = agregarAcotado(d.entregas, entrega)
+
+			select {
+			case d.cola <- entrega:
+			default:
+				entrega.Estado = entregaFallida
+				entrega.Intentos = append(entrega.Intentos, intentoWebhook{Fecha: time.Now(), Error: "cola de entregas llena", Duracion: "0s"})
+				d.fallidos = agregarAcotado(d.fallidos, entrega)
+			}
+		}
+	}
+}
+
+// Agrega al final descartando el más antiguo si se llegó a la capacidad
+func agregarAcotado(lista []*entregaWebhook, entrega *entregaWebhook) []*entregaWebhook {
+	if len(lista) == capacidadRegistro {
+		lista = append(lista[:0], lista[1:]...)
+	}
+	return append(lista, entrega)
+}
+
+// Firma HMAC-SHA256 de "<timestamp>.<cuerpo>" en hexadecimal
+func firmarWebhook(secreto string, timestamp int64, cuerpo []byte) string {
+	mac := hmac.New(sha256.New, []byte(secreto))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(cuerpo)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Hace un intento de entrega y programa el siguiente si falla
+func (d *despachadorWebhooks) entregar(entrega *entregaWebhook) {
+	ctx, span := iniciarSpanConTipo(d.ctx, "webhook.entregar", spanCliente)
+	defer span.Finalizar()
+	span.AsignarAtributo("webhook.suscripcion_id", entrega.SuscripcionID)
+	span.AsignarAtributo("webhook.evento", entrega.Evento)
+
+	d.mu.Lock()
+	numero := len(entrega.Intentos) + 1
+	enRonda := numero - entrega.intentosPrevios
+	entrega.ProximoIntento = nil
+	d.mu.Unlock()
+
+	inicio := time.Now()
+	codigo, err := d.enviar(ctx, entrega)
+	intento := intentoWebhook{Numero: numero, Fecha: inicio, CodigoHTTP: codigo, Duracion: time.Since(inicio).Round(time.Millisecond).String()}
+	if err != nil {
+		intento.Error = err.Error()
+		span.RegistrarError(intento.Error)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entrega.Intentos = append(entrega.Intentos, intento)
+	switch {
+	case err == nil:
+		entrega.Estado = entregaExitosa
+	case enRonda >= intentosMaximoWebhook:
+		entrega.Estado = entregaFallida
+		d.fallidos = agregarAcotado(d.fallidos, entrega)
+		log.Printf("Webhook %d agotó sus %d intentos: %v", entrega.ID, enRonda, err)
+	default:
+		espera := d.esperaReintento(enRonda)
+		proximo := time.Now().Add(espera)
+		entrega.ProximoIntento = &proximo
+		time.AfterFunc(espera, func() {
+			select {
+			case d.cola <- entrega:
+			case <-d.ctx.Done():
+			}
+		})
+	}
+}
+
+// Espera exponencial (1s, 2s, 4s...) con hasta un 20% de variación aleatoria
+func (d *despachadorWebhooks) esperaReintento(intento int) time.Duration {
+	espera := d.esperaInicial << (intento - 1)
+	if espera > d.esperaMaxima || espera <= 0 {
+		espera = d.esperaMaxima
+	}
+	return espera + time.Duration(rand.Int64N(int64(espera/5)+1))
+}
+
+// Envía el POST firmado; cualquier respuesta que no sea 2xx es un error
+func (d *despachadorWebhooks) enviar(ctx context.Context, entrega *entregaWebhook) (int, error) {
+	peticion, err := http.NewRequestWithContext(ctx, http.MethodPost, entrega.url, bytes.NewReader(entrega.cuerpo))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	peticion.Header.Set("Content-Type", "application/json")
+	peticion.Header.Set("User-Agent", "api-libros-webhooks/1.0")
+	peticion.Header.Set("X-Libros-Evento", entrega.Evento)
+	peticion.Header.Set("X-Libros-Entrega", strconv.Itoa(entrega.ID))
+	peticion.Header.Set("X-Libros-Firma", fmt.Sprintf("t=%d,v1=%s", timestamp, firmarWebhook(entrega.secreto, timestamp, entrega.cuerpo)))
+	inyectarTraceparent(ctx, peticion.Header)
+
+	respuesta, err := d.cliente.Do(peticion)
+	if err != nil {
+		return 0, err
+	}
+	defer respuesta.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(respuesta.Body, 64<<10))
+
+	if respuesta.StatusCode < 200 || respuesta.StatusCode > 299 {
+		return respuesta.StatusCode, fmt.Errorf("respuesta %s", respuesta.Status)
+	}
+	return respuesta.StatusCode, nil
+}
+
+// Copia de las entregas que cumplen el filtro, sin los datos internos
+func copiarEntregas(lista []*entregaWebhook, incluir func(*entregaWebhook) bool) []entregaWebhook {
+	resultado := []entregaWebhook{}
+	for _, e := range lista {
+		if incluir(e) {
+			copia := *e
+			copia.Intentos = append([]intentoWebhook{}, e.Intentos...)
+			resultado = append(resultado, copia)
+		}
+	}
+	return resultado
+}
+
+// Valida una suscripción nueva; devuelve el mensaje de error o nil
+func (d *despachadorWebhooks) validarSuscripcion(s suscripcionWebhook) *mensaje {
+	destino, err := url.Parse(s.URL)
+	if err != nil || (destino.Scheme != "http" && destino.Scheme != "https") || destino.Host == "" {
+		return nuevoMensaje(msgURLInvalida)
+	}
+	// Los nombres se comprueban de nuevo al conectar (ver clienteWebhooks)
+	host := strings.ToLower(destino.Hostname())
+	if !d.redesPrivadas {
+		ip := net.ParseIP(host)
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && !direccionPublica(ip)) {
+			return nuevoMensaje(msgURLPrivada)
+		}
+	}
+	if len(s.Eventos) == 0 {
+		return nuevoMensaje(msgEventosRequeridos)
+	}
+	for _, evento := range s.Eventos {
+		if !slices.Contains(eventosWebhook, evento) {
+			return nuevoMensaje(msgEventoDesconocido, evento)
+		}
+	}
+	return nil
+}
+
+// Genera un secreto aleatorio de 32 bytes
+func generarSecreto() string {
+	b := make([]byte, 32)
+	if _, err := cryptorand.Read(b); err != nil {
+		panic(err)
+	}
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// GET /api/webhooks - Listar suscripciones (sin secretos)
+func obtenerWebhooks(w http.ResponseWriter, r *http.Request) {
+	d := sucursalDe(r.Context()).webhooks
+	d.mu.Lock()
+	suscripciones := make([]suscripcionWebhook, len(d.suscripciones))
+	for i, s := range d.suscripciones {
+		s.Secreto = ""
+		suscripciones[i] = s
+	}
+	d.mu.Unlock()
+
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"webhooks": suscripciones,
+		"total":    len(suscripciones),
+	})
+}
+
+// POST /api/webhooks - Crear suscripción
+func crearWebhook(w http.ResponseWriter, r *http.Request) {
+	d := sucursalDe(r.Context()).webhooks
+	var nueva suscripcionWebhook
+	if err := decodificarJSON(w, r, &nueva); err != nil {
+		responderMensaje(w, r, err.Estado, err.Mensaje)
+		return
+	}
+	if mensaje := d.validarSuscripcion(nueva); mensaje != nil {
+		responderMensaje(w, r, http.StatusBadRequest, mensaje)
+		return
+	}
+	if nueva.Secreto == "" {
+		nueva.Secreto = generarSecreto()
+	}
+	nueva.FechaCreado = time.Now()
+
+	d.mu.Lock()
+	nueva.ID = d.contadorID
+	d.contadorID++
+	d.suscripciones = append(d.suscripciones, nueva)
+	d.mu.Unlock()
+
+	// Única vez que se devuelve el secreto
+	responderJSON(w, http.StatusCreated, nueva)
+}
+
+// Busca la suscripción del parámetro {id}; responde el error si no existe
+func suscripcionDeRuta(w http.ResponseWriter, r *http.Request) (suscripcionWebhook, bool) {
+	d := sucursalDe(r.Context()).webhooks
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return suscripcionWebhook{}, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.suscripciones {
+		if s.ID == id {
+			s.Secreto = ""
+			return s, true
+		}
+	}
+	responderError(w, r, http.StatusNotFound, msgWebhookNoEncontrado)
+	return suscripcionWebhook{}, false
+}
+
+// GET /api/webhooks/{id} - Obtener una suscripción
+func obtenerWebhookPorID(w http.ResponseWriter, r *http.Request) {
+	if s, ok := suscripcionDeRuta(w, r); ok {
+		responderJSON(w, http.StatusOK, s)
+	}
+}
+
+// DELETE /api/webhooks/{id} - Eliminar suscripción (las entregas en curso siguen)
+func eliminarWebhook(w http.ResponseWriter, r *http.Request) {
+	d := sucursalDe(r.Context()).webhooks
+	s, ok := suscripcionDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	d.mu.Lock()
+	d.suscripciones = slices.DeleteFunc(d.suscripciones, func(otra suscripcionWebhook) bool {
+		return otra.ID == s.ID
+	})
+	d.mu.Unlock()
+
+	responderJSON(w, http.StatusOK, map[string]string{
+		"mensaje": traducir(r.Context(), msgWebhookEliminado),
+	})
+}
+
+// GET /api/webhooks/{id}/entregas - Log de entregas de una suscripción
+func obtenerEntregasWebhook(w http.ResponseWriter, r *http.Request) {
+	d := sucursalDe(r.Context()).webhooks
+	s, ok := suscripcionDeRuta(w, r)
+	if !ok {
+		return
+	}
+
+	d.mu.Lock()
+	entregas := copiarEntregas(d.entregas, func(e *entregaWebhook) bool {
+		return e.SuscripcionID == s.ID
+	})
+	d.mu.Unlock()
+
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"entregas": entregas,
+		"total":    len(entregas),
+	})
+}
+
+// GET /api/webhooks/fallidos - Entregas que agotaron los reintentos
+func obtenerWebhooksFallidos(w http.ResponseWriter, r *http.Request) {
+	d := sucursalDe(r.Context()).webhooks
+	d.mu.Lock()
+	fallidos := copiarEntregas(d.fallidos, func(*entregaWebhook) bool { return true })
+	d.mu.Unlock()
+
+	responderJSON(w, http.StatusOK, map[string]interface{}{
+		"entregas": fallidos,
+		"total":    len(fallidos),
+	})
+}
+
+// POST /api/webhooks/fallidos/{id}/reintentar - Volver a encolar una entrega fallida
+func reintentarWebhookFallido(w http.ResponseWriter, r *http.Request) {
+	d := sucursalDe(r.Context()).webhooks
+	id, err := strconv.Atoi(parametroRuta(r, "id"))
+	if err != nil {
+		responderError(w, r, http.StatusBadRequest, msgIDInvalido)
+		return
+	}
+
+	d.mu.Lock()
+	indice := slices.IndexFunc(d.fallidos, func(e *entregaWebhook) bool { return e.ID == id })
+	if indice < 0 {
+		d.mu.Unlock()
+		responderError(w, r, http.StatusNotFound, msgEntregaNoEncontrada)
+		return
+	}
+	entrega := d.fallidos[indice]
+	d.fallidos = slices.Delete(d.fallidos, indice, indice+1)
+	// Se conserva el historial; la nueva ronda tiene otra vez todos los intentos
+	entrega.Estado = entregaPendiente
+	entrega.intentosPrevios = len(entrega.Intentos)
+	d.mu.Unlock()
+
+	select {
+	case d.cola <- entrega:
+		responderJSON(w, http.StatusAccepted, map[string]string{
+			"mensaje": traducir(r.Context(), msgEntregaEncolada),
+		})
+	default:
+		d.mu.Lock()
+		entrega.Estado = entregaFallida
+		d.fallidos = agregarAcotado(d.fallidos, entrega)
+		d.mu.Unlock()
+		responderError(w, r, http.StatusServiceUnavailable, msgColaEntregasLlena)
+	}
+}
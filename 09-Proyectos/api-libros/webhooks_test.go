@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// servidorWebhooks levanta la API con webhooks a loopback permitidos (si se
+// pide) y reintentos de milisegundos
+func servidorWebhooks(t *testing.T, redesPrivadas bool) *httptest.Server {
+	t.Helper()
+	srv, err := nuevoServidor(configuracionServidor{
+		Portadas:              almacenLocal{dir: t.TempDir()},
+		WebhooksRedesPrivadas: redesPrivadas,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := srv.sucursales.PorDefecto().webhooks
+	d.esperaInicial = time.Millisecond
+	d.esperaMaxima = 5 * time.Millisecond
+
+	ctx, cancelar := context.WithCancel(context.Background())
+	srv.Iniciar(ctx, time.Hour, time.Hour)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		cancelar()
+		srv.Detener()
+	})
+	return ts
+}
+
+// suscribir crea un webhook para los eventos y devuelve la suscripción
+func suscribir(t *testing.T, api, destino string, eventos ...string) suscripcionWebhook {
+	t.Helper()
+	cuerpo, _ := json.Marshal(map[string]interface{}{"url": destino, "eventos": eventos, "secreto": "s3cr3t"})
+	var s suscripcionWebhook
+	if estado := pedirJSON(t, http.MethodPost, api+"/api/webhooks", string(cuerpo), &s); estado != http.StatusCreated {
+		t.Fatalf("POST /api/webhooks = %d", estado)
+	}
+	return s
+}
+
+// pedirJSON hace la petición y decodifica la respuesta en destino (si no es nil)
+func pedirJSON(t *testing.T, metodo, url, cuerpo string, destino interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(metodo, url, strings.NewReader(cuerpo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cuerpo != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	datos, _ := io.ReadAll(resp.Body)
+	if destino != nil && len(datos) > 0 {
+		if err := json.Unmarshal(datos, destino); err != nil {
+			t.Fatalf("%s %s: respuesta %q: %v", metodo, url, datos, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// esperarHasta repite la comprobación hasta que se cumpla o pasen 5s
+func esperarHasta(t *testing.T, descripcion string, condicion func() bool) {
+	t.Helper()
+	limite := time.Now().Add(5 * time.Second)
+	for !condicion() {
+		if time.Now().After(limite) {
+			t.Fatalf("no se cumplió a tiempo: %s", descripcion)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+type listaEntregas struct {
+	Entregas []entregaWebhook `json:"entregas"`
+	Total    int              `json:"total"`
+}
+
+func TestWebhookFirmado(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var recibidas []*http.Request
+	var cuerpos [][]byte
+	receptor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cuerpo, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		recibidas = append(recibidas, r)
+		cuerpos = append(cuerpos, cuerpo)
+		mu.Unlock()
+	}))
+	defer receptor.Close()
+
+	api := servidorWebhooks(t, true)
+	suscribir(t, api.URL, receptor.URL, eventoCreado)
+	pedirJSON(t, http.MethodPost, api.URL+"/api/libros", `{"titulo":"Rayuela","autor":"Julio Cortázar","año":1963}`, nil)
+
+	esperarHasta(t, "llega el webhook", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(recibidas) == 1
+	})
+	mu.Lock()
+	r, cuerpo := recibidas[0], cuerpos[0]
+	mu.Unlock()
+
+	if r.Header.Get("X-Libros-Evento") != eventoCreado || r.Header.Get("X-Libros-Entrega") == "" {
+		t.Errorf("cabeceras = %v", r.Header)
+	}
+	var timestamp int64
+	var firma string
+	if _, err := fmt.Sscanf(strings.Replace(r.Header.Get("X-Libros-Firma"), ",v1=", " ", 1), "t=%d %s", &timestamp, &firma); err != nil {
+		t.Fatalf("X-Libros-Firma = %q: %v", r.Header.Get("X-Libros-Firma"), err)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	fmt.Fprintf(mac, "%d.%s", timestamp, cuerpo)
+	if !hmac.Equal([]byte(firma), []byte(hex.EncodeToString(mac.Sum(nil)))) {
+		t.Errorf("firma %s no corresponde al cuerpo", firma)
+	}
+	if time.Since(time.Unix(timestamp, 0)) > time.Minute {
+		t.Errorf("timestamp viejo: %d", timestamp)
+	}
+
+	var evento eventoLibro
+	if err := json.Unmarshal(cuerpo, &evento); err != nil || evento.Tipo != eventoCreado || evento.Libro.Titulo != "Rayuela" {
+		t.Errorf("cuerpo = %s (%v)", cuerpo, err)
+	}
+}
+
+func TestWebhookReintentaHastaEntregar(t *testing.T) {
+	t.Parallel()
+	var llamadas atomic.Int32
+	receptor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if llamadas.Add(1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receptor.Close()
+
+	api := servidorWebhooks(t, true)
+	s := suscribir(t, api.URL, receptor.URL, eventoCreado)
+	pedirJSON(t, http.MethodPost, api.URL+"/api/libros", `{"titulo":"Rayuela","autor":"Julio Cortázar","año":1963}`, nil)
+
+	var lista listaEntregas
+	rutaEntregas := fmt.Sprintf("%s/api/webhooks/%d/entregas", api.URL, s.ID)
+	esperarHasta(t, "la entrega termina", func() bool {
+		pedirJSON(t, http.MethodGet, rutaEntregas, "", &lista)
+		return lista.Total == 1 && lista.Entregas[0].Estado == entregaExitosa
+	})
+
+	intentos := lista.Entregas[0].Intentos
+	if len(intentos) != 3 {
+		t.Fatalf("intentos = %+v, se esperaban 3", intentos)
+	}
+	for i, esperado := range []int{500, 500, 200} {
+		if intentos[i].Numero != i+1 || intentos[i].CodigoHTTP != esperado {
+			t.Errorf("intento %d = %+v, se esperaba código %d", i+1, intentos[i], esperado)
+		}
+	}
+}
+
+// Tras agotar los intentos la entrega queda en fallidos; al reintentarla
+// se conserva el historial y tiene otra ronda completa
+func TestWebhookFallidoYReintento(t *testing.T) {
+	t.Parallel()
+	receptor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receptor.Close()
+
+	api := servidorWebhooks(t, true)
+	suscribir(t, api.URL, receptor.URL, eventoCreado)
+	pedirJSON(t, http.MethodPost, api.URL+"/api/libros", `{"titulo":"Rayuela","autor":"Julio Cortázar","año":1963}`, nil)
+
+	var fallidos listaEntregas
+	esperarHasta(t, "la entrega pasa a fallidos", func() bool {
+		pedirJSON(t, http.MethodGet, api.URL+"/api/webhooks/fallidos", "", &fallidos)
+		return fallidos.Total == 1
+	})
+	entrega := fallidos.Entregas[0]
+	if entrega.Estado != entregaFallida || len(entrega.Intentos) != intentosMaximoWebhook {
+		t.Fatalf("entrega = %+v", entrega)
+	}
+
+	ruta := fmt.Sprintf("%s/api/webhooks/fallidos/%d/reintentar", api.URL, entrega.ID)
+	if estado := pedirJSON(t, http.MethodPost, ruta, "", nil); estado != http.StatusAccepted {
+		t.Fatalf("reintentar = %d", estado)
+	}
+	esperarHasta(t, "la segunda ronda también falla", func() bool {
+		pedirJSON(t, http.MethodGet, api.URL+"/api/webhooks/fallidos", "", &fallidos)
+		return fallidos.Total == 1 && len(fallidos.Entregas[0].Intentos) == 2*intentosMaximoWebhook
+	})
+	for i, intento := range fallidos.Entregas[0].Intentos {
+		if intento.Numero != i+1 || intento.CodigoHTTP != http.StatusServiceUnavailable {
+			t.Errorf("intento %d = %+v", i+1, intento)
+		}
+	}
+
+	if estado := pedirJSON(t, http.MethodPost, api.URL+"/api/webhooks/fallidos/999/reintentar", "", nil); estado != http.StatusNotFound {
+		t.Errorf("reintentar inexistente = %d, se esperaba 404", estado)
+	}
+}
+
+func TestWebhookRechazaDireccionesInternas(t *testing.T) {
+	t.Parallel()
+	api := servidorWebhooks(t, false)
+
+	for _, destino := range []string{
+		"http://localhost:9000/hook",
+		"http://api.localhost/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]:8080/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.10/hook",
+		"http://172.16.0.1/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0:8080/hook",
+		"http://[fe80::1]/hook",
+	} {
+		var respuesta struct {
+			Codigo string `json:"codigo"`
+		}
+		cuerpo := fmt.Sprintf(`{"url":%q,"eventos":["creado"]}`, destino)
+		estado := pedirJSON(t, http.MethodPost, api.URL+"/api/webhooks", cuerpo, &respuesta)
+		if estado != http.StatusBadRequest || respuesta.Codigo != string(msgURLPrivada) {
+			t.Errorf("%s: estado %d, código %q; se esperaba 400 url_privada", destino, estado, respuesta.Codigo)
+		}
+	}
+
+	if estado := pedirJSON(t, http.MethodPost, api.URL+"/api/webhooks", `{"url":"https://hooks.example.com/libros","eventos":["creado"]}`, nil); estado != http.StatusCreated {
+		t.Errorf("URL pública: estado %d, se esperaba 201", estado)
+	}
+}
+
+// Un nombre que resuelve a una dirección interna se corta al conectar
+func TestClienteWebhooksBloqueaAlConectar(t *testing.T) {
+	t.Parallel()
+	var llamadas atomic.Int32
+	receptor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		llamadas.Add(1)
+	}))
+	defer receptor.Close()
+
+	d := nuevoDespachadorWebhooks(context.Background(), false)
+	_, puerto, _ := net.SplitHostPort(receptor.Listener.Addr().String())
+	entrega := &entregaWebhook{url: "http://localhost:" + puerto + "/", cuerpo: []byte("{}")}
+	if _, err := d.enviar(context.Background(), entrega); err == nil || !strings.Contains(err.Error(), "destino no permitido") {
+		t.Errorf("err = %v, se esperaba destino no permitido", err)
+	}
+	if llamadas.Load() != 0 {
+		t.Errorf("el receptor recibió %d peticiones", llamadas.Load())
+	}
+
+	// Con la opción activada la misma entrega llega
+	if _, err := nuevoDespachadorWebhooks(context.Background(), true).enviar(context.Background(), entrega); err != nil {
+		t.Errorf("con redes privadas permitidas: %v", err)
+	}
+}
+
+func TestDireccionPublica(t *testing.T) {
+	t.Parallel()
+	casos := map[string]bool{
+		"8.8.8.8":         true,
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.31.255.255":  false,
+		"192.168.0.1":     false,
+		"169.254.169.254": false,
+		"100.100.0.1":     false,
+		"0.1.2.3":         false,
+		"224.0.0.1":       false,
+		"::1":             false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+	}
+	for texto, esperado := range casos {
+		if obtenido := direccionPublica(net.ParseIP(texto)); obtenido != esperado {
+			t.Errorf("direccionPublica(%s) = %v, se esperaba %v", texto, obtenido, esperado)
+		}
+	}
+}
+
+func TestEsperaReintentoExponencial(t *testing.T) {
+	t.Parallel()
+	d := nuevoDespachadorWebhooks(context.Background(), false)
+	for intento, base := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 20: esperaMaximaWebhook} {
+		for range 20 {
+			espera := d.esperaReintento(intento)
+			if espera < base || espera > base+base/5 {
+				t.Errorf("intento %d: espera %s fuera de [%s, %s]", intento, espera, base, base+base/5)
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Flujo de cambios del catálogo sobre WebSocket (RFC 6455)
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GUID fijo del protocolo para calcular Sec-WebSocket-Accept
+const guidWebSocket = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Códigos de operación de los frames
+const (
+	opTexto  = 0x1
+	opCierre = 0x8
+	opPing   = 0x9
+	opPong   = 0xA
+)
+
+// Códigos de cierre
+const (
+	cierreNormal        = 1000
+	cierreSaliendo      = 1001
+	cierreMensajeGrande = 1009
+	cierreReintentar    = 1013
+)
+
+// Límites de la conexión
+const (
+	tamañoMaximoFrameWS   = 64 << 10
+	longitudMaximaControl = 125
+	tiempoEscrituraWS     = 10 * time.Second
+	intervaloPingWS       = 30 * time.Second
+)
+
+// Conexión WebSocket del lado del servidor (solo envía frames sin máscara)
+type conexionWS struct {
+	conn    net.Conn
+	lector  *bufio.Reader
+	muEnvio sync.Mutex
+}
+
+// GET /api/libros/eventos/ws - Cambios del catálogo sobre WebSocket
+func transmitirEventosWS(w http.ResponseWriter, r *http.Request) {
+	s := sucursalDe(r.Context())
+	if !contieneToken(r.Header.Get("Connection"), "upgrade") || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		responderError(w, r, http.StatusBadRequest, msgWebSocketEsperado)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		responderError(w, r, http.StatusUpgradeRequired, msgWebSocketVersion)
+		return
+	}
+	clave := r.Header.Get("Sec-WebSocket-Key")
+	if clave == "" {
+		responderError(w, r, http.StatusBadRequest, msgWebSocketFaltaClave)
+		return
+	}
+	desde, err := ultimoEventoRecibido(r)
+	if err != nil {
+		responderMensaje(w, r, http.StatusBadRequest, comoMensaje(err))
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		responderError(w, r, http.StatusInternalServerError, msgWebSocketNoSoportado)
+		return
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		log.Printf("Error al tomar la conexión WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	ws := &conexionWS{conn: conn, lector: buffer.Reader}
+	fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", aceptarClaveWS(clave))
+
+	canal, pendientes, completo, cancelar := s.eventos.SuscribirDesde(desde)
+	defer cancelar()
+
+	// El cliente solo envía pings y el cierre; los mensajes de datos se ignoran
+	cerrado := make(chan struct{})
+	go func() {
+		defer close(cerrado)
+		ws.leerControl()
+	}()
+	apagando := servidorDe(r.Context()).apagando
+
+	ultimo := desde
+	if !completo {
+		ws.enviarJSON(avisoDesincronizado(r.Context()))
+		ultimo = -1
+	}
+
+	for _, evento := range pendientes {
+		if ws.enviarJSON(evento) != nil {
+			return
+		}
+		ultimo = evento.ID
+	}
+
+	ping := time.NewTicker(intervaloPingWS)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-cerrado:
+			return
+		case <-apagando:
+			ws.cerrar(cierreSaliendo, "servidor apagándose")
+			return
+		case <-ping.C:
+			if ws.enviar(opPing, nil) != nil {
+				return
+			}
+		case evento := <-canal:
+			// Igual que en SSE: ante eventos perdidos el cliente reconecta con ?desde=
+			if ultimo >= 0 && evento.ID != ultimo+1 {
+				ws.cerrar(cierreReintentar, "eventos perdidos, reconecta con ?desde=")
+				return
+			}
+			if ws.enviarJSON(evento) != nil {
+				return
+			}
+			ultimo = evento.ID
+		}
+	}
+}
+
+// Indica si una cabecera con lista separada por comas incluye el token
+func contieneToken(cabecera, token string) bool {
+	for _, parte := range strings.Split(cabecera, ",") {
+		if strings.EqualFold(strings.TrimSpace(parte), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sec-WebSocket-Accept = base64(SHA-1(clave + GUID))
+func aceptarClaveWS(clave string) string {
+	suma := sha1.Sum([]byte(clave + guidWebSocket))
+	return base64.StdEncoding.EncodeToString(suma[:])
+}
+
+// Envía un valor como mensaje de texto JSON
+func (ws *conexionWS) enviarJSON(valor interface{}) error {
+	contenido, err := json.Marshal(valor)
+	if err != nil {
+		return err
+	}
+	return ws.enviar(opTexto, contenido)
+}
+
+// Escribe un frame completo (FIN activado, sin fragmentar)
+func (ws *conexionWS) enviar(opcode byte, contenido []byte) error {
+	cabecera := []byte{0x80 | opcode}
+	switch n := len(contenido); {
+	case n < 126:
+		cabecera = append(cabecera, byte(n))
+	case n <= 0xFFFF:
+		cabecera = append(cabecera, 126)
+		cabecera = binary.BigEndian.AppendUint16(cabecera, uint16(n))
+	default:
+		cabecera = append(cabecera, 127)
+		cabecera = binary.BigEndian.AppendUint64(cabecera, uint64(n))
+	}
+
+	ws.muEnvio.Lock()
+	defer ws.muEnvio.Unlock()
+
+	ws.conn.SetWriteDeadline(time.Now().Add(tiempoEscrituraWS))
+	_, err := ws.conn.Write(append(cabecera, contenido...))
+	return err
+}
+
+// Envía el frame de cierre con su código y motivo
+func (ws *conexionWS) cerrar(codigo uint16, motivo string) {
+	contenido := binary.BigEndian.AppendUint16(nil, codigo)
+	ws.enviar(opCierre, append(contenido, motivo...))
+}
+
+// Lee frames del cliente hasta que cierre o falle la conexión
+func (ws *conexionWS) leerControl() {
+	for {
+		opcode, contenido, err := ws.leerFrame()
+		if err != nil {
+			if errors.Is(err, errFrameGrande) {
+				ws.cerrar(cierreMensajeGrande, "frame demasiado grande")
+			}
+			return
+		}
+
+		switch opcode {
+		case opPing:
+			ws.enviar(opPong, contenido)
+		case opCierre:
+			// Responder con el mismo código, como pide el protocolo
+			codigo := uint16(cierreNormal)
+			if len(contenido) >= 2 {
+				codigo = binary.BigEndian.Uint16(contenido)
+			}
+			ws.cerrar(codigo, "")
+			return
+		}
+	}
+}
+
+var errFrameGrande = errors.New("frame demasiado grande")
+
+// Lee un frame; los del cliente siempre llegan enmascarados
+func (ws *conexionWS) leerFrame() (byte, []byte, error) {
+	var cabecera [2]byte
+	if _, err := io.ReadFull(ws.lector, cabecera[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := cabecera[0] & 0x0F
+	if cabecera[1]&0x80 == 0 {
+		return 0, nil, fmt.Errorf("frame del cliente sin máscara")
+	}
+
+	longitud := uint64(cabecera[1] & 0x7F)
+	switch longitud {
+	case 126:
+		var extendida [2]byte
+		if _, err := io.ReadFull(ws.lector, extendida[:]); err != nil {
+			return 0, nil, err
+		}
+		longitud = uint64(binary.BigEndian.Uint16(extendida[:]))
+	case 127:
+		var extendida [8]byte
+		if _, err := io.ReadFull(ws.lector, extendida[:]); err != nil {
+			return 0, nil, err
+		}
+		longitud = binary.BigEndian.Uint64(extendida[:])
+	}
+	if longitud > tamañoMaximoFrameWS || (opcode >= opCierre && longitud > longitudMaximaControl) {
+		return 0, nil, errFrameGrande
+	}
+
+	var mascara [4]byte
+	if _, err := io.ReadFull(ws.lector, mascara[:]); err != nil {
+		return 0, nil, err
+	}
+	contenido := make([]byte, longitud)
+	if _, err := io.ReadFull(ws.lector, contenido); err != nil {
+		return 0, nil, err
+	}
+	for i := range contenido {
+		contenido[i] ^= mascara[i%4]
+	}
+	return opcode, contenido, nil
+}
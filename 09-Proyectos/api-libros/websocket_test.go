@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Ejemplo de la sección 1.3 de RFC 6455
+const (
+	claveEjemploWS    = "dGhlIHNhbXBsZSBub25jZQ=="
+	aceptadaEjemploWS = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+func TestAceptarClaveWS(t *testing.T) {
+	t.Parallel()
+	if aceptada := aceptarClaveWS(claveEjemploWS); aceptada != aceptadaEjemploWS {
+		t.Errorf("Sec-WebSocket-Accept %q, se esperaba %q", aceptada, aceptadaEjemploWS)
+	}
+}
+
+// clienteWS es el lado cliente de una conexión ya aceptada
+type clienteWS struct {
+	t      *testing.T
+	conn   net.Conn
+	lector *bufio.Reader
+}
+
+// conectarWS hace el handshake contra ruta y comprueba el 101
+func conectarWS(t *testing.T, direccion, ruta string) *clienteWS {
+	t.Helper()
+	conn, err := net.Dial("tcp", direccion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+direccion+ruta, nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", claveEjemploWS)
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	lector := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(lector, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != aceptadaEjemploWS ||
+		!strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		t.Fatalf("handshake: %d %v", resp.StatusCode, resp.Header)
+	}
+	return &clienteWS{t: t, conn: conn, lector: lector}
+}
+
+// enviar escribe un frame del cliente; sin máscara viola el protocolo
+func (c *clienteWS) enviar(opcode byte, contenido []byte, enmascarar bool) {
+	c.t.Helper()
+	frame := []byte{0x80 | opcode}
+	marca := byte(0)
+	if enmascarar {
+		marca = 0x80
+	}
+	switch n := len(contenido); {
+	case n < 126:
+		frame = append(frame, marca|byte(n))
+	default:
+		frame = append(frame, marca|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	}
+	if enmascarar {
+		mascara := [4]byte{0x12, 0x34, 0x56, 0x78}
+		frame = append(frame, mascara[:]...)
+		for i, b := range contenido {
+			frame = append(frame, b^mascara[i%4])
+		}
+	} else {
+		frame = append(frame, contenido...)
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// leer devuelve el siguiente frame del servidor, que nunca va enmascarado
+func (c *clienteWS) leer() (byte, []byte, error) {
+	var cabecera [2]byte
+	if _, err := io.ReadFull(c.lector, cabecera[:]); err != nil {
+		return 0, nil, err
+	}
+	if cabecera[0]&0x80 == 0 || cabecera[1]&0x80 != 0 {
+		c.t.Fatalf("frame del servidor fragmentado o enmascarado: %x", cabecera)
+	}
+	longitud := int(cabecera[1] & 0x7F)
+	switch longitud {
+	case 126:
+		var extendida [2]byte
+		io.ReadFull(c.lector, extendida[:])
+		longitud = int(binary.BigEndian.Uint16(extendida[:]))
+	case 127:
+		var extendida [8]byte
+		io.ReadFull(c.lector, extendida[:])
+		longitud = int(binary.BigEndian.Uint64(extendida[:]))
+	}
+	contenido := make([]byte, longitud)
+	_, err := io.ReadFull(c.lector, contenido)
+	return cabecera[0] & 0x0F, contenido, err
+}
+
+// leerEvento lee el siguiente mensaje de texto como evento
+func (c *clienteWS) leerEvento() eventoLibro {
+	c.t.Helper()
+	opcode, contenido, err := c.leer()
+	if err != nil || opcode != opTexto {
+		c.t.Fatalf("se esperaba un evento: opcode %x, %q, %v", opcode, contenido, err)
+	}
+	var evento eventoLibro
+	if err := json.Unmarshal(contenido, &evento); err != nil {
+		c.t.Fatal(err)
+	}
+	return evento
+}
+
+// esperarCierre comprueba el frame de cierre y que después se corte la conexión
+func (c *clienteWS) esperarCierre(codigo uint16) {
+	c.t.Helper()
+	opcode, contenido, err := c.leer()
+	if err != nil || opcode != opCierre || len(contenido) < 2 || binary.BigEndian.Uint16(contenido) != codigo {
+		c.t.Fatalf("se esperaba el cierre %d: opcode %x, %q, %v", codigo, opcode, contenido, err)
+	}
+	if _, _, err := c.leer(); err != io.EOF {
+		c.t.Errorf("la conexión sigue abierta después del cierre: %v", err)
+	}
+}
+
+func TestWebSocketHandshakeRechazado(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	casos := []struct {
+		cabeceras map[string]string
+		estado    int
+	}{
+		{map[string]string{}, http.StatusBadRequest},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": claveEjemploWS}, http.StatusUpgradeRequired},
+		{map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13"}, http.StatusBadRequest},
+	}
+	for _, caso := range casos {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/libros/eventos/ws", nil)
+		for nombre, valor := range caso.cabeceras {
+			req.Header.Set(nombre, valor)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != caso.estado {
+			t.Errorf("%v: %d, se esperaba %d", caso.cabeceras, resp.StatusCode, caso.estado)
+		}
+		if caso.estado == http.StatusUpgradeRequired && resp.Header.Get("Sec-WebSocket-Version") != "13" {
+			t.Error("falta Sec-WebSocket-Version: 13 en el 426")
+		}
+	}
+}
+
+// Reanuda con ?desde=, envía los eventos nuevos, contesta los pings y
+// devuelve el cierre con el mismo código
+func TestWebSocketEventosYControl(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+	s := srv.sucursales.PorDefecto()
+	publicarEventos(s.eventos, 5)
+
+	ws := conectarWS(t, ts.Listener.Addr().String(), "/api/libros/eventos/ws?desde=3")
+	for _, id := range []int64{4, 5} {
+		if evento := ws.leerEvento(); evento.ID != id {
+			t.Errorf("repetido: evento %d, se esperaba %d", evento.ID, id)
+		}
+	}
+
+	publicarEventos(s.eventos, 1)
+	if evento := ws.leerEvento(); evento.ID != 6 || evento.Tipo != eventoCreado {
+		t.Errorf("en vivo: %+v", evento)
+	}
+
+	// Ping enmascarado: el pong trae el mismo contenido, sin máscara
+	ws.enviar(opPing, []byte("hola"), true)
+	if opcode, contenido, err := ws.leer(); err != nil || opcode != opPong || string(contenido) != "hola" {
+		t.Errorf("pong: opcode %x, %q, %v", opcode, contenido, err)
+	}
+
+	// Los mensajes de datos del cliente se ignoran
+	ws.enviar(opTexto, []byte(strings.Repeat("x", 300)), true)
+	publicarEventos(s.eventos, 1)
+	if evento := ws.leerEvento(); evento.ID != 7 {
+		t.Errorf("después de un mensaje del cliente: %+v", evento)
+	}
+
+	ws.enviar(opCierre, binary.BigEndian.AppendUint16(nil, cierreSaliendo), true)
+	ws.esperarCierre(cierreSaliendo)
+}
+
+func TestWebSocketDesincronizado(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+	publicarEventos(srv.sucursales.PorDefecto().eventos, capacidadHistorial+10)
+
+	ws := conectarWS(t, ts.Listener.Addr().String(), "/api/libros/eventos/ws?desde=1")
+	opcode, contenido, err := ws.leer()
+	var aviso map[string]string
+	if err != nil || opcode != opTexto || json.Unmarshal(contenido, &aviso) != nil || aviso["tipo"] != "desincronizado" || aviso["mensaje"] == "" {
+		t.Fatalf("se esperaba el aviso desincronizado: %q %v", contenido, err)
+	}
+	if evento := ws.leerEvento(); evento.ID != 11 {
+		t.Errorf("primer evento guardado %d, se esperaba 11", evento.ID)
+	}
+}
+
+// Un frame sin máscara corta la conexión; un control demasiado largo se
+// cierra con 1009
+func TestWebSocketFramesInvalidos(t *testing.T) {
+	t.Parallel()
+	_, ts := servidorPrueba(t)
+
+	ws := conectarWS(t, ts.Listener.Addr().String(), "/api/libros/eventos/ws")
+	ws.enviar(opPing, []byte("hola"), false)
+	if _, _, err := ws.leer(); err != io.EOF {
+		t.Errorf("frame sin máscara: se esperaba el corte, hubo %v", err)
+	}
+
+	ws = conectarWS(t, ts.Listener.Addr().String(), "/api/libros/eventos/ws")
+	ws.enviar(opPing, make([]byte, longitudMaximaControl+1), true)
+	ws.esperarCierre(cierreMensajeGrande)
+}
+
+// Al apagar el servidor se cierra con 1001
+func TestWebSocketApagado(t *testing.T) {
+	t.Parallel()
+	srv, ts := servidorPrueba(t)
+	ws := conectarWS(t, ts.Listener.Addr().String(), "/api/libros/eventos/ws")
+	srv.CerrarFlujos()
+	opcode, contenido, err := ws.leer()
+	if err != nil || opcode != opCierre || binary.BigEndian.Uint16(contenido) != cierreSaliendo {
+		t.Errorf("al apagar: opcode %x, %q, %v", opcode, contenido, err)
+	}
+}